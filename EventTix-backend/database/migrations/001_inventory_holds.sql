@@ -0,0 +1,22 @@
+-- Inventory holds reserve ticket_types stock while a checkout session is open.
+-- available_quantity is decremented when the hold is taken, so a hold is either
+-- converted into a sale or released back into available_quantity.
+
+ALTER TABLE ticket_types
+    ADD CONSTRAINT ticket_types_available_quantity_non_negative CHECK (available_quantity >= 0);
+
+CREATE TABLE IF NOT EXISTS inventory_holds (
+    id                  BIGSERIAL PRIMARY KEY,
+    reservation_id      UUID        NOT NULL,
+    checkout_session_id TEXT,
+    ticket_type_id      INTEGER     NOT NULL REFERENCES ticket_types (id) ON DELETE CASCADE,
+    quantity            INTEGER     NOT NULL CHECK (quantity > 0),
+    status              TEXT        NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'converted', 'released')),
+    expires_at          TIMESTAMPTZ NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS inventory_holds_reservation_idx ON inventory_holds (reservation_id);
+CREATE INDEX IF NOT EXISTS inventory_holds_session_idx ON inventory_holds (checkout_session_id);
+CREATE INDEX IF NOT EXISTS inventory_holds_active_expiry_idx ON inventory_holds (expires_at) WHERE status = 'active';
@@ -0,0 +1,27 @@
+-- Server-side pricing of checkout sessions. The order total is computed from
+-- ticket_types.price_cents when the session is created and reconciled against
+-- the amount the payment provider reports when the order is fulfilled.
+
+CREATE TABLE IF NOT EXISTS checkout_sessions (
+    id                 UUID PRIMARY KEY,             -- same as inventory_holds.reservation_id
+    gateway_session_id TEXT UNIQUE,
+    user_id            UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    event_id           UUID        NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    amount_total_cents BIGINT      NOT NULL CHECK (amount_total_cents >= 0),
+    total_quantity     INTEGER     NOT NULL CHECK (total_quantity > 0),
+    status             TEXT        NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'fulfilled', 'expired', 'amount_mismatch')),
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS checkout_session_lines (
+    checkout_session_id UUID    NOT NULL REFERENCES checkout_sessions (id) ON DELETE CASCADE,
+    ticket_type_id      INTEGER NOT NULL REFERENCES ticket_types (id) ON DELETE CASCADE,
+    name                TEXT    NOT NULL,
+    quantity            INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price_cents    BIGINT  NOT NULL CHECK (unit_price_cents >= 0),
+    PRIMARY KEY (checkout_session_id, ticket_type_id)
+);
+
+-- Price actually charged for each ticket, needed for per-ticket refunds.
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS price_cents BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,27 @@
+-- Order refunds. A refund covers one or more tickets of an order; refunded tickets
+-- are voided and their quantity goes back to ticket_types.available_quantity.
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS is_void BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS voided_at TIMESTAMPTZ;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_amount_cents BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id          UUID        NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    amount_cents      BIGINT      NOT NULL CHECK (amount_cents >= 0),
+    status            TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    reason            TEXT,
+    requested_by      UUID REFERENCES users (id) ON DELETE SET NULL,
+    gateway_refund_id TEXT,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS refund_tickets (
+    refund_id UUID NOT NULL REFERENCES refunds (id) ON DELETE CASCADE,
+    ticket_id UUID NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+    PRIMARY KEY (refund_id, ticket_id)
+);
+
+CREATE INDEX IF NOT EXISTS refunds_order_idx ON refunds (order_id);
@@ -0,0 +1,11 @@
+-- Per-event currency. Prices in ticket_types, tickets, orders and checkout
+-- sessions are stored in the minor unit of this currency (ISO 4217).
+
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'PLN';
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'PLN';
+
+ALTER TABLE checkout_sessions
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'PLN';
@@ -0,0 +1,51 @@
+-- Per-event discount codes. A code takes a percentage or a fixed amount (in the
+-- event currency's minor unit) off the tickets it applies to. Every checkout that
+-- uses a code holds a redemption, which counts against the caps until it expires
+-- unpaid or is released.
+
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id                       SERIAL PRIMARY KEY,
+    event_id                 UUID        NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    code                     TEXT        NOT NULL,
+    discount_type            TEXT        NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    discount_value           BIGINT      NOT NULL CHECK (discount_value > 0),
+    ticket_type_ids          INTEGER[],                -- NULL applies to every ticket type
+    max_redemptions          INTEGER CHECK (max_redemptions > 0),
+    max_redemptions_per_user INTEGER CHECK (max_redemptions_per_user > 0),
+    starts_at                TIMESTAMPTZ,
+    ends_at                  TIMESTAMPTZ,
+    is_active                BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_by               UUID REFERENCES users (id) ON DELETE SET NULL,
+    created_at               TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at               TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (discount_type <> 'percent' OR discount_value <= 100)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS promo_codes_event_code_idx ON promo_codes (event_id, UPPER(code));
+
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id                  BIGSERIAL PRIMARY KEY,
+    promo_code_id       INTEGER     NOT NULL REFERENCES promo_codes (id) ON DELETE CASCADE,
+    checkout_session_id UUID        NOT NULL UNIQUE,
+    user_id             UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    order_id            UUID REFERENCES orders (id) ON DELETE SET NULL,
+    discount_cents      BIGINT      NOT NULL CHECK (discount_cents >= 0),
+    status              TEXT        NOT NULL DEFAULT 'reserved' CHECK (status IN ('reserved', 'redeemed', 'released')),
+    expires_at          TIMESTAMPTZ NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS promo_redemptions_code_idx ON promo_redemptions (promo_code_id, status);
+
+ALTER TABLE checkout_sessions
+    ADD COLUMN IF NOT EXISTS promo_code_id  INTEGER REFERENCES promo_codes (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS discount_cents BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE checkout_session_lines
+    ADD COLUMN IF NOT EXISTS discount_cents BIGINT NOT NULL DEFAULT 0;
+
+-- total_amount_cents stays the amount charged; gross is total + discount.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS promo_code_id  INTEGER REFERENCES promo_codes (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS discount_cents BIGINT NOT NULL DEFAULT 0;
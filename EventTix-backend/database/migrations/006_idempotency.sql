@@ -0,0 +1,17 @@
+-- Idempotent fulfillment: one order per payment session, and replayable responses
+-- for requests sent with an Idempotency-Key header.
+--
+-- Creating the index fails if duplicate orders already exist; find them with
+--   SELECT payment_gateway_charge_id FROM orders GROUP BY 1 HAVING COUNT(*) > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS orders_payment_gateway_charge_id_idx ON orders (payment_gateway_charge_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key           TEXT        NOT NULL,
+    scope         TEXT        NOT NULL,           -- method and path the key was used on
+    request_hash  TEXT        NOT NULL,
+    status_code   INTEGER,                        -- NULL while the first request is still running
+    response_body BYTEA,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (key, scope)
+);
@@ -0,0 +1,20 @@
+-- Paid payment sessions that could not be turned into an order. Admins list them
+-- and replay the fulfillment once the cause has been fixed.
+
+CREATE TABLE IF NOT EXISTS fulfillment_failures (
+    id                  BIGSERIAL PRIMARY KEY,
+    gateway_session_id  TEXT        NOT NULL UNIQUE,
+    checkout_session_id UUID        NOT NULL,
+    amount_paid_cents   BIGINT      NOT NULL,
+    currency            TEXT        NOT NULL DEFAULT '',
+    stage               TEXT        NOT NULL,
+    error               TEXT        NOT NULL,
+    attempts            INTEGER     NOT NULL DEFAULT 1,
+    status              TEXT        NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    order_id            UUID REFERENCES orders (id) ON DELETE SET NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_attempt_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS fulfillment_failures_status_idx ON fulfillment_failures (status, last_attempt_at);
@@ -0,0 +1,11 @@
+-- Purchase limits per ticket type. max_per_customer counts a buyer's tickets that
+-- were not voided by a refund plus tickets held by their open checkouts.
+
+ALTER TABLE ticket_types
+    ADD COLUMN IF NOT EXISTS min_per_order    INTEGER NOT NULL DEFAULT 1 CHECK (min_per_order >= 1),
+    ADD COLUMN IF NOT EXISTS max_per_order    INTEGER CHECK (max_per_order >= 1),
+    ADD COLUMN IF NOT EXISTS max_per_customer INTEGER CHECK (max_per_customer >= 1);
+
+ALTER TABLE ticket_types DROP CONSTRAINT IF EXISTS ticket_types_per_order_range;
+ALTER TABLE ticket_types
+    ADD CONSTRAINT ticket_types_per_order_range CHECK (max_per_order IS NULL OR max_per_order >= min_per_order);
@@ -0,0 +1,24 @@
+-- Sales windows and price tiers per ticket type. A ticket type can only be reserved
+-- between sales_start and sales_end (either may be open). Tiers are tried in position
+-- order; the first one whose ends_at has not passed and whose until_sold count has not
+-- been reached sets the price, otherwise ticket_types.price_cents applies.
+
+ALTER TABLE ticket_types
+    ADD COLUMN IF NOT EXISTS sales_start TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS sales_end   TIMESTAMPTZ;
+
+ALTER TABLE ticket_types DROP CONSTRAINT IF EXISTS ticket_types_sales_window;
+ALTER TABLE ticket_types
+    ADD CONSTRAINT ticket_types_sales_window CHECK (sales_start IS NULL OR sales_end IS NULL OR sales_end > sales_start);
+
+CREATE TABLE IF NOT EXISTS ticket_price_tiers (
+    id             SERIAL PRIMARY KEY,
+    ticket_type_id INTEGER NOT NULL REFERENCES ticket_types (id) ON DELETE CASCADE,
+    position       INTEGER NOT NULL,
+    name           TEXT    NOT NULL,
+    price_cents    BIGINT  NOT NULL CHECK (price_cents >= 0),
+    ends_at        TIMESTAMPTZ,
+    until_sold     INTEGER CHECK (until_sold > 0),
+    CHECK (ends_at IS NOT NULL OR until_sold IS NOT NULL),
+    UNIQUE (ticket_type_id, position)
+);
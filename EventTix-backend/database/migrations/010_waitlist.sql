@@ -0,0 +1,25 @@
+-- Waitlist for sold-out ticket types. Entries are served first come, first served:
+-- when stock comes back the oldest waiting entry gets an offer, which holds the
+-- tickets in a checkout session until offer_expires_at. An expired offer releases
+-- the stock to the next entry in line.
+
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+    id                  BIGSERIAL PRIMARY KEY,
+    ticket_type_id      INTEGER     NOT NULL REFERENCES ticket_types (id) ON DELETE CASCADE,
+    user_id             UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    quantity            INTEGER     NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    status              TEXT        NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'offered', 'claimed', 'expired', 'cancelled')),
+    offer_token         TEXT UNIQUE,
+    checkout_session_id UUID REFERENCES checkout_sessions (id) ON DELETE SET NULL,
+    offer_expires_at    TIMESTAMPTZ,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One place in line per user and ticket type.
+CREATE UNIQUE INDEX IF NOT EXISTS waitlist_entries_active_user
+    ON waitlist_entries (ticket_type_id, user_id) WHERE status IN ('waiting', 'offered');
+
+CREATE INDEX IF NOT EXISTS waitlist_entries_queue
+    ON waitlist_entries (ticket_type_id, created_at, id) WHERE status = 'waiting';
@@ -0,0 +1,65 @@
+-- Service fees, VAT and invoices. Ticket prices and fees are gross amounts; the VAT
+-- they contain is worked out at the event's rate (in basis points, 2300 = 23%) and
+-- stored per order line. Platform fees are set by admins, organizer fees by the
+-- event's creator; both are charged per ticket on top of its price.
+
+ALTER TABLE ticket_types
+    ADD COLUMN IF NOT EXISTS platform_fee_cents  BIGINT NOT NULL DEFAULT 0 CHECK (platform_fee_cents >= 0),
+    ADD COLUMN IF NOT EXISTS organizer_fee_cents BIGINT NOT NULL DEFAULT 0 CHECK (organizer_fee_cents >= 0);
+
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS vat_rate_bps INTEGER NOT NULL DEFAULT 2300 CHECK (vat_rate_bps BETWEEN 0 AND 10000);
+
+ALTER TABLE checkout_session_lines
+    ADD COLUMN IF NOT EXISTS platform_fee_cents  BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS organizer_fee_cents BIGINT NOT NULL DEFAULT 0;
+
+-- Buyer details for the invoice are captured at checkout and copied to the order.
+ALTER TABLE checkout_sessions
+    ADD COLUMN IF NOT EXISTS vat_rate_bps       INTEGER NOT NULL DEFAULT 2300,
+    ADD COLUMN IF NOT EXISTS buyer_company_name TEXT,
+    ADD COLUMN IF NOT EXISTS buyer_nip          TEXT,
+    ADD COLUMN IF NOT EXISTS buyer_address      TEXT;
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS fees_cents         BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS vat_cents          BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS buyer_company_name TEXT,
+    ADD COLUMN IF NOT EXISTS buyer_nip          TEXT,
+    ADD COLUMN IF NOT EXISTS buyer_address      TEXT;
+
+-- Fee amounts are line totals. gross_cents = net_cents + vat_cents is what the line
+-- charged: ticket prices after discount plus fees.
+CREATE TABLE IF NOT EXISTS order_lines (
+    id                  BIGSERIAL PRIMARY KEY,
+    order_id            UUID    NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    ticket_type_id      INTEGER REFERENCES ticket_types (id) ON DELETE SET NULL,
+    name                TEXT    NOT NULL,
+    quantity            INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price_cents    BIGINT  NOT NULL,
+    discount_cents      BIGINT  NOT NULL DEFAULT 0,
+    platform_fee_cents  BIGINT  NOT NULL DEFAULT 0,
+    organizer_fee_cents BIGINT  NOT NULL DEFAULT 0,
+    vat_rate_bps        INTEGER NOT NULL,
+    net_cents           BIGINT  NOT NULL,
+    vat_cents           BIGINT  NOT NULL,
+    gross_cents         BIGINT  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS order_lines_order ON order_lines (order_id);
+
+-- Invoice numbers run without gaps per calendar year: FV/2026/000001, ...
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    year        INTEGER PRIMARY KEY,
+    last_number INTEGER NOT NULL
+);
+
+-- An issued invoice never changes, so the rendered PDF is kept rather than rebuilt
+-- from the order, which also keeps it after the order is deleted.
+CREATE TABLE IF NOT EXISTS invoices (
+    id        BIGSERIAL PRIMARY KEY,
+    order_id  UUID        UNIQUE REFERENCES orders (id) ON DELETE SET NULL,
+    number    TEXT        NOT NULL UNIQUE,
+    issued_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    pdf       BYTEA       NOT NULL
+);
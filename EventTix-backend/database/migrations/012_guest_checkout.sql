@@ -0,0 +1,35 @@
+-- Guest checkout. Buyers without an account are recorded as a guest contact, one per
+-- email address (stored lower case). Their checkouts, orders, tickets and promo
+-- redemptions point at the contact instead of a user until the address is
+-- registered and verified, when they are claimed into the new account.
+
+CREATE TABLE IF NOT EXISTS guest_contacts (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email      TEXT        NOT NULL UNIQUE,
+    name       TEXT        NOT NULL,
+    user_id    UUID        REFERENCES users (id) ON DELETE SET NULL, -- set once claimed
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE checkout_sessions
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS guest_contact_id UUID REFERENCES guest_contacts (id) ON DELETE CASCADE;
+
+-- guest_token_hash is the SHA-256 of the magic-link token that lets a guest view
+-- the order; the token itself is only ever sent by email.
+ALTER TABLE orders
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS guest_contact_id UUID REFERENCES guest_contacts (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS guest_token_hash TEXT UNIQUE;
+
+ALTER TABLE tickets
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS guest_contact_id UUID REFERENCES guest_contacts (id) ON DELETE SET NULL;
+
+ALTER TABLE promo_redemptions
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS guest_contact_id UUID REFERENCES guest_contacts (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS orders_guest_contact ON orders (guest_contact_id) WHERE guest_contact_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS tickets_guest_contact ON tickets (guest_contact_id) WHERE guest_contact_id IS NOT NULL;
@@ -0,0 +1,12 @@
+-- Refund policies. Each rule refunds refund_percent of the ticket price when an
+-- order is cancelled at least hours_before_start hours before the event starts;
+-- the rule with the largest threshold that still applies wins. Events without
+-- rules cannot be cancelled by buyers. Service fees are never refunded.
+
+CREATE TABLE IF NOT EXISTS event_refund_rules (
+    id                 BIGSERIAL PRIMARY KEY,
+    event_id           UUID    NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    hours_before_start INTEGER NOT NULL CHECK (hours_before_start >= 0),
+    refund_percent     INTEGER NOT NULL CHECK (refund_percent BETWEEN 0 AND 100),
+    UNIQUE (event_id, hours_before_start)
+);
@@ -0,0 +1,47 @@
+-- Ticket transfers between accounts. The owner offers a ticket to an email address,
+-- the recipient accepts through the emailed link and the ticket moves to their
+-- account with a new scan code, so QR codes handed out before stop working.
+-- Creators can turn transfers off per event.
+
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS transfers_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- scan_code is the value encoded in the ticket's QR code (ticket_code holds the
+-- rendered image). Tickets issued so far encode their ID.
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS scan_code TEXT;
+UPDATE tickets SET scan_code = id::text WHERE scan_code IS NULL;
+ALTER TABLE tickets
+    ALTER COLUMN scan_code SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS tickets_scan_code ON tickets (scan_code);
+
+-- token_hash is the SHA-256 of the token in the emailed link.
+CREATE TABLE IF NOT EXISTS ticket_transfers (
+    id           BIGSERIAL PRIMARY KEY,
+    ticket_id    UUID        NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+    from_user_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    to_email     TEXT        NOT NULL,
+    to_user_id   UUID        REFERENCES users (id) ON DELETE SET NULL,
+    token_hash   TEXT        NOT NULL UNIQUE,
+    status       TEXT        NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'accepted', 'cancelled', 'expired')),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One open transfer per ticket.
+CREATE UNIQUE INDEX IF NOT EXISTS ticket_transfers_pending
+    ON ticket_transfers (ticket_id) WHERE status = 'pending';
+
+-- Ownership changes of a ticket, oldest first.
+CREATE TABLE IF NOT EXISTS ticket_history (
+    id           BIGSERIAL PRIMARY KEY,
+    ticket_id    UUID        NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+    action       TEXT        NOT NULL,
+    from_user_id UUID        REFERENCES users (id) ON DELETE SET NULL,
+    to_user_id   UUID        REFERENCES users (id) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ticket_history_ticket ON ticket_history (ticket_id, created_at);
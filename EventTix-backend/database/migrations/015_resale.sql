@@ -0,0 +1,61 @@
+-- Fan-to-fan resale. Holders list tickets at up to their face value plus the
+-- event's cap; a buyer pays for a listing through a regular checkout session, and
+-- on payment the listed ticket is voided and a new one issued to the buyer. What
+-- the seller is owed, less the platform's fee, is kept in resale_ledger until it
+-- has been paid out.
+
+-- How far above face value tickets of the event may be resold, in percent.
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS resale_cap_percent INTEGER NOT NULL DEFAULT 0 CHECK (resale_cap_percent BETWEEN 0 AND 100);
+
+-- face_value_cents is set on tickets issued by a resale, whose price_cents is what
+-- the reseller charged; other tickets are worth their price_cents.
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS face_value_cents BIGINT;
+
+-- A listing is 'reserved' while a buyer is in checkout for it; once reserved_until
+-- has passed it can be bought again.
+CREATE TABLE IF NOT EXISTS resale_listings (
+    id                  BIGSERIAL PRIMARY KEY,
+    ticket_id           UUID        NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+    seller_id           UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    event_id            UUID        NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    ticket_type_id      INTEGER     NOT NULL REFERENCES ticket_types (id) ON DELETE CASCADE,
+    price_cents         BIGINT      NOT NULL CHECK (price_cents > 0),
+    status              TEXT        NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'reserved', 'sold', 'cancelled')),
+    checkout_session_id UUID,
+    reserved_until      TIMESTAMPTZ,
+    sold_ticket_id      UUID REFERENCES tickets (id) ON DELETE SET NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One open listing per ticket.
+CREATE UNIQUE INDEX IF NOT EXISTS resale_listings_open_ticket
+    ON resale_listings (ticket_id) WHERE status IN ('active', 'reserved');
+
+CREATE INDEX IF NOT EXISTS resale_listings_open_event
+    ON resale_listings (event_id, ticket_type_id, price_cents) WHERE status IN ('active', 'reserved');
+
+ALTER TABLE checkout_sessions
+    ADD COLUMN IF NOT EXISTS resale_listing_id BIGINT REFERENCES resale_listings (id) ON DELETE SET NULL;
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS resale_listing_id BIGINT REFERENCES resale_listings (id) ON DELETE SET NULL;
+
+-- One row per sale: gross_cents = fee_cents + payout_cents.
+CREATE TABLE IF NOT EXISTS resale_ledger (
+    id           BIGSERIAL PRIMARY KEY,
+    listing_id   BIGINT      NOT NULL UNIQUE REFERENCES resale_listings (id) ON DELETE CASCADE,
+    order_id     UUID        NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    seller_id    UUID        REFERENCES users (id) ON DELETE SET NULL,
+    currency     TEXT        NOT NULL,
+    gross_cents  BIGINT      NOT NULL,
+    fee_cents    BIGINT      NOT NULL,
+    payout_cents BIGINT      NOT NULL,
+    paid_out_at  TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS resale_ledger_unpaid ON resale_ledger (created_at) WHERE paid_out_at IS NULL;
@@ -0,0 +1,59 @@
+-- Reserved seating. A venue is laid out in sections, rows and seats; an event held
+-- at a seated venue maps its seats to ticket types, which act as price zones. Buyers
+-- pick seats at checkout, each picked seat is held for the checkout's reservation,
+-- and the tickets issued for it carry the seat.
+
+CREATE TABLE IF NOT EXISTS venues (
+    id         SERIAL PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    address    TEXT,
+    creator_id UUID        REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS venue_sections (
+    id         SERIAL PRIMARY KEY,
+    venue_id   INTEGER NOT NULL REFERENCES venues (id) ON DELETE CASCADE,
+    name       TEXT    NOT NULL,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (venue_id, name)
+);
+
+-- x and y place the seat on the rendered map; they are in the section's own grid.
+CREATE TABLE IF NOT EXISTS venue_seats (
+    id          BIGSERIAL PRIMARY KEY,
+    section_id  INTEGER NOT NULL REFERENCES venue_sections (id) ON DELETE CASCADE,
+    row_label   TEXT    NOT NULL,
+    seat_number TEXT    NOT NULL,
+    x           INTEGER NOT NULL DEFAULT 0,
+    y           INTEGER NOT NULL DEFAULT 0,
+    accessible  BOOLEAN NOT NULL DEFAULT FALSE,
+    obstructed  BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (section_id, row_label, seat_number)
+);
+
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS venue_id INTEGER REFERENCES venues (id) ON DELETE SET NULL;
+
+-- The seats an event sells and the ticket type each one is sold as. A seat is
+-- 'held' by a checkout's reservation until held_until, after which it can be
+-- picked again, and 'sold' once a ticket was issued for it.
+CREATE TABLE IF NOT EXISTS event_seats (
+    event_id       UUID        NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    seat_id        BIGINT      NOT NULL REFERENCES venue_seats (id) ON DELETE CASCADE,
+    ticket_type_id INTEGER     NOT NULL REFERENCES ticket_types (id) ON DELETE CASCADE,
+    status         TEXT        NOT NULL DEFAULT 'available' CHECK (status IN ('available', 'held', 'sold')),
+    reservation_id UUID,
+    held_until     TIMESTAMPTZ,
+    ticket_id      UUID        REFERENCES tickets (id) ON DELETE SET NULL,
+    PRIMARY KEY (event_id, seat_id)
+);
+
+CREATE INDEX IF NOT EXISTS event_seats_reservation ON event_seats (reservation_id) WHERE status = 'held';
+CREATE INDEX IF NOT EXISTS event_seats_ticket_type ON event_seats (ticket_type_id);
+
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS seat_id BIGINT REFERENCES venue_seats (id) ON DELETE SET NULL;
+
+-- A seat can only be on one valid ticket of an event.
+CREATE UNIQUE INDEX IF NOT EXISTS tickets_event_seat ON tickets (event_id, seat_id) WHERE seat_id IS NOT NULL AND NOT is_void;
@@ -0,0 +1,33 @@
+-- Multi-event carts. A cart holds lines from several events and is paid through a
+-- single checkout session, which becomes a single order. Every checkout and order
+-- line now says which event it is for and carries that event's VAT rate; event_id
+-- on checkout_sessions and orders is only set when everything is for one event.
+
+ALTER TABLE checkout_session_lines
+    ADD COLUMN IF NOT EXISTS event_id     UUID REFERENCES events (id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS vat_rate_bps INTEGER NOT NULL DEFAULT 2300;
+
+UPDATE checkout_session_lines l
+SET event_id = cs.event_id, vat_rate_bps = cs.vat_rate_bps
+FROM checkout_sessions cs
+WHERE cs.id = l.checkout_session_id AND l.event_id IS NULL;
+
+ALTER TABLE checkout_session_lines
+    ALTER COLUMN event_id SET NOT NULL;
+
+ALTER TABLE order_lines
+    ADD COLUMN IF NOT EXISTS event_id UUID REFERENCES events (id) ON DELETE SET NULL;
+
+UPDATE order_lines l
+SET event_id = o.event_id
+FROM orders o
+WHERE o.id = l.order_id AND l.event_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS order_lines_event ON order_lines (event_id);
+CREATE INDEX IF NOT EXISTS checkout_session_lines_event ON checkout_session_lines (event_id);
+
+ALTER TABLE checkout_sessions
+    ALTER COLUMN event_id DROP NOT NULL;
+
+ALTER TABLE orders
+    ALTER COLUMN event_id DROP NOT NULL;
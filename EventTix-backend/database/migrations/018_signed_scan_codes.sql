@@ -0,0 +1,23 @@
+-- Signed ticket QR codes. A scan code is a token signed with a key of the ticket's
+-- event, carrying the ticket's ID, event, ticket type and issue version, so scanners
+-- can check it without the database. Every event has one active Ed25519 key;
+-- rotating it retires the old one. Private keys are stored encrypted with
+-- TICKET_SIGNING_SECRET.
+
+CREATE TABLE IF NOT EXISTS event_signing_keys (
+    id                 BIGSERIAL PRIMARY KEY,
+    event_id           UUID        NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    public_key         BYTEA       NOT NULL,
+    sealed_private_key BYTEA       NOT NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retired_at         TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS event_signing_keys_active
+    ON event_signing_keys (event_id) WHERE retired_at IS NULL;
+
+-- code_version goes up every time a ticket gets a new code; only the code of the
+-- current version is admitted. Tickets issued so far keep their unsigned codes
+-- until they are reissued (POST /api/admin/scan-codes/reissue).
+ALTER TABLE tickets
+    ADD COLUMN IF NOT EXISTS code_version INTEGER NOT NULL DEFAULT 1;
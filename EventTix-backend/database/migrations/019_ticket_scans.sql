@@ -0,0 +1,19 @@
+-- Check-in log. Every scan at the door is recorded with who scanned it, on which
+-- device, at which gate and what came of it. A ticket is admitted by a single
+-- conditional update, so two gates scanning it at once cannot both let it in; the
+-- earliest admitted scan tells a later one when and where the ticket was used.
+
+CREATE TABLE IF NOT EXISTS ticket_scans (
+    id              BIGSERIAL PRIMARY KEY,
+    ticket_id       UUID        NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+    event_id        UUID        REFERENCES events (id) ON DELETE SET NULL, -- event the gate admits to, if it said
+    scanner_user_id UUID        REFERENCES users (id) ON DELETE SET NULL,
+    device          TEXT        NOT NULL DEFAULT '',
+    gate            TEXT        NOT NULL DEFAULT '',
+    outcome         TEXT        NOT NULL
+        CHECK (outcome IN ('admitted', 'duplicate', 'void', 'wrong_event', 'wrong_seat')),
+    scanned_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ticket_scans_ticket ON ticket_scans (ticket_id, scanned_at);
+CREATE INDEX IF NOT EXISTS ticket_scans_event ON ticket_scans (event_id, scanned_at);
@@ -0,0 +1,25 @@
+-- Door staff. A creator invites someone by email to scan the tickets of one event
+-- during a time window; accepting the emailed link while logged in with that
+-- address assigns their account, and plain user accounts become 'staff'. The
+-- scanning endpoints require an assignment to the event that is open at the time,
+-- unless the scanner is the event's creator or an admin.
+
+CREATE TABLE IF NOT EXISTS event_staff (
+    id          BIGSERIAL PRIMARY KEY,
+    event_id    UUID        NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    email       TEXT        NOT NULL,
+    user_id     UUID        REFERENCES users (id) ON DELETE CASCADE, -- set once accepted
+    invited_by  UUID        REFERENCES users (id) ON DELETE SET NULL,
+    token_hash  TEXT        NOT NULL UNIQUE,                         -- SHA-256 of the emailed link's token
+    starts_at   TIMESTAMPTZ NOT NULL,
+    ends_at     TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    revoked_at  TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (ends_at > starts_at)
+);
+
+-- One live invitation per event and address; inviting again updates it.
+CREATE UNIQUE INDEX IF NOT EXISTS event_staff_live
+    ON event_staff (event_id, email) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS event_staff_user ON event_staff (user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,13 @@
+-- Offline scanning. Scanner devices download a signed manifest of an event's
+-- tickets, keep scanning without a connection and upload the scans afterwards.
+-- An uploaded scan keeps the time the device recorded it at; the earliest scan of
+-- a ticket is the one that admitted it, whichever order scans arrive in.
+
+ALTER TABLE ticket_scans
+    ADD COLUMN IF NOT EXISTS client_scan_id TEXT,       -- the device's ID of a scan made offline
+    ADD COLUMN IF NOT EXISTS synced_at      TIMESTAMPTZ; -- when a scan made offline was uploaded
+
+-- A device that uploads a scan again, e.g. after a dropped connection, gets the
+-- outcome of the first upload.
+CREATE UNIQUE INDEX IF NOT EXISTS ticket_scans_client
+    ON ticket_scans (device, client_scan_id) WHERE client_scan_id IS NOT NULL;
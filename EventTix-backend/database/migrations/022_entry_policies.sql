@@ -0,0 +1,30 @@
+-- Entry policies per ticket type. A single-entry ticket is used at its first
+-- scan; a multi-entry ticket admits up to max_entries times; an unlimited ticket
+-- admits any number of times; an in/out ticket admits again once it has been
+-- scanned out. Any ticket type may be limited to the validity dates valid_from
+-- and valid_until (either may be open), e.g. a day pass. Entries are counted from
+-- the check-in log; tickets.is_used is set at a ticket's first entry.
+
+ALTER TABLE ticket_types
+    ADD COLUMN IF NOT EXISTS entry_policy TEXT NOT NULL DEFAULT 'single'
+        CHECK (entry_policy IN ('single', 'multi', 'unlimited', 'in_out')),
+    ADD COLUMN IF NOT EXISTS max_entries  INTEGER CHECK (max_entries >= 1),
+    ADD COLUMN IF NOT EXISTS valid_from   TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS valid_until  TIMESTAMPTZ;
+
+ALTER TABLE ticket_types DROP CONSTRAINT IF EXISTS ticket_types_max_entries;
+ALTER TABLE ticket_types
+    ADD CONSTRAINT ticket_types_max_entries CHECK ((entry_policy = 'multi') = (max_entries IS NOT NULL));
+
+ALTER TABLE ticket_types DROP CONSTRAINT IF EXISTS ticket_types_validity;
+ALTER TABLE ticket_types
+    ADD CONSTRAINT ticket_types_validity CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_until > valid_from);
+
+-- checked_out: an in/out ticket scanned on its way out; not_inside: scanned out
+-- without being in; outside_validity: scanned in before valid_from or from
+-- valid_until on.
+ALTER TABLE ticket_scans DROP CONSTRAINT IF EXISTS ticket_scans_outcome_check;
+ALTER TABLE ticket_scans
+    ADD CONSTRAINT ticket_scans_outcome_check CHECK (outcome IN (
+        'admitted', 'duplicate', 'void', 'wrong_event', 'wrong_seat',
+        'checked_out', 'not_inside', 'outside_validity'));
@@ -0,0 +1,10 @@
+-- Paid sessions whose order was rejected (e.g. the amount charged does not match
+-- the checkout) are refunded in full through the payment provider. Their queue
+-- entry is kept as 'refunded' with the provider's refund ID.
+
+ALTER TABLE fulfillment_failures
+    ADD COLUMN IF NOT EXISTS refund_id TEXT;
+
+ALTER TABLE fulfillment_failures DROP CONSTRAINT IF EXISTS fulfillment_failures_status_check;
+ALTER TABLE fulfillment_failures
+    ADD CONSTRAINT fulfillment_failures_status_check CHECK (status IN ('open', 'resolved', 'refunded'));
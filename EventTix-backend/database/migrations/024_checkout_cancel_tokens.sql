@@ -0,0 +1,5 @@
+-- Guest checkouts have no account to prove who may back out of them, so
+-- create-session hands the guest a cancel token. Only its hash is stored.
+
+ALTER TABLE checkout_sessions
+    ADD COLUMN IF NOT EXISTS cancel_token_hash TEXT;
@@ -11,6 +11,7 @@ require golang.org/x/crypto v0.37.0
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/mailgun/mailgun-go/v4 v4.23.0
 	github.com/stripe/stripe-go/v78 v78.12.0
 	github.com/yeqown/go-qrcode/v2 v2.2.5
@@ -26,9 +27,11 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e // indirect
 	github.com/yeqown/reedsolomon v1.0.0 // indirect
 	golang.org/x/image v0.10.0 // indirect
 )
 
-require github.com/google/uuid v1.6.0
+require (
+	github.com/google/uuid v1.6.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+)
@@ -0,0 +1,247 @@
+// Package checkin admits tickets at the door and keeps the log of every scan.
+//
+// Every scan locks its ticket, so when two gates scan the same ticket at the same
+// moment only one of them lets it in; the other waits, finds the ticket used and
+// is told when and at which gate it was first used.
+package checkin
+
+import (
+	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/refunds"
+	"TickVibe-EventTix-backend/internal/scancodes"
+	"TickVibe-EventTix-backend/internal/seating"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Scan outcomes stored in ticket_scans.outcome.
+const (
+	OutcomeAdmitted   = "admitted"
+	OutcomeDuplicate  = "duplicate"
+	OutcomeVoid       = "void"
+	OutcomeWrongEvent = "wrong_event"
+	OutcomeWrongSeat  = "wrong_seat" // the seat map no longer has the ticket's seat sold to it
+
+	OutcomeCheckedOut      = "checked_out"      // an in/out ticket on its way out
+	OutcomeNotInside       = "not_inside"       // a check-out of a ticket that is not in
+	OutcomeOutsideValidity = "outside_validity" // before or after the ticket type's validity dates
+)
+
+var (
+	ErrTicketNotFound = errors.New("ticket not found")
+	ErrInvalidCode    = errors.New("ticket code is not genuine")
+	ErrCodeReplaced   = errors.New("ticket code has been replaced by a newer one")
+)
+
+// Scan is a ticket presented at a gate.
+type Scan struct {
+	Code      string // the ticket's scan code as read from its QR code
+	EventID   string // event the gate admits to; empty admits to the ticket's own event
+	ScannerID string // user who scanned, empty if not known
+	Device    string
+	Gate      string
+	ScannedAt time.Time // when a device recorded a scan made offline; zero for now
+	ClientID  string    // the device's ID of a scan made offline
+	CheckOut  bool      // the holder is leaving; in/out tickets only
+
+	ticketID string // the ticket Code belongs to, once resolved
+}
+
+// offline reports whether the scan was made offline and uploaded later.
+func (s *Scan) offline() bool {
+	return !s.ScannedAt.IsZero()
+}
+
+// Entry is where and when a ticket was let in.
+type Entry struct {
+	ID        int64     `json:"-"`
+	ScannedAt time.Time `json:"scanned_at"`
+	Gate      string    `json:"gate,omitempty"`
+	Device    string    `json:"device,omitempty"`
+}
+
+// Result is what came of a scan.
+type Result struct {
+	ClientID   string `json:"client_id,omitempty"`
+	Outcome    string `json:"outcome"`
+	TicketID   string `json:"ticket_id"`
+	Seat       string `json:"seat,omitempty"`
+	FirstEntry *Entry `json:"first_entry,omitempty"` // for duplicates; nil if used before scans were logged
+	*Usage            // the ticket's entries after the scan; nil when it was turned away before they counted
+}
+
+// Admitted reports whether the holder may go in.
+func (r *Result) Admitted() bool {
+	return r.Outcome == OutcomeAdmitted
+}
+
+// CheckIn admits the ticket of a scan if it is valid and its entry policy allows
+// another entry, or checks an in/out ticket out, and records the scan whatever its
+// outcome. Tickets that do not exist and check-outs of tickets that are not in/out
+// are not recorded.
+func CheckIn(db *sql.DB, scan Scan) (*Result, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if scan.ticketID, err = resolve(tx, scan.Code); err != nil {
+		return nil, err
+	}
+	result, err := checkIn(tx, scan)
+	if err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+// resolve returns the ticket a scanned code belongs to. A signed code must carry a
+// valid signature, and one that was genuine but has been replaced since is turned
+// away; tickets issued before codes were signed are found by their unsigned code.
+func resolve(tx *sql.Tx, code string) (string, error) {
+	signed := scancodes.IsSigned(code)
+	if signed {
+		_, err := scancodes.Verify(tx, code)
+		if errors.Is(err, scancodes.ErrInvalidCode) {
+			return "", ErrInvalidCode
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	var ticketID string
+	err := tx.QueryRow(`SELECT id FROM tickets WHERE scan_code = $1`, code).Scan(&ticketID)
+	switch {
+	case err == sql.ErrNoRows && signed:
+		return "", ErrCodeReplaced
+	case err == sql.ErrNoRows:
+		return "", ErrTicketNotFound
+	}
+	return ticketID, err
+}
+
+// checkIn settles a scan of a resolved ticket. The ticket stays locked until the
+// transaction ends: a refund recorded meanwhile would void it after the pending
+// refund check, entries in the log are counted for multi-entry and in/out tickets,
+// and uploads of scans made offline must not settle the same ticket at once.
+func checkIn(tx *sql.Tx, scan Scan) (*Result, error) {
+	var eventID string
+	var isVoid bool
+	err := tx.QueryRow(`SELECT event_id, is_void FROM tickets WHERE id = $1 FOR UPDATE`, scan.ticketID).Scan(&eventID, &isVoid)
+	if err == sql.ErrNoRows {
+		return nil, ErrTicketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	// A ticket whose refund is being paid out is void unless the provider declines it
+	refunding, err := refunds.Pending(tx, scan.ticketID)
+	if err != nil {
+		return nil, err
+	}
+	isVoid = isVoid || refunding
+
+	rules, err := TicketRules(tx, scan.ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if scan.CheckOut && rules.PolicyOrDefault() != models.PolicyInOut {
+		return nil, ErrCheckOutNotAllowed
+	}
+
+	result := &Result{TicketID: scan.ticketID, ClientID: scan.ClientID}
+	seat, seatAssigned, hasSeat, err := seating.TicketSeat(tx, scan.ticketID)
+	if err != nil {
+		return nil, err
+	}
+	result.Seat = seat
+
+	switch {
+	case scan.EventID != "" && scan.EventID != eventID:
+		result.Outcome = OutcomeWrongEvent
+	case isVoid:
+		result.Outcome = OutcomeVoid
+	case hasSeat && !seatAssigned:
+		result.Outcome = OutcomeWrongSeat
+	case !scan.CheckOut && !rules.ValidAt(scanTime(scan)):
+		result.Outcome = OutcomeOutsideValidity
+	case scan.CheckOut || rules.PolicyOrDefault() != models.PolicySingle:
+		if err := enter(tx, scan, rules, result); err != nil {
+			return nil, err
+		}
+	default:
+		// The ticket is locked and not void, so the update only misses a used ticket
+		res, err := tx.Exec(`
+			UPDATE tickets SET is_used = TRUE
+			WHERE id = $1 AND NOT is_used AND NOT is_void`, scan.ticketID)
+		if err != nil {
+			return nil, err
+		}
+		result.Usage = &Usage{Policy: models.PolicySingle, EntriesUsed: 1, EntriesLeft: entriesLeft(1, 1)}
+		result.Outcome = OutcomeDuplicate
+		if n, _ := res.RowsAffected(); n == 1 {
+			result.Outcome = OutcomeAdmitted
+		}
+	}
+
+	if result.Outcome == OutcomeDuplicate && rules.PolicyOrDefault() == models.PolicySingle {
+		first, err := firstEntry(tx, scan.ticketID)
+		if err != nil {
+			return nil, err
+		}
+		if scan.offline() && first != nil && earlier(scan, first) {
+			// Made offline before the scan that admitted the ticket, so this one did
+			if _, err := tx.Exec(`UPDATE ticket_scans SET outcome = $2 WHERE id = $1`, first.ID, OutcomeDuplicate); err != nil {
+				return nil, err
+			}
+			result.Outcome = OutcomeAdmitted
+		} else {
+			result.FirstEntry = first
+		}
+	}
+	if err := record(tx, scan, result.Outcome); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// earlier reports whether a scan came before an entry; ties go to the device
+// named first, so the outcome does not depend on the order scans are uploaded in.
+func earlier(scan Scan, first *Entry) bool {
+	if !scan.ScannedAt.Equal(first.ScannedAt) {
+		return scan.ScannedAt.Before(first.ScannedAt)
+	}
+	return scan.Device < first.Device
+}
+
+// firstEntry returns the scan that admitted a ticket, or nil for tickets used
+// before scans were logged.
+func firstEntry(q querier, ticketID string) (*Entry, error) {
+	entry := &Entry{}
+	err := q.QueryRow(`
+		SELECT id, scanned_at, gate, device
+		FROM ticket_scans
+		WHERE ticket_id = $1 AND outcome = $2
+		ORDER BY scanned_at, device, id
+		LIMIT 1`, ticketID, OutcomeAdmitted).Scan(&entry.ID, &entry.ScannedAt, &entry.Gate, &entry.Device)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func record(tx *sql.Tx, scan Scan, outcome string) error {
+	var scannedAt *time.Time
+	if scan.offline() {
+		scannedAt = &scan.ScannedAt
+	}
+	_, err := tx.Exec(`
+		INSERT INTO ticket_scans (ticket_id, event_id, scanner_user_id, device, gate, outcome,
+		                          scanned_at, client_scan_id, synced_at)
+		VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, '')::uuid, $4, $5, $6,
+		        COALESCE($7, NOW()), NULLIF($8, ''), CASE WHEN $7::timestamptz IS NULL THEN NULL ELSE NOW() END)`,
+		scan.ticketID, scan.EventID, scan.ScannerID, scan.Device, scan.Gate, outcome,
+		scannedAt, scan.ClientID)
+	return err
+}
@@ -0,0 +1,87 @@
+package checkin
+
+import (
+	"TickVibe-EventTix-backend/internal/testdb"
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// issuedTicket creates a paid ticket of an event with an unsigned scan code, as
+// issued before codes were signed, and returns the code.
+func issuedTicket(t *testing.T, db *sql.DB, eventID string) string {
+	t.Helper()
+	userID := testdb.User(t, db, "user")
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+	var orderID string
+	if err := db.QueryRow(`
+		INSERT INTO orders (user_id, event_id, total_amount_cents, currency, status, payment_gateway_charge_id, ticket_quantity)
+		VALUES ($1, $2, 2500, 'PLN', 'completed', $3, 1)
+		RETURNING id`, userID, eventID, "test-"+uuid.New().String()).Scan(&orderID); err != nil {
+		t.Fatalf("creating order: %v", err)
+	}
+	code := "test-" + uuid.New().String()
+	if _, err := db.Exec(`
+		INSERT INTO tickets (id, order_id, event_id, user_id, ticket_type_id, ticket_code, price_cents, scan_code)
+		VALUES ($1, $2, $3, $4, $5, '', 2500, $6)`,
+		uuid.New().String(), orderID, eventID, userID, typeID, code); err != nil {
+		t.Fatalf("creating ticket: %v", err)
+	}
+	return code
+}
+
+// scansOf counts the scans logged for the ticket of a code.
+func scansOf(t *testing.T, db *sql.DB, code string) int {
+	t.Helper()
+	return testdb.Count(t, db, `
+		SELECT COUNT(*) FROM ticket_scans s JOIN tickets t ON t.id = s.ticket_id
+		WHERE t.scan_code = $1`, code)
+}
+
+func TestConcurrentCheckInsAdmitOnce(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	code := issuedTicket(t, db, eventID)
+
+	// Two gates scan the ticket at the same moment
+	const gates = 2
+	results := make(chan *Result, gates)
+	errs := make(chan error, gates)
+	var wg sync.WaitGroup
+	for _, gate := range []string{"A", "B"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := CheckIn(db, Scan{Code: code, EventID: eventID, Gate: gate})
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- result
+		}()
+	}
+	wg.Wait()
+	close(results)
+	close(errs)
+	for err := range errs {
+		t.Fatalf("CheckIn: %v", err)
+	}
+
+	outcomes := make(map[string]int)
+	for r := range results {
+		outcomes[r.Outcome]++
+		if r.Outcome == OutcomeDuplicate && r.FirstEntry == nil {
+			t.Error("duplicate scan is not told when the ticket was first used")
+		}
+	}
+	if outcomes[OutcomeAdmitted] != 1 || outcomes[OutcomeDuplicate] != gates-1 {
+		t.Errorf("outcomes = %v, want one admitted and %d duplicate", outcomes, gates-1)
+	}
+	if n := testdb.Count(t, db, `
+		SELECT COUNT(*) FROM ticket_scans s JOIN tickets t ON t.id = s.ticket_id
+		WHERE t.scan_code = $1 AND s.outcome = $2`, code, OutcomeAdmitted); n != 1 {
+		t.Errorf("admitted scans logged = %d, want 1", n)
+	}
+}
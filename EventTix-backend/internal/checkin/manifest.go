@@ -0,0 +1,145 @@
+package checkin
+
+import (
+	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/scancodes"
+	"TickVibe-EventTix-backend/internal/seating"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// Ticket statuses in an offline manifest.
+const (
+	StatusValid = "valid"
+	StatusUsed  = "used"
+)
+
+// ManifestTicket is a ticket as a device scanning offline knows it. The ticket's
+// code itself is not in the manifest, only its hash. A ticket is used once it has
+// no entries left.
+type ManifestTicket struct {
+	CodeHash    string     `json:"h"` // see CodeHash
+	TicketID    string     `json:"t"`
+	Status      string     `json:"s"` // valid, used, void or wrong_seat
+	Seat        string     `json:"seat,omitempty"`
+	Policy      string     `json:"p,omitempty"`  // entry policy, omitted for single entry
+	EntriesLeft *int       `json:"n,omitempty"`  // multi entry only
+	Inside      bool       `json:"in,omitempty"` // in/out only: scanned in and not out since
+	ValidFrom   *time.Time `json:"from,omitempty"`
+	ValidUntil  *time.Time `json:"until,omitempty"`
+}
+
+// Manifest is an event's tickets at a point in time.
+type Manifest struct {
+	EventID     string           `json:"event_id"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Tickets     []ManifestTicket `json:"tickets"`
+}
+
+// SignedManifest is a manifest signed with the event's key. Payload is the
+// manifest's JSON, which a device checks against the signature before using it;
+// the public key should match the one the device was set up with.
+type SignedManifest struct {
+	KeyID     int64  `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey []byte `json:"public_key"` // base64 in JSON
+	Payload   string `json:"payload"`    // base64url, no padding
+	Signature string `json:"signature"`  // base64url, no padding
+}
+
+// CodeHash is how a manifest refers to a ticket's scan code: the base64url SHA-256
+// of the code, without padding.
+func CodeHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// EventManifest returns the signed manifest of an event's tickets.
+func EventManifest(db *sql.DB, eventID string) (*SignedManifest, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.scan_code, t.is_used, t.is_void,
+		       COALESCE(vs.name, ''), COALESCE(s.row_label, ''), COALESCE(s.seat_number, ''),
+		       t.seat_id IS NULL OR EXISTS(SELECT 1 FROM event_seats es
+		                                   WHERE es.event_id = t.event_id AND es.seat_id = t.seat_id
+		                                     AND es.ticket_id = t.id AND es.status = $2),
+		       tt.entry_policy, tt.max_entries, tt.valid_from, tt.valid_until,
+		       (SELECT COUNT(*) FROM ticket_scans sc WHERE sc.ticket_id = t.id AND sc.outcome = $3),
+		       COALESCE((SELECT sc.outcome = $3 FROM ticket_scans sc
+		                 WHERE sc.ticket_id = t.id AND sc.outcome IN ($3, $4)
+		                 ORDER BY sc.scanned_at DESC, sc.id DESC
+		                 LIMIT 1), FALSE)
+		FROM tickets t
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		LEFT JOIN venue_seats s ON s.id = t.seat_id
+		LEFT JOIN venue_sections vs ON vs.id = s.section_id
+		WHERE t.event_id = $1
+		ORDER BY t.id`, eventID, seating.StatusSold, OutcomeAdmitted, OutcomeCheckedOut)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	manifest := Manifest{EventID: eventID, GeneratedAt: time.Now().UTC(), Tickets: []ManifestTicket{}}
+	for rows.Next() {
+		var t ManifestTicket
+		var code, section, row, number string
+		var used, void, seatAssigned bool
+		var rules models.EntryRules
+		var entries int
+		if err := rows.Scan(&t.TicketID, &code, &used, &void, &section, &row, &number, &seatAssigned,
+			&rules.Policy, &rules.MaxEntries, &rules.ValidFrom, &rules.ValidUntil, &entries, &t.Inside); err != nil {
+			return nil, err
+		}
+		t.ValidFrom, t.ValidUntil = rules.ValidFrom, rules.ValidUntil
+		switch rules.PolicyOrDefault() {
+		case models.PolicyMulti:
+			if used && entries == 0 {
+				entries = 1 // used before scans were logged
+			}
+			t.Policy = rules.Policy
+			t.EntriesLeft = entriesLeft(*rules.MaxEntries, entries)
+			used = *t.EntriesLeft == 0
+		case models.PolicyUnlimited, models.PolicyInOut:
+			t.Policy = rules.Policy
+			used = false
+		}
+		t.Inside = t.Inside && rules.Policy == models.PolicyInOut
+		t.CodeHash = CodeHash(code)
+		if section != "" {
+			t.Seat = seating.Label(section, row, number)
+		}
+		switch {
+		case void:
+			t.Status = OutcomeVoid
+		case !seatAssigned:
+			t.Status = OutcomeWrongSeat
+		case used:
+			t.Status = StatusUsed
+		default:
+			t.Status = StatusValid
+		}
+		manifest.Tickets = append(manifest.Tickets, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scancodes.ActiveKey(db, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedManifest{
+		KeyID:     key.ID,
+		Algorithm: key.Algorithm,
+		PublicKey: key.PublicKey,
+		Payload:   base64.RawURLEncoding.EncodeToString(payload),
+		Signature: base64.RawURLEncoding.EncodeToString(key.SignPayload(payload)),
+	}, nil
+}
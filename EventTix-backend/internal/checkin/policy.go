@@ -0,0 +1,162 @@
+package checkin
+
+import (
+	"TickVibe-EventTix-backend/internal/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrCheckOutNotAllowed = errors.New("only in/out tickets can be checked out")
+
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Usage is how far a ticket is through its entry policy.
+type Usage struct {
+	Policy      string `json:"entry_policy"`
+	EntriesUsed int    `json:"entries_used"`
+	EntriesLeft *int   `json:"entries_left,omitempty"` // nil when entries are not limited
+	Inside      bool   `json:"inside,omitempty"`       // in/out tickets scanned in and not out since
+}
+
+// Exhausted reports whether the ticket has no entries left.
+func (u *Usage) Exhausted() bool {
+	return u.EntriesLeft != nil && *u.EntriesLeft <= 0
+}
+
+// TicketRules returns the entry rules of a ticket's type.
+func TicketRules(q querier, ticketID string) (models.EntryRules, error) {
+	var rules models.EntryRules
+	err := q.QueryRow(`
+		SELECT tt.entry_policy, tt.max_entries, tt.valid_from, tt.valid_until
+		FROM tickets t
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		WHERE t.id = $1`, ticketID).Scan(&rules.Policy, &rules.MaxEntries, &rules.ValidFrom, &rules.ValidUntil)
+	if err == sql.ErrNoRows {
+		return rules, ErrTicketNotFound
+	}
+	return rules, err
+}
+
+// TicketUsage returns how far a ticket is through the entry policy of its type.
+func TicketUsage(q querier, ticketID string) (*Usage, error) {
+	rules, err := TicketRules(q, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	var isUsed bool
+	if err := q.QueryRow(`SELECT is_used FROM tickets WHERE id = $1`, ticketID).Scan(&isUsed); err != nil {
+		return nil, err
+	}
+	return usage(q, ticketID, rules, isUsed)
+}
+
+// usage counts a ticket's entries in the check-in log. A ticket used before scans
+// were logged has had one entry.
+func usage(q querier, ticketID string, rules models.EntryRules, isUsed bool) (*Usage, error) {
+	u := &Usage{Policy: rules.PolicyOrDefault()}
+	var last sql.NullString
+	if err := q.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE outcome = $2),
+		       (SELECT outcome FROM ticket_scans
+		        WHERE ticket_id = $1 AND outcome IN ($2, $3)
+		        ORDER BY scanned_at DESC, id DESC
+		        LIMIT 1)
+		FROM ticket_scans
+		WHERE ticket_id = $1`, ticketID, OutcomeAdmitted, OutcomeCheckedOut).Scan(&u.EntriesUsed, &last); err != nil {
+		return nil, err
+	}
+	if isUsed && u.EntriesUsed == 0 {
+		u.EntriesUsed = 1
+	}
+
+	switch u.Policy {
+	case models.PolicySingle:
+		u.EntriesLeft = entriesLeft(1, u.EntriesUsed)
+	case models.PolicyMulti:
+		u.EntriesLeft = entriesLeft(*rules.MaxEntries, u.EntriesUsed)
+	case models.PolicyInOut:
+		u.Inside = last.String == OutcomeAdmitted
+	}
+	return u, nil
+}
+
+func entriesLeft(max, used int) *int {
+	left := max - used
+	if left < 0 {
+		left = 0
+	}
+	return &left
+}
+
+// enter settles a scan of a ticket whose policy allows more than one entry, or a
+// check-out scan. The ticket is locked while its entries are counted, so two
+// gates scanning it at once see each other's entries.
+func enter(tx *sql.Tx, scan Scan, rules models.EntryRules, result *Result) error {
+	var isUsed, isVoid bool
+	if err := tx.QueryRow(`SELECT is_used, is_void FROM tickets WHERE id = $1 FOR UPDATE`,
+		scan.ticketID).Scan(&isUsed, &isVoid); err != nil {
+		return err
+	}
+	if isVoid {
+		// Refunded in the meantime
+		result.Outcome = OutcomeVoid
+		return nil
+	}
+	u, err := usage(tx, scan.ticketID, rules, isUsed)
+	if err != nil {
+		return err
+	}
+	result.Usage = u
+
+	switch {
+	case scan.CheckOut && u.Inside:
+		result.Outcome = OutcomeCheckedOut
+		u.Inside = false
+		return nil
+	case scan.CheckOut:
+		result.Outcome = OutcomeNotInside
+		return nil
+	case u.Inside || u.Exhausted():
+		result.Outcome = OutcomeDuplicate
+		result.FirstEntry, err = lastEntry(tx, scan.ticketID)
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE tickets SET is_used = TRUE WHERE id = $1`, scan.ticketID); err != nil {
+		return err
+	}
+	result.Outcome = OutcomeAdmitted
+	u.EntriesUsed++
+	if u.EntriesLeft != nil {
+		*u.EntriesLeft--
+	}
+	u.Inside = u.Policy == models.PolicyInOut
+	return nil
+}
+
+// lastEntry returns the latest scan that admitted a ticket, or nil for tickets
+// used before scans were logged.
+func lastEntry(tx *sql.Tx, ticketID string) (*Entry, error) {
+	entry := &Entry{}
+	err := tx.QueryRow(`
+		SELECT id, scanned_at, gate, device
+		FROM ticket_scans
+		WHERE ticket_id = $1 AND outcome = $2
+		ORDER BY scanned_at DESC, id DESC
+		LIMIT 1`, ticketID, OutcomeAdmitted).Scan(&entry.ID, &entry.ScannedAt, &entry.Gate, &entry.Device)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// scanTime returns when a scan was made.
+func scanTime(scan Scan) time.Time {
+	if scan.offline() {
+		return scan.ScannedAt
+	}
+	return time.Now()
+}
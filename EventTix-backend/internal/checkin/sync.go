@@ -0,0 +1,125 @@
+package checkin
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MaxBatch is the most scans a device may upload at once.
+const MaxBatch = 1000
+
+// MaxClockSkew is how far in the future a device's clock may put a scan; later
+// times are taken as the time of the upload.
+const MaxClockSkew = 5 * time.Minute
+
+// Outcomes reported for uploaded scans whose code names no ticket: codes that were
+// never issued, fail their signature check or have been replaced, and for
+// check-outs of tickets that are not in/out. They are not logged.
+const (
+	OutcomeUnknownTicket      = "unknown_ticket"
+	OutcomeInvalidCode        = "invalid_code"
+	OutcomeReplacedCode       = "replaced_code"
+	OutcomeCheckOutNotAllowed = "check_out_not_allowed"
+)
+
+var ErrInvalidBatch = errors.New("every scan needs a client_id, a code and a scanned_at time")
+
+// Sync settles scans a device made offline, earliest first, and returns their
+// outcomes in the order given. Each scan is settled on its own, so one that fails
+// leaves the others settled. A scan the device uploaded before gets its recorded
+// outcome again. A single-entry ticket is admitted by its earliest scan from any
+// device; entries of other tickets are counted in the order they are uploaded.
+func Sync(db *sql.DB, scans []Scan) ([]Result, error) {
+	now := time.Now()
+	order := make([]int, len(scans))
+	for i := range scans {
+		s := &scans[i]
+		if s.ClientID == "" || s.Code == "" || s.ScannedAt.IsZero() {
+			return nil, ErrInvalidBatch
+		}
+		if s.ScannedAt.After(now.Add(MaxClockSkew)) {
+			s.ScannedAt = now
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scans[order[a]].ScannedAt.Before(scans[order[b]].ScannedAt)
+	})
+
+	results := make([]Result, len(scans))
+	for _, i := range order {
+		result, err := syncScan(db, scans[i])
+		switch {
+		case errors.Is(err, ErrTicketNotFound):
+			result = &Result{ClientID: scans[i].ClientID, Outcome: OutcomeUnknownTicket}
+		case errors.Is(err, ErrInvalidCode):
+			result = &Result{ClientID: scans[i].ClientID, Outcome: OutcomeInvalidCode}
+		case errors.Is(err, ErrCodeReplaced):
+			result = &Result{ClientID: scans[i].ClientID, Outcome: OutcomeReplacedCode}
+		case errors.Is(err, ErrCheckOutNotAllowed):
+			result = &Result{ClientID: scans[i].ClientID, Outcome: OutcomeCheckOutNotAllowed}
+		case err != nil:
+			return nil, err
+		}
+		results[i] = *result
+	}
+	return results, nil
+}
+
+// syncScan settles one uploaded scan. When the device uploads the same scan twice
+// at once, the upload that records it second gets the outcome the first recorded.
+func syncScan(db *sql.DB, scan Scan) (*Result, error) {
+	result, err := settle(db, scan)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		if recorded, uploadedErr := uploaded(db, scan); uploadedErr != nil {
+			return nil, uploadedErr
+		} else if recorded != nil {
+			return recorded, nil
+		}
+	}
+	return result, err
+}
+
+func settle(db *sql.DB, scan Scan) (*Result, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if result, err := uploaded(tx, scan); err != nil || result != nil {
+		return result, err
+	}
+	if scan.ticketID, err = resolve(tx, scan.Code); err != nil {
+		return nil, err
+	}
+	result, err := checkIn(tx, scan)
+	if err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+// uploaded returns the outcome of a scan the device has uploaded before, or nil.
+func uploaded(q querier, scan Scan) (*Result, error) {
+	result := &Result{ClientID: scan.ClientID}
+	err := q.QueryRow(`
+		SELECT ticket_id, outcome FROM ticket_scans
+		WHERE device = $1 AND client_scan_id = $2`, scan.Device, scan.ClientID).Scan(&result.TicketID, &result.Outcome)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if result.Outcome == OutcomeDuplicate {
+		if result.FirstEntry, err = firstEntry(q, result.TicketID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
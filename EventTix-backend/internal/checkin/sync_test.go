@@ -0,0 +1,106 @@
+package checkin
+
+import (
+	"TickVibe-EventTix-backend/internal/testdb"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncAdmitsEarliestScanAcrossDevices(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	code := issuedTicket(t, db, eventID)
+	scannedAt := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+
+	// Gate B scanned the ticket first but uploads last
+	batchA := []Scan{{Code: code, EventID: eventID, Device: "device-a", Gate: "A", ClientID: "a-1", ScannedAt: scannedAt.Add(time.Minute)}}
+	batchB := []Scan{{Code: code, EventID: eventID, Device: "device-b", Gate: "B", ClientID: "b-1", ScannedAt: scannedAt}}
+	upload := func(batch []Scan) Result {
+		t.Helper()
+		results, err := Sync(db, batch)
+		if err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+		return results[0]
+	}
+
+	if r := upload(batchA); r.Outcome != OutcomeAdmitted {
+		t.Fatalf("first upload: outcome = %q, want %q", r.Outcome, OutcomeAdmitted)
+	}
+	if r := upload(batchB); r.Outcome != OutcomeAdmitted {
+		t.Fatalf("earlier scan uploaded later: outcome = %q, want %q", r.Outcome, OutcomeAdmitted)
+	}
+
+	// Uploading again reports what was recorded and logs nothing new
+	r := upload(batchA)
+	if r.Outcome != OutcomeDuplicate {
+		t.Errorf("re-upload of the later scan: outcome = %q, want %q", r.Outcome, OutcomeDuplicate)
+	}
+	if r.FirstEntry == nil || r.FirstEntry.Gate != "B" {
+		t.Errorf("re-upload of the later scan: first entry = %+v, want the scan at gate B", r.FirstEntry)
+	}
+	if r := upload(batchB); r.Outcome != OutcomeAdmitted {
+		t.Errorf("re-upload of the earlier scan: outcome = %q, want %q", r.Outcome, OutcomeAdmitted)
+	}
+	if n := scansOf(t, db, code); n != 2 {
+		t.Errorf("scans logged = %d, want 2", n)
+	}
+}
+
+func TestConcurrentReuploadsAreIdempotent(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	code := issuedTicket(t, db, eventID)
+	batch := []Scan{{Code: code, EventID: eventID, Device: "device-a", ClientID: "a-1", ScannedAt: time.Now().Add(-time.Minute)}}
+
+	// The device retries an upload whose response it did not get while the first is still running
+	const uploads = 4
+	outcomes := make(chan string, uploads)
+	var wg sync.WaitGroup
+	for range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := Sync(db, append([]Scan(nil), batch...))
+			if err != nil {
+				t.Errorf("Sync: %v", err)
+				return
+			}
+			outcomes <- results[0].Outcome
+		}()
+	}
+	wg.Wait()
+	close(outcomes)
+
+	for outcome := range outcomes {
+		if outcome != OutcomeAdmitted {
+			t.Errorf("outcome = %q, want every upload %q", outcome, OutcomeAdmitted)
+		}
+	}
+	if n := scansOf(t, db, code); n != 1 {
+		t.Errorf("scans logged = %d, want 1", n)
+	}
+}
+
+func TestSyncReportsRefusedCheckOutPerScan(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	code := issuedTicket(t, db, eventID)
+	scannedAt := time.Now().Add(-time.Hour)
+
+	// A single-entry ticket scanned in, then out by mistake; the mistake does not fail the batch
+	results, err := Sync(db, []Scan{
+		{Code: code, EventID: eventID, Device: "device-a", ClientID: "a-1", ScannedAt: scannedAt},
+		{Code: code, EventID: eventID, Device: "device-a", ClientID: "a-2", ScannedAt: scannedAt.Add(time.Minute), CheckOut: true},
+	})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if results[0].Outcome != OutcomeAdmitted || results[1].Outcome != OutcomeCheckOutNotAllowed {
+		t.Errorf("outcomes = %q, %q, want %q, %q", results[0].Outcome, results[1].Outcome, OutcomeAdmitted, OutcomeCheckOutNotAllowed)
+	}
+	if n := scansOf(t, db, code); n != 1 {
+		t.Errorf("scans logged = %d, want 1", n)
+	}
+}
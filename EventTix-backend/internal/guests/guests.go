@@ -0,0 +1,178 @@
+// Package guests records buyers who check out without an account. A guest is known
+// by email address only; their orders are opened through magic links sent to that
+// address, and are claimed by the account that later registers and verifies it.
+package guests
+
+import (
+	"TickVibe-EventTix-backend/internal/utils"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+var (
+	ErrInvalidContact = errors.New("a valid email address and name are required")
+	ErrInvalidToken   = errors.New("order link is invalid or no longer valid")
+)
+
+// Contact is a guest buyer. There is one per email address; a later checkout with
+// the same address reuses it and updates the name.
+type Contact struct {
+	ID    string `json:"-"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// Normalize trims the contact's details, lower-cases the email and checks both.
+func (c *Contact) Normalize() error {
+	c.Name = strings.TrimSpace(c.Name)
+	addr, err := mail.ParseAddress(strings.TrimSpace(c.Email))
+	if err != nil || c.Name == "" || len(c.Name) > 200 {
+		return ErrInvalidContact
+	}
+	c.Email = strings.ToLower(addr.Address)
+	return nil
+}
+
+// Upsert stores a normalized contact and sets its ID.
+func Upsert(db *sql.DB, c *Contact) error {
+	return db.QueryRow(`
+		INSERT INTO guest_contacts (email, name) VALUES ($1, $2)
+		ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name, updated_at = NOW()
+		RETURNING id`, c.Email, c.Name).Scan(&c.ID)
+}
+
+// Load returns a contact by ID.
+func Load(db *sql.DB, contactID string) (*Contact, error) {
+	c := &Contact{ID: contactID}
+	err := db.QueryRow(`SELECT email, name FROM guest_contacts WHERE id = $1`, contactID).Scan(&c.Email, &c.Name)
+	return c, err
+}
+
+// NewToken returns a magic-link token and the hash to store with the order.
+func NewToken() (token, hash string, err error) {
+	token, err = utils.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the stored form of a magic-link token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// OrderURL is the page a magic link opens.
+func OrderURL(token string) string {
+	return "http://localhost:5173/guest/orders/" + token
+}
+
+// OrderByToken returns the guest order a magic-link token opens. Links stop working
+// once the order was claimed into an account or a newer link was sent.
+func OrderByToken(db *sql.DB, token string) (string, error) {
+	var orderID string
+	err := db.QueryRow(`SELECT id FROM orders WHERE guest_token_hash = $1 AND user_id IS NULL`, HashToken(token)).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidToken
+	}
+	return orderID, err
+}
+
+// OrderLink is a freshly issued magic link to one guest order.
+type OrderLink struct {
+	OrderID    string
+	EventTitle string
+	URL        string
+}
+
+// ReissueLinks replaces the magic links of every unclaimed guest order of an email
+// address and returns the new ones, so a guest who lost the email can get back in.
+// Older links stop working.
+func ReissueLinks(db *sql.DB, email string) ([]OrderLink, error) {
+	rows, err := db.Query(`
+		SELECT o.id, COALESCE(e.title, (SELECT string_agg(DISTINCT ev.title, ', ')
+		                                FROM order_lines ol JOIN events ev ON ev.id = ol.event_id
+		                                WHERE ol.order_id = o.id), '')
+		FROM orders o
+		JOIN guest_contacts g ON g.id = o.guest_contact_id
+		LEFT JOIN events e ON e.id = o.event_id
+		WHERE g.email = $1 AND o.user_id IS NULL
+		ORDER BY o.created_at`, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, err
+	}
+	var links []OrderLink
+	for rows.Next() {
+		var l OrderLink
+		if err := rows.Scan(&l.OrderID, &l.EventTitle); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range links {
+		token, hash, err := NewToken()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec(`UPDATE orders SET guest_token_hash = $1 WHERE id = $2`, hash, links[i].OrderID); err != nil {
+			return nil, err
+		}
+		links[i].URL = OrderURL(token)
+	}
+	return links, nil
+}
+
+// Claim moves everything bought as a guest with a user's email address into the
+// user's account and returns the number of orders claimed. Only verified addresses
+// are claimed, so registering someone else's address does not hand over their
+// tickets. The magic links of claimed orders stop working.
+func Claim(db *sql.DB, userID string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var contactID string
+	err = tx.QueryRow(`
+		UPDATE guest_contacts g
+		SET user_id = u.id, updated_at = NOW()
+		FROM users u
+		WHERE u.id = $1 AND u.is_email_verified AND g.email = LOWER(u.email)
+		RETURNING g.id`, userID).Scan(&contactID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`
+		UPDATE orders SET user_id = $1, guest_token_hash = NULL
+		WHERE guest_contact_id = $2 AND user_id IS NULL`, userID, contactID)
+	if err != nil {
+		return 0, err
+	}
+	claimed, _ := res.RowsAffected()
+	for _, table := range []string{"tickets", "checkout_sessions", "promo_redemptions"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET user_id = $1 WHERE guest_contact_id = $2 AND user_id IS NULL`,
+			userID, contactID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return claimed, nil
+}
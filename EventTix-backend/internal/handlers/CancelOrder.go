@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/refunds"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type cancelOrderRequest struct {
+	TicketIDs []string `json:"ticket_ids"` // empty cancels every valid ticket the buyer still holds
+}
+
+type cancelOrderResponse struct {
+	*refunds.Result
+	RefundPercent int `json:"refund_percent"`
+}
+
+// CancelOrderHandler lets buyers cancel their own order, or some of its tickets.
+// What they get back follows the event's refund policy at the time of cancelling,
+// so the tickets of a cart order are cancelled one event at a time;
+// service fees are kept. The refund goes through the payment provider before the
+// tickets are voided and their stock is put back on sale.
+func CancelOrderHandler(db *sql.DB, gateway payments.PaymentGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		orderID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid order ID", http.StatusBadRequest)
+			return
+		}
+
+		var req cancelOrderRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				utils.WriteJSONError(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+		}
+		for _, id := range req.TicketIDs {
+			if _, err := uuid.Parse(id); err != nil {
+				utils.WriteJSONError(w, "Invalid ticket ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var buyerID sql.NullString
+		var resold bool
+		err = db.QueryRow(`
+			SELECT o.user_id, o.resale_listing_id IS NOT NULL
+			FROM orders o
+			WHERE o.id = $1`, orderID).Scan(&buyerID, &resold)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println("Error loading order:", err)
+			utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if err == sql.ErrNoRows || buyerID.String != claims.UserID {
+			utils.WriteJSONError(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		// The seller has already been credited for a resale; such tickets go back on
+		// the resale market instead
+		if resold {
+			utils.WriteJSONError(w, "Tickets bought on resale cannot be cancelled, list them for resale instead", http.StatusConflict)
+			return
+		}
+
+		// Only tickets the buyer still holds can be handed back: transferred ones
+		// belong to someone else now. Whether they were used or listed for resale is
+		// checked by the refund with the tickets locked.
+		rows, err := db.Query(`
+			SELECT t.id, t.event_id
+			FROM tickets t
+			WHERE t.order_id = $1 AND t.user_id = $2 AND NOT t.is_void
+			  AND (cardinality($3::uuid[]) = 0 OR t.id = ANY($3))`,
+			orderID, claims.UserID, pq.Array(req.TicketIDs))
+		if err != nil {
+			log.Println("Error loading order tickets:", err)
+			utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		var ticketIDs []string
+		var eventID string
+		var mixed bool
+		for rows.Next() {
+			var id, ticketEventID string
+			if err := rows.Scan(&id, &ticketEventID); err != nil {
+				rows.Close()
+				log.Println("Error scanning order ticket:", err)
+				utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			ticketIDs = append(ticketIDs, id)
+			mixed = mixed || (eventID != "" && ticketEventID != eventID)
+			eventID = ticketEventID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			log.Println("Error loading order tickets:", err)
+			utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if len(ticketIDs) == 0 || (len(req.TicketIDs) > 0 && len(ticketIDs) != len(req.TicketIDs)) {
+			utils.WriteJSONError(w, "No cancellable tickets selected", http.StatusBadRequest)
+			return
+		}
+		// Each event of a cart order has its own refund policy
+		if mixed {
+			utils.WriteJSONError(w, "This order is for several events, cancel the tickets of one event at a time", http.StatusBadRequest)
+			return
+		}
+
+		var startTime time.Time
+		if err := db.QueryRow(`SELECT start_time FROM events WHERE id = $1`, eventID).Scan(&startTime); err != nil {
+			log.Println("Error loading event:", err)
+			utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		policies, err := refunds.LoadPolicies(db, []string{eventID})
+		if err != nil {
+			log.Println("Error loading refund policy:", err)
+			utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if len(policies[eventID]) == 0 {
+			utils.WriteJSONError(w, "This event does not allow cancellations", http.StatusConflict)
+			return
+		}
+		percent := refunds.PercentAt(policies[eventID], startTime, time.Now())
+		if percent == 0 {
+			utils.WriteJSONError(w, "This order can no longer be cancelled", http.StatusConflict)
+			return
+		}
+
+		result, err := refunds.Issue(db, gateway, refunds.Request{
+			OrderID:     orderID.String(),
+			TicketIDs:   ticketIDs,
+			Reason:      "Cancelled by customer",
+			RequestedBy: claims.UserID,
+			Percent:     percent,
+			Holder:      claims.UserID,
+		})
+		switch {
+		case errors.Is(err, refunds.ErrOrderNotFound):
+			utils.WriteJSONError(w, "Order not found", http.StatusNotFound)
+		case errors.Is(err, refunds.ErrNotRefundable):
+			utils.WriteJSONError(w, "Order cannot be cancelled in its current state", http.StatusConflict)
+		case errors.Is(err, refunds.ErrNoTickets), errors.Is(err, refunds.ErrForeignTicket):
+			utils.WriteJSONError(w, "No cancellable tickets selected", http.StatusBadRequest)
+		case errors.Is(err, refunds.ErrTicketUsed):
+			utils.WriteJSONError(w, "Tickets that were already used cannot be cancelled", http.StatusConflict)
+		case errors.Is(err, refunds.ErrTicketListed):
+			utils.WriteJSONError(w, "Take the tickets off the resale market before cancelling them", http.StatusConflict)
+		case errors.Is(err, refunds.ErrProviderDeclined):
+			utils.WriteJSONError(w, "Payment provider rejected the refund", http.StatusBadGateway)
+		case err != nil:
+			log.Printf("Error cancelling order %s: %v", orderID, err)
+			utils.WriteJSONError(w, "Failed to cancel order", http.StatusInternalServerError)
+		default:
+			// Cancelled tickets go back on sale, first to anyone on the waitlist
+			go OfferReleasedStock(db)
+			utils.WriteJSON(w, http.StatusOK, cancelOrderResponse{Result: result, RefundPercent: percent})
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/promos"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	errCartShape       = errors.New("send either event_id with tickets, or events")
+	errMixedCurrencies = errors.New("events in one cart must be sold in the same currency")
+)
+
+// CartEvent is what a cart buys from one event.
+type CartEvent struct {
+	EventID string `json:"event_id"`
+	Tickets []struct {
+		TicketTypeID int `json:"ticket_type_id"`
+		Quantity     int `json:"quantity"`
+	} `json:"tickets"`
+	SeatIDs []int64 `json:"seat_ids,omitempty"`
+}
+
+// cart returns what the checkout buys, per event. A request for a single event is a
+// cart of one; an event listed twice in a cart is merged into one entry.
+func (req *CheckoutRequest) cart() ([]CartEvent, error) {
+	if len(req.Events) == 0 {
+		return []CartEvent{{EventID: req.EventID, Tickets: req.Tickets, SeatIDs: req.SeatIDs}}, nil
+	}
+	if req.EventID != "" || len(req.Tickets) > 0 || len(req.SeatIDs) > 0 {
+		return nil, errCartShape
+	}
+
+	var cart []CartEvent
+	index := make(map[string]int)
+	for _, e := range req.Events {
+		i, ok := index[e.EventID]
+		if !ok {
+			index[e.EventID] = len(cart)
+			cart = append(cart, e)
+			continue
+		}
+		cart[i].Tickets = append(cart[i].Tickets, e.Tickets...)
+		cart[i].SeatIDs = append(cart[i].SeatIDs, e.SeatIDs...)
+	}
+	return cart, nil
+}
+
+// sameCurrency reports whether all reserved lines are priced in one currency, as a
+// single payment session needs.
+func sameCurrency(reserved []inventory.ReservedLine) bool {
+	for _, r := range reserved {
+		if r.Currency != reserved[0].Currency {
+			return false
+		}
+	}
+	return true
+}
+
+// redeemCartPromo applies a promo code to the lines of the cart's event it was
+// issued for. Codes belong to one event, so the others are left at full price.
+func redeemCartPromo(db *sql.DB, cs *CheckoutSession, code string, expiresAt time.Time) (*promos.Redemption, error) {
+	err := promos.ErrInvalidCode
+	for _, eventID := range cs.eventIDs() {
+		var r *promos.Redemption
+		r, err = promos.Redeem(db, eventID, cs.UserID, cs.GuestContactID, code, cs.ID, cs.promoLines(eventID), expiresAt)
+		if !errors.Is(err, promos.ErrInvalidCode) {
+			return r, err
+		}
+	}
+	return nil, err
+}
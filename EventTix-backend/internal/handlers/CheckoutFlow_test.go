@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/testdb"
+	"TickVibe-EventTix-backend/internal/utils"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// checkoutMux serves the checkout routes the way main wires them for the fake provider.
+func checkoutMux(db *sql.DB, gateway *payments.FakeGateway) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /checkout/create-session", middleware.OptionalAuth(CreateCheckoutSessionHandler(db, gateway)))
+	mux.HandleFunc("POST /webhooks/fake", PaymentWebhookHandler(db, gateway))
+	mux.HandleFunc("GET /payments/fake/checkout/{id}", FakeCheckoutHandler(db, gateway))
+	return mux
+}
+
+// loggedIn adds the token cookie of a user to a request.
+func loggedIn(t *testing.T, req *http.Request, userID string) *http.Request {
+	t.Helper()
+	token, err := utils.GenerateJWT(userID, "user", userID+"@example.com", true, "Test User")
+	if err != nil {
+		t.Fatalf("generating token: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	return req
+}
+
+// createSession opens a checkout for quantity tickets of a ticket type as a logged-in
+// user and returns the payment session ID and the URL of its checkout page.
+func createSession(t *testing.T, mux http.Handler, userID, eventID string, ticketTypeID, quantity int) (string, string) {
+	t.Helper()
+	body := fmt.Sprintf(`{"event_id": %q, "tickets": [{"ticket_type_id": %d, "quantity": %d}]}`,
+		eventID, ticketTypeID, quantity)
+	req := loggedIn(t, httptest.NewRequest(http.MethodPost, "/checkout/create-session", strings.NewReader(body)), userID)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create-session: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp struct {
+		URL           string `json:"url"`
+		TransactionID string `json:"transaction_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding create-session response: %v", err)
+	}
+	return resp.TransactionID, resp.URL
+}
+
+// pay has the fake provider report a session as paid to the webhook.
+func pay(t *testing.T, mux http.Handler, gateway *payments.FakeGateway, sessionID string) {
+	t.Helper()
+	event, err := gateway.Simulate(sessionID, payments.SessionPaid)
+	if err != nil {
+		t.Fatalf("paying: %v", err)
+	}
+	payload, header, err := gateway.SignedDelivery(event)
+	if err != nil {
+		t.Fatalf("signing delivery: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/fake", bytes.NewReader(payload))
+	req.Header = header
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("webhook: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+// assertTickets checks that a session was turned into one order holding want tickets
+// of the user.
+func assertTickets(t *testing.T, db *sql.DB, sessionID, userID string, want int) {
+	t.Helper()
+	orderID, err := orderForSession(db, sessionID)
+	if err != nil || orderID == "" {
+		t.Fatalf("no order for session %s: %v", sessionID, err)
+	}
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM tickets WHERE order_id = $1 AND user_id = $2`, orderID, userID); n != want {
+		t.Fatalf("order has %d tickets of the buyer, want %d", n, want)
+	}
+}
+
+func TestCheckoutRejectsForeignUserID(t *testing.T) {
+	// The buyer is checked before anything touches the database
+	mux := checkoutMux(nil, payments.NewFakeGateway("http://localhost:8080", "test-fake-secret"))
+	body := `{"event_id": "e", "user_id": "11111111-1111-1111-1111-111111111111",
+		"tickets": [{"ticket_type_id": 1, "quantity": 1}]}`
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"anonymous", httptest.NewRequest(http.MethodPost, "/checkout/create-session", strings.NewReader(body))},
+		{"another user", loggedIn(t, httptest.NewRequest(http.MethodPost, "/checkout/create-session", strings.NewReader(body)),
+			"22222222-2222-2222-2222-222222222222")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, tt.req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+			}
+		})
+	}
+}
+
+func TestCheckoutThroughWebhook(t *testing.T) {
+	db := testdb.Open(t)
+	userID := testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+
+	gateway := payments.NewFakeGateway("http://localhost:8080", "test-fake-secret")
+	mux := checkoutMux(db, gateway)
+	sessionID, _ := createSession(t, mux, userID, eventID, typeID, 2)
+
+	// The buyer pays and the provider reports it to the webhook
+	event, err := gateway.Simulate(sessionID, payments.SessionPaid)
+	if err != nil {
+		t.Fatalf("paying: %v", err)
+	}
+	payload, header, err := gateway.SignedDelivery(event)
+	if err != nil {
+		t.Fatalf("signing delivery: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/fake", bytes.NewReader(payload))
+	req.Header = header
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("webhook: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	assertTickets(t, db, sessionID, userID, 2)
+	if n := testdb.Count(t, db, `SELECT available_quantity FROM ticket_types WHERE id = $1`, typeID); n != 8 {
+		t.Errorf("available_quantity = %d, want 8", n)
+	}
+}
+
+func TestCheckoutThroughFakeCheckoutPage(t *testing.T) {
+	db := testdb.Open(t)
+	userID := testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+
+	gateway := payments.NewFakeGateway("http://localhost:8080", "test-fake-secret")
+	mux := checkoutMux(db, gateway)
+	sessionID, checkoutURL := createSession(t, mux, userID, eventID, typeID, 1)
+
+	page, err := url.Parse(checkoutURL)
+	if err != nil {
+		t.Fatalf("parsing checkout URL %q: %v", checkoutURL, err)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, page.Path+"?outcome=paid", nil))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("checkout page: status = %d, want %d: %s", rec.Code, http.StatusSeeOther, rec.Body)
+	}
+	if loc := rec.Header().Get("Location"); !strings.Contains(loc, "session_id="+sessionID) {
+		t.Errorf("redirected to %q, want the success page of session %s", loc, sessionID)
+	}
+
+	assertTickets(t, db, sessionID, userID, 1)
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/pricing"
+	"TickVibe-EventTix-backend/internal/promos"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Checkout session statuses stored in checkout_sessions.status.
+const (
+	checkoutStatusOpen           = "open"
+	checkoutStatusFulfilled      = "fulfilled"
+	checkoutStatusExpired        = "expired"
+	checkoutStatusAmountMismatch = "amount_mismatch"
+)
+
+// CheckoutLine is one priced line of a checkout session. DiscountCents is the
+// promo discount on the whole line; the fees are charged per ticket. VATRateBps
+// is the rate of the line's event.
+type CheckoutLine struct {
+	EventID           string
+	TicketTypeID      int
+	Name              string
+	Quantity          int
+	UnitPriceCents    int64
+	DiscountCents     int64
+	PlatformFeeCents  int64
+	OrganizerFeeCents int64
+	VATRateBps        int
+}
+
+// feesCents returns the service fees of the whole line.
+func (l CheckoutLine) feesCents() int64 {
+	return (l.PlatformFeeCents + l.OrganizerFeeCents) * int64(l.Quantity)
+}
+
+// orderLine is a checkout line with the VAT breakdown stored on the order.
+type orderLine struct {
+	CheckoutLine
+	NetCents   int64
+	VATCents   int64
+	GrossCents int64
+}
+
+// orderLines breaks every line down into net amount and VAT at its event's rate.
+// Prices and fees are gross, so the VAT is taken out of the amount charged.
+func (cs *CheckoutSession) orderLines() []orderLine {
+	lines := make([]orderLine, 0, len(cs.Lines))
+	for _, l := range cs.Lines {
+		gross := l.UnitPriceCents*int64(l.Quantity) - l.DiscountCents + l.feesCents()
+		vat := pricing.VATFromGross(gross, l.VATRateBps)
+		lines = append(lines, orderLine{CheckoutLine: l, NetCents: gross - vat, VATCents: vat, GrossCents: gross})
+	}
+	return lines
+}
+
+// InvoiceBuyer is the company an invoice is made out to, captured at checkout.
+type InvoiceBuyer struct {
+	CompanyName string `json:"company_name"`
+	NIP         string `json:"nip"`
+	Address     string `json:"address"`
+}
+
+// normalize trims the buyer's details and checks the NIP.
+func (b *InvoiceBuyer) normalize() error {
+	b.CompanyName = strings.TrimSpace(b.CompanyName)
+	b.Address = strings.TrimSpace(b.Address)
+	if b.CompanyName == "" || b.Address == "" {
+		return errors.New("company name and address are required for an invoice")
+	}
+	nip, err := utils.NormalizeNIP(b.NIP)
+	if err != nil {
+		return err
+	}
+	b.NIP = nip
+	return nil
+}
+
+// ticketPrices returns what each ticket of the line is charged once the line's
+// discount is spread over it. The first tickets absorb any indivisible remainder.
+func (l CheckoutLine) ticketPrices() []int64 {
+	prices := make([]int64, l.Quantity)
+	if l.Quantity == 0 {
+		return prices
+	}
+	share, remainder := l.DiscountCents/int64(l.Quantity), l.DiscountCents%int64(l.Quantity)
+	for i := range prices {
+		prices[i] = l.UnitPriceCents - share
+		if int64(i) < remainder {
+			prices[i]--
+		}
+	}
+	return prices
+}
+
+// CheckoutSession is the server-side record of what a buyer is paying for. Its ID is
+// the inventory reservation ID, so holds and pricing share one key. AmountTotalCents
+// is the amount to charge: ticket prices less DiscountCents, plus FeesCents. A cart
+// buys from several events at once; EventID is only set when all lines are for one.
+type CheckoutSession struct {
+	ID               string
+	GatewaySessionID string
+	UserID           string // empty for guest checkouts
+	GuestContactID   string // set instead of UserID for guest checkouts
+	CancelTokenHash  string // lets a guest cancel the checkout; empty for account checkouts
+	EventID          string // empty for carts spanning several events
+	AmountTotalCents int64
+	DiscountCents    int64
+	PromoCodeID      sql.NullInt64
+	Currency         string
+	FeesCents        int64
+	Buyer            *InvoiceBuyer // nil when no company invoice was asked for
+	TotalQuantity    int
+	Status           string
+	ResaleListingID  int64 // set when buying a resale listing instead of new stock
+	Lines            []CheckoutLine
+}
+
+// newCheckoutSession prices reserved lines with the ticket prices read while the
+// stock was being reserved. Lines from several events make it a cart.
+func newCheckoutSession(reservationID, userID string, reserved []inventory.ReservedLine) *CheckoutSession {
+	cs := &CheckoutSession{
+		ID:     reservationID,
+		UserID: userID,
+		Status: checkoutStatusOpen,
+	}
+	for _, r := range reserved {
+		name := r.Name
+		if r.Tier != "" {
+			name += " (" + r.Tier + ")"
+		}
+		l := CheckoutLine{
+			EventID:           r.EventID,
+			TicketTypeID:      r.TicketTypeID,
+			Name:              name,
+			Quantity:          r.Quantity,
+			UnitPriceCents:    r.PriceCents,
+			PlatformFeeCents:  r.PlatformFeeCents,
+			OrganizerFeeCents: r.OrganizerFeeCents,
+			VATRateBps:        r.VATRateBps,
+		}
+		cs.Lines = append(cs.Lines, l)
+		cs.FeesCents += l.feesCents()
+		cs.AmountTotalCents += r.PriceCents*int64(r.Quantity) + l.feesCents()
+		cs.TotalQuantity += r.Quantity
+		cs.Currency = r.Currency
+	}
+	if events := cs.eventIDs(); len(events) == 1 {
+		cs.EventID = events[0]
+	} else {
+		// Ticket type names alone do not say which event of the cart they are for
+		for i, r := range reserved {
+			cs.Lines[i].Name = r.EventTitle + ": " + cs.Lines[i].Name
+		}
+	}
+	return cs
+}
+
+// eventIDs lists the events the session buys from, in the order of its lines.
+func (cs *CheckoutSession) eventIDs() []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, l := range cs.Lines {
+		if !seen[l.EventID] {
+			seen[l.EventID] = true
+			ids = append(ids, l.EventID)
+		}
+	}
+	return ids
+}
+
+// promoLines lists the session's lines of an event for pricing a promo code.
+func (cs *CheckoutSession) promoLines(eventID string) []promos.Line {
+	lines := make([]promos.Line, 0, len(cs.Lines))
+	for _, l := range cs.Lines {
+		if l.EventID != eventID {
+			continue
+		}
+		lines = append(lines, promos.Line{TicketTypeID: l.TicketTypeID, Quantity: l.Quantity, UnitPriceCents: l.UnitPriceCents})
+	}
+	return lines
+}
+
+// applyPromo takes a redeemed promo code's discounts off the session's lines and total.
+func (cs *CheckoutSession) applyPromo(r *promos.Redemption) {
+	cs.PromoCodeID = sql.NullInt64{Int64: int64(r.PromoCodeID), Valid: true}
+	for i := range cs.Lines {
+		d := r.LineDiscounts[cs.Lines[i].TicketTypeID]
+		cs.Lines[i].DiscountCents = d
+		cs.DiscountCents += d
+	}
+	cs.AmountTotalCents -= cs.DiscountCents
+}
+
+// saveCheckoutSession stores a checkout session and its lines.
+func saveCheckoutSession(db *sql.DB, cs *CheckoutSession) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var buyer InvoiceBuyer
+	if cs.Buyer != nil {
+		buyer = *cs.Buyer
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO checkout_sessions (id, user_id, event_id, amount_total_cents, discount_cents, promo_code_id,
+		                               currency, total_quantity, status,
+		                               buyer_company_name, buyer_nip, buyer_address, guest_contact_id, resale_listing_id,
+		                               cancel_token_hash)
+		VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''),
+		        NULLIF($13, '')::uuid, NULLIF($14, 0), NULLIF($15, ''))`,
+		cs.ID, cs.UserID, cs.EventID, cs.AmountTotalCents, cs.DiscountCents, cs.PromoCodeID,
+		cs.Currency, cs.TotalQuantity, cs.Status,
+		buyer.CompanyName, buyer.NIP, buyer.Address, cs.GuestContactID, cs.ResaleListingID,
+		cs.CancelTokenHash); err != nil {
+		return err
+	}
+
+	for _, l := range cs.Lines {
+		if _, err := tx.Exec(`
+			INSERT INTO checkout_session_lines (checkout_session_id, event_id, ticket_type_id, name, quantity, unit_price_cents,
+			                                    discount_cents, platform_fee_cents, organizer_fee_cents, vat_rate_bps)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			cs.ID, l.EventID, l.TicketTypeID, l.Name, l.Quantity, l.UnitPriceCents,
+			l.DiscountCents, l.PlatformFeeCents, l.OrganizerFeeCents, l.VATRateBps); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// attachGatewaySession records the payment provider's session ID on a checkout session.
+func attachGatewaySession(db *sql.DB, checkoutSessionID, gatewaySessionID string) error {
+	_, err := db.Exec(`UPDATE checkout_sessions SET gateway_session_id = $1, updated_at = NOW() WHERE id = $2`,
+		gatewaySessionID, checkoutSessionID)
+	return err
+}
+
+// setCheckoutSessionStatus updates the status of a checkout session.
+func setCheckoutSessionStatus(db *sql.DB, checkoutSessionID, status string) error {
+	_, err := db.Exec(`UPDATE checkout_sessions SET status = $1, updated_at = NOW() WHERE id = $2`,
+		status, checkoutSessionID)
+	return err
+}
+
+// loadCheckoutSession fetches a checkout session and its lines.
+func loadCheckoutSession(db *sql.DB, checkoutSessionID string) (*CheckoutSession, error) {
+	cs := &CheckoutSession{}
+	var gatewaySessionID, userID, guestContactID, eventID, companyName, nip, address sql.NullString
+	var resaleListingID sql.NullInt64
+	err := db.QueryRow(`
+		SELECT id, gateway_session_id, user_id, guest_contact_id, event_id, amount_total_cents, discount_cents, promo_code_id,
+		       currency, total_quantity, status, buyer_company_name, buyer_nip, buyer_address, resale_listing_id
+		FROM checkout_sessions
+		WHERE id = $1`, checkoutSessionID).Scan(
+		&cs.ID, &gatewaySessionID, &userID, &guestContactID, &eventID, &cs.AmountTotalCents, &cs.DiscountCents, &cs.PromoCodeID,
+		&cs.Currency, &cs.TotalQuantity, &cs.Status, &companyName, &nip, &address, &resaleListingID)
+	if err != nil {
+		return nil, err
+	}
+	cs.GatewaySessionID = gatewaySessionID.String
+	cs.UserID = userID.String
+	cs.GuestContactID = guestContactID.String
+	cs.EventID = eventID.String
+	cs.ResaleListingID = resaleListingID.Int64
+	if companyName.Valid {
+		cs.Buyer = &InvoiceBuyer{CompanyName: companyName.String, NIP: nip.String, Address: address.String}
+	}
+
+	rows, err := db.Query(`
+		SELECT event_id, ticket_type_id, name, quantity, unit_price_cents, discount_cents, platform_fee_cents, organizer_fee_cents,
+		       vat_rate_bps
+		FROM checkout_session_lines
+		WHERE checkout_session_id = $1
+		ORDER BY ticket_type_id`, cs.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l CheckoutLine
+		if err := rows.Scan(&l.EventID, &l.TicketTypeID, &l.Name, &l.Quantity, &l.UnitPriceCents, &l.DiscountCents,
+			&l.PlatformFeeCents, &l.OrganizerFeeCents, &l.VATRateBps); err != nil {
+			return nil, err
+		}
+		cs.Lines = append(cs.Lines, l)
+		cs.FeesCents += l.feesCents()
+	}
+	return cs, rows.Err()
+}
@@ -1,28 +1,50 @@
 package handlers
 
 import (
+	"TickVibe-EventTix-backend/internal/guests"
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/promos"
+	"TickVibe-EventTix-backend/internal/resale"
+	"TickVibe-EventTix-backend/internal/seating"
 	"TickVibe-EventTix-backend/internal/utils"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
-
-	"github.com/stripe/stripe-go/v78"
-	"github.com/stripe/stripe-go/v78/checkout/session"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// CheckoutRequest buys tickets of one event, or a cart of several through Events.
 type CheckoutRequest struct {
-	EventID string `json:"event_id"`
-	UserID  string `json:"user_id"`
+	EventID string          `json:"event_id"`
+	UserID  string          `json:"user_id"`         // optional; must be the logged-in user
+	Guest   *guests.Contact `json:"guest,omitempty"` // email and name of a buyer without an account
 	Tickets []struct {
 		TicketTypeID int `json:"ticket_type_id"`
 		Quantity     int `json:"quantity"`
 	} `json:"tickets"`
+	SeatIDs   []int64       `json:"seat_ids,omitempty"` // seats picked on the seat map of a seated event
+	Events    []CartEvent   `json:"events,omitempty"`   // a cart; replaces event_id, tickets and seat_ids
+	PromoCode string        `json:"promo_code,omitempty"`
+	Invoice   *InvoiceBuyer `json:"invoice,omitempty"` // set when the buyer wants a company invoice
 }
 
-func CreateCheckoutSessionHandler(db *sql.DB) http.HandlerFunc {
+const (
+	// checkoutSessionTTL is how long a payment session stays open; 30 minutes is Stripe's minimum.
+	checkoutSessionTTL = 30 * time.Minute
+	// holdGracePeriod keeps holds a little longer than the session so a late
+	// completion webhook still finds its stock reserved.
+	holdGracePeriod = 5 * time.Minute
+)
+
+func CreateCheckoutSessionHandler(db *sql.DB, gateway payments.PaymentGateway) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CheckoutRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -30,76 +52,399 @@ func CreateCheckoutSessionHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-		if stripe.Key == "" {
-			utils.WriteJSONError(w, "Server mis‑config", http.StatusInternalServerError)
+		// The buyer is the logged-in user; a user_id in the body is only accepted
+		// when it names that same user
+		claims, loggedIn := middleware.GetUserFromContext(r)
+		if req.UserID != "" && (!loggedIn || req.UserID != claims.UserID) {
+			utils.WriteJSONError(w, "Log in to check out with your account", http.StatusUnauthorized)
 			return
 		}
+		if loggedIn && req.Guest == nil {
+			req.UserID = claims.UserID
+		}
 
-		var lineItems []*stripe.CheckoutSessionLineItemParams
-		var totalAmount int64 // accumulate total amount from tickets
-		var totalQuantity int // accumulate total quantity from tickets
+		// Buyers without an account check out as a guest, known by email address
+		if req.Guest != nil {
+			if req.UserID != "" {
+				utils.WriteJSONError(w, "Check out either with an account or as a guest", http.StatusBadRequest)
+				return
+			}
+			if err := req.Guest.Normalize(); err != nil {
+				utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else if req.UserID == "" {
+			utils.WriteJSONError(w, "Log in or enter your email address to check out", http.StatusBadRequest)
+			return
+		}
 
-		for _, t := range req.Tickets {
-			var name string
-			var price int64
+		if req.Invoice != nil {
+			if err := req.Invoice.normalize(); err != nil {
+				utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		cart, err := req.cart()
+		if err != nil {
+			utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-			if err := db.QueryRow(
-				`SELECT name, price_cents FROM ticket_types 
-                WHERE id = $1 AND event_id = $2`,
-				t.TicketTypeID, req.EventID).Scan(&name, &price); err != nil {
-				utils.WriteJSONError(w, "Invalid ticket type", http.StatusBadRequest)
+		// Every event of the cart is checked against its own seats and purchase limits
+		var eventLines []inventory.EventLines
+		var lines []inventory.Line
+		var lineErrors []LineError
+		limits := make(map[int]purchaseLimits)
+		for _, e := range cart {
+			requested := make([]inventory.Line, 0, len(e.Tickets))
+			for _, t := range e.Tickets {
+				requested = append(requested, inventory.Line{TicketTypeID: t.TicketTypeID, Quantity: t.Quantity})
+			}
+			requested, err := seatLines(db, e.EventID, requested, e.SeatIDs)
+			if err != nil {
+				writeSeatError(w, err)
 				return
 			}
 
-			totalAmount += price * int64(t.Quantity)
-			totalQuantity += t.Quantity
-
-			lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
-				Quantity: stripe.Int64(int64(t.Quantity)),
-				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency:   stripe.String("pln"),
-					UnitAmount: stripe.Int64(price),
-					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-						Name: stripe.String(name),
-					},
-				},
-			})
+			merged, eventLimits, eventErrors, err := checkOrderLimits(db, e.EventID, requested)
+			if err != nil {
+				log.Println("Error checking purchase limits:", err)
+				utils.WriteJSONError(w, "Could not reserve tickets", http.StatusInternalServerError)
+				return
+			}
+			lineErrors = append(lineErrors, eventErrors...)
+			if req.Guest != nil {
+				lineErrors = append(lineErrors, guestLimitErrors(merged, eventLimits)...)
+			}
+			for id, pl := range eventLimits {
+				limits[id] = pl
+			}
+			eventLines = append(eventLines, inventory.EventLines{EventID: e.EventID, Lines: merged})
+			lines = append(lines, merged...)
+		}
+		if len(lineErrors) > 0 {
+			writeLineErrors(w, http.StatusBadRequest, lineErrors)
+			return
 		}
 
-		var ticketTypesParam string
-		for i, t := range req.Tickets {
-			entry := strconv.Itoa(t.TicketTypeID) + ":" + strconv.Itoa(t.Quantity)
-			if i > 0 {
-				ticketTypesParam += ","
+		var guestContactID string
+		if req.Guest != nil {
+			if err := guests.Upsert(db, req.Guest); err != nil {
+				log.Println("Error saving guest contact:", err)
+				utils.WriteJSONError(w, "Could not create checkout session", http.StatusInternalServerError)
+				return
 			}
-			ticketTypesParam += entry
+			guestContactID = req.Guest.ID
 		}
 
-		successURL := "http://localhost:5173/success" +
-			"?session_id={CHECKOUT_SESSION_ID}" +
-			"&user_id=" + req.UserID +
-			"&event_id=" + req.EventID +
-			"&quantity=" + strconv.Itoa(totalQuantity)
+		// Reserve the stock up front; the hold lives as long as the Stripe session does.
+		expiresAt := time.Now().Add(checkoutSessionTTL)
 
-		params := &stripe.CheckoutSessionParams{
-			PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
-			LineItems:          lineItems,
-			Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
-			SuccessURL:         stripe.String(successURL),
-			CancelURL:          stripe.String("http://localhost:8080/events/" + req.EventID)}
+		reservationID, reserved, err := inventory.ReserveCart(db, eventLines, expiresAt.Add(holdGracePeriod))
+		if err != nil {
+			writeReserveError(w, err)
+			return
+		}
+		if !sameCurrency(reserved) {
+			releaseCheckout(db, reservationID)
+			utils.WriteJSONError(w, errMixedCurrencies.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, e := range cart {
+			if !holdSeats(w, db, e.EventID, reservationID, e.SeatIDs, expiresAt.Add(holdGracePeriod)) {
+				return
+			}
+		}
+
+		// Totals are computed here from ticket_types.price_cents and stored with the
+		// session; the webhook reconciles them against what Stripe actually charged.
+		cs := newCheckoutSession(reservationID, req.UserID, reserved)
+		cs.GuestContactID = guestContactID
+		cs.Buyer = req.Invoice
+
+		// Guests get a token that lets them back out of the checkout
+		var cancelToken string
+		if req.Guest != nil {
+			if cancelToken, cs.CancelTokenHash, err = guests.NewToken(); err != nil {
+				log.Println("Error generating cancel token:", err)
+				releaseCheckout(db, cs.ID)
+				utils.WriteJSONError(w, "Could not create checkout session", http.StatusInternalServerError)
+				return
+			}
+		}
+		if cs.AmountTotalCents == 0 {
+			// Payment providers refuse zero-amount sessions
+			releaseCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Free tickets are claimed through registration", http.StatusBadRequest)
+			return
+		}
+
+		// A promo code takes one of its uses for as long as the stock is held
+		if req.PromoCode != "" {
+			redemption, err := redeemCartPromo(db, cs, req.PromoCode, expiresAt.Add(holdGracePeriod))
+			if err != nil {
+				releaseCheckout(db, cs.ID)
+				switch {
+				case errors.Is(err, promos.ErrInvalidCode), errors.Is(err, promos.ErrCodeNotActive),
+					errors.Is(err, promos.ErrNotApplicable):
+					utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+				case errors.Is(err, promos.ErrCodeExhausted), errors.Is(err, promos.ErrUserLimitReached):
+					utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+				default:
+					log.Println("Promo code error:", err)
+					utils.WriteJSONError(w, "Could not apply promo code", http.StatusInternalServerError)
+				}
+				return
+			}
+			cs.applyPromo(redemption)
+		}
 
-		s, err := session.New(params)
+		if err := saveCheckoutSession(db, cs); err != nil {
+			log.Println("Error saving checkout session:", err)
+			releaseCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Could not create checkout session", http.StatusInternalServerError)
+			return
+		}
+
+		// Per-customer limits are counted only now, so this checkout's own holds are included
+		lineErrors, limitErr := checkCustomerLimits(db, req.UserID, lines, limits)
+		if limitErr != nil || len(lineErrors) > 0 {
+			abandonCheckout(db, cs.ID)
+			if limitErr != nil {
+				log.Println("Error checking customer purchase limits:", limitErr)
+				utils.WriteJSONError(w, "Could not reserve tickets", http.StatusInternalServerError)
+			} else {
+				writeLineErrors(w, http.StatusConflict, lineErrors)
+			}
+			return
+		}
+
+		var customerEmail string
+		if req.Guest != nil {
+			customerEmail = req.Guest.Email
+		}
+		s, err := openPaymentSession(db, gateway, cs, customerEmail, expiresAt)
 		if err != nil {
-			log.Println("Stripe error:", err)
-			utils.WriteJSONError(w, "Could not create Stripe session", http.StatusInternalServerError)
+			log.Printf("Payment provider %s error: %v", gateway.Name(), err)
+			releaseCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Could not create payment session", http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]string{
+		resp := map[string]string{
 			"url":            s.URL,
 			"transaction_id": s.ID,
-		})
+		}
+		if cancelToken != "" {
+			resp["cancel_token"] = cancelToken
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// openPaymentSession creates the payment provider session for a saved checkout and
+// links it to the checkout and its stock holds, which then live as long as it does.
+// customerEmail prefills the provider's checkout page and may be empty.
+func openPaymentSession(db *sql.DB, gateway payments.PaymentGateway, cs *CheckoutSession, customerEmail string, expiresAt time.Time) (*payments.Session, error) {
+	// Prices are already in the currency's minor unit (whole yen for JPY), which
+	// is what payment providers expect; they only want the code in lower case.
+	// A discounted line is split when its tickets do not all cost the same.
+	var lineItems []payments.LineItem
+	for _, l := range cs.Lines {
+		prices := l.ticketPrices()
+		for start := 0; start < len(prices); {
+			end := start
+			for end < len(prices) && prices[end] == prices[start] {
+				end++
+			}
+			lineItems = append(lineItems, payments.LineItem{
+				Name:            l.Name,
+				Quantity:        int64(end - start),
+				UnitAmountCents: prices[start],
+				Currency:        strings.ToLower(cs.Currency),
+			})
+			start = end
+		}
+		if fee := l.PlatformFeeCents + l.OrganizerFeeCents; fee > 0 {
+			lineItems = append(lineItems, payments.LineItem{
+				Name:            l.Name + " - service fee",
+				Quantity:        int64(l.Quantity),
+				UnitAmountCents: fee,
+				Currency:        strings.ToLower(cs.Currency),
+			})
+		}
+	}
+
+	// The buyer comes back to the event's page, or to the cart a cart was bought from
+	frontend := utils.FrontendURL()
+	successURL := frontend + "/success?session_id=" + payments.SessionIDPlaceholder
+	cancelURL := frontend + "/cart"
+	if cs.EventID != "" {
+		var slug string
+		if err := db.QueryRow(`SELECT slug FROM events WHERE id = $1`, cs.EventID).Scan(&slug); err != nil {
+			return nil, fmt.Errorf("loading event %s: %w", cs.EventID, err)
+		}
+		cancelURL = frontend + "/events/" + url.PathEscape(slug)
+	}
+
+	s, err := gateway.CreateSession(payments.SessionParams{
+		LineItems:         lineItems,
+		SuccessURL:        successURL,
+		CancelURL:         cancelURL,
+		ExpiresAt:         expiresAt,
+		ClientReferenceID: cs.UserID,
+		CustomerEmail:     customerEmail,
+		Metadata: map[string]string{
+			"checkout_session_id": cs.ID,
+			"user_id":             cs.UserID,
+			"event_id":            cs.EventID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachGatewaySession(db, cs.ID, s.ID); err != nil {
+		log.Printf("Failed to attach session %s to checkout %s: %v", s.ID, cs.ID, err)
+	}
+	if err := inventory.AttachSession(db, cs.ID, s.ID, s.ExpiresAt.Add(holdGracePeriod)); err != nil {
+		log.Printf("Failed to attach session %s to reservation %s: %v", s.ID, cs.ID, err)
+	}
+	return s, nil
+}
+
+// writeReserveError answers a request whose stock could not be reserved.
+func writeReserveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInsufficientStock):
+		utils.WriteJSONError(w, "Not enough tickets available", http.StatusConflict)
+	case errors.Is(err, inventory.ErrUnknownTicketType):
+		utils.WriteJSONError(w, "Invalid ticket type", http.StatusBadRequest)
+	case errors.Is(err, inventory.ErrInvalidQuantity):
+		utils.WriteJSONError(w, "Invalid ticket selection", http.StatusBadRequest)
+	case errors.Is(err, inventory.ErrNotOnSale):
+		utils.WriteJSONError(w, "Tickets of this type are not on sale", http.StatusConflict)
+	case errors.Is(err, inventory.ErrPriceTierEnds):
+		utils.WriteJSONError(w, "Not enough tickets left at the current price; buy the rest in a separate order", http.StatusConflict)
+	default:
+		log.Println("Reservation error:", err)
+		utils.WriteJSONError(w, "Could not reserve tickets", http.StatusInternalServerError)
+	}
+}
+
+// writeLineErrors answers a checkout request with the reason each refused line failed.
+func writeLineErrors(w http.ResponseWriter, status int, lineErrors []LineError) {
+	utils.WriteJSON(w, status, map[string]interface{}{
+		"error": "Invalid ticket selection",
+		"lines": lineErrors,
+	})
+}
+
+// releaseCheckout gives back the stock, seats, promo code use and resale listing taken
+// by a checkout that never got a payment session.
+func releaseCheckout(db *sql.DB, checkoutSessionID string) {
+	if _, err := inventory.Release(db, checkoutSessionID); err != nil {
+		log.Printf("Failed to release reservation %s: %v", checkoutSessionID, err)
+	}
+	if err := promos.Release(db, checkoutSessionID); err != nil {
+		log.Printf("Failed to release promo code of checkout %s: %v", checkoutSessionID, err)
+	}
+	if err := seating.Release(db, checkoutSessionID); err != nil {
+		log.Printf("Failed to release seats of checkout %s: %v", checkoutSessionID, err)
+	}
+	if err := resale.Release(db, checkoutSessionID); err != nil {
+		log.Printf("Failed to release resale listing of checkout %s: %v", checkoutSessionID, err)
+	}
+}
+
+// abandonCheckout releases a saved checkout that will never reach a payment session
+// and marks it expired.
+func abandonCheckout(db *sql.DB, checkoutSessionID string) {
+	releaseCheckout(db, checkoutSessionID)
+	if err := setCheckoutSessionStatus(db, checkoutSessionID, checkoutStatusExpired); err != nil {
+		log.Printf("Failed to expire checkout session %s: %v", checkoutSessionID, err)
+	}
+}
+
+type cancelCheckoutRequest struct {
+	SessionID   string `json:"session_id"`
+	CancelToken string `json:"cancel_token"` // required for guest checkouts
+}
+
+// errNotCheckoutOwner is returned when the caller did not start the checkout.
+var errNotCheckoutOwner = errors.New("checkout session belongs to someone else")
+
+// checkCheckoutOwner makes sure the caller started the checkout behind a payment
+// session: the logged-in buyer, or a guest holding the checkout's cancel token.
+func checkCheckoutOwner(db *sql.DB, r *http.Request, gatewaySessionID, cancelToken string) error {
+	var userID, tokenHash sql.NullString
+	err := db.QueryRow(`SELECT user_id, cancel_token_hash FROM checkout_sessions WHERE gateway_session_id = $1`,
+		gatewaySessionID).Scan(&userID, &tokenHash)
+	if err != nil {
+		return err
+	}
+
+	if userID.Valid {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok || claims.UserID != userID.String {
+			return errNotCheckoutOwner
+		}
+		return nil
+	}
+	if !tokenHash.Valid || cancelToken == "" ||
+		subtle.ConstantTimeCompare([]byte(guests.HashToken(cancelToken)), []byte(tokenHash.String)) != 1 {
+		return errNotCheckoutOwner
+	}
+	return nil
+}
+
+// CancelCheckoutSessionHandler expires an open payment session when the buyer backs out
+// of checkout and gives its reserved tickets back. Only the buyer may cancel it.
+func CancelCheckoutSessionHandler(db *sql.DB, gateway payments.PaymentGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req cancelCheckoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SessionID == "" {
+			utils.WriteJSONError(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := checkCheckoutOwner(db, r, req.SessionID, req.CancelToken); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				utils.WriteJSONError(w, "Checkout session not found", http.StatusNotFound)
+			case errors.Is(err, errNotCheckoutOwner):
+				utils.WriteJSONError(w, "You cannot cancel this checkout session", http.StatusForbidden)
+			default:
+				log.Printf("Could not load checkout for payment session %s: %v", req.SessionID, err)
+				utils.WriteJSONError(w, "Could not cancel checkout session", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// A session that was already paid or expired cannot be expired again;
+		// in that case the webhook owns the holds and we leave them alone.
+		if err := gateway.ExpireSession(req.SessionID); err != nil {
+			log.Printf("Could not expire payment session %s: %v", req.SessionID, err)
+			utils.WriteJSONError(w, "Checkout session can no longer be cancelled", http.StatusConflict)
+			return
+		}
+
+		// Handle it like the provider's expiry event, which may arrive later as well
+		session, err := gateway.FetchSession(req.SessionID)
+		if err != nil {
+			log.Printf("Could not fetch payment session %s: %v", req.SessionID, err)
+			utils.WriteJSONError(w, "Failed to release reserved tickets", http.StatusInternalServerError)
+			return
+		}
+		if err := handlePaymentEvent(db, gateway, &payments.Event{Type: payments.EventSessionExpired, Session: *session}); err != nil {
+			log.Printf("Failed to release holds for session %s: %v", req.SessionID, err)
+			utils.WriteJSONError(w, "Failed to release reserved tickets", http.StatusInternalServerError)
+			return
+		}
+
+		go OfferReleasedStock(db)
+		utils.WriteJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
 	}
 }
@@ -17,6 +17,7 @@ type UpComingEvent struct {
 	LocationAddress string    `json:"location_address,omitempty"`
 	ImageURL        string    `json:"image_url,omitempty"`
 	IsPublished     bool      `json:"is_published"`
+	Currency        string    `json:"currency"`
 	CreatedAt       time.Time `json:"created_at"`
 }
 
@@ -24,7 +25,7 @@ func GetUpcomingEventsHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		query := `
 			SELECT id, title, slug, description, start_time,
-			       location_name, location_address, image_url, is_published, created_at
+			       location_name, location_address, image_url, is_published, currency, created_at
 			FROM events
 			WHERE start_time >= NOW()
 			ORDER BY start_time ASC
@@ -45,7 +46,7 @@ func GetUpcomingEventsHandler(db *sql.DB) http.HandlerFunc {
 			err := rows.Scan(
 				&e.ID, &e.Title, &e.Slug, &e.Description,
 				&e.StartTime, &e.LocationName, &e.LocationAddress,
-				&e.ImageURL, &e.IsPublished, &e.CreatedAt,
+				&e.ImageURL, &e.IsPublished, &e.Currency, &e.CreatedAt,
 			)
 			if err != nil {
 				http.Error(w, "Error scanning event", http.StatusInternalServerError)
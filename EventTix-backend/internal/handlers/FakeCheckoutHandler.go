@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// FakeCheckoutHandler stands in for the hosted checkout page when PAYMENT_PROVIDER=fake.
+// It settles the session with ?outcome=paid (default), failed or expired, processes the
+// resulting event exactly like a webhook delivery and redirects the buyer back.
+func FakeCheckoutHandler(db *sql.DB, gateway *payments.FakeGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+
+		outcome := payments.SessionStatus(r.URL.Query().Get("outcome"))
+		if outcome == "" {
+			outcome = payments.SessionPaid
+		}
+
+		event, err := gateway.Simulate(sessionID, outcome)
+		if errors.Is(err, payments.ErrSessionNotFound) {
+			utils.WriteJSONError(w, "Payment session not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := handlePaymentEvent(db, gateway, event); err != nil {
+			log.Printf("Error handling fake payment event for session %s: %v", sessionID, err)
+			utils.WriteJSONError(w, "Failed to process payment", http.StatusInternalServerError)
+			return
+		}
+
+		redirectURL, err := gateway.RedirectURL(sessionID)
+		if err != nil {
+			utils.WriteJSONError(w, "Payment session not found", http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	}
+}
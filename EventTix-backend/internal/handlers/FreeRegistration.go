@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// freeSessionPrefix marks the payment_gateway_charge_id of orders that were never
+// paid for, so they cannot collide with a payment provider's session IDs.
+const freeSessionPrefix = "free_"
+
+type RegisterRequest struct {
+	Tickets []struct {
+		TicketTypeID int `json:"ticket_type_id"`
+		Quantity     int `json:"quantity"`
+	} `json:"tickets"`
+	SeatIDs []int64 `json:"seat_ids,omitempty"` // seats picked on the seat map of a seated event
+}
+
+// RegisterForEventHandler issues free tickets without a payment provider. The
+// tickets go through the same reservation, purchase limits and WriteOrders as a
+// paid checkout; a selection that costs anything is sent to checkout instead.
+func RegisterForEventHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSONError(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var eventID string
+		err := db.QueryRow(`SELECT id FROM events WHERE slug = $1 AND is_published = TRUE`, r.PathValue("slug")).Scan(&eventID)
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "Event not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error looking up event for registration:", err)
+			utils.WriteJSONError(w, "Could not register", http.StatusInternalServerError)
+			return
+		}
+
+		lines := make([]inventory.Line, 0, len(req.Tickets))
+		for _, t := range req.Tickets {
+			lines = append(lines, inventory.Line{TicketTypeID: t.TicketTypeID, Quantity: t.Quantity})
+		}
+		lines, err = seatLines(db, eventID, lines, req.SeatIDs)
+		if err != nil {
+			writeSeatError(w, err)
+			return
+		}
+
+		lines, limits, lineErrors, err := checkOrderLimits(db, eventID, lines)
+		if err != nil {
+			log.Println("Error checking purchase limits:", err)
+			utils.WriteJSONError(w, "Could not register", http.StatusInternalServerError)
+			return
+		}
+		if len(lineErrors) > 0 {
+			writeLineErrors(w, http.StatusBadRequest, lineErrors)
+			return
+		}
+
+		// The order is written right away, so the hold only has to outlive this request
+		reservationID, reserved, err := inventory.Reserve(db, eventID, lines, time.Now().Add(holdGracePeriod))
+		if err != nil {
+			writeReserveError(w, err)
+			return
+		}
+		if !holdSeats(w, db, eventID, reservationID, req.SeatIDs, time.Now().Add(holdGracePeriod)) {
+			return
+		}
+
+		cs := newCheckoutSession(reservationID, claims.UserID, reserved)
+		if cs.AmountTotalCents != 0 {
+			releaseCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Paid tickets must be bought through checkout", http.StatusPaymentRequired)
+			return
+		}
+
+		if err := saveCheckoutSession(db, cs); err != nil {
+			log.Println("Error saving checkout session:", err)
+			releaseCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Could not register", http.StatusInternalServerError)
+			return
+		}
+
+		lineErrors, limitErr := checkCustomerLimits(db, claims.UserID, lines, limits)
+		if limitErr != nil || len(lineErrors) > 0 {
+			abandonCheckout(db, cs.ID)
+			if limitErr != nil {
+				log.Println("Error checking customer purchase limits:", limitErr)
+				utils.WriteJSONError(w, "Could not register", http.StatusInternalServerError)
+			} else {
+				writeLineErrors(w, http.StatusConflict, lineErrors)
+			}
+			return
+		}
+
+		orderID, err := WriteOrders(db, Record{
+			CheckoutSessionID: cs.ID,
+			SessionID:         freeSessionPrefix + cs.ID,
+			Currency:          cs.Currency,
+		})
+		if err != nil {
+			// Nothing was written, so the registration can simply be given up
+			log.Printf("Error writing free order for checkout %s: %v", cs.ID, err)
+			abandonCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Could not register", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusCreated, map[string]string{
+			"order_id":   orderID,
+			"session_id": freeSessionPrefix + cs.ID,
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/payments"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Fulfillment failure statuses stored in fulfillment_failures.status.
+const (
+	FulfillmentOpen     = "open"
+	FulfillmentResolved = "resolved"
+	FulfillmentRefunded = "refunded" // rejected and refunded in full
+)
+
+// ErrFulfillmentNotFound is returned when replaying an unknown or resolved failure.
+var ErrFulfillmentNotFound = errors.New("fulfillment failure not found")
+
+// FulfillmentFailure is a paid payment session that WriteOrders could not turn into
+// an order. It stays open until a delivery or an admin replay succeeds.
+type FulfillmentFailure struct {
+	ID                int64      `json:"id"`
+	SessionID         string     `json:"session_id"`
+	CheckoutSessionID string     `json:"checkout_session_id"`
+	AmountPaidCents   int64      `json:"amount_paid_cents"`
+	Currency          string     `json:"currency"`
+	Stage             string     `json:"stage"`
+	Error             string     `json:"error"`
+	Attempts          int        `json:"attempts"`
+	Status            string     `json:"status"`
+	OrderID           *string    `json:"order_id,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastAttemptAt     time.Time  `json:"last_attempt_at"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+	RefundID          *string    `json:"refund_id,omitempty"`
+}
+
+// recordFulfillmentFailure adds a failed fulfillment to the queue, or counts another
+// attempt of one that is already there. A refunded entry stays refunded.
+func recordFulfillmentFailure(db *sql.DB, rec Record, err error) error {
+	stage := "unknown"
+	var ferr *FulfillmentError
+	if errors.As(err, &ferr) {
+		stage = ferr.Stage
+	}
+
+	_, dbErr := db.Exec(`
+		INSERT INTO fulfillment_failures (gateway_session_id, checkout_session_id, amount_paid_cents, currency, stage, error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (gateway_session_id) DO UPDATE
+		SET stage = EXCLUDED.stage, error = EXCLUDED.error, attempts = fulfillment_failures.attempts + 1,
+		    last_attempt_at = NOW(),
+		    status = CASE WHEN fulfillment_failures.status = $8 THEN fulfillment_failures.status ELSE $7 END,
+		    resolved_at = CASE WHEN fulfillment_failures.status = $8 THEN fulfillment_failures.resolved_at END`,
+		rec.SessionID, rec.CheckoutSessionID, rec.AmountPaidCents, rec.Currency, stage, err.Error(), FulfillmentOpen,
+		FulfillmentRefunded)
+	return dbErr
+}
+
+// refundRejected refunds the full amount of a paid session whose order was rejected
+// and marks its queue entry refunded. A session that was refunded before is left
+// alone, however often the provider delivers its event.
+func refundRejected(db *sql.DB, gateway payments.PaymentGateway, rec Record) error {
+	var status string
+	err := db.QueryRow(`SELECT status FROM fulfillment_failures WHERE gateway_session_id = $1`, rec.SessionID).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if status == FulfillmentRefunded {
+		return nil
+	}
+
+	refund, err := gateway.Refund(payments.RefundParams{
+		SessionID:   rec.SessionID,
+		AmountCents: rec.AmountPaidCents,
+		Reason:      "order rejected",
+	})
+	if err != nil {
+		return fmt.Errorf("refunding rejected session %s: %w", rec.SessionID, err)
+	}
+	log.Printf("Refunded rejected payment session %s in full (refund %s)", rec.SessionID, refund.ID)
+
+	_, err = db.Exec(`
+		UPDATE fulfillment_failures
+		SET status = $1, refund_id = $2, resolved_at = NOW()
+		WHERE gateway_session_id = $3`,
+		FulfillmentRefunded, refund.ID, rec.SessionID)
+	return err
+}
+
+// resolveFulfillmentFailure closes the queue entry of a session that has now been fulfilled.
+func resolveFulfillmentFailure(db *sql.DB, sessionID, orderID string) error {
+	_, err := db.Exec(`
+		UPDATE fulfillment_failures
+		SET status = $1, order_id = $2, resolved_at = NOW()
+		WHERE gateway_session_id = $3 AND status = $4`,
+		FulfillmentResolved, orderID, sessionID, FulfillmentOpen)
+	return err
+}
+
+// fulfillmentPending reports whether a paid session is waiting in the queue.
+func fulfillmentPending(db *sql.DB, sessionID string) (bool, error) {
+	var pending bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM fulfillment_failures WHERE gateway_session_id = $1 AND status = $2)`,
+		sessionID, FulfillmentOpen).Scan(&pending)
+	return pending, err
+}
+
+// ListFulfillmentFailures returns queued failures with the given status, newest attempt first.
+func ListFulfillmentFailures(db *sql.DB, status string) ([]FulfillmentFailure, error) {
+	rows, err := db.Query(`
+		SELECT id, gateway_session_id, checkout_session_id, amount_paid_cents, currency, stage, error,
+		       attempts, status, order_id, created_at, last_attempt_at, resolved_at, refund_id
+		FROM fulfillment_failures
+		WHERE status = $1
+		ORDER BY last_attempt_at DESC`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []FulfillmentFailure{}
+	for rows.Next() {
+		var f FulfillmentFailure
+		if err := rows.Scan(&f.ID, &f.SessionID, &f.CheckoutSessionID, &f.AmountPaidCents, &f.Currency, &f.Stage,
+			&f.Error, &f.Attempts, &f.Status, &f.OrderID, &f.CreatedAt, &f.LastAttemptAt, &f.ResolvedAt,
+			&f.RefundID); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+// RetryFulfillment replays an open failure through WriteOrders and returns the order
+// it produced. A failed replay is counted as another attempt.
+func RetryFulfillment(db *sql.DB, id int64) (string, error) {
+	var rec Record
+	err := db.QueryRow(`
+		SELECT checkout_session_id, gateway_session_id, amount_paid_cents, currency
+		FROM fulfillment_failures
+		WHERE id = $1 AND status = $2`, id, FulfillmentOpen).Scan(
+		&rec.CheckoutSessionID, &rec.SessionID, &rec.AmountPaidCents, &rec.Currency)
+	if err == sql.ErrNoRows {
+		return "", ErrFulfillmentNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	return fulfill(db, rec)
+}
+
+// fulfill writes the order of a paid session and keeps the needs-attention queue in
+// step with the outcome.
+func fulfill(db *sql.DB, rec Record) (string, error) {
+	orderID, err := WriteOrders(db, rec)
+	if err != nil {
+		if qerr := recordFulfillmentFailure(db, rec, err); qerr != nil {
+			return "", errors.Join(err, qerr)
+		}
+		return "", err
+	}
+
+	if err := resolveFulfillmentFailure(db, rec.SessionID, orderID); err != nil {
+		return orderID, err
+	}
+	return orderID, nil
+}
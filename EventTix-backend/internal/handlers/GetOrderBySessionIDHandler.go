@@ -13,6 +13,7 @@ type OrderResponse struct {
 	ID               string         `json:"id"`
 	UserID           string         `json:"user_id"`
 	TotalAmountCents int64          `json:"total_amount_cents"`
+	Currency         string         `json:"currency"`
 	Status           string         `json:"status"`
 	EventID          string         `json:"event_id"`
 	TicketQuantity   int            `json:"ticket_quantity"`
@@ -45,49 +46,7 @@ func GetOrderBySessionIDHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var order OrderResponse
-		var ticketDetailsJSON []byte
-
-		// Query the database for order details using the transaction_id (which is the session ID from Stripe)
-		err := db.QueryRow(`
-			SELECT
-				o.id,
-				o.user_id,
-				o.total_amount_cents,
-				o.status,
-				(SELECT t.event_id FROM tickets t WHERE t.order_id = o.id LIMIT 1) AS event_id,
-				COUNT(t.id) AS ticket_quantity,
-				o.created_at,
-				COALESCE(
-					json_agg(
-						json_build_object(
-							'id', t.id,
-							'ticket_type_id', t.ticket_type_id,
-							'ticket_code', t.ticket_code
-						)
-					) FILTER (WHERE t.id IS NOT NULL),
-					'[]'::json
-				) AS tickets_details
-			FROM
-				orders o
-			LEFT JOIN
-				tickets t ON o.id = t.order_id
-			WHERE
-				o.payment_gateway_charge_id = $1
-			GROUP BY
-				o.id, o.user_id, o.total_amount_cents, o.status, o.created_at`,
-			sessionID,
-		).Scan(
-			&order.ID,
-			&order.UserID, // Ensure this is meant to be the user_id from the orders table
-			&order.TotalAmountCents,
-			&order.Status,
-			&order.EventID,        // This will now be populated
-			&order.TicketQuantity, // This will now be populated
-			&order.CreatedAt,
-			&ticketDetailsJSON, // This will now contain the JSON array of tickets
-		)
-
+		order, err := loadOrderResponse(db, "o.payment_gateway_charge_id = $1", sessionID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				utils.WriteJSONError(w, "Order not found", http.StatusNotFound)
@@ -97,16 +56,6 @@ func GetOrderBySessionIDHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Unmarshal the JSON byte slice into the Tickets slice
-		if len(ticketDetailsJSON) > 0 {
-			if err := json.Unmarshal(ticketDetailsJSON, &order.Tickets); err != nil {
-				utils.WriteJSONError(w, "Failed to parse ticket details", http.StatusInternalServerError)
-				return
-			}
-		} else {
-			order.Tickets = []TicketDetail{} // Ensure it's an empty array if no tickets
-		}
-
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(order); err != nil {
 			utils.WriteJSONError(w, "Failed to encode response", http.StatusInternalServerError)
@@ -114,3 +63,63 @@ func GetOrderBySessionIDHandler(db *sql.DB) http.HandlerFunc {
 		}
 	}
 }
+
+// loadOrderResponse fetches the one order matching condition, a WHERE clause on
+// orders o with a single $1 argument, together with its tickets.
+func loadOrderResponse(db *sql.DB, condition string, arg string) (*OrderResponse, error) {
+	var order OrderResponse
+	var ticketDetailsJSON []byte
+
+	err := db.QueryRow(`
+		SELECT
+			o.id,
+			COALESCE(o.user_id::text, ''),
+			o.total_amount_cents,
+			o.currency,
+			o.status,
+			(SELECT t.event_id FROM tickets t WHERE t.order_id = o.id LIMIT 1) AS event_id,
+			COUNT(t.id) AS ticket_quantity,
+			o.created_at,
+			COALESCE(
+				json_agg(
+					json_build_object(
+						'id', t.id,
+						'ticket_type_id', t.ticket_type_id,
+						'ticket_code', t.ticket_code
+					)
+				) FILTER (WHERE t.id IS NOT NULL),
+				'[]'::json
+			) AS tickets_details
+		FROM
+			orders o
+		LEFT JOIN
+			tickets t ON o.id = t.order_id
+		WHERE
+			`+condition+`
+		GROUP BY
+			o.id, o.user_id, o.total_amount_cents, o.currency, o.status, o.created_at`,
+		arg,
+	).Scan(
+		&order.ID,
+		&order.UserID, // empty for guest orders
+		&order.TotalAmountCents,
+		&order.Currency,
+		&order.Status,
+		&order.EventID,
+		&order.TicketQuantity,
+		&order.CreatedAt,
+		&ticketDetailsJSON, // JSON array of the order's tickets
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the JSON byte slice into the Tickets slice
+	order.Tickets = []TicketDetail{} // Ensure it's an empty array if no tickets
+	if len(ticketDetailsJSON) > 0 {
+		if err := json.Unmarshal(ticketDetailsJSON, &order.Tickets); err != nil {
+			return nil, err
+		}
+	}
+	return &order, nil
+}
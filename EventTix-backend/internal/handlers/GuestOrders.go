@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/guests"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// guestOrderID resolves the magic-link token in the path, answering the request
+// itself when it does not open an order.
+func guestOrderID(w http.ResponseWriter, r *http.Request, db *sql.DB) (string, bool) {
+	orderID, err := guests.OrderByToken(db, r.PathValue("token"))
+	if errors.Is(err, guests.ErrInvalidToken) {
+		utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+		return "", false
+	} else if err != nil {
+		log.Println("Error looking up guest order:", err)
+		utils.WriteJSONError(w, "Failed to retrieve order details", http.StatusInternalServerError)
+		return "", false
+	}
+	return orderID, true
+}
+
+// GuestOrderHandler shows a guest their order and tickets through the magic link
+// emailed with them.
+func GuestOrderHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderID, ok := guestOrderID(w, r, db)
+		if !ok {
+			return
+		}
+
+		order, err := loadOrderResponse(db, "o.id = $1", orderID)
+		if err != nil {
+			log.Printf("Error loading guest order %s: %v", orderID, err)
+			utils.WriteJSONError(w, "Failed to retrieve order details", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, order)
+	}
+}
+
+// GuestOrderInvoiceHandler serves the PDF invoice of a guest order through its magic link.
+func GuestOrderInvoiceHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderID, ok := guestOrderID(w, r, db)
+		if !ok {
+			return
+		}
+		writeInvoice(w, db, orderID)
+	}
+}
+
+type guestLinksRequest struct {
+	Email string `json:"email"`
+}
+
+// ResendGuestOrderLinksHandler emails fresh magic links to every guest order of an
+// address. It answers the same whether or not there are any, so it cannot be used
+// to find out who bought tickets.
+func ResendGuestOrderLinksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req guestLinksRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+			utils.WriteJSONError(w, "Email is required", http.StatusBadRequest)
+			return
+		}
+
+		go sendGuestOrderLinks(db, req.Email)
+		utils.WriteJSON(w, http.StatusOK, map[string]string{
+			"message": "If there are orders for this address, links to them are on their way",
+		})
+	}
+}
+
+// sendGuestOrderLinks reissues and emails the magic links of an address's guest orders.
+func sendGuestOrderLinks(db *sql.DB, email string) {
+	links, err := guests.ReissueLinks(db, email)
+	if err != nil {
+		log.Printf("Error reissuing guest order links: %v", err)
+		return
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	var body, plain strings.Builder
+	body.WriteString(`<div style="font-family: Arial, sans-serif; max-width: 600px; margin: auto;">
+            <h2>Your TickVibe orders</h2><ul>`)
+	for _, l := range links {
+		body.WriteString(fmt.Sprintf(`<li><a href="%s">%s</a></li>`, l.URL, html.EscapeString(l.EventTitle)))
+		plain.WriteString(fmt.Sprintf("%s: %s\n", l.EventTitle, l.URL))
+	}
+	body.WriteString(`</ul><p>Links sent earlier no longer work.</p></div>`)
+
+	if err := utils.SendEmail(strings.TrimSpace(email), "Your TickVibe orders", plain.String(), body.String()); err != nil {
+		log.Printf("Error sending guest order links: %v", err)
+	}
+}
+
+// claimGuestOrders moves orders bought as a guest with a user's verified email
+// address into their account.
+func claimGuestOrders(db *sql.DB, userID string) {
+	n, err := guests.Claim(db, userID)
+	if err != nil {
+		log.Printf("Error claiming guest orders for user %s: %v", userID, err)
+	} else if n > 0 {
+		log.Printf("Claimed %d guest orders for user %s", n, userID)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/invoices"
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// OrderInvoiceHandler serves the PDF invoice of an order to its buyer, the event's
+// creator and admins. The invoice is issued on the first download.
+func OrderInvoiceHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		orderID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid order ID", http.StatusBadRequest)
+			return
+		}
+
+		buyerID, creatorIDs, err := invoices.OrderParties(db, orderID.String())
+		if errors.Is(err, invoices.ErrOrderNotFound) {
+			utils.WriteJSONError(w, "Order not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error loading order:", err)
+			utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if claims.UserID != buyerID && !slices.Contains(creatorIDs, claims.UserID) && claims.Role != "admin" {
+			// Not revealing whether someone else's order exists
+			utils.WriteJSONError(w, "Order not found", http.StatusNotFound)
+			return
+		}
+
+		writeInvoice(w, db, orderID.String())
+	}
+}
+
+// writeInvoice answers with the PDF invoice of an order, issuing it if needed.
+func writeInvoice(w http.ResponseWriter, db *sql.DB, orderID string) {
+	inv, err := invoices.ForOrder(db, orderID)
+	switch {
+	case errors.Is(err, invoices.ErrOrderNotFound):
+		utils.WriteJSONError(w, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, invoices.ErrNotInvoiceable):
+		utils.WriteJSONError(w, "No invoice can be issued for this order", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error issuing invoice for order %s: %v", orderID, err)
+		utils.WriteJSONError(w, "Failed to issue invoice", http.StatusInternalServerError)
+		return
+	}
+
+	filename := strings.ReplaceAll(inv.Number, "/", "-") + ".pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(inv.PDF)))
+	w.Write(inv.PDF)
+}
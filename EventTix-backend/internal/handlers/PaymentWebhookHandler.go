@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/promos"
+	"TickVibe-EventTix-backend/internal/resale"
+	"TickVibe-EventTix-backend/internal/seating"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// maxWebhookBodyBytes caps the size of a webhook payload we are willing to read.
+const maxWebhookBodyBytes = int64(65536)
+
+// PaymentWebhookHandler receives payment provider events, lets the gateway verify
+// their signature and fulfills orders from the stored checkout session.
+func PaymentWebhookHandler(db *sql.DB, gateway payments.PaymentGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		event, err := gateway.ParseWebhook(payload, r.Header)
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			log.Printf("%s webhook signature verification failed: %v", gateway.Name(), err)
+			utils.WriteJSONError(w, "Invalid signature", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error parsing %s webhook: %v", gateway.Name(), err)
+			utils.WriteJSONError(w, "Failed to process event", http.StatusInternalServerError)
+			return
+		}
+
+		if err := handlePaymentEvent(db, gateway, event); err != nil {
+			log.Printf("Error handling payment event %s (%s): %v", event.ID, event.Type, err)
+			// A non-2xx answer makes the provider retry the delivery later.
+			utils.WriteJSONError(w, "Failed to process event", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, map[string]bool{"received": true})
+	}
+}
+
+// handlePaymentEvent acts on a verified payment event. Ignored event types are a no-op.
+// A paid session whose order is rejected is refunded in full.
+func handlePaymentEvent(db *sql.DB, gateway payments.PaymentGateway, event *payments.Event) error {
+	s := &event.Session
+
+	switch event.Type {
+	case payments.EventSessionCompleted:
+		rec, err := recordFromSession(s)
+		if err != nil {
+			return err
+		}
+		// Failures are queued for admins; rejected orders are final and refunded. A
+		// refund that fails is tried again when the provider redelivers the event.
+		_, err = fulfill(db, rec)
+		if errors.Is(err, errOrderRejected) {
+			return refundRejected(db, gateway, rec)
+		}
+		return err
+
+	case payments.EventSessionExpired, payments.EventPaymentFailed:
+		if id := s.Metadata["checkout_session_id"]; id != "" {
+			if _, err := inventory.Release(db, id); err != nil {
+				return fmt.Errorf("releasing holds for checkout %s: %w", id, err)
+			}
+			if err := promos.Release(db, id); err != nil {
+				return fmt.Errorf("releasing promo code of checkout %s: %w", id, err)
+			}
+			if err := seating.Release(db, id); err != nil {
+				return fmt.Errorf("releasing seats of checkout %s: %w", id, err)
+			}
+			if err := resale.Release(db, id); err != nil {
+				return fmt.Errorf("releasing resale listing of checkout %s: %w", id, err)
+			}
+			if err := setCheckoutSessionStatus(db, id, checkoutStatusExpired); err != nil {
+				return fmt.Errorf("expiring checkout session %s: %w", id, err)
+			}
+		} else if _, err := inventory.ReleaseBySession(db, s.ID); err != nil {
+			return fmt.Errorf("releasing holds for session %s: %w", s.ID, err)
+		}
+		log.Printf("Payment session %s was not paid (%s), reserved tickets released", s.ID, event.Type)
+		go OfferReleasedStock(db)
+		return nil
+	}
+
+	return nil
+}
+
+// recordFromSession identifies the stored checkout session through the metadata
+// attached in CreateCheckoutSessionHandler and keeps the amount actually charged.
+func recordFromSession(s *payments.Session) (Record, error) {
+	checkoutSessionID := s.Metadata["checkout_session_id"]
+	if checkoutSessionID == "" {
+		return Record{}, fmt.Errorf("payment session %s is missing order metadata", s.ID)
+	}
+
+	return Record{
+		CheckoutSessionID: checkoutSessionID,
+		SessionID:         s.ID,
+		AmountPaidCents:   s.AmountTotalCents,
+		Currency:          s.Currency,
+	}, nil
+}
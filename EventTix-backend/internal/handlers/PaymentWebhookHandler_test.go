@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/testdb"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v78/webhook"
+)
+
+const testWebhookSecret = "whsec_test_secret"
+
+// stripeFixture is a checkout.session.completed event as Stripe delivers it.
+func stripeFixture(eventID, sessionID, checkoutSessionID string, amountCents int64) []byte {
+	return []byte(fmt.Sprintf(`{
+		"id": %q,
+		"object": "event",
+		"api_version": "2024-04-10",
+		"type": "checkout.session.completed",
+		"data": {"object": {
+			"id": %q,
+			"object": "checkout.session",
+			"status": "complete",
+			"payment_status": "paid",
+			"amount_total": %d,
+			"currency": "pln",
+			"metadata": {"checkout_session_id": %q}
+		}}
+	}`, eventID, sessionID, amountCents, checkoutSessionID))
+}
+
+// deliver posts a payload to the webhook handler with the given Stripe-Signature.
+func deliver(handler http.Handler, payload []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", signature)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// sign signs a payload with the test secret as Stripe would at the given time.
+func sign(payload []byte, at time.Time) string {
+	return webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    testWebhookSecret,
+		Timestamp: at,
+	}).Header
+}
+
+// testCheckout reserves quantity tickets of a ticket type for a user and saves the
+// checkout session a payment session would be opened for.
+func testCheckout(t *testing.T, db *sql.DB, userID, eventID string, ticketTypeID, quantity int) *CheckoutSession {
+	t.Helper()
+	lines := []inventory.Line{{TicketTypeID: ticketTypeID, Quantity: quantity}}
+	reservationID, reserved, err := inventory.Reserve(db, eventID, lines, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("reserving tickets: %v", err)
+	}
+	cs := newCheckoutSession(reservationID, userID, reserved)
+	if err := saveCheckoutSession(db, cs); err != nil {
+		t.Fatalf("saving checkout session: %v", err)
+	}
+	return cs
+}
+
+func TestPaymentWebhookRejectsBadSignature(t *testing.T) {
+	// The signature is checked before anything touches the database
+	handler := PaymentWebhookHandler(nil, payments.NewStripeGateway("sk_test_unused", testWebhookSecret))
+	payload := stripeFixture("evt_bad_signature", "cs_test_bad", "00000000-0000-0000-0000-000000000000", 1000)
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{"missing", ""},
+		{"wrong secret", webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: "whsec_other"}).Header},
+		{"tampered payload", sign(append([]byte(" "), payload...), time.Now())},
+		{"stale timestamp", sign(payload, time.Now().Add(-time.Hour))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := deliver(handler, payload, tt.signature); rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestPaymentWebhookFulfillsValidEvent(t *testing.T) {
+	db := testdb.Open(t)
+	userID := testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, userID)
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+	cs := testCheckout(t, db, userID, eventID, typeID, 2)
+
+	handler := PaymentWebhookHandler(db, payments.NewStripeGateway("sk_test_unused", testWebhookSecret))
+	sessionID := "cs_test_" + cs.ID
+	payload := stripeFixture("evt_valid_"+cs.ID, sessionID, cs.ID, cs.AmountTotalCents)
+	if rec := deliver(handler, payload, sign(payload, time.Now())); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	orderID, err := orderForSession(db, sessionID)
+	if err != nil || orderID == "" {
+		t.Fatalf("no order for session %s: %v", sessionID, err)
+	}
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM tickets WHERE order_id = $1`, orderID); n != 2 {
+		t.Fatalf("order has %d tickets, want 2", n)
+	}
+}
+
+func TestPaymentWebhookIgnoresReplayedEvent(t *testing.T) {
+	db := testdb.Open(t)
+	userID := testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, userID)
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+	cs := testCheckout(t, db, userID, eventID, typeID, 1)
+
+	handler := PaymentWebhookHandler(db, payments.NewStripeGateway("sk_test_unused", testWebhookSecret))
+	sessionID := "cs_test_" + cs.ID
+	payload := stripeFixture("evt_replay_"+cs.ID, sessionID, cs.ID, cs.AmountTotalCents)
+	signature := sign(payload, time.Now())
+
+	// Stripe redelivers events, and a captured delivery may be sent again
+	for i := 0; i < 3; i++ {
+		if rec := deliver(handler, payload, signature); rec.Code != http.StatusOK {
+			t.Fatalf("delivery %d: status = %d, want %d: %s", i+1, rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM orders WHERE payment_gateway_charge_id = $1`, sessionID); n != 1 {
+		t.Fatalf("%d orders for session %s, want 1", n, sessionID)
+	}
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM tickets t JOIN orders o ON o.id = t.order_id
+		WHERE o.payment_gateway_charge_id = $1`, sessionID); n != 1 {
+		t.Fatalf("%d tickets for session %s, want 1", n, sessionID)
+	}
+}
@@ -1,182 +1,449 @@
 package handlers
 
 import (
+	"TickVibe-EventTix-backend/internal/guests"
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/promos"
+	"TickVibe-EventTix-backend/internal/resale"
+	"TickVibe-EventTix-backend/internal/scancodes"
+	"TickVibe-EventTix-backend/internal/seating"
 	"TickVibe-EventTix-backend/internal/utils"
 	"database/sql"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"log"
-	"math"
 	"net/http"
-	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
-	"github.com/skip2/go-qrcode"
 )
 
-// Define the structure for individual ticket details within the record
-type PurchasedTicket struct {
-	TicketTypeID int `json:"ticket_type_id"`
-	Quantity     int `json:"quantity"`
-}
-
-// Update the Record struct to include the detailed tickets array
+// Record identifies a paid payment session that should be turned into an order.
+// Everything about what was bought comes from the stored checkout session.
 type Record struct {
-	SessionID     string            `json:"transactionId"`
-	EventID       *string           `json:"eventId"`
-	UserID        string            `json:"userId"`
-	TotalAmount   string            `json:"totalAmount"`
-	Tickets       []PurchasedTicket `json:"tickets"`       // Changed to an array of PurchasedTicket
-	TotalQuantity int               `json:"totalQuantity"` // Include totalQuantity from frontend
+	CheckoutSessionID string // checkout_sessions.id, also the inventory reservation ID
+	SessionID         string // the payment provider's session ID
+	AmountPaidCents   int64  // amount the payment provider reports it charged
+	Currency          string // currency the payment provider charged in
 }
 
-func PayTest(db *sql.DB) http.HandlerFunc {
+// PaymentStatus is a read-only poll for the checkout success page. Orders are only
+// written by PaymentWebhookHandler, so this merely reports whether that has happened yet.
+func PaymentStatus(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var rec Record
-		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
-			log.Printf("Error decoding request payload: %v", err) // Log the actual error
-			utils.WriteJSONError(w, "Invalid request payload", http.StatusBadRequest)
+		sessionID := r.URL.Query().Get("session_id")
+		if sessionID == "" {
+			utils.WriteJSONError(w, "Session ID is required", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("Received transaction data: %+v", rec) // Log the received data for debugging
-
-		WriteOrders(db, rec)
+		var orderID, status string
+		err := db.QueryRow(`SELECT id, status FROM orders WHERE payment_gateway_charge_id = $1`, sessionID).Scan(&orderID, &status)
+		if err == sql.ErrNoRows {
+			// Paid but not fulfilled: say so rather than letting the buyer wait forever
+			pending, err := fulfillmentPending(db, sessionID)
+			if err != nil {
+				log.Printf("Error looking up fulfillment of session %s: %v", sessionID, err)
+				utils.WriteJSONError(w, "Failed to retrieve payment status", http.StatusInternalServerError)
+				return
+			}
+			if pending {
+				utils.WriteJSON(w, http.StatusOK, map[string]string{"status": "needs_attention"})
+				return
+			}
+			utils.WriteJSON(w, http.StatusOK, map[string]string{"status": "pending"})
+			return
+		} else if err != nil {
+			log.Printf("Error looking up order for session %s: %v", sessionID, err)
+			utils.WriteJSONError(w, "Failed to retrieve payment status", http.StatusInternalServerError)
+			return
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status": "record created",
+		utils.WriteJSON(w, http.StatusOK, map[string]string{
+			"status":   status,
+			"order_id": orderID,
 		})
 	}
 }
 
-func WriteOrders(db *sql.DB, rec Record) {
-	amountStr := strings.TrimSpace(rec.TotalAmount)
-	amountFloat, err := parseAmount(amountStr)
+// Stages of WriteOrders reported in a FulfillmentError.
+const (
+	stageLoad      = "load_checkout"
+	stageRejected  = "rejected"
+	stageOrder     = "insert_order"
+	stageInventory = "convert_inventory"
+	stagePromo     = "confirm_promo"
+	stageTickets   = "insert_tickets"
+	stageResale    = "resale"
+	stageSeats     = "assign_seats"
+	stageCommit    = "commit"
+)
+
+// errOrderRejected is returned when a paid session does not match its checkout or its
+// stock, seats or resale listing are gone. It is final: the session is queued and refunded, and the payment
+// provider should not be asked to deliver the event again.
+var errOrderRejected = errors.New("order rejected")
+
+// FulfillmentError reports the stage at which a paid session could not be turned
+// into an order. Nothing of the order is written when it is returned.
+type FulfillmentError struct {
+	SessionID string
+	Stage     string
+	Err       error
+}
+
+func (e *FulfillmentError) Error() string {
+	return fmt.Sprintf("fulfilling payment session %s failed at %s: %v", e.SessionID, e.Stage, e.Err)
+}
+
+func (e *FulfillmentError) Unwrap() error { return e.Err }
+
+// orderForSession returns the order already written for a payment session, or "".
+func orderForSession(db *sql.DB, sessionID string) (string, error) {
+	var orderID string
+	err := db.QueryRow(`SELECT id FROM orders WHERE payment_gateway_charge_id = $1`, sessionID).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return orderID, err
+}
+
+// WriteOrders turns a paid payment session into an order with its tickets and returns
+// the order ID. A cart becomes one order whose lines and tickets each name their
+// event. The order, its tickets, the sold stock and the promo redemption are
+// written in one transaction, so a failure leaves nothing behind and is reported as
+// a *FulfillmentError. It is idempotent: a session that was already fulfilled
+// returns its existing order, however often the provider delivers the event.
+func WriteOrders(db *sql.DB, rec Record) (string, error) {
+	fail := func(stage string, err error) (string, error) {
+		return "", &FulfillmentError{SessionID: rec.SessionID, Stage: stage, Err: err}
+	}
+
+	if orderID, err := orderForSession(db, rec.SessionID); err != nil {
+		return fail(stageLoad, err)
+	} else if orderID != "" {
+		log.Printf("Payment session %s was already fulfilled as order %s", rec.SessionID, orderID)
+		return orderID, nil
+	}
+
+	cs, err := loadCheckoutSession(db, rec.CheckoutSessionID)
 	if err != nil {
-		log.Println("Error parsing amount:", err)
-		return
+		return fail(stageLoad, fmt.Errorf("loading checkout session %s: %w", rec.CheckoutSessionID, err))
+	}
+	if cs.GatewaySessionID != "" && cs.GatewaySessionID != rec.SessionID {
+		log.Printf("FRAUD SIGNAL: payment session %s claims checkout %s, which belongs to session %s",
+			rec.SessionID, cs.ID, cs.GatewaySessionID)
+		return fail(stageRejected, errOrderRejected)
+	}
+
+	// The amount charged must match what the server priced; anything else is rejected
+	if rec.AmountPaidCents != cs.AmountTotalCents || (rec.Currency != "" && !strings.EqualFold(rec.Currency, cs.Currency)) {
+		log.Printf("FRAUD SIGNAL: payment session %s charged %s but checkout %s was priced at %s; order rejected",
+			rec.SessionID, utils.FormatAmount(rec.AmountPaidCents, rec.Currency), cs.ID, utils.FormatAmount(cs.AmountTotalCents, cs.Currency))
+		if err := setCheckoutSessionStatus(db, cs.ID, checkoutStatusAmountMismatch); err != nil {
+			log.Printf("Error flagging checkout session %s: %v", cs.ID, err)
+		}
+		// The buyer is refunded; the tickets go back on sale now rather than when the holds expire
+		releaseCheckout(db, cs.ID)
+		return fail(stageRejected, fmt.Errorf("%w: charged %d, priced %d", errOrderRejected, rec.AmountPaidCents, cs.AmountTotalCents))
 	}
-	amountCents := int64(math.Round(amountFloat * 100))
 
-	// Use the totalQuantity directly from the frontend payload
-	totalQuantity := rec.TotalQuantity
+	tx, err := db.Begin()
+	if err != nil {
+		return fail(stageOrder, err)
+	}
+	defer tx.Rollback()
+
+	// reject drops an order that can no longer be fulfilled as paid for: the rest of
+	// the checkout is given back and the buyer is refunded
+	reject := func(stage string, err error) (string, error) {
+		tx.Rollback()
+		log.Printf("Payment session %s cannot be fulfilled: %v", rec.SessionID, err)
+		releaseCheckout(db, cs.ID)
+		if err := setCheckoutSessionStatus(db, cs.ID, checkoutStatusExpired); err != nil {
+			log.Printf("Error expiring checkout session %s: %v", cs.ID, err)
+		}
+		return fail(stage, fmt.Errorf("%w: %w", errOrderRejected, err))
+	}
+
+	// Insert into orders and get order_id. A concurrent delivery of the same session
+	// loses on the unique payment_gateway_charge_id and gets the winner's order.
+	lines := cs.orderLines()
+	var vatCents int64
+	for _, l := range lines {
+		vatCents += l.VATCents
+	}
+	var buyer InvoiceBuyer
+	if cs.Buyer != nil {
+		buyer = *cs.Buyer
+	}
+
+	// Guests open their order through a magic link; only its hash is stored
+	var guestToken, guestTokenHash string
+	if cs.GuestContactID != "" {
+		if guestToken, guestTokenHash, err = guests.NewToken(); err != nil {
+			return fail(stageOrder, err)
+		}
+	}
 
-	// Insert into orders and get order_id
 	var orderID string
-	err = db.QueryRow(
-		`INSERT INTO orders (user_id, total_amount_cents, status, payment_gateway_charge_id, event_id, ticket_quantity)
-         VALUES ($1, $2, $3, $4, $5, $6)
+	err = tx.QueryRow(
+		`INSERT INTO orders (user_id, total_amount_cents, discount_cents, promo_code_id, currency, status,
+                             payment_gateway_charge_id, event_id, ticket_quantity, fees_cents, vat_cents,
+                             buyer_company_name, buyer_nip, buyer_address, guest_contact_id, guest_token_hash, resale_listing_id)
+         VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9, $10, $11, NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''),
+                 NULLIF($15, '')::uuid, NULLIF($16, ''), NULLIF($17, 0))
+         ON CONFLICT (payment_gateway_charge_id) DO NOTHING
          RETURNING id`,
-		rec.UserID, amountCents, "completed", rec.SessionID, rec.EventID, totalQuantity,
+		cs.UserID, cs.AmountTotalCents, cs.DiscountCents, cs.PromoCodeID, cs.Currency, "completed",
+		rec.SessionID, cs.EventID, cs.TotalQuantity, cs.FeesCents, vatCents,
+		buyer.CompanyName, buyer.NIP, buyer.Address, cs.GuestContactID, guestTokenHash, cs.ResaleListingID,
 	).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return orderForSession(db, rec.SessionID)
+	} else if err != nil {
+		return fail(stageOrder, err)
+	}
 
-	if err != nil {
-		fmt.Print("Error inserting order: ", err)
-		return
+	for _, l := range lines {
+		if _, err := tx.Exec(`
+			INSERT INTO order_lines (order_id, event_id, ticket_type_id, name, quantity, unit_price_cents, discount_cents,
+			                         platform_fee_cents, organizer_fee_cents, vat_rate_bps, net_cents, vat_cents, gross_cents)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			orderID, l.EventID, l.TicketTypeID, l.Name, l.Quantity, l.UnitPriceCents, l.DiscountCents,
+			l.PlatformFeeCents*int64(l.Quantity), l.OrganizerFeeCents*int64(l.Quantity),
+			l.VATRateBps, l.NetCents, l.VATCents, l.GrossCents); err != nil {
+			return fail(stageOrder, err)
+		}
+	}
+
+	// The stock was taken when the session was created; mark the holds as sold. Stock
+	// that ran out with an expired hold is not sold twice: the order is rejected, the
+	// rest of the checkout is given back and the session waits in the queue.
+	if err := inventory.Convert(tx, cs.ID); errors.Is(err, inventory.ErrStockGone) {
+		return reject(stageInventory, err)
+	} else if err != nil {
+		return fail(stageInventory, err)
+	}
+	if cs.PromoCodeID.Valid {
+		if err := promos.Confirm(tx, cs.ID, orderID); err != nil {
+			return fail(stagePromo, err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE checkout_sessions SET status = $1, updated_at = NOW() WHERE id = $2`,
+		checkoutStatusFulfilled, cs.ID); err != nil {
+		return fail(stageOrder, err)
 	}
 
 	// Store ticket details for email
 	var ticketDetails []TicketEmailData
 
-	// Insert individual tickets based on the received 'Tickets' array
-	ticketIndex := 1
-	for _, ticketSelection := range rec.Tickets {
-		for i := 0; i < ticketSelection.Quantity; i++ { // Loop for the quantity of THIS specific ticket type
+	// A resale reissues the listed ticket instead of selling new stock. The listing
+	// may have lapsed and gone to another buyer, or the seller's ticket been used or
+	// voided, while this buyer paid; either way the order is rejected.
+	ticketLines := cs.Lines
+	if cs.ResaleListingID != 0 {
+		ticketID := uuid.New().String()
+		sale, err := resale.Complete(tx, cs.ID, orderID, cs.UserID, ticketID)
+		switch {
+		case errors.Is(err, resale.ErrNotResellable):
+			tx.Rollback() // releases the listing's row lock
+			if err := resale.Withdraw(db, cs.ID); err != nil {
+				log.Printf("Error withdrawing listing %d: %v", cs.ResaleListingID, err)
+			}
+			return reject(stageResale, fmt.Errorf("reissuing listing %d: %w", cs.ResaleListingID, err))
+		case errors.Is(err, resale.ErrListingNotFound):
+			return reject(stageResale, fmt.Errorf("reissuing listing %d: %w", cs.ResaleListingID, err))
+		case err != nil:
+			return fail(stageResale, fmt.Errorf("reissuing listing %d: %w", cs.ResaleListingID, err))
+		}
+		seat, _, _, err := seating.TicketSeat(tx, ticketID)
+		if err != nil {
+			return fail(stageResale, err)
+		}
+		ticketDetails = append(ticketDetails, TicketEmailData{ID: ticketID, EventID: cs.EventID, TypeName: sale.TicketTypeName,
+			Seat: seat, QRCode: sale.QRCode})
+		ticketLines = nil
+	}
+
+	// Tickets of seated ticket types get the seats their checkout held
+	seated := make(map[int]bool)
+	for _, eventID := range cs.eventIDs() {
+		eventSeated, err := seating.SeatedTypes(tx, eventID)
+		if err != nil {
+			return fail(stageSeats, err)
+		}
+		for id := range eventSeated {
+			seated[id] = true
+		}
+	}
+	seats, err := seating.Held(tx, cs.ID)
+	if err != nil {
+		return fail(stageSeats, err)
+	}
+
+	// Insert individual tickets for every priced line of the checkout session
+	signingKeys := make(map[string]*scancodes.Key) // by event
+	for _, line := range ticketLines {
+		prices := line.ticketPrices()
+		for i := 0; i < line.Quantity; i++ { // Loop for the quantity of THIS specific ticket type
 			ticketID := uuid.New().String() // Create a new uuid for Ticket id
 
-			// Generate QR code for the ticket
-			ticketCode, err := generateTicketQRCode(ticketID)
-			if err != nil {
-				log.Printf("Error generating QR code for ticket %s: %v", ticketID, err)
-				continue // Continue to next ticket if QR generation fails
+			var seat seating.AssignedSeat
+			if seated[line.TicketTypeID] {
+				// A hold that ran out may have gone to someone else in the meantime, which
+				// rejects the order like stock that is gone
+				if len(seats[line.TicketTypeID]) == 0 {
+					return reject(stageSeats, fmt.Errorf("no seat held for ticket %d of type %d: %w", i+1, line.TicketTypeID, seating.ErrSeatTaken))
+				}
+				seat, seats[line.TicketTypeID] = seats[line.TicketTypeID][0], seats[line.TicketTypeID][1:]
 			}
 
-			_, err = db.Exec(
-				`INSERT INTO tickets (id, order_id, event_id, user_id, ticket_type_id, ticket_code)
-                 VALUES ($1, $2, $3, $4, $5, $6)`,
-				ticketID, orderID, rec.EventID, rec.UserID, ticketSelection.TicketTypeID, ticketCode,
-			)
-
+			// Sign the ticket's QR code with its event's key
+			key, ok := signingKeys[line.EventID]
+			if !ok {
+				if key, err = scancodes.ActiveKey(tx, line.EventID); err != nil {
+					return fail(stageTickets, fmt.Errorf("loading signing key of event %s: %w", line.EventID, err))
+				}
+				signingKeys[line.EventID] = key
+			}
+			code, err := key.Sign(ticketID, line.TicketTypeID, 1)
 			if err != nil {
-				fmt.Printf("Error inserting ticket (order_id: %s, type: %d, #%d): %v\n", orderID, ticketSelection.TicketTypeID, i+1, err)
-				continue // Continue to next ticket if one fails
+				return fail(stageTickets, fmt.Errorf("generating QR code for ticket %s: %w", ticketID, err))
 			}
 
-			// Get ticket type name for email
-			var ticketTypeName string
-			err = db.QueryRow("SELECT name FROM ticket_types WHERE id = $1", ticketSelection.TicketTypeID).Scan(&ticketTypeName)
+			_, err = tx.Exec(
+				`INSERT INTO tickets (id, order_id, event_id, user_id, ticket_type_id, ticket_code, price_cents, guest_contact_id, scan_code, seat_id)
+                 VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7, NULLIF($8, '')::uuid, $9, NULLIF($10, 0))`,
+				ticketID, orderID, line.EventID, cs.UserID, line.TicketTypeID, code.Image, prices[i], cs.GuestContactID, code.Value, seat.SeatID,
+			)
 			if err != nil {
-				ticketTypeName = "Standard Ticket"
+				return fail(stageTickets, fmt.Errorf("inserting ticket %d of type %d: %w", i+1, line.TicketTypeID, err))
+			}
+			if seat.SeatID != 0 {
+				if err := seating.Sell(tx, cs.ID, seat.SeatID, ticketID); errors.Is(err, seating.ErrSeatTaken) {
+					return reject(stageSeats, fmt.Errorf("selling seat %d: %w", seat.SeatID, err))
+				} else if err != nil {
+					return fail(stageSeats, fmt.Errorf("selling seat %d: %w", seat.SeatID, err))
+				}
 			}
 
 			// Add to email data
 			ticketDetails = append(ticketDetails, TicketEmailData{
 				ID:       ticketID,
-				Index:    ticketIndex,
-				TypeName: ticketTypeName,
-				QRCode:   ticketCode,
+				EventID:  line.EventID,
+				TypeName: line.Name,
+				Seat:     seat.Label,
+				QRCode:   code.Image,
 			})
-			ticketIndex++
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fail(stageCommit, err)
+	}
+
 	// Send confirmation email with tickets
-	go sendTicketConfirmationEmail(db, rec, orderID, ticketDetails, amountCents)
+	var orderURL string
+	if guestToken != "" {
+		orderURL = guests.OrderURL(guestToken)
+	}
+	go sendTicketConfirmationEmail(db, cs, orderID, orderURL, ticketDetails)
+	return orderID, nil
 }
 
 // Add these structs at the top of the file
 type TicketEmailData struct {
 	ID       string
-	Index    int
+	EventID  string
+	Index    int // number of the ticket within its event
 	TypeName string
+	Seat     string // empty for general admission
 	QRCode   string
 }
 
+// TicketEmailEvent is one event of the order with the tickets bought for it.
+type TicketEmailEvent struct {
+	Title    string
+	DateTime string
+	Location string
+	Tickets  []TicketEmailData
+}
+
 type TicketEmailTemplate struct {
-	EventTitle    string
-	EventDateTime string
-	EventLocation string
-	TotalTickets  int
-	TotalAmount   string
-	Tickets       []TicketEmailData
+	EventTitle   string // the events' titles, joined for carts
+	TotalTickets int
+	TotalAmount  string
+	OrderURL     string // magic link to the order, for guests
+	Events       []TicketEmailEvent
+}
+
+// groupTicketsByEvent loads the details of every event the tickets are for and
+// groups the tickets under them, numbered per event, in the order they were issued.
+func groupTicketsByEvent(db *sql.DB, tickets []TicketEmailData) ([]TicketEmailEvent, error) {
+	var events []TicketEmailEvent
+	index := make(map[string]int)
+	for _, t := range tickets {
+		i, ok := index[t.EventID]
+		if !ok {
+			var e TicketEmailEvent
+			err := db.QueryRow(`
+				SELECT e.title, 
+				       COALESCE(e.location_name, '') || COALESCE(', ' || e.location_address, '') as location,
+				       to_char(e.start_time, 'Day, Month DD, YYYY at HH12:MI AM') as formatted_date
+				FROM events e 
+				WHERE e.id = $1`, t.EventID).Scan(&e.Title, &e.Location, &e.DateTime)
+			if err != nil {
+				return nil, fmt.Errorf("loading event %s: %w", t.EventID, err)
+			}
+			i = len(events)
+			index[t.EventID] = i
+			events = append(events, e)
+		}
+		t.Index = len(events[i].Tickets) + 1
+		events[i].Tickets = append(events[i].Tickets, t)
+	}
+	return events, nil
 }
 
-// Add this new function
-func sendTicketConfirmationEmail(db *sql.DB, rec Record, orderID string, tickets []TicketEmailData, amountCents int64) {
-	// Get user email
+// sendTicketConfirmationEmail sends one email with all tickets of an order, grouped
+// by the event they are for.
+func sendTicketConfirmationEmail(db *sql.DB, cs *CheckoutSession, orderID, orderURL string, tickets []TicketEmailData) {
+	// Get user email, or the guest's for guest checkouts
 	var userEmail string
-	err := db.QueryRow("SELECT email FROM users WHERE id = $1", rec.UserID).Scan(&userEmail)
+	var err error
+	if cs.GuestContactID != "" {
+		err = db.QueryRow("SELECT email FROM guest_contacts WHERE id = $1", cs.GuestContactID).Scan(&userEmail)
+	} else {
+		err = db.QueryRow("SELECT email FROM users WHERE id = $1", cs.UserID).Scan(&userEmail)
+	}
 	if err != nil {
 		log.Printf("Error getting user email for order %s: %v", orderID, err)
 		return
 	}
 
 	// Get event details
-	var eventTitle, eventLocation, eventDateTime string
-	err = db.QueryRow(`
-        SELECT e.title, 
-               COALESCE(e.location_name, '') || COALESCE(', ' || e.location_address, '') as location,
-               to_char(e.start_time, 'Day, Month DD, YYYY at HH12:MI AM') as formatted_date
-        FROM events e 
-        WHERE e.id = $1`, rec.EventID).Scan(&eventTitle, &eventLocation, &eventDateTime)
+	events, err := groupTicketsByEvent(db, tickets)
 	if err != nil {
 		log.Printf("Error getting event details for order %s: %v", orderID, err)
 		return
 	}
+	titles := make([]string, 0, len(events))
+	for _, e := range events {
+		titles = append(titles, e.Title)
+	}
+	eventTitle := strings.Join(titles, ", ")
 
 	// Prepare template data
 	templateData := TicketEmailTemplate{
-		EventTitle:    eventTitle,
-		EventDateTime: eventDateTime,
-		EventLocation: eventLocation,
-		TotalTickets:  len(tickets),
-		TotalAmount:   fmt.Sprintf("%.2f PLN", float64(amountCents)/100),
-		Tickets:       tickets,
+		EventTitle:   eventTitle,
+		TotalTickets: len(tickets),
+		TotalAmount:  utils.FormatAmount(cs.AmountTotalCents, cs.Currency),
+		OrderURL:     orderURL,
+		Events:       events,
 	}
 
 	// Parse and execute template
@@ -184,7 +451,7 @@ func sendTicketConfirmationEmail(db *sql.DB, rec Record, orderID string, tickets
 	if err != nil {
 		log.Printf("Error parsing ticket email template: %v", err)
 		// Fallback to simple email
-		sendSimpleTicketEmail(userEmail, eventTitle, tickets)
+		sendSimpleTicketEmail(userEmail, eventTitle, orderURL, events)
 		return
 	}
 
@@ -192,13 +459,16 @@ func sendTicketConfirmationEmail(db *sql.DB, rec Record, orderID string, tickets
 	err = tmpl.Execute(&htmlBuffer, templateData)
 	if err != nil {
 		log.Printf("Error executing ticket email template: %v", err)
-		sendSimpleTicketEmail(userEmail, eventTitle, tickets)
+		sendSimpleTicketEmail(userEmail, eventTitle, orderURL, events)
 		return
 	}
 
 	// Send email
 	subject := fmt.Sprintf("Your TickVibe Tickets for %s", eventTitle)
 	plainText := fmt.Sprintf("Your tickets for %s are attached. Total tickets: %d. Please keep this email safe for entry to the event.", eventTitle, len(tickets))
+	if orderURL != "" {
+		plainText += " View your order at " + orderURL
+	}
 
 	err = utils.SendEmail(userEmail, subject, plainText, htmlBuffer.String())
 	if err != nil {
@@ -209,7 +479,7 @@ func sendTicketConfirmationEmail(db *sql.DB, rec Record, orderID string, tickets
 }
 
 // Fallback simple email function
-func sendSimpleTicketEmail(userEmail, eventTitle string, tickets []TicketEmailData) {
+func sendSimpleTicketEmail(userEmail, eventTitle, orderURL string, events []TicketEmailEvent) {
 	subject := fmt.Sprintf("Your TickVibe Tickets for %s", eventTitle)
 
 	var htmlContent strings.Builder
@@ -217,21 +487,40 @@ func sendSimpleTicketEmail(userEmail, eventTitle string, tickets []TicketEmailDa
         <div style="font-family: Arial, sans-serif; max-width: 600px; margin: auto;">
             <h2>🎫 Your TickVibe Tickets</h2>
             <p>Thank you for your purchase! Your tickets for <strong>%s</strong> are ready.</p>
-            <h3>Your Tickets:</h3>
-    `, eventTitle))
+    `, html.EscapeString(eventTitle)))
 
-	for _, ticket := range tickets {
+	var total int
+	for _, event := range events {
 		htmlContent.WriteString(fmt.Sprintf(`
+            <h3>%s</h3>
+            <p>%s<br>%s</p>
+        `, html.EscapeString(event.Title), html.EscapeString(event.DateTime), html.EscapeString(event.Location)))
+
+		for _, ticket := range event.Tickets {
+			var seatLine string
+			if ticket.Seat != "" {
+				seatLine = fmt.Sprintf("\n                <p><strong>Seat:</strong> %s</p>", html.EscapeString(ticket.Seat))
+			}
+			htmlContent.WriteString(fmt.Sprintf(`
             <div style="border: 1px solid #ddd; margin: 10px 0; padding: 15px; border-radius: 8px;">
                 <h4>Ticket #%d</h4>
                 <p><strong>ID:</strong> %s</p>
-                <p><strong>Type:</strong> %s</p>
+                <p><strong>Type:</strong> %s</p>%s
                 <div style="text-align: center; margin: 15px 0;">
                     <img src="data:image/png;base64,%s" alt="QR Code" width="150" height="150" style="border: 1px solid #ddd; padding: 10px;">
                     <p><small>Present this QR code at the venue entrance</small></p>
                 </div>
             </div>
-        `, ticket.Index, ticket.ID, ticket.TypeName, ticket.QRCode))
+        `, ticket.Index, ticket.ID, ticket.TypeName, seatLine, ticket.QRCode))
+			total++
+		}
+	}
+
+	if orderURL != "" {
+		htmlContent.WriteString(fmt.Sprintf(`
+            <p>You can view your order at any time through <a href="%s">this link</a>.
+               Create an account with this email address to keep all your tickets in one place.</p>
+        `, orderURL))
 	}
 
 	htmlContent.WriteString(`
@@ -241,33 +530,10 @@ func sendSimpleTicketEmail(userEmail, eventTitle string, tickets []TicketEmailDa
         </div>
     `)
 
-	plainText := fmt.Sprintf("Your tickets for %s are ready. Total tickets: %d. Please check your email for QR codes.", eventTitle, len(tickets))
+	plainText := fmt.Sprintf("Your tickets for %s are ready. Total tickets: %d. Please check your email for QR codes.", eventTitle, total)
 
 	err := utils.SendEmail(userEmail, subject, plainText, htmlContent.String())
 	if err != nil {
 		log.Printf("Error sending simple ticket email: %v", err)
 	}
 }
-
-func parseAmount(amountStr string) (float64, error) {
-	re := regexp.MustCompile(`[\d.,]+`)
-	match := re.FindString(amountStr)
-	if match == "" {
-		return 0, fmt.Errorf("no numeric amount found in %q", amountStr)
-	}
-	// Replace first comma with dot to handle European decimal comma
-	normalized := strings.Replace(match, ",", ".", 1)
-	return strconv.ParseFloat(normalized, 64)
-}
-
-// generateTicketQRCode creates a QR code PNG for the given ticket id, encodes it in base64, and returns the encoded string.
-func generateTicketQRCode(ticketID string) (string, error) {
-	// Create a QR code PNG file as byte slice; adjust size as needed (here using 256x256)
-	png, err := qrcode.Encode(ticketID, qrcode.Medium, 256)
-	if err != nil {
-		return "", err
-	}
-	// Encode the PNG data to base64
-	encoded := base64.StdEncoding.EncodeToString(png)
-	return encoded, nil
-}
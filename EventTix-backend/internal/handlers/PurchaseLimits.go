@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// LineError explains why one line of a checkout request was refused.
+type LineError struct {
+	TicketTypeID int    `json:"ticket_type_id"`
+	Quantity     int    `json:"quantity"`
+	Error        string `json:"error"`
+}
+
+type purchaseLimits struct {
+	minPerOrder    int
+	maxPerOrder    sql.NullInt64
+	maxPerCustomer sql.NullInt64
+}
+
+// checkOrderLimits validates the requested quantities against each ticket type's
+// per-order limits. It returns the merged lines and the limits it loaded, which
+// checkCustomerLimits reuses once the checkout has been saved.
+func checkOrderLimits(db *sql.DB, eventID string, lines []inventory.Line) ([]inventory.Line, map[int]purchaseLimits, []LineError, error) {
+	var lineErrors []LineError
+	for _, l := range lines {
+		if l.Quantity <= 0 {
+			lineErrors = append(lineErrors, LineError{l.TicketTypeID, l.Quantity, "quantity must be at least 1"})
+		}
+	}
+	if len(lines) == 0 {
+		lineErrors = append(lineErrors, LineError{Error: "no tickets requested"})
+	}
+	if len(lineErrors) > 0 {
+		return nil, nil, lineErrors, nil
+	}
+
+	merged := inventory.MergeLines(lines)
+	ids := make([]int, 0, len(merged))
+	for _, l := range merged {
+		ids = append(ids, l.TicketTypeID)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, min_per_order, max_per_order, max_per_customer
+		FROM ticket_types
+		WHERE event_id = $1 AND id = ANY($2)`, eventID, pq.Array(ids))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	limits := make(map[int]purchaseLimits, len(ids))
+	for rows.Next() {
+		var id int
+		var pl purchaseLimits
+		if err := rows.Scan(&id, &pl.minPerOrder, &pl.maxPerOrder, &pl.maxPerCustomer); err != nil {
+			return nil, nil, nil, err
+		}
+		limits[id] = pl
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, l := range merged {
+		pl, ok := limits[l.TicketTypeID]
+		switch {
+		case !ok:
+			lineErrors = append(lineErrors, LineError{l.TicketTypeID, l.Quantity, "invalid ticket type"})
+		case l.Quantity < pl.minPerOrder:
+			lineErrors = append(lineErrors, LineError{l.TicketTypeID, l.Quantity,
+				fmt.Sprintf("at least %d tickets per order", pl.minPerOrder)})
+		case pl.maxPerOrder.Valid && int64(l.Quantity) > pl.maxPerOrder.Int64:
+			lineErrors = append(lineErrors, LineError{l.TicketTypeID, l.Quantity,
+				fmt.Sprintf("at most %d tickets per order", pl.maxPerOrder.Int64)})
+		}
+	}
+	return merged, limits, lineErrors, nil
+}
+
+// guestLimitErrors refuses guests the ticket types that have a per-customer limit.
+// A guest is known only by an email address nobody verified, and a fresh address
+// per checkout would get round any limit.
+func guestLimitErrors(lines []inventory.Line, limits map[int]purchaseLimits) []LineError {
+	var lineErrors []LineError
+	for _, l := range lines {
+		if limits[l.TicketTypeID].maxPerCustomer.Valid {
+			lineErrors = append(lineErrors, LineError{l.TicketTypeID, l.Quantity,
+				"tickets limited per customer require logging in"})
+		}
+	}
+	return lineErrors
+}
+
+// checkCustomerLimits validates per-customer limits after the checkout was saved.
+// It counts the tickets of the customer's own orders that were not refunded, plus
+// the stock held by their open checkouts, this one included. Tickets are counted by
+// the order that bought them, so passing them on to someone else frees no room. Because every checkout reserves before it
+// counts, two concurrent checkouts always see each other and cannot both slip
+// past the limit. Guests never get this far, see guestLimitErrors.
+func checkCustomerLimits(db *sql.DB, userID string, lines []inventory.Line, limits map[int]purchaseLimits) ([]LineError, error) {
+	var ids []int
+	for _, l := range lines {
+		if limits[l.TicketTypeID].maxPerCustomer.Valid {
+			ids = append(ids, l.TicketTypeID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT ticket_type_id, SUM(quantity)
+		FROM (
+			SELECT t.ticket_type_id, 1 AS quantity
+			FROM tickets t
+			JOIN orders o ON o.id = t.order_id
+			WHERE o.user_id = $1 AND t.ticket_type_id = ANY($2) AND t.is_void = FALSE
+			UNION ALL
+			SELECT h.ticket_type_id, h.quantity
+			FROM inventory_holds h
+			JOIN checkout_sessions cs ON cs.id = h.reservation_id
+			WHERE cs.user_id = $1 AND h.ticket_type_id = ANY($2)
+			  AND h.status = $3 AND h.expires_at > NOW()
+		) owned
+		GROUP BY ticket_type_id`, userID, pq.Array(ids), inventory.StatusActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := make(map[int]int64)
+	for rows.Next() {
+		var id int
+		var n int64
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		owned[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var lineErrors []LineError
+	for _, l := range lines {
+		pl := limits[l.TicketTypeID]
+		if pl.maxPerCustomer.Valid && owned[l.TicketTypeID] > pl.maxPerCustomer.Int64 {
+			lineErrors = append(lineErrors, LineError{l.TicketTypeID, l.Quantity,
+				fmt.Sprintf("at most %d tickets per customer, %d already bought or in checkout",
+					pl.maxPerCustomer.Int64, owned[l.TicketTypeID]-int64(l.Quantity))})
+		}
+	}
+	return lineErrors, nil
+}
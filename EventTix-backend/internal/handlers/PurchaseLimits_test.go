@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/testdb"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckOrderLimitsRefusesBadQuantities(t *testing.T) {
+	// Quantities are checked before the limits are loaded
+	tests := []struct {
+		name  string
+		lines []inventory.Line
+		want  []LineError
+	}{
+		{"no lines", nil, []LineError{{Error: "no tickets requested"}}},
+		{"zero", []inventory.Line{{TicketTypeID: 1, Quantity: 0}},
+			[]LineError{{1, 0, "quantity must be at least 1"}}},
+		{"negative", []inventory.Line{{TicketTypeID: 1, Quantity: 2}, {TicketTypeID: 2, Quantity: -3}},
+			[]LineError{{2, -3, "quantity must be at least 1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, got, err := checkOrderLimits(nil, "e", tt.lines)
+			if err != nil {
+				t.Fatalf("checkOrderLimits: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("line errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOrderLimitsPerOrder(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+	if _, err := db.Exec(`UPDATE ticket_types SET min_per_order = 2, max_per_order = 4 WHERE id = $1`, typeID); err != nil {
+		t.Fatalf("setting limits: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		lines []inventory.Line
+		want  []LineError
+	}{
+		{"below minimum", []inventory.Line{{TicketTypeID: typeID, Quantity: 1}},
+			[]LineError{{typeID, 1, "at least 2 tickets per order"}}},
+		{"at minimum", []inventory.Line{{TicketTypeID: typeID, Quantity: 2}}, nil},
+		{"at maximum", []inventory.Line{{TicketTypeID: typeID, Quantity: 4}}, nil},
+		{"above maximum", []inventory.Line{{TicketTypeID: typeID, Quantity: 5}},
+			[]LineError{{typeID, 5, "at most 4 tickets per order"}}},
+		{"split lines are merged", []inventory.Line{{TicketTypeID: typeID, Quantity: 3}, {TicketTypeID: typeID, Quantity: 2}},
+			[]LineError{{typeID, 5, "at most 4 tickets per order"}}},
+		{"other event's ticket type", []inventory.Line{{TicketTypeID: typeID + 100000, Quantity: 2}},
+			[]LineError{{typeID + 100000, 2, "invalid ticket type"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, got, err := checkOrderLimits(db, eventID, tt.lines)
+			if err != nil {
+				t.Fatalf("checkOrderLimits: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("line errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomerLimitCountsTransferredTickets(t *testing.T) {
+	db := testdb.Open(t)
+	buyerID := testdb.User(t, db, "user")
+	friendID := testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+	if _, err := db.Exec(`UPDATE ticket_types SET max_per_customer = 2 WHERE id = $1`, typeID); err != nil {
+		t.Fatalf("setting limit: %v", err)
+	}
+
+	gateway := payments.NewFakeGateway("http://localhost:8080", "test-fake-secret")
+	mux := checkoutMux(db, gateway)
+	sessionID, _ := createSession(t, mux, buyerID, eventID, typeID, 2)
+	pay(t, mux, gateway, sessionID)
+	assertTickets(t, db, sessionID, buyerID, 2)
+
+	// Handing the tickets on does not make room for more
+	if _, err := db.Exec(`UPDATE tickets SET user_id = $1 WHERE event_id = $2`, friendID, eventID); err != nil {
+		t.Fatalf("transferring tickets: %v", err)
+	}
+	body := fmt.Sprintf(`{"event_id": %q, "tickets": [{"ticket_type_id": %d, "quantity": 1}]}`, eventID, typeID)
+	req := loggedIn(t, httptest.NewRequest(http.MethodPost, "/checkout/create-session", strings.NewReader(body)), buyerID)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("second checkout: status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+}
@@ -1,16 +1,29 @@
 package handlers
 
 import (
+	"TickVibe-EventTix-backend/internal/checkin"
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/refunds"
+	"TickVibe-EventTix-backend/internal/scancodes"
+	"TickVibe-EventTix-backend/internal/seating"
 	"TickVibe-EventTix-backend/internal/utils"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 // qrcodeReq represents the structure of the incoming QR code request.
 type qrcodeReq struct {
-	QRCode string `json:"img"` // Assuming the QR code string is sent in a field named 'img'
+	QRCode  string `json:"img"`     // Assuming the QR code string is sent in a field named 'img'
+	EventID string `json:"eventId"` // event the scanner is checking tickets for
 }
 
 // scanResponse defines the structure for the response sent to the frontend after scanning.
@@ -19,16 +32,47 @@ type scanResponse struct {
 	Message  string  `json:"message"`
 	TicketID *string `json:"ticketId,omitempty"` // Changed to *string to hold the UUID
 	IsUsed   *bool   `json:"isUsed,omitempty"`   // Added to indicate if the ticket is already used
+	IsVoid   *bool   `json:"isVoid,omitempty"`   // Voided (e.g. refunded) tickets must not be admitted
+	Seat     string  `json:"seat,omitempty"`     // seat the holder must take, for seated events
+	// Entries the ticket has had and has left under its type's entry policy;
+	// IsUsed is set once none are left
+	Usage           *checkin.Usage `json:"usage,omitempty"`
+	OutsideValidity bool           `json:"outsideValidity,omitempty"` // not valid at this time; Message says when it is
 }
 
 // validateRequest defines the structure for the incoming validation request.
 type validateRequest struct {
-	TicketID string `json:"ticketId"` // The UUID of the ticket to validate
+	Code     string `json:"code"`               // scan code read from the ticket's QR code
+	EventID  string `json:"eventId"`            // event the gate admits to
+	Device   string `json:"device,omitempty"`   // scanner device, for the check-in log
+	Gate     string `json:"gate,omitempty"`     // entrance the device is at
+	CheckOut bool   `json:"checkOut,omitempty"` // the holder is leaving; in/out tickets only
+}
+
+// validateResponse carries the check-in outcome; Error is set when the holder
+// must not be admitted.
+type validateResponse struct {
+	*checkin.Result
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// scanEventID parses the event a scanner request is for and checks the user may
+// scan its tickets, writing the error response if not.
+func scanEventID(w http.ResponseWriter, r *http.Request, db *sql.DB, raw string) (string, bool) {
+	eventID, err := uuid.Parse(raw)
+	if err != nil {
+		utils.WriteJSONError(w, "Invalid event ID", http.StatusBadRequest)
+		return "", false
+	}
+	return eventID.String(), authorizeScan(w, r, db, eventID.String())
 }
 
 // QrCodeScanning handles the QR code scanning logic.
-// It checks if the provided QR code (which is the ticket ID, a UUID string) exists
-// in the 'tickets' table and returns its current 'is_used' status.
+// It checks if the provided QR code (the ticket's scan code) exists in the
+// 'tickets' table and returns its current 'is_used' status. Signed codes must carry
+// a valid signature first; codes replaced since (by a transfer or a reissue) are
+// no longer found. Scanners only find tickets of the event they are assigned to.
 func QrCodeScanning(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req qrcodeReq
@@ -38,20 +82,53 @@ func QrCodeScanning(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		eventID, ok := scanEventID(w, r, db, req.EventID)
+		if !ok {
+			return
+		}
+
 		// Log the received QR code for debugging purposes.
 		fmt.Printf("Received QR Code for scanning (expected Ticket ID/UUID): %s\n", req.QRCode)
 
+		// A signed code that was altered or made up is turned away before the lookup.
+		// Tickets issued before codes were signed carry unsigned codes until reissued.
+		var claims *scancodes.Claims
+		if scancodes.IsSigned(req.QRCode) {
+			var err error
+			claims, err = scancodes.Verify(db, req.QRCode)
+			if errors.Is(err, scancodes.ErrInvalidCode) {
+				utils.WriteJSON(w, http.StatusOK, scanResponse{
+					Exists:  false,
+					Message: "Ticket code is not genuine. Do not admit.",
+				})
+				return
+			} else if err != nil {
+				log.Printf("Database error verifying QR Code %s: %v", req.QRCode, err)
+				utils.WriteJSONError(w, "Database error during QR code scan", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// SQL query to check if the ticket_id exists and retrieve its 'is_used' status.
 		// IMPORTANT: Ensure your 'ticket_id' column is of a type that can store UUID strings
 		// and 'is_used' is a BOOLEAN type.
-		query := `SELECT id, is_used FROM tickets WHERE id = $1` // Use $1 for PostgreSQL, ? for MySQL/SQLite
+		query := `SELECT id, event_id, is_used, is_void FROM tickets WHERE scan_code = $1` // Use $1 for PostgreSQL, ? for MySQL/SQLite
 
-		var foundTicketID string
-		var isUsed bool
+		var foundTicketID, ticketEventID string
+		var isUsed, isVoid bool
 		// Execute the query. QueryRow is used when you expect at most one row.
-		err := db.QueryRow(query, req.QRCode).Scan(&foundTicketID, &isUsed)
+		err := db.QueryRow(query, req.QRCode).Scan(&foundTicketID, &ticketEventID, &isUsed, &isVoid)
 
 		if err != nil {
+			if err == sql.ErrNoRows && claims != nil {
+				// Genuine, but the ticket has been given a newer code since.
+				resp := scanResponse{
+					Exists:  false,
+					Message: "This QR code has been replaced by a newer one for the same ticket. Do not admit.",
+				}
+				utils.WriteJSON(w, http.StatusOK, resp)
+				return
+			}
 			if err == sql.ErrNoRows {
 				// QR code (ticket ID/UUID) not found in the database.
 				fmt.Printf("Ticket ID '%s' from QR Code not found.\n", req.QRCode)
@@ -67,20 +144,98 @@ func QrCodeScanning(db *sql.DB) http.HandlerFunc {
 			utils.WriteJSONError(w, "Database error during QR code scan", http.StatusInternalServerError)
 			return
 		}
+		// A ticket whose refund is being paid out is void, as when checking it in
+		refunding, err := refunds.Pending(db, foundTicketID)
+		if err != nil {
+			log.Printf("Database error loading refunds of Ticket ID %s: %v", foundTicketID, err)
+			utils.WriteJSONError(w, "Database error during QR code scan", http.StatusInternalServerError)
+			return
+		}
+		isVoid = isVoid || refunding
+
+		if ticketEventID != eventID {
+			// The scanner is not assigned to the ticket's event.
+			resp := scanResponse{
+				Exists:  false,
+				Message: "Ticket is for a different event. Do not admit.",
+			}
+			utils.WriteJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		// A seated ticket is only valid for the seat the seat map has sold to it
+		seat, seatAssigned, hasSeat, err := seating.TicketSeat(db, foundTicketID)
+		if err != nil {
+			log.Printf("Database error loading seat of Ticket ID %s: %v", foundTicketID, err)
+			utils.WriteJSONError(w, "Database error during QR code scan", http.StatusInternalServerError)
+			return
+		}
+		if hasSeat && !seatAssigned && !isVoid {
+			resp := scanResponse{
+				Exists:   true,
+				Message:  "Ticket's seat assignment does not match the seat map. Do not admit.",
+				TicketID: &foundTicketID,
+				IsUsed:   &isUsed,
+				IsVoid:   &isVoid,
+				Seat:     seat,
+			}
+			utils.WriteJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		if isVoid {
+			// Refunded or otherwise voided tickets are reported but never valid for entry.
+			resp := scanResponse{
+				Exists:   true,
+				Message:  "Ticket has been voided and is not valid for entry.",
+				TicketID: &foundTicketID,
+				IsUsed:   &isUsed,
+				IsVoid:   &isVoid,
+			}
+			utils.WriteJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		// Multi-entry, unlimited and in/out tickets stay valid after their first entry
+		rules, err := checkin.TicketRules(db, foundTicketID)
+		var usage *checkin.Usage
+		if err == nil {
+			usage, err = checkin.TicketUsage(db, foundTicketID)
+		}
+		if err != nil {
+			log.Printf("Database error loading entries of Ticket ID %s: %v", foundTicketID, err)
+			utils.WriteJSONError(w, "Database error during QR code scan", http.StatusInternalServerError)
+			return
+		}
+		isUsed = usage.Exhausted()
+		message := "Ticket found successfully!"
+		outsideValidity := !rules.ValidAt(time.Now())
+		if outsideValidity {
+			message = validityMessage(rules)
+		}
 
 		// If we reach here, the ticket ID (UUID) was found.
 		fmt.Printf("Ticket ID '%s' from QR Code found. Is Used: %t\n", foundTicketID, isUsed)
 		resp := scanResponse{
-			Exists:   true,
-			Message:  "Ticket found successfully!",
-			TicketID: &foundTicketID,
-			IsUsed:   &isUsed, // Include the 'isUsed' status in the response
+			Exists:          true,
+			Message:         message,
+			TicketID:        &foundTicketID,
+			IsUsed:          &isUsed, // Include the 'isUsed' status in the response
+			IsVoid:          &isVoid,
+			Seat:            seat,
+			Usage:           usage,
+			OutsideValidity: outsideValidity,
 		}
 		utils.WriteJSON(w, http.StatusOK, resp)
 	}
 }
 
-// ValidateTicket handles the request to mark a ticket as used.
+// ValidateTicket handles the request to admit a ticket, or to check an in/out
+// ticket out. The ticket is found by its scan code, which must be genuine and
+// current as when scanning. Entries are limited by the entry policy of the ticket's type and
+// counted in the check-in log, and the response reports the entries left. Of two
+// gates scanning the same ticket at once only one uses its last entry; every scan
+// is written to the check-in log.
 func ValidateTicket(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req validateRequest
@@ -90,46 +245,107 @@ func ValidateTicket(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Log the received ticket ID for validation.
-		fmt.Printf("Received Ticket ID for validation: %s\n", req.TicketID)
+		// Log the received code for validation.
+		fmt.Printf("Received QR Code for validation: %s\n", req.Code)
 
-		// First, check the current status of the ticket.
-		var currentIsUsed bool
-		checkQuery := `SELECT is_used FROM tickets WHERE id = $1`
-		err := db.QueryRow(checkQuery, req.TicketID).Scan(&currentIsUsed)
-
-		if err != nil {
-			if err == sql.ErrNoRows {
-				// Ticket not found.
-				fmt.Printf("Validation failed: Ticket ID '%s' not found.\n", req.TicketID)
-				utils.WriteJSONError(w, fmt.Sprintf("Ticket with ID %s not found.", req.TicketID), http.StatusNotFound)
-				return
-			}
-			// Other database error.
-			fmt.Printf("Database error checking ticket status for ID %s: %v\n", req.TicketID, err)
-			utils.WriteJSONError(w, "Database error checking ticket status", http.StatusInternalServerError)
+		eventID, ok := scanEventID(w, r, db, req.EventID)
+		if !ok {
 			return
 		}
+		claims, _ := middleware.GetUserFromContext(r)
 
-		if currentIsUsed {
-			// Ticket is already used.
-			fmt.Printf("Validation failed: Ticket ID '%s' is already used.\n", req.TicketID)
-			utils.WriteJSONError(w, "Ticket is already used.", http.StatusConflict) // 409 Conflict is appropriate
-			return
+		scan := checkin.Scan{
+			Code:      req.Code,
+			EventID:   eventID,
+			ScannerID: claims.UserID,
+			Device:    strings.TrimSpace(req.Device),
+			Gate:      strings.TrimSpace(req.Gate),
+			CheckOut:  req.CheckOut,
 		}
 
-		// If the ticket exists and is not used, proceed to update its status.
-		updateQuery := `UPDATE tickets SET is_used = TRUE WHERE id = $1`
-		_, err = db.Exec(updateQuery, req.TicketID)
-
-		if err != nil {
-			fmt.Printf("Database error updating ticket status for ID %s: %v\n", req.TicketID, err)
+		result, err := checkin.CheckIn(db, scan)
+		if errors.Is(err, checkin.ErrTicketNotFound) {
+			fmt.Printf("Validation failed: QR Code '%s' not found.\n", req.Code)
+			utils.WriteJSONError(w, "Ticket not found. Do not admit.", http.StatusNotFound)
+			return
+		} else if errors.Is(err, checkin.ErrInvalidCode) {
+			utils.WriteJSONError(w, "Ticket code is not genuine. Do not admit.", http.StatusConflict)
+			return
+		} else if errors.Is(err, checkin.ErrCodeReplaced) {
+			utils.WriteJSONError(w, "This QR code has been replaced by a newer one for the same ticket. Do not admit.", http.StatusConflict)
+			return
+		} else if errors.Is(err, checkin.ErrCheckOutNotAllowed) {
+			utils.WriteJSONError(w, "This ticket admits its holder without check-out scans.", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Database error checking in QR Code %s: %v", req.Code, err)
 			utils.WriteJSONError(w, "Database error updating ticket status", http.StatusInternalServerError)
 			return
 		}
 
-		// Ticket successfully validated.
-		fmt.Printf("Ticket ID '%s' successfully validated (marked as used).\n", req.TicketID)
-		utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Ticket validated successfully!"})
+		resp := validateResponse{Result: result}
+		status := http.StatusConflict // 409 Conflict for every scan that is turned away
+		switch result.Outcome {
+		case checkin.OutcomeAdmitted:
+			status = http.StatusOK
+			resp.Message = "Ticket validated successfully!"
+			if u := result.Usage; u.Policy == models.PolicyMulti {
+				resp.Message += fmt.Sprintf(" %d of %d entries left.", *u.EntriesLeft, u.EntriesUsed+*u.EntriesLeft)
+			} else if u.Policy == models.PolicyInOut {
+				resp.Message += " Scan the ticket out when the holder leaves to allow re-entry."
+			}
+		case checkin.OutcomeCheckedOut:
+			status = http.StatusOK
+			resp.Message = "Ticket checked out. The holder can re-enter with the same ticket."
+		case checkin.OutcomeDuplicate:
+			resp.Error = "Ticket is already used."
+			if u := result.Usage; u.Policy == models.PolicyMulti {
+				resp.Error = fmt.Sprintf("All %d entries of this ticket have been used.", u.EntriesUsed)
+			} else if u.Policy == models.PolicyInOut {
+				resp.Error = "Ticket is already inside and has not been checked out."
+			}
+			if e := result.FirstEntry; e != nil {
+				at := e.ScannedAt.Local().Format("15:04:05 on 2 Jan 2006")
+				if result.Usage.Policy == models.PolicySingle {
+					resp.Error = fmt.Sprintf("Ticket was already used at %s", at)
+				} else {
+					resp.Error += fmt.Sprintf(" Last entry at %s", at)
+				}
+				if e.Gate != "" {
+					resp.Error += fmt.Sprintf(" at gate %s", e.Gate)
+				}
+				resp.Error += "."
+			}
+		case checkin.OutcomeNotInside:
+			resp.Error = "Ticket is not checked in, so it cannot be checked out."
+		case checkin.OutcomeOutsideValidity:
+			rules, err := checkin.TicketRules(db, result.TicketID)
+			if err != nil {
+				log.Printf("Database error loading entry rules of Ticket ID %s: %v", result.TicketID, err)
+			}
+			resp.Error = validityMessage(rules)
+		case checkin.OutcomeVoid:
+			resp.Error = "Ticket has been voided."
+		case checkin.OutcomeWrongEvent:
+			resp.Error = "Ticket is for a different event."
+		case checkin.OutcomeWrongSeat:
+			resp.Error = "Ticket's seat assignment does not match the seat map."
+		}
+		utils.WriteJSON(w, status, resp)
+	}
+}
+
+// validityMessage tells door staff when a ticket outside its validity dates is valid.
+func validityMessage(rules models.EntryRules) string {
+	const layout = "15:04 on 2 Jan 2006"
+	switch {
+	case rules.ValidFrom != nil && rules.ValidUntil != nil:
+		return fmt.Sprintf("Ticket is only valid from %s until %s. Do not admit.",
+			rules.ValidFrom.Local().Format(layout), rules.ValidUntil.Local().Format(layout))
+	case rules.ValidFrom != nil:
+		return fmt.Sprintf("Ticket is not valid before %s. Do not admit.", rules.ValidFrom.Local().Format(layout))
+	case rules.ValidUntil != nil:
+		return fmt.Sprintf("Ticket was only valid until %s. Do not admit.", rules.ValidUntil.Local().Format(layout))
 	}
+	return "Ticket is not valid at this time. Do not admit."
 }
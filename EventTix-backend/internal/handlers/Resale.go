@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/resale"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type listTicketRequest struct {
+	PriceCents int64 `json:"price_cents"`
+}
+
+// ListTicketForResaleHandler puts one of the user's tickets up for resale at a price
+// of at most its face value plus the event's resale cap.
+func ListTicketForResaleHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ticketID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid ticket ID", http.StatusBadRequest)
+			return
+		}
+
+		var req listTicketRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSONError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		listing, err := resale.List(db, ticketID.String(), claims.UserID, req.PriceCents)
+		switch {
+		case errors.Is(err, resale.ErrTicketNotFound):
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, resale.ErrInvalidPrice), errors.Is(err, resale.ErrPriceAboveCap):
+			utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, resale.ErrResaleDisabled), errors.Is(err, resale.ErrNotResellable),
+			errors.Is(err, resale.ErrAlreadyListed), errors.Is(err, resale.ErrTransferPending):
+			utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Printf("Error listing ticket %s for resale: %v", ticketID, err)
+			utils.WriteJSONError(w, "Failed to list ticket", http.StatusInternalServerError)
+		default:
+			utils.WriteJSON(w, http.StatusCreated, listing)
+		}
+	}
+}
+
+// DelistTicketHandler takes one of the user's tickets off the resale market. A
+// listing someone is paying for right now cannot be withdrawn.
+func DelistTicketHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ticketID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid ticket ID", http.StatusBadRequest)
+			return
+		}
+
+		err = resale.Cancel(db, ticketID.String(), claims.UserID)
+		switch {
+		case errors.Is(err, resale.ErrListingNotFound):
+			utils.WriteJSONError(w, "This ticket is not listed for resale", http.StatusNotFound)
+		case errors.Is(err, resale.ErrListingReserved):
+			utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Printf("Error delisting ticket %s: %v", ticketID, err)
+			utils.WriteJSONError(w, "Failed to delist ticket", http.StatusInternalServerError)
+		default:
+			utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Ticket taken off the resale market"})
+		}
+	}
+}
+
+// EventResaleListingsHandler lists the tickets of a published event that can be
+// bought from other fans, cheapest first.
+func EventResaleListingsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var eventID string
+		err := db.QueryRow(`SELECT id FROM events WHERE slug = $1 AND is_published = TRUE`, r.PathValue("slug")).Scan(&eventID)
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "Event not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error looking up event for resale:", err)
+			utils.WriteJSONError(w, "Failed to load resale listings", http.StatusInternalServerError)
+			return
+		}
+
+		listings, err := resale.ForEvent(db, eventID)
+		if err != nil {
+			log.Printf("Error loading resale listings of event %s: %v", eventID, err)
+			utils.WriteJSONError(w, "Failed to load resale listings", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, listings)
+	}
+}
+
+// ResaleCheckoutHandler reserves a resale listing for the user and opens a payment
+// session for it. The payment is fulfilled like any other checkout, which is where
+// the ticket changes hands.
+func ResaleCheckoutHandler(db *sql.DB, gateway payments.PaymentGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		listingID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid listing ID", http.StatusBadRequest)
+			return
+		}
+
+		checkoutID := uuid.NewString()
+		expiresAt := time.Now().Add(checkoutSessionTTL)
+
+		listing, err := resale.Reserve(db, listingID, claims.UserID, checkoutID, expiresAt.Add(holdGracePeriod))
+		switch {
+		case errors.Is(err, resale.ErrListingNotFound):
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, resale.ErrOwnListing):
+			utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, resale.ErrListingReserved):
+			utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("Error reserving resale listing %d: %v", listingID, err)
+			utils.WriteJSONError(w, "Could not create checkout session", http.StatusInternalServerError)
+			return
+		}
+
+		// A resale is one ticket at the seller's price; no service fees or promo codes apply
+		cs := &CheckoutSession{
+			ID:               checkoutID,
+			UserID:           claims.UserID,
+			EventID:          listing.EventID,
+			AmountTotalCents: listing.PriceCents,
+			Currency:         listing.Currency,
+			TotalQuantity:    1,
+			Status:           checkoutStatusOpen,
+			ResaleListingID:  listing.ID,
+			Lines: []CheckoutLine{{
+				EventID:        listing.EventID,
+				TicketTypeID:   listing.TicketTypeID,
+				Name:           listing.TicketTypeName + " (resale)",
+				Quantity:       1,
+				UnitPriceCents: listing.PriceCents,
+				VATRateBps:     listing.VATRateBps,
+			}},
+		}
+		if err := saveCheckoutSession(db, cs); err != nil {
+			log.Println("Error saving checkout session:", err)
+			releaseCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Could not create checkout session", http.StatusInternalServerError)
+			return
+		}
+
+		s, err := openPaymentSession(db, gateway, cs, "", expiresAt)
+		if err != nil {
+			log.Printf("Payment provider %s error: %v", gateway.Name(), err)
+			abandonCheckout(db, cs.ID)
+			utils.WriteJSONError(w, "Could not create payment session", http.StatusInternalServerError)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, map[string]string{
+			"url":            s.URL,
+			"transaction_id": s.ID,
+		})
+	}
+}
+
+// ResaleEarningsHandler lists what the user has sold on the resale market and
+// what they were or will be paid out for it.
+func ResaleEarningsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		entries, err := resale.Ledger(db, claims.UserID)
+		if err != nil {
+			log.Printf("Error loading resale earnings of user %s: %v", claims.UserID, err)
+			utils.WriteJSONError(w, "Failed to load resale earnings", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/resale"
+	"TickVibe-EventTix-backend/internal/testdb"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// listedTicket buys a ticket for a seller and lists it for resale. It returns the
+// mux serving the checkout routes, the gateway behind them and the listing.
+func listedTicket(t *testing.T, db *sql.DB) (*http.ServeMux, *payments.FakeGateway, *resale.Listing) {
+	t.Helper()
+	sellerID := testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	if _, err := db.Exec(`UPDATE events SET transfers_enabled = TRUE, resale_cap_percent = 120 WHERE id = $1`, eventID); err != nil {
+		t.Fatalf("enabling resale: %v", err)
+	}
+	typeID := testdb.TicketType(t, db, eventID, 10, 2500)
+
+	gateway := payments.NewFakeGateway("http://localhost:8080", "test-fake-secret")
+	mux := checkoutMux(db, gateway)
+	mux.HandleFunc("POST /api/resale/listings/{id}/checkout", middleware.RequireAuth(ResaleCheckoutHandler(db, gateway)))
+	sessionID, _ := createSession(t, mux, sellerID, eventID, typeID, 1)
+	pay(t, mux, gateway, sessionID)
+
+	var ticketID string
+	if err := db.QueryRow(`SELECT id FROM tickets WHERE event_id = $1 AND user_id = $2`, eventID, sellerID).Scan(&ticketID); err != nil {
+		t.Fatalf("finding the seller's ticket: %v", err)
+	}
+	listing, err := resale.List(db, ticketID, sellerID, 2500)
+	if err != nil {
+		t.Fatalf("listing the ticket: %v", err)
+	}
+	return mux, gateway, listing
+}
+
+// buyListing opens a resale checkout for a buyer and returns its payment session ID.
+func buyListing(t *testing.T, mux http.Handler, listingID int64, buyerID string) string {
+	t.Helper()
+	req := loggedIn(t, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/resale/listings/%d/checkout", listingID), nil), buyerID)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("resale checkout: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp struct {
+		TransactionID string `json:"transaction_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding resale checkout response: %v", err)
+	}
+	return resp.TransactionID
+}
+
+// assertRefunded checks that a paid session got no order and was refunded.
+func assertRefunded(t *testing.T, db *sql.DB, sessionID string) {
+	t.Helper()
+	if orderID, err := orderForSession(db, sessionID); err != nil || orderID != "" {
+		t.Errorf("session %s was fulfilled as order %q (%v), want it rejected", sessionID, orderID, err)
+	}
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM fulfillment_failures WHERE gateway_session_id = $1 AND status = $2`,
+		sessionID, FulfillmentRefunded); n != 1 {
+		t.Errorf("session %s was not refunded", sessionID)
+	}
+}
+
+func TestResaleRejectsLapsedListing(t *testing.T) {
+	db := testdb.Open(t)
+	mux, gateway, listing := listedTicket(t, db)
+	buyerID := testdb.User(t, db, "user")
+	sessionID := buyListing(t, mux, listing.ID, buyerID)
+
+	// The buyer's reservation runs out and someone else reserves the listing before the payment arrives
+	if _, err := db.Exec(`UPDATE resale_listings SET reserved_until = NOW() - INTERVAL '1 second' WHERE id = $1`, listing.ID); err != nil {
+		t.Fatalf("lapsing reservation: %v", err)
+	}
+	otherCheckout := uuid.NewString()
+	if _, err := resale.Reserve(db, listing.ID, testdb.User(t, db, "user"), otherCheckout, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("reserving for another buyer: %v", err)
+	}
+
+	pay(t, mux, gateway, sessionID)
+	assertRefunded(t, db, sessionID)
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM resale_listings WHERE id = $1 AND status = $2 AND checkout_session_id = $3`,
+		listing.ID, resale.StatusReserved, otherCheckout); n != 1 {
+		t.Errorf("the other buyer lost their reservation")
+	}
+}
+
+func TestResaleRejectsTicketNoLongerResellable(t *testing.T) {
+	db := testdb.Open(t)
+	mux, gateway, listing := listedTicket(t, db)
+	sessionID := buyListing(t, mux, listing.ID, testdb.User(t, db, "user"))
+
+	// The seller gets in with the ticket while the buyer pays
+	if _, err := db.Exec(`UPDATE tickets SET is_used = TRUE WHERE id = $1`, listing.TicketID); err != nil {
+		t.Fatalf("using the ticket: %v", err)
+	}
+
+	pay(t, mux, gateway, sessionID)
+	assertRefunded(t, db, sessionID)
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM resale_listings WHERE id = $1 AND status = $2`,
+		listing.ID, resale.StatusCancelled); n != 1 {
+		t.Errorf("the listing of a used ticket is still on the market")
+	}
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM tickets WHERE id = $1 AND is_used AND NOT is_void`, listing.TicketID); n != 1 {
+		t.Errorf("the seller's ticket was changed")
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/checkin"
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type batchScansRequest struct {
+	Device string `json:"device"`
+	Scans  []struct {
+		ClientID  string    `json:"client_id"` // the device's ID of the scan
+		Code      string    `json:"code"`      // scan code read from the ticket's QR code
+		ScannedAt time.Time `json:"scanned_at"`
+		Gate      string    `json:"gate"`
+		CheckOut  bool      `json:"check_out,omitempty"` // in/out tickets only
+	} `json:"scans"`
+}
+
+// ScannerManifestHandler returns the signed manifest of an event's tickets, for a
+// device to keep scanning when it loses its connection.
+func ScannerManifestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := scanEventID(w, r, db, r.PathValue("id"))
+		if !ok {
+			return
+		}
+
+		manifest, err := checkin.EventManifest(db, eventID)
+		if err != nil {
+			log.Printf("Error building scanner manifest of event %s: %v", eventID, err)
+			utils.WriteJSONError(w, "Failed to build manifest", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, manifest)
+	}
+}
+
+// ScannerBatchScansHandler takes the scans a device made offline. Each names the
+// scanned code, which is checked as when scanning online. The earliest scan of a
+// single-entry ticket admits it, whatever order devices upload in; the outcome of
+// every scan is reported back, with the first entry of duplicates.
+func ScannerBatchScansHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := scanEventID(w, r, db, r.PathValue("id"))
+		if !ok {
+			return
+		}
+		claims, _ := middleware.GetUserFromContext(r)
+
+		var req batchScansRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		device := strings.TrimSpace(req.Device)
+		if device == "" {
+			utils.WriteJSONError(w, "device is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Scans) > checkin.MaxBatch {
+			utils.WriteJSONError(w, fmt.Sprintf("Upload at most %d scans at once", checkin.MaxBatch), http.StatusBadRequest)
+			return
+		}
+
+		scans := make([]checkin.Scan, len(req.Scans))
+		for i, s := range req.Scans {
+			scans[i] = checkin.Scan{
+				Code:      s.Code,
+				EventID:   eventID,
+				ScannerID: claims.UserID,
+				Device:    device,
+				Gate:      strings.TrimSpace(s.Gate),
+				ScannedAt: s.ScannedAt,
+				ClientID:  s.ClientID,
+				CheckOut:  s.CheckOut,
+			}
+		}
+
+		results, err := checkin.Sync(db, scans)
+		if errors.Is(err, checkin.ErrInvalidBatch) {
+			utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error syncing scans of device %s for event %s: %v", device, eventID, err)
+			utils.WriteJSONError(w, "Failed to sync scans", http.StatusInternalServerError)
+			return
+		}
+
+		outcomes := make(map[string]int)
+		for _, result := range results {
+			outcomes[result.Outcome]++
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"results":  results,
+			"outcomes": outcomes, // number of scans per outcome
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/seating"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// EventSeatMapHandler serves the seat map of a published seated event with the
+// ticket type and status of every seat.
+func EventSeatMapHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var eventID string
+		err := db.QueryRow(`SELECT id FROM events WHERE slug = $1 AND is_published = TRUE`, r.PathValue("slug")).Scan(&eventID)
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "Event not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error looking up event for seat map:", err)
+			utils.WriteJSONError(w, "Failed to load seat map", http.StatusInternalServerError)
+			return
+		}
+
+		venue, err := seating.Map(db, eventID)
+		if errors.Is(err, seating.ErrNotSeated) {
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading seat map of event %s: %v", eventID, err)
+			utils.WriteJSONError(w, "Failed to load seat map", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, venue)
+	}
+}
+
+// seatLines adds the seats picked in checkout to the requested lines, one line per
+// ticket type they are sold as. Seated ticket types can only be bought by seat.
+func seatLines(db *sql.DB, eventID string, lines []inventory.Line, seatIDs []int64) ([]inventory.Line, error) {
+	seated, err := seating.SeatedTypes(db, eventID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if seated[l.TicketTypeID] {
+			return nil, seating.ErrSeatsRequired
+		}
+	}
+	if len(seatIDs) == 0 {
+		return lines, nil
+	}
+
+	counts, err := seating.Count(db, eventID, seatIDs)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		lines = append(lines, inventory.Line{TicketTypeID: id, Quantity: counts[id]})
+	}
+	return lines, nil
+}
+
+// holdSeats holds the picked seats for a reservation whose stock was just taken.
+// On failure the reservation is released and the error answered.
+func holdSeats(w http.ResponseWriter, db *sql.DB, eventID, reservationID string, seatIDs []int64, until time.Time) bool {
+	if len(seatIDs) == 0 {
+		return true
+	}
+	err := seating.Hold(db, eventID, reservationID, seatIDs, until)
+	if err == nil {
+		return true
+	}
+	releaseCheckout(db, reservationID)
+	writeSeatError(w, err)
+	return false
+}
+
+// writeSeatError answers a checkout request whose seats could not be used.
+func writeSeatError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, seating.ErrSeatsRequired), errors.Is(err, seating.ErrInvalidSeats):
+		utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, seating.ErrSeatTaken):
+		utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+	default:
+		log.Println("Seat selection error:", err)
+		utils.WriteJSONError(w, "Could not reserve seats", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/staff"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// StaffInvitationHandler shows the invitation behind a door staff link, so the
+// recipient can see which event it is for before logging in.
+func StaffInvitationHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invitation, err := staff.Preview(db, r.PathValue("token"))
+		if errors.Is(err, staff.ErrInvitationNotFound) {
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error loading staff invitation:", err)
+			utils.WriteJSONError(w, "Failed to load invitation", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, invitation)
+	}
+}
+
+// AcceptStaffInvitationHandler assigns the logged-in user to the event of a door
+// staff link. The account keeps its role; the assignment alone lets it scan the
+// event during the invitation's window.
+func AcceptStaffInvitationHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		assignment, err := staff.Accept(db, r.PathValue("token"), claims.UserID, claims.Email)
+		switch {
+		case errors.Is(err, staff.ErrInvitationNotFound):
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, staff.ErrWrongAccount):
+			utils.WriteJSONError(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			log.Println("Error accepting staff invitation:", err)
+			utils.WriteJSONError(w, "Failed to accept invitation", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, assignment)
+	}
+}
+
+// ScannerEventsHandler lists the events the user may open the scanner for.
+func ScannerEventsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		events, err := staff.ScannerEvents(db, claims)
+		if err != nil {
+			log.Println("Error listing scanner events:", err)
+			utils.WriteJSONError(w, "Failed to load events", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, events)
+	}
+}
+
+// authorizeScan checks that the user may scan tickets of the event a scanner
+// request is for, and writes the error response if not.
+func authorizeScan(w http.ResponseWriter, r *http.Request, db *sql.DB, eventID string) bool {
+	claims, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	allowed, err := staff.CanScan(db, claims, eventID)
+	if err != nil {
+		log.Printf("Error checking scanner access of user %s to event %s: %v", claims.UserID, eventID, err)
+		utils.WriteJSONError(w, "Failed to check scanner access", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		utils.WriteJSONError(w, "You are not assigned to scan tickets of this event at this time", http.StatusForbidden)
+		return false
+	}
+	return true
+}
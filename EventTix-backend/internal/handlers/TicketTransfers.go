@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/transfers"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type transferTicketRequest struct {
+	Email string `json:"email"`
+}
+
+// TransferTicketHandler offers one of the user's tickets to an email address and
+// emails the recipient a link to accept it. A new offer replaces an open one.
+func TransferTicketHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ticketID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid ticket ID", http.StatusBadRequest)
+			return
+		}
+
+		var req transferTicketRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSONError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		transfer, token, err := transfers.Offer(db, ticketID.String(), claims.UserID, req.Email)
+		switch {
+		case errors.Is(err, transfers.ErrTicketNotFound):
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, transfers.ErrInvalidRecipient), errors.Is(err, transfers.ErrSelfTransfer):
+			utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, transfers.ErrTransfersDisabled), errors.Is(err, transfers.ErrNotTransferable),
+			errors.Is(err, transfers.ErrListedForResale):
+			utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Printf("Error offering ticket %s: %v", ticketID, err)
+			utils.WriteJSONError(w, "Failed to transfer ticket", http.StatusInternalServerError)
+		default:
+			go sendTransferEmail(transfer, token)
+			utils.WriteJSON(w, http.StatusCreated, transfer)
+		}
+	}
+}
+
+// CancelTicketTransferHandler withdraws the open transfer of one of the user's tickets.
+func CancelTicketTransferHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ticketID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid ticket ID", http.StatusBadRequest)
+			return
+		}
+
+		err = transfers.Cancel(db, ticketID.String(), claims.UserID)
+		if errors.Is(err, transfers.ErrTransferNotFound) {
+			utils.WriteJSONError(w, "No open transfer for this ticket", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error cancelling transfer of ticket %s: %v", ticketID, err)
+			utils.WriteJSONError(w, "Failed to cancel transfer", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Transfer cancelled"})
+	}
+}
+
+// TicketTransferHandler shows the recipient of a transfer link what they are
+// being offered.
+func TicketTransferHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transfer, err := transfers.Preview(db, r.PathValue("token"))
+		if errors.Is(err, transfers.ErrTransferNotFound) {
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error loading ticket transfer:", err)
+			utils.WriteJSONError(w, "Failed to load transfer", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, transfer)
+	}
+}
+
+// AcceptTicketTransferHandler moves the ticket of a transfer link into the account of
+// the logged-in user it was sent to. The ticket gets a new QR code; the one the
+// sender had stops working.
+func AcceptTicketTransferHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ticketID, err := transfers.Accept(db, r.PathValue("token"), claims.UserID, claims.Email)
+		switch {
+		case errors.Is(err, transfers.ErrTransferNotFound):
+			utils.WriteJSONError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, transfers.ErrSelfTransfer):
+			utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, transfers.ErrWrongAccount):
+			utils.WriteJSONError(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, transfers.ErrNotTransferable):
+			utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Println("Error accepting ticket transfer:", err)
+			utils.WriteJSONError(w, "Failed to accept transfer", http.StatusInternalServerError)
+		default:
+			utils.WriteJSON(w, http.StatusOK, map[string]string{
+				"message":   "The ticket is now in your account",
+				"ticket_id": ticketID,
+			})
+		}
+	}
+}
+
+// TicketHistoryHandler lists the changes of a ticket's owner to its current holder,
+// the event's creator and admins.
+func TicketHistoryHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			utils.WriteJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ticketID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid ticket ID", http.StatusBadRequest)
+			return
+		}
+
+		var holderID sql.NullString
+		var creatorID string
+		err = db.QueryRow(`
+			SELECT t.user_id, e.creator_id
+			FROM tickets t
+			JOIN events e ON e.id = t.event_id
+			WHERE t.id = $1`, ticketID).Scan(&holderID, &creatorID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println("Error loading ticket:", err)
+			utils.WriteJSONError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if err == sql.ErrNoRows || (holderID.String != claims.UserID && creatorID != claims.UserID && claims.Role != "admin") {
+			utils.WriteJSONError(w, "Ticket not found", http.StatusNotFound)
+			return
+		}
+
+		history, err := transfers.History(db, ticketID.String())
+		if err != nil {
+			log.Printf("Error loading history of ticket %s: %v", ticketID, err)
+			utils.WriteJSONError(w, "Failed to load ticket history", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, history)
+	}
+}
+
+// sendTransferEmail emails the recipient of a transfer the link to accept it.
+func sendTransferEmail(t *transfers.Transfer, token string) {
+	url := transfers.AcceptURL(token)
+	subject := fmt.Sprintf("%s sent you a ticket for %s", t.FromName, t.EventTitle)
+	body := fmt.Sprintf(`<div style="font-family: Arial, sans-serif; max-width: 600px; margin: auto;">
+            <h2>You've been sent a ticket</h2>
+            <p>%s wants to give you a %s ticket for <strong>%s</strong>.</p>
+            <p><a href="%s">Accept the ticket</a> before %s. You'll need to log in or create an account.</p>
+        </div>`,
+		html.EscapeString(t.FromName), html.EscapeString(t.TicketTypeName), html.EscapeString(t.EventTitle),
+		url, t.ExpiresAt.Format("2006-01-02 15:04 MST"))
+	plain := fmt.Sprintf("%s wants to give you a %s ticket for %s. Accept it before %s: %s",
+		t.FromName, t.TicketTypeName, t.EventTitle, t.ExpiresAt.Format("2006-01-02 15:04 MST"), url)
+
+	if err := utils.SendEmail(t.ToEmail, subject, plain, body); err != nil {
+		log.Printf("Error sending transfer email for ticket %s: %v", t.TicketID, err)
+	}
+}
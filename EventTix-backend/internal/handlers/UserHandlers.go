@@ -3,9 +3,13 @@ package handlers
 import (
 	"TickVibe-EventTix-backend/internal/middleware"
 	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/refunds"
+	"TickVibe-EventTix-backend/internal/resale"
+	"TickVibe-EventTix-backend/internal/seating"
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 )
 
 func UserTicketsHandler(db *sql.DB) http.HandlerFunc {
@@ -19,11 +23,19 @@ func UserTicketsHandler(db *sql.DB) http.HandlerFunc {
 		log.Printf("User claims: %+v\n", claims)
 
 		query := `
-			SELECT t.id, t.order_id, t.ticket_type_id, t.ticket_code, t.is_used, t.created_at,
-			       e.title AS event_title, tt.name AS ticket_type_name
+			SELECT t.id, t.order_id, t.ticket_type_id, t.ticket_code, t.is_used, t.is_void, t.created_at,
+			       e.title AS event_title, tt.name AS ticket_type_name, e.id, e.start_time,
+			       e.transfers_enabled, tr.to_email,
+			       o.user_id IS NOT DISTINCT FROM t.user_id AND o.resale_listing_id IS NULL AS is_buyer,
+			       COALESCE(t.face_value_cents, t.price_cents), e.resale_cap_percent,
+			       vs.name, s.row_label, s.seat_number
 			FROM tickets t
 			JOIN events e ON t.event_id = e.id
 			JOIN ticket_types tt ON t.ticket_type_id = tt.id
+			JOIN orders o ON t.order_id = o.id
+			LEFT JOIN venue_seats s ON s.id = t.seat_id
+			LEFT JOIN venue_sections vs ON vs.id = s.section_id
+			LEFT JOIN ticket_transfers tr ON tr.ticket_id = t.id AND tr.status = 'pending' AND tr.expires_at > NOW()
 			WHERE t.user_id = $1
 			ORDER BY t.created_at DESC
 		`
@@ -39,16 +51,53 @@ func UserTicketsHandler(db *sql.DB) http.HandlerFunc {
 		var tickets []models.UserTicketInfo
 		for rows.Next() {
 			var t models.UserTicketInfo
+			var section, row, number sql.NullString
 			if err := rows.Scan(
-				&t.ID, &t.OrderID, &t.TicketTypeID, &t.Code, &t.Status,
-				&t.CreatedAt, &t.EventTitle, &t.TicketTypeName,
+				&t.ID, &t.OrderID, &t.TicketTypeID, &t.Code, &t.Status, &t.IsVoid,
+				&t.CreatedAt, &t.EventTitle, &t.TicketTypeName, &t.EventID, &t.EventStart,
+				&t.TransfersEnabled, &t.TransferTo, &t.IsBuyer, &t.FaceValueCents, &t.ResaleCapPercent,
+				&section, &row, &number,
 			); err != nil {
 				log.Println("Scan error:", err)
 				continue
 			}
+			if section.Valid {
+				t.Seat = seating.Label(section.String, row.String, number.String)
+			}
 			tickets = append(tickets, t)
 		}
 
+		// Tell the tickets view what cancelling would refund under each event's policy;
+		// tickets received in a transfer or bought on resale cannot be cancelled
+		eventIDs := make([]string, 0, len(tickets))
+		for _, t := range tickets {
+			eventIDs = append(eventIDs, t.EventID)
+		}
+		policies, err := refunds.LoadPolicies(db, eventIDs)
+		if err != nil {
+			log.Println("Error loading refund policies:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		listed, err := resale.Listed(db, claims.UserID)
+		if err != nil {
+			log.Println("Error loading resale listings:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		for i := range tickets {
+			if !tickets[i].IsVoid && !tickets[i].Status && tickets[i].IsBuyer {
+				tickets[i].RefundPercent = refunds.PercentAt(policies[tickets[i].EventID], tickets[i].EventStart, now)
+			}
+			if tickets[i].TransfersEnabled {
+				tickets[i].ResaleMaxCents = resale.MaxPriceCents(tickets[i].FaceValueCents, tickets[i].ResaleCapPercent)
+			}
+			if l, ok := listed[tickets[i].ID.String()]; ok {
+				tickets[i].ListedPriceCents = &l.PriceCents
+			}
+		}
+
 		respondWithJSON(w, http.StatusOK, tickets)
 	}
 }
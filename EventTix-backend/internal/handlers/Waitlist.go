@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/inventory"
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/seating"
+	"TickVibe-EventTix-backend/internal/utils"
+	"TickVibe-EventTix-backend/internal/waitlist"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// waitlistOfferTTL is how long a waitlist offer holds its tickets before they go
+// to the next person in line.
+const waitlistOfferTTL = 12 * time.Hour
+
+// offerMu keeps concurrent triggers from offering the same stock twice over.
+var offerMu sync.Mutex
+
+type joinWaitlistRequest struct {
+	TicketTypeID int `json:"ticket_type_id"`
+	Quantity     int `json:"quantity"`
+}
+
+// JoinWaitlistHandler puts the user in line for a sold-out ticket type of an event.
+func JoinWaitlistHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req joinWaitlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteJSONError(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if req.Quantity == 0 {
+			req.Quantity = 1
+		}
+
+		var eventID string
+		err := db.QueryRow(`SELECT id FROM events WHERE slug = $1 AND is_published = TRUE`, r.PathValue("slug")).Scan(&eventID)
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "Event not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("Error looking up event for waitlist:", err)
+			utils.WriteJSONError(w, "Could not join waitlist", http.StatusInternalServerError)
+			return
+		}
+
+		// Offers hand out stock, not seats; seated ticket types are bought by seat only
+		seated, err := seating.SeatedTypes(db, eventID)
+		if err != nil {
+			log.Println("Error loading seated ticket types:", err)
+			utils.WriteJSONError(w, "Could not join waitlist", http.StatusInternalServerError)
+			return
+		}
+		if seated[req.TicketTypeID] {
+			utils.WriteJSONError(w, seating.ErrSeatedWaitlist.Error(), http.StatusConflict)
+			return
+		}
+
+		// The eventual offer has to be a valid order on its own
+		_, _, lineErrors, err := checkOrderLimits(db, eventID,
+			[]inventory.Line{{TicketTypeID: req.TicketTypeID, Quantity: req.Quantity}})
+		if err != nil {
+			log.Println("Error checking purchase limits:", err)
+			utils.WriteJSONError(w, "Could not join waitlist", http.StatusInternalServerError)
+			return
+		}
+		if len(lineErrors) > 0 {
+			writeLineErrors(w, http.StatusBadRequest, lineErrors)
+			return
+		}
+
+		entry, err := waitlist.Join(db, eventID, req.TicketTypeID, claims.UserID, req.Quantity)
+		switch {
+		case errors.Is(err, waitlist.ErrNotSoldOut):
+			utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, waitlist.ErrAlreadyWaiting):
+			utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Println("Error joining waitlist:", err)
+			utils.WriteJSONError(w, "Could not join waitlist", http.StatusInternalServerError)
+		default:
+			utils.WriteJSON(w, http.StatusCreated, entry)
+		}
+	}
+}
+
+// MyWaitlistHandler lists the waitlists the user is in and their place in each.
+func MyWaitlistHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		entries, err := waitlist.ListForUser(db, claims.UserID)
+		if err != nil {
+			log.Println("Error listing waitlist entries:", err)
+			utils.WriteJSONError(w, "Failed to load waitlist", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, entries)
+	}
+}
+
+// LeaveWaitlistHandler takes the user out of a waitlist, giving up any open offer.
+func LeaveWaitlistHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			utils.WriteJSONError(w, "Invalid waitlist entry ID", http.StatusBadRequest)
+			return
+		}
+
+		checkoutSessionID, found, err := waitlist.Leave(db, id, claims.UserID)
+		if err != nil {
+			log.Println("Error leaving waitlist:", err)
+			utils.WriteJSONError(w, "Could not leave waitlist", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			utils.WriteJSONError(w, "Waitlist entry not found", http.StatusNotFound)
+			return
+		}
+		if checkoutSessionID != "" {
+			abandonCheckout(db, checkoutSessionID)
+			go OfferReleasedStock(db)
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Left the waitlist"})
+	}
+}
+
+// ClaimWaitlistOfferHandler turns an emailed waitlist offer into a checkout for the
+// tickets it holds. Free tickets are issued right away, like a registration.
+func ClaimWaitlistOfferHandler(db *sql.DB, gateway payments.PaymentGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		offer, err := waitlist.OfferByToken(db, r.PathValue("token"))
+		switch {
+		case errors.Is(err, waitlist.ErrOfferNotFound):
+			utils.WriteJSONError(w, "Offer not found or already used", http.StatusNotFound)
+			return
+		case errors.Is(err, waitlist.ErrOfferExpired):
+			utils.WriteJSONError(w, err.Error(), http.StatusGone)
+			return
+		case err != nil:
+			log.Println("Error loading waitlist offer:", err)
+			utils.WriteJSONError(w, "Could not load offer", http.StatusInternalServerError)
+			return
+		}
+		if offer.UserID != claims.UserID {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		cs, err := loadCheckoutSession(db, offer.CheckoutSessionID)
+		if err != nil {
+			log.Printf("Error loading checkout session %s of waitlist offer %d: %v", offer.CheckoutSessionID, offer.ID, err)
+			utils.WriteJSONError(w, "Could not load offer", http.StatusInternalServerError)
+			return
+		}
+
+		// Limits may have changed, or the user bought elsewhere, since they joined the line
+		lines := []inventory.Line{{TicketTypeID: offer.TicketTypeID, Quantity: offer.Quantity}}
+		_, limits, lineErrors, err := checkOrderLimits(db, offer.EventID, lines)
+		if err == nil && len(lineErrors) == 0 {
+			lineErrors, err = checkCustomerLimits(db, claims.UserID, lines, limits)
+		}
+		if err != nil {
+			log.Println("Error checking purchase limits:", err)
+			utils.WriteJSONError(w, "Could not claim offer", http.StatusInternalServerError)
+			return
+		}
+		if len(lineErrors) > 0 {
+			writeLineErrors(w, http.StatusConflict, lineErrors)
+			return
+		}
+
+		claimed, err := waitlist.MarkClaimed(db, offer.ID)
+		if err != nil {
+			log.Println("Error claiming waitlist offer:", err)
+			utils.WriteJSONError(w, "Could not claim offer", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			utils.WriteJSONError(w, waitlist.ErrOfferExpired.Error(), http.StatusGone)
+			return
+		}
+
+		if cs.AmountTotalCents == 0 {
+			orderID, err := WriteOrders(db, Record{CheckoutSessionID: cs.ID, SessionID: freeSessionPrefix + cs.ID, Currency: cs.Currency})
+			if err != nil {
+				log.Printf("Error writing free order for waitlist offer %d: %v", offer.ID, err)
+				abandonCheckout(db, cs.ID)
+				go OfferReleasedStock(db)
+				utils.WriteJSONError(w, "Could not claim offer", http.StatusInternalServerError)
+				return
+			}
+			utils.WriteJSON(w, http.StatusCreated, map[string]string{
+				"order_id":   orderID,
+				"session_id": freeSessionPrefix + cs.ID,
+			})
+			return
+		}
+
+		s, err := openPaymentSession(db, gateway, cs, "", time.Now().Add(checkoutSessionTTL))
+		if err != nil {
+			log.Printf("Payment provider %s error: %v", gateway.Name(), err)
+			abandonCheckout(db, cs.ID)
+			go OfferReleasedStock(db)
+			utils.WriteJSONError(w, "Could not create payment session", http.StatusInternalServerError)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]string{
+			"url":            s.URL,
+			"transaction_id": s.ID,
+		})
+	}
+}
+
+// OfferReleasedStock expires waitlist offers that were not claimed in time and
+// offers whatever stock is free to the next people in line. It is called wherever
+// stock comes back, and periodically by StartWaitlistWorker.
+func OfferReleasedStock(db *sql.DB) {
+	offerMu.Lock()
+	defer offerMu.Unlock()
+
+	expired, err := waitlist.ExpireOffers(db)
+	if err != nil {
+		log.Printf("Error expiring waitlist offers: %v", err)
+		return
+	}
+	for _, id := range expired {
+		abandonCheckout(db, id)
+	}
+
+	// Each round serves the head of every queue; stop once nobody more can be served
+	for {
+		next, err := waitlist.NextInLine(db)
+		if err != nil {
+			log.Printf("Error reading waitlists: %v", err)
+			return
+		}
+		offered := 0
+		for _, e := range next {
+			ok, err := offerToEntry(db, e)
+			if err != nil {
+				log.Printf("Error offering tickets to waitlist entry %d: %v", e.ID, err)
+				continue
+			}
+			if ok {
+				offered++
+			}
+		}
+		if offered == 0 {
+			return
+		}
+	}
+}
+
+// offerToEntry holds tickets for a waiting entry in a checkout session of its own
+// and emails the purchase link. It returns false when the stock was gone, the
+// ticket type is no longer on sale or the entry runs past its price tier.
+func offerToEntry(db *sql.DB, e waitlist.Entry) (bool, error) {
+	expiresAt := time.Now().Add(waitlistOfferTTL)
+	reservationID, reserved, err := inventory.Reserve(db, e.EventID,
+		[]inventory.Line{{TicketTypeID: e.TicketTypeID, Quantity: e.Quantity}}, expiresAt.Add(holdGracePeriod))
+	if errors.Is(err, inventory.ErrInsufficientStock) || errors.Is(err, inventory.ErrNotOnSale) ||
+		errors.Is(err, inventory.ErrPriceTierEnds) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	cs := newCheckoutSession(reservationID, e.UserID, reserved)
+	if err := saveCheckoutSession(db, cs); err != nil {
+		releaseCheckout(db, cs.ID)
+		return false, err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		abandonCheckout(db, cs.ID)
+		return false, err
+	}
+	ok, err := waitlist.MarkOffered(db, e.ID, cs.ID, token, expiresAt)
+	if err != nil || !ok {
+		abandonCheckout(db, cs.ID)
+		return false, err
+	}
+
+	go sendWaitlistOfferEmail(db, e, cs, token, expiresAt)
+	return true, nil
+}
+
+func sendWaitlistOfferEmail(db *sql.DB, e waitlist.Entry, cs *CheckoutSession, token string, expiresAt time.Time) {
+	var userEmail, eventTitle string
+	err := db.QueryRow(`
+		SELECT u.email, ev.title
+		FROM users u, events ev
+		WHERE u.id = $1 AND ev.id = $2`, e.UserID, e.EventID).Scan(&userEmail, &eventTitle)
+	if err != nil {
+		log.Printf("Error loading waitlist offer email details for entry %d: %v", e.ID, err)
+		return
+	}
+
+	offerLink := fmt.Sprintf("http://localhost:5173/waitlist/offers/%s", token)
+	deadline := expiresAt.Format("Monday, January 2 at 15:04 MST")
+	subject := fmt.Sprintf("Tickets for %s are available for you", eventTitle)
+	plainText := fmt.Sprintf("Good news! %d x %s for %s (%s) are held for you until %s. Buy them here: %s",
+		e.Quantity, e.TicketTypeName, eventTitle, utils.FormatAmount(cs.AmountTotalCents, cs.Currency), deadline, offerLink)
+	html := fmt.Sprintf(`<p>Good news! <strong>%d x %s</strong> for <strong>%s</strong> (%s) are held for you until %s.</p>
+<p><a href='%s'>Buy your tickets</a></p>
+<p>If you do not buy them in time, they go to the next person on the waitlist.</p>`,
+		e.Quantity, e.TicketTypeName, eventTitle, utils.FormatAmount(cs.AmountTotalCents, cs.Currency), deadline, offerLink)
+
+	if err := utils.SendEmail(userEmail, subject, plainText, html); err != nil {
+		log.Printf("Error sending waitlist offer email to %s: %v", userEmail, err)
+	}
+}
+
+// StartWaitlistWorker runs OfferReleasedStock every interval until ctx is cancelled,
+// so expired offers roll over and stock freed by expired holds reaches the waitlist.
+func StartWaitlistWorker(ctx context.Context, db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				OfferReleasedStock(db)
+			}
+		}
+	}()
+}
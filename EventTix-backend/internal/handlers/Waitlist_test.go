@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/testdb"
+	"TickVibe-EventTix-backend/internal/waitlist"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// soldOutWaitlist creates a sold-out ticket type of one ticket and puts each user
+// on its waitlist in turn. It returns the ticket type and the entries in line order.
+func soldOutWaitlist(t *testing.T, db *sql.DB, eventID string, userIDs ...string) (int, []int64) {
+	t.Helper()
+	typeID := testdb.TicketType(t, db, eventID, 1, 2500)
+	if _, err := db.Exec(`UPDATE ticket_types SET available_quantity = 0 WHERE id = $1`, typeID); err != nil {
+		t.Fatalf("selling out: %v", err)
+	}
+	var entries []int64
+	for _, userID := range userIDs {
+		e, err := waitlist.Join(db, eventID, typeID, userID, 1)
+		if err != nil {
+			t.Fatalf("joining the waitlist: %v", err)
+		}
+		entries = append(entries, e.ID)
+	}
+	// The ticket comes back, e.g. from an unpaid checkout
+	if _, err := db.Exec(`UPDATE ticket_types SET available_quantity = 1 WHERE id = $1`, typeID); err != nil {
+		t.Fatalf("restocking: %v", err)
+	}
+	return typeID, entries
+}
+
+// entryStatus returns the status of a waitlist entry.
+func entryStatus(t *testing.T, db *sql.DB, entryID int64) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow(`SELECT status FROM waitlist_entries WHERE id = $1`, entryID).Scan(&status); err != nil {
+		t.Fatalf("reading entry %d: %v", entryID, err)
+	}
+	return status
+}
+
+// lapseOffer moves an offer's deadline into the past.
+func lapseOffer(t *testing.T, db *sql.DB, entryID int64) {
+	t.Helper()
+	if _, err := db.Exec(`UPDATE waitlist_entries SET offer_expires_at = NOW() - INTERVAL '1 second' WHERE id = $1`,
+		entryID); err != nil {
+		t.Fatalf("lapsing offer: %v", err)
+	}
+}
+
+func TestExpiredWaitlistOfferMovesToNextEntry(t *testing.T) {
+	db := testdb.Open(t)
+	first, second := testdb.User(t, db, "user"), testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	typeID, entries := soldOutWaitlist(t, db, eventID, first, second)
+
+	OfferReleasedStock(db)
+	if s := entryStatus(t, db, entries[0]); s != waitlist.StatusOffered {
+		t.Fatalf("first entry is %s, want %s", s, waitlist.StatusOffered)
+	}
+	if s := entryStatus(t, db, entries[1]); s != waitlist.StatusWaiting {
+		t.Fatalf("second entry is %s while the ticket is held for the first, want %s", s, waitlist.StatusWaiting)
+	}
+
+	lapseOffer(t, db, entries[0])
+	OfferReleasedStock(db)
+	if s := entryStatus(t, db, entries[0]); s != waitlist.StatusExpired {
+		t.Errorf("first entry is %s after its offer lapsed, want %s", s, waitlist.StatusExpired)
+	}
+	if s := entryStatus(t, db, entries[1]); s != waitlist.StatusOffered {
+		t.Errorf("second entry is %s, want %s", s, waitlist.StatusOffered)
+	}
+	if n := testdb.Count(t, db, `SELECT available_quantity FROM ticket_types WHERE id = $1`, typeID); n != 0 {
+		t.Errorf("available_quantity = %d, want the ticket held for the second entry", n)
+	}
+}
+
+func TestLateWaitlistClaimIsGone(t *testing.T) {
+	db := testdb.Open(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/waitlist/offers/{token}/checkout", middleware.RequireAuth(
+		ClaimWaitlistOfferHandler(db, payments.NewFakeGateway("http://localhost:8080", "test-fake-secret"))))
+
+	tests := []struct {
+		name    string
+		expired bool // the worker closed the offer before the claim
+	}{
+		{"deadline passed", false},
+		{"offer expired by the worker", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := testdb.User(t, db, "user")
+			eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+			_, entries := soldOutWaitlist(t, db, eventID, userID)
+			OfferReleasedStock(db)
+
+			var token string
+			if err := db.QueryRow(`SELECT offer_token FROM waitlist_entries WHERE id = $1`, entries[0]).Scan(&token); err != nil {
+				t.Fatalf("reading offer token: %v", err)
+			}
+			lapseOffer(t, db, entries[0])
+			if tt.expired {
+				if _, err := waitlist.ExpireOffers(db); err != nil {
+					t.Fatalf("expiring offers: %v", err)
+				}
+			}
+
+			req := loggedIn(t, httptest.NewRequest(http.MethodPost, "/api/waitlist/offers/"+token+"/checkout", nil), userID)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusGone {
+				t.Fatalf("claim: status = %d, want %d: %s", rec.Code, http.StatusGone, rec.Body)
+			}
+			if claimed, err := waitlist.MarkClaimed(db, entries[0]); err != nil || claimed {
+				t.Errorf("MarkClaimed after the deadline = %v, %v; want false", claimed, err)
+			}
+		})
+	}
+}
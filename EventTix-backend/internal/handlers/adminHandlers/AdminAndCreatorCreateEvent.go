@@ -3,6 +3,8 @@ package adminHandlers
 import (
 	"TickVibe-EventTix-backend/internal/middleware"
 	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/pricing"
+	"TickVibe-EventTix-backend/internal/refunds"
 	"TickVibe-EventTix-backend/internal/utils"
 	"database/sql"
 	"encoding/json"
@@ -14,18 +16,26 @@ import (
 	"github.com/google/uuid"
 )
 
+// defaultVATRateBps is the standard Polish VAT rate, used when an event sets none.
+const defaultVATRateBps = 2300
+
 type CreateEventRequest struct {
-	Title           string                `json:"title"`
-	Slug            string                `json:"slug"`
-	Description     string                `json:"description"`
-	StartTime       time.Time             `json:"start_time"`
-	LocationName    string                `json:"location_name"`
-	LocationAddress string                `json:"location_address"`
-	ImageURL        string                `json:"image_url"`
-	IsPublished     bool                  `json:"is_published"`
-	CityID          int                   `json:"city_id"`
-	CategoryIDs     []int                 `json:"category_ids"`
-	TicketTypes     []models.TicketTypeIn `json:"ticket_types"`
+	Title            string                `json:"title"`
+	Slug             string                `json:"slug"`
+	Description      string                `json:"description"`
+	StartTime        time.Time             `json:"start_time"`
+	LocationName     string                `json:"location_name"`
+	LocationAddress  string                `json:"location_address"`
+	ImageURL         string                `json:"image_url"`
+	IsPublished      bool                  `json:"is_published"`
+	CityID           int                   `json:"city_id"`
+	Currency         string                `json:"currency"`
+	VATRateBps       *int                  `json:"vat_rate_bps"`       // defaults to 2300 (23%)
+	RefundPolicy     []models.RefundRule   `json:"refund_policy"`      // empty means buyers cannot cancel
+	TransfersEnabled *bool                 `json:"transfers_enabled"`  // defaults to true
+	ResaleCapPercent int                   `json:"resale_cap_percent"` // resale markup over face value, 0 by default
+	CategoryIDs      []int                 `json:"category_ids"`
+	TicketTypes      []models.TicketTypeIn `json:"ticket_types"`
 }
 
 func AdminAndCreatorCreateEventHandler(db *sql.DB) http.HandlerFunc {
@@ -47,9 +57,39 @@ func AdminAndCreatorCreateEventHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		currency, err := utils.NormalizeCurrency(req.Currency)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid currency")
+			return
+		}
+
+		vatRate := defaultVATRateBps
+		if req.VATRateBps != nil {
+			vatRate = *req.VATRateBps
+		}
+		if err := utils.ValidateVATRate(vatRate); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := utils.ValidateRefundPolicy(req.RefundPolicy); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := utils.ValidateResaleCap(req.ResaleCapPercent); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		transfersEnabled := req.TransfersEnabled == nil || *req.TransfersEnabled
+		for _, tt := range req.TicketTypes {
+			if tt.PlatformFeeCents != nil && claims.Role != "admin" {
+				respondWithError(w, http.StatusForbidden, "Only admins can set platform fees")
+				return
+			}
+		}
+
 		// Validate CityID exists
 		var cityExists bool
-		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM cities WHERE id = $1)", req.CityID).Scan(&cityExists)
+		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM cities WHERE id = $1)", req.CityID).Scan(&cityExists)
 		if err != nil {
 			log.Println("Error checking city:", err)
 			respondWithError(w, http.StatusInternalServerError, "Internal error")
@@ -105,10 +145,12 @@ func AdminAndCreatorCreateEventHandler(db *sql.DB) http.HandlerFunc {
 		_, err = tx.Exec(`
 			INSERT INTO events (
 				id, creator_id, title, slug, description, start_time,
-				location_name, location_address, image_url, is_published, city_id
-			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`,
+				location_name, location_address, image_url, is_published, city_id, currency, vat_rate_bps,
+				transfers_enabled, resale_cap_percent
+			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)`,
 			eventID, userID, req.Title, req.Slug, req.Description, req.StartTime,
-			req.LocationName, req.LocationAddress, imagePath, req.IsPublished, req.CityID,
+			req.LocationName, req.LocationAddress, imagePath, req.IsPublished, req.CityID, currency, vatRate,
+			transfersEnabled, req.ResaleCapPercent,
 		)
 		if err != nil {
 			log.Println("Event insert failed:", err)
@@ -116,6 +158,12 @@ func AdminAndCreatorCreateEventHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if err := refunds.ReplacePolicy(tx, eventID.String(), req.RefundPolicy); err != nil {
+			log.Println("Refund policy insert failed:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create event")
+			return
+		}
+
 		// Insert categories
 		for _, cid := range req.CategoryIDs {
 			_, err := tx.Exec(`INSERT INTO event_categories (event_id, category_id) VALUES ($1, $2)`, eventID, cid)
@@ -128,12 +176,23 @@ func AdminAndCreatorCreateEventHandler(db *sql.DB) http.HandlerFunc {
 
 		// Insert ticket types
 		for _, tt := range req.TicketTypes {
-			_, err := tx.Exec(`
+			var ticketTypeID int
+			err := tx.QueryRow(`
 				INSERT INTO ticket_types (
-					event_id, name, description, price_cents, total_quantity, available_quantity
-				) VALUES ($1, $2, $3, $4, $5, $5)`,
+					event_id, name, description, price_cents, total_quantity, available_quantity,
+					min_per_order, max_per_order, max_per_customer, sales_start, sales_end,
+					platform_fee_cents, organizer_fee_cents,
+					entry_policy, max_entries, valid_from, valid_until
+				) VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10, COALESCE($11, 0), COALESCE($12, 0), $13, $14, $15, $16)
+				RETURNING id`,
 				eventID, tt.Name, tt.Description, tt.PriceCents, tt.TotalQuantity,
-			)
+				tt.MinOrDefault(), tt.MaxPerOrder, tt.MaxPerCustomer, tt.SalesStart, tt.SalesEnd,
+				tt.PlatformFeeCents, tt.OrganizerFeeCents,
+				tt.PolicyOrDefault(), tt.MaxEntries, tt.ValidFrom, tt.ValidUntil,
+			).Scan(&ticketTypeID)
+			if err == nil {
+				err = pricing.ReplaceTiers(tx, ticketTypeID, tt.PriceTiers)
+			}
 			if err != nil {
 				log.Println("Ticket insert failed:", err)
 				respondWithError(w, http.StatusInternalServerError, "Failed to create ticket types")
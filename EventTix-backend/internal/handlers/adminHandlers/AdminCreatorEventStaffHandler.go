@@ -0,0 +1,118 @@
+package adminHandlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/staff"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type inviteStaffRequest struct {
+	Email    string    `json:"email"`
+	StartsAt time.Time `json:"starts_at"` // optional, defaults around the event's start
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// AdminCreatorInviteStaffHandler invites door staff by email to scan an event's
+// tickets during a time window, and emails them a link to accept.
+func AdminCreatorInviteStaffHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+		claims, _ := middleware.GetUserFromContext(r)
+
+		var req inviteStaffRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		assignment, token, err := staff.Invite(db, eventID, req.Email, claims.UserID, req.StartsAt, req.EndsAt)
+		switch {
+		case errors.Is(err, staff.ErrEventNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, staff.ErrInvalidEmail), errors.Is(err, staff.ErrInvalidWindow):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case err != nil:
+			log.Printf("Error inviting staff to event %s: %v", eventID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to invite staff")
+		default:
+			go sendStaffInvitationEmail(assignment, claims.FullName, token)
+			respondWithJSON(w, http.StatusCreated, assignment)
+		}
+	}
+}
+
+// AdminCreatorListStaffHandler lists the door staff invited to an event.
+func AdminCreatorListStaffHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		assignments, err := staff.List(db, eventID)
+		if err != nil {
+			log.Printf("Error listing staff of event %s: %v", eventID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load staff")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, assignments)
+	}
+}
+
+// AdminCreatorRevokeStaffHandler takes away a staff member's access to an event's
+// scanners, or withdraws their invitation.
+func AdminCreatorRevokeStaffHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid staff ID")
+			return
+		}
+
+		err = staff.Revoke(db, eventID, id)
+		if errors.Is(err, staff.ErrAssignmentNotFound) {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			log.Printf("Error revoking staff %d of event %s: %v", id, eventID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to revoke staff")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func sendStaffInvitationEmail(a *staff.Assignment, inviter, token string) {
+	url := staff.AcceptURL(token)
+	window := fmt.Sprintf("%s to %s", a.StartsAt.Format("2006-01-02 15:04 MST"), a.EndsAt.Format("2006-01-02 15:04 MST"))
+	subject := fmt.Sprintf("You're invited to scan tickets at %s", a.EventTitle)
+	body := fmt.Sprintf(`<div style="font-family: Arial, sans-serif; max-width: 600px; margin: auto;">
+            <h2>Door staff invitation</h2>
+            <p>%s invited you to scan tickets at <strong>%s</strong>, from %s.</p>
+            <p><a href="%s">Accept the invitation</a>. You'll need to log in or create an account with this email address.</p>
+        </div>`,
+		html.EscapeString(inviter), html.EscapeString(a.EventTitle), html.EscapeString(window), url)
+	plain := fmt.Sprintf("%s invited you to scan tickets at %s, from %s. Accept the invitation: %s",
+		inviter, a.EventTitle, window, url)
+
+	if err := utils.SendEmail(a.Email, subject, plain, body); err != nil {
+		log.Printf("Error sending staff invitation %d: %v", a.ID, err)
+	}
+}
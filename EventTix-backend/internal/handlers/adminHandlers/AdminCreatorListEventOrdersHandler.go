@@ -10,6 +10,17 @@ import (
 	"github.com/google/uuid"
 )
 
+// creatorOwnsEvent reports whether the event was created by the given user.
+func creatorOwnsEvent(db *sql.DB, eventID, userID string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM events WHERE id = $1 AND creator_id = $2`, eventID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// AdminCreatorListEventOrdersHandler lists the orders with tickets for an event. The
+// amounts are the event's share of each order, summed from its order lines with
+// the discount they were given, so a cart order does not report other events'
+// sales; orders from before order lines were kept report their whole amounts.
 func AdminCreatorListEventOrdersHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := middleware.GetUserFromContext(r)
@@ -26,21 +37,28 @@ func AdminCreatorListEventOrdersHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		if claims.Role == "creator" {
-			var count int
-			err := db.QueryRow(`SELECT COUNT(*) FROM events WHERE id = $1 AND creator_id = $2`, eventID, claims.UserID).Scan(&count)
-			if err != nil || count == 0 {
+			owns, err := creatorOwnsEvent(db, eventID.String(), claims.UserID)
+			if err != nil || !owns {
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
 		}
 
 		query := `
-			SELECT DISTINCT o.id, o.user_id, u.email, o.status, o.total_amount_cents,
-			                o.payment_gateway_charge_id, o.created_at
+			SELECT o.id, COALESCE(o.user_id::text, ''), COALESCE(u.email, g.email), o.status,
+			       COALESCE(l.total_cents, o.total_amount_cents), COALESCE(l.discount_cents, o.discount_cents),
+			       CASE WHEN COALESCE(l.discount_cents, o.discount_cents) > 0 THEN pc.code END, o.currency,
+			       o.payment_gateway_charge_id, o.created_at
 			FROM orders o
-			JOIN users u ON o.user_id = u.id
-			JOIN tickets t ON t.order_id = o.id
-			WHERE t.event_id = $1
+			LEFT JOIN users u ON o.user_id = u.id
+			LEFT JOIN guest_contacts g ON o.guest_contact_id = g.id
+			LEFT JOIN promo_codes pc ON pc.id = o.promo_code_id
+			LEFT JOIN LATERAL (
+				SELECT SUM(ol.gross_cents) AS total_cents, SUM(ol.discount_cents) AS discount_cents
+				FROM order_lines ol
+				WHERE ol.order_id = o.id AND ol.event_id = $1
+			) l ON TRUE
+			WHERE EXISTS (SELECT 1 FROM tickets t WHERE t.order_id = o.id AND t.event_id = $1)
 			ORDER BY o.created_at DESC
 		`
 
@@ -56,10 +74,13 @@ func AdminCreatorListEventOrdersHandler(db *sql.DB) http.HandlerFunc {
 		for rows.Next() {
 			var o models.OrderInfo
 			if err := rows.Scan(&o.ID, &o.UserID, &o.BuyerEmail, &o.Status,
-				&o.TotalAmount, &o.PaymentRef, &o.CreatedAt); err != nil {
+				&o.TotalAmount, &o.Discount, &o.PromoCode, &o.Currency,
+				&o.PaymentRef, &o.CreatedAt); err != nil {
 				log.Println("Scan error:", err)
 				continue
 			}
+			o.GrossAmount = o.TotalAmount + o.Discount
+			o.NetAmount = o.TotalAmount
 			orders = append(orders, o)
 		}
 
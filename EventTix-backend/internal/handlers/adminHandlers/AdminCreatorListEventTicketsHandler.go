@@ -36,11 +36,11 @@ func AdminCreatorListEventTicketsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		query := `
-			SELECT t.id, t.order_id, t.ticket_type_id, t.ticket_code, t.is_used, t.created_at,
-      		 u.email AS buyer_email, tt.name AS ticket_type_name
+			SELECT t.id, t.order_id, t.ticket_type_id, t.ticket_code, t.is_used, t.is_void, t.created_at,
+      		 COALESCE(u.email, g.email) AS holder_email, tt.name AS ticket_type_name
 			FROM tickets t
-			JOIN orders o ON t.order_id = o.id
-			JOIN users u ON o.user_id = u.id
+			LEFT JOIN users u ON t.user_id = u.id
+			LEFT JOIN guest_contacts g ON t.guest_contact_id = g.id
 			JOIN ticket_types tt ON t.ticket_type_id = tt.id
 			WHERE t.event_id = $1
 			ORDER BY t.created_at DESC
@@ -58,7 +58,7 @@ func AdminCreatorListEventTicketsHandler(db *sql.DB) http.HandlerFunc {
 		for rows.Next() {
 			var t models.AdminTicketInfo
 			if err := rows.Scan(
-				&t.ID, &t.OrderID, &t.TicketTypeID, &t.Code, &t.Status,
+				&t.ID, &t.OrderID, &t.TicketTypeID, &t.Code, &t.Status, &t.IsVoid,
 				&t.CreatedAt, &t.UserEmail, &t.TicketTypeName,
 			); err != nil {
 				log.Println("Scan error:", err)
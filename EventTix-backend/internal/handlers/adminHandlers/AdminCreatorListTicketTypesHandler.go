@@ -3,6 +3,7 @@ package adminHandlers
 import (
 	"TickVibe-EventTix-backend/internal/middleware"
 	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/pricing"
 	"database/sql"
 	"log"
 	"net/http"
@@ -36,7 +37,10 @@ func AdminCreatorListTicketTypesHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		rows, err := db.Query(`
-			SELECT id, name, description, price_cents, total_quantity, available_quantity, created_at, updated_at
+			SELECT id, name, description, price_cents, total_quantity, available_quantity, created_at, updated_at,
+			       min_per_order, max_per_order, max_per_customer, sales_start, sales_end,
+			       platform_fee_cents, organizer_fee_cents,
+			       entry_policy, max_entries, valid_from, valid_until
 			FROM ticket_types
 			WHERE event_id = $1
 			ORDER BY id ASC
@@ -51,13 +55,33 @@ func AdminCreatorListTicketTypesHandler(db *sql.DB) http.HandlerFunc {
 		var ticketTypes []models.TicketTypeOut
 		for rows.Next() {
 			var t models.TicketTypeOut
-			if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.PriceCents, &t.TotalQuantity, &t.AvailableQuantity, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.PriceCents, &t.TotalQuantity, &t.AvailableQuantity, &t.CreatedAt, &t.UpdatedAt,
+				&t.MinPerOrder, &t.MaxPerOrder, &t.MaxPerCustomer, &t.SalesStart, &t.SalesEnd,
+				&t.PlatformFeeCents, &t.OrganizerFeeCents,
+				&t.Policy, &t.MaxEntries, &t.ValidFrom, &t.ValidUntil); err != nil {
 				log.Println("Scan error:", err)
 				continue
 			}
 			ticketTypes = append(ticketTypes, t)
 		}
 
+		ids := make([]int, 0, len(ticketTypes))
+		for _, t := range ticketTypes {
+			ids = append(ids, t.ID)
+		}
+		tiers, err := pricing.LoadTiers(db, ids)
+		if err != nil {
+			log.Println("DB error fetching price tiers:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for i := range ticketTypes {
+			ticketTypes[i].PriceTiers = tiers[ticketTypes[i].ID]
+			if ticketTypes[i].PriceTiers == nil {
+				ticketTypes[i].PriceTiers = []models.PriceTier{}
+			}
+		}
+
 		respondWithJSON(w, http.StatusOK, ticketTypes)
 	}
 }
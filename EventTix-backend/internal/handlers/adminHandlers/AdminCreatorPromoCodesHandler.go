@@ -0,0 +1,117 @@
+package adminHandlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/promos"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// authorizeEventAccess parses the event_id path value and, for creators, checks that
+// they own the event. It writes the error response itself and returns false on failure.
+func authorizeEventAccess(w http.ResponseWriter, r *http.Request, db *sql.DB) (string, bool) {
+	claims, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+
+	eventID, err := uuid.Parse(r.PathValue("event_id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid event ID")
+		return "", false
+	}
+
+	if claims.Role == "creator" {
+		owns, err := creatorOwnsEvent(db, eventID.String(), claims.UserID)
+		if err != nil || !owns {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return "", false
+		}
+	}
+	return eventID.String(), true
+}
+
+// AdminCreatorCreatePromoCodeHandler defines a discount code for an event.
+func AdminCreatorCreatePromoCodeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+		claims, _ := middleware.GetUserFromContext(r)
+
+		var code promos.Code
+		if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		code.EventID = eventID
+
+		err := promos.Create(db, &code, claims.UserID)
+		switch {
+		case errors.Is(err, promos.ErrInvalidPromo):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, promos.ErrDuplicateCode):
+			respondWithError(w, http.StatusConflict, "Promo code already exists for this event")
+		case err != nil:
+			log.Println("Error creating promo code:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create promo code")
+		default:
+			respondWithJSON(w, http.StatusCreated, code)
+		}
+	}
+}
+
+// AdminCreatorListPromoCodesHandler lists an event's discount codes and how often each was used.
+func AdminCreatorListPromoCodesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		codes, err := promos.List(db, eventID)
+		if err != nil {
+			log.Println("Error listing promo codes:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load promo codes")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, codes)
+	}
+}
+
+// AdminCreatorDeactivatePromoCodeHandler stops a code from being accepted at checkout.
+// Orders that already used it keep their discount.
+func AdminCreatorDeactivatePromoCodeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid promo code ID")
+			return
+		}
+
+		found, err := promos.Deactivate(db, eventID, id)
+		if err != nil {
+			log.Println("Error deactivating promo code:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to deactivate promo code")
+			return
+		}
+		if !found {
+			respondWithError(w, http.StatusNotFound, "Promo code not found")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]string{"message": "Promo code deactivated"})
+	}
+}
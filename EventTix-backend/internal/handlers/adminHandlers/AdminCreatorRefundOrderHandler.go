@@ -0,0 +1,97 @@
+package adminHandlers
+
+import (
+	"TickVibe-EventTix-backend/internal/handlers"
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/refunds"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type refundOrderRequest struct {
+	TicketIDs []string `json:"ticket_ids"` // empty refunds the whole order
+	Reason    string   `json:"reason"`
+}
+
+// AdminCreatorRefundOrderHandler refunds a whole order or selected tickets of it.
+// Creators can only refund orders for events they own.
+func AdminCreatorRefundOrderHandler(db *sql.DB, gateway payments.PaymentGateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		orderID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid order ID")
+			return
+		}
+
+		var req refundOrderRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+				return
+			}
+		}
+		for _, id := range req.TicketIDs {
+			if _, err := uuid.Parse(id); err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid ticket ID")
+				return
+			}
+		}
+
+		eventIDs, err := refunds.OrderEventIDs(db, orderID.String())
+		if errors.Is(err, refunds.ErrOrderNotFound) {
+			respondWithError(w, http.StatusNotFound, "Order not found")
+			return
+		} else if err != nil {
+			log.Println("Error loading order:", err)
+			respondWithError(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+
+		// Creators can only refund orders made up entirely of their own events
+		if claims.Role == "creator" {
+			for _, eventID := range eventIDs {
+				owns, err := creatorOwnsEvent(db, eventID, claims.UserID)
+				if err != nil || !owns {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		result, err := refunds.Issue(db, gateway, refunds.Request{
+			OrderID:     orderID.String(),
+			TicketIDs:   req.TicketIDs,
+			Reason:      req.Reason,
+			RequestedBy: claims.UserID,
+		})
+		switch {
+		case errors.Is(err, refunds.ErrOrderNotFound):
+			respondWithError(w, http.StatusNotFound, "Order not found")
+		case errors.Is(err, refunds.ErrNotRefundable):
+			respondWithError(w, http.StatusConflict, "Order cannot be refunded in its current state")
+		case errors.Is(err, refunds.ErrNoTickets), errors.Is(err, refunds.ErrForeignTicket):
+			respondWithError(w, http.StatusBadRequest, "No refundable tickets selected")
+		case errors.Is(err, refunds.ErrProviderDeclined):
+			respondWithError(w, http.StatusBadGateway, "Payment provider rejected the refund")
+		case err != nil:
+			log.Printf("Error refunding order %s: %v", orderID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to refund order")
+		default:
+			// Refunded tickets go back on sale, first to anyone on the waitlist
+			go handlers.OfferReleasedStock(db)
+			respondWithJSON(w, http.StatusOK, result)
+		}
+	}
+}
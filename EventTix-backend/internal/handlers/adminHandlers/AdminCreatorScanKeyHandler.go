@@ -0,0 +1,73 @@
+package adminHandlers
+
+import (
+	"TickVibe-EventTix-backend/internal/scancodes"
+	"database/sql"
+	"log"
+	"net/http"
+)
+
+// reissueBatch is how many unsigned codes are replaced per transaction.
+const reissueBatch = 500
+
+// AdminCreatorEventScanKeyHandler returns the public key an event's ticket codes are
+// signed with, for scanners to verify codes without a connection.
+func AdminCreatorEventScanKeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		key, err := scancodes.ActiveKey(db, eventID)
+		if err != nil {
+			log.Printf("Error loading signing key of event %s: %v", eventID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load signing key")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, key)
+	}
+}
+
+// AdminCreatorRotateScanKeyHandler replaces an event's signing key, e.g. after a
+// scanner device was lost, and gives all of the event's tickets new codes.
+func AdminCreatorRotateScanKeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		key, reissued, err := scancodes.Rotate(db, eventID)
+		if err != nil {
+			log.Printf("Error rotating signing key of event %s: %v", eventID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to rotate signing key")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"key":      key,
+			"reissued": reissued,
+		})
+	}
+}
+
+// AdminReissueUnsignedCodesHandler gives every ticket still carrying an unsigned
+// code from before codes were signed a signed one.
+func AdminReissueUnsignedCodesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		total := 0
+		for {
+			n, err := scancodes.ReissueUnsigned(db, reissueBatch)
+			if err != nil {
+				log.Printf("Error reissuing unsigned ticket codes after %d: %v", total, err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to reissue ticket codes")
+				return
+			}
+			total += n
+			if n < reissueBatch {
+				break
+			}
+		}
+		respondWithJSON(w, http.StatusOK, map[string]int{"reissued": total})
+	}
+}
@@ -0,0 +1,154 @@
+package adminHandlers
+
+import (
+	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/seating"
+	"TickVibe-EventTix-backend/internal/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// canUseVenue reports whether the user may see and seat events at a venue: admins
+// may use every venue, creators the ones they created.
+func canUseVenue(db *sql.DB, claims *utils.Claims, venueID int) (bool, error) {
+	if claims.Role != "creator" {
+		return true, nil
+	}
+	var owns bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM venues WHERE id = $1 AND creator_id = $2)`,
+		venueID, claims.UserID).Scan(&owns)
+	return owns, err
+}
+
+// AdminCreatorCreateVenueHandler stores a seated venue with its sections, rows and seats.
+func AdminCreatorCreateVenueHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var venue seating.Venue
+		if err := json.NewDecoder(r.Body).Decode(&venue); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		err := seating.CreateVenue(db, &venue, claims.UserID)
+		if errors.Is(err, seating.ErrInvalidVenue) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			log.Println("Error creating venue:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create venue")
+			return
+		}
+		respondWithJSON(w, http.StatusCreated, venue)
+	}
+}
+
+// AdminCreatorListVenuesHandler lists the venues the user can seat events at.
+func AdminCreatorListVenuesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var creatorID string
+		if claims.Role == "creator" {
+			creatorID = claims.UserID
+		}
+		venues, err := seating.Venues(db, creatorID)
+		if err != nil {
+			log.Println("Error listing venues:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load venues")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, venues)
+	}
+}
+
+// AdminCreatorGetVenueHandler returns a venue's layout, whose section and seat IDs
+// are used to map seats to ticket types.
+func AdminCreatorGetVenueHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		venueID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid venue ID")
+			return
+		}
+		if ok, err := canUseVenue(db, claims, venueID); err != nil || !ok {
+			respondWithError(w, http.StatusNotFound, "Venue not found")
+			return
+		}
+
+		venue, err := seating.GetVenue(db, venueID)
+		if errors.Is(err, seating.ErrVenueNotFound) {
+			respondWithError(w, http.StatusNotFound, "Venue not found")
+			return
+		} else if err != nil {
+			log.Printf("Error loading venue %d: %v", venueID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load venue")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, venue)
+	}
+}
+
+type assignSeatsRequest struct {
+	VenueID int            `json:"venue_id"`
+	Zones   []seating.Zone `json:"zones"`
+}
+
+// AdminCreatorAssignSeatsHandler seats an event at a venue and maps its seats to the
+// event's ticket types. The stock of each mapped ticket type becomes its seat count.
+func AdminCreatorAssignSeatsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, ok := authorizeEventAccess(w, r, db)
+		if !ok {
+			return
+		}
+		claims, _ := middleware.GetUserFromContext(r)
+
+		var req assignSeatsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		if ok, err := canUseVenue(db, claims, req.VenueID); err != nil || !ok {
+			respondWithError(w, http.StatusNotFound, "Venue not found")
+			return
+		}
+
+		counts, err := seating.AssignSeats(db, eventID, req.VenueID, req.Zones)
+		switch {
+		case errors.Is(err, seating.ErrVenueNotFound):
+			respondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, seating.ErrInvalidZones):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, seating.ErrSeatingLocked):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case err != nil:
+			log.Printf("Error assigning seats of event %s: %v", eventID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to assign seats")
+		default:
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"venue_id": req.VenueID,
+				"seats":    counts, // by ticket type
+			})
+		}
+	}
+}
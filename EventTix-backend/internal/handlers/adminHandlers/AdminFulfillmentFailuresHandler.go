@@ -0,0 +1,65 @@
+package adminHandlers
+
+import (
+	"TickVibe-EventTix-backend/internal/handlers"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// AdminListFulfillmentFailuresHandler lists paid sessions that did not become orders.
+// ?status=resolved shows the ones that were fixed since, ?status=refunded the
+// rejected ones that were refunded.
+func AdminListFulfillmentFailuresHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = handlers.FulfillmentOpen
+		}
+		if status != handlers.FulfillmentOpen && status != handlers.FulfillmentResolved &&
+			status != handlers.FulfillmentRefunded {
+			respondWithError(w, http.StatusBadRequest, "Invalid status")
+			return
+		}
+
+		failures, err := handlers.ListFulfillmentFailures(db, status)
+		if err != nil {
+			log.Println("Error listing fulfillment failures:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load fulfillment failures")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, failures)
+	}
+}
+
+// AdminRetryFulfillmentHandler replays a failed fulfillment and reports the outcome.
+func AdminRetryFulfillmentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid fulfillment failure ID")
+			return
+		}
+
+		orderID, err := handlers.RetryFulfillment(db, id)
+		var ferr *handlers.FulfillmentError
+		switch {
+		case errors.Is(err, handlers.ErrFulfillmentNotFound):
+			respondWithError(w, http.StatusNotFound, "Fulfillment failure not found or already resolved")
+		case errors.As(err, &ferr):
+			log.Printf("Replaying fulfillment %d failed: %v", id, err)
+			respondWithJSON(w, http.StatusConflict, map[string]string{
+				"error": "Fulfillment failed again",
+				"stage": ferr.Stage,
+				"cause": ferr.Err.Error(),
+			})
+		case err != nil:
+			log.Printf("Error replaying fulfillment %d: %v", id, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to replay fulfillment")
+		default:
+			respondWithJSON(w, http.StatusOK, map[string]string{"status": handlers.FulfillmentResolved, "order_id": orderID})
+		}
+	}
+}
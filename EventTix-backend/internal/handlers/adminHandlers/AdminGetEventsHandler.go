@@ -3,6 +3,7 @@ package adminHandlers
 import (
 	"TickVibe-EventTix-backend/internal/middleware"
 	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/refunds"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -39,7 +40,7 @@ func AdminCreatorListEventsHandler(db *sql.DB) http.HandlerFunc {
 		log.Printf("User: %+v\n", claims)
 		query := `
 			SELECT e.id, e.title, e.slug, e.start_time,
-	        e.created_at, e.updated_at, is_published
+	        e.created_at, e.updated_at, is_published, e.currency
 			FROM events e
 			WHERE 1=1
 		`
@@ -80,7 +81,7 @@ func AdminCreatorListEventsHandler(db *sql.DB) http.HandlerFunc {
 			var e models.EventSummary
 
 			if err := rows.Scan(&e.ID, &e.Title, &e.Slug,
-				&e.StartTime, &e.CreatedAt, &e.UpdatedAt, &e.IsPublished); err != nil {
+				&e.StartTime, &e.CreatedAt, &e.UpdatedAt, &e.IsPublished, &e.Currency); err != nil {
 				log.Println("Scan error:", err)
 				continue
 			}
@@ -104,7 +105,8 @@ func AdminCreatorGetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 
 		query := `
             SELECT id, creator_id, title, slug, description, start_time,
-                   location_name, location_address, image_url, is_published
+                   location_name, location_address, image_url, is_published, currency, vat_rate_bps,
+                   transfers_enabled, resale_cap_percent
             FROM events WHERE slug = $1
         `
 		var e models.EventDetails
@@ -112,7 +114,8 @@ func AdminCreatorGetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 		err := db.QueryRow(query, slug).Scan(
 			&e.ID, &e.CreatorID, &e.Title, &e.Slug, &e.Description,
 			&e.StartTime, &e.LocationName, &e.LocationAddress,
-			&e.ImageURL, &e.IsPublished,
+			&e.ImageURL, &e.IsPublished, &e.Currency, &e.VATRateBps,
+			&e.TransfersEnabled, &e.ResaleCapPercent,
 		)
 		if err != nil {
 			log.Println("Error fetching event by slug:", err)
@@ -121,13 +124,17 @@ func AdminCreatorGetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		resp := models.EventDetailsResponse{
-			ID:          e.ID,
-			CreatorID:   e.CreatorID,
-			Title:       e.Title,
-			Slug:        e.Slug,
-			Description: e.Description,
-			StartTime:   e.StartTime,
-			IsPublished: e.IsPublished,
+			ID:               e.ID,
+			CreatorID:        e.CreatorID,
+			Title:            e.Title,
+			Slug:             e.Slug,
+			Description:      e.Description,
+			StartTime:        e.StartTime,
+			IsPublished:      e.IsPublished,
+			Currency:         e.Currency,
+			VATRateBps:       e.VATRateBps,
+			TransfersEnabled: e.TransfersEnabled,
+			ResaleCapPercent: e.ResaleCapPercent,
 		}
 
 		if e.LocationName.Valid {
@@ -146,6 +153,17 @@ func AdminCreatorGetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		policies, err := refunds.LoadPolicies(db, []string{e.ID})
+		if err != nil {
+			log.Println("Error loading refund policy:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		resp.RefundPolicy = policies[e.ID]
+		if resp.RefundPolicy == nil {
+			resp.RefundPolicy = []models.RefundRule{}
+		}
+
 		respondWithJSON(w, http.StatusOK, resp)
 	}
 }
@@ -0,0 +1,46 @@
+package adminHandlers
+
+import (
+	"TickVibe-EventTix-backend/internal/resale"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// AdminListResalePayoutsHandler lists completed resales whose sellers have not been
+// paid out yet.
+func AdminListResalePayoutsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := resale.Ledger(db, "")
+		if err != nil {
+			log.Println("Error listing resale payouts:", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to load resale payouts")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, entries)
+	}
+}
+
+// AdminMarkResalePaidOutHandler records that the seller of a resale has been paid.
+func AdminMarkResalePaidOutHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid ledger entry ID")
+			return
+		}
+
+		err = resale.MarkPaidOut(db, id)
+		if errors.Is(err, resale.ErrLedgerNotFound) {
+			respondWithError(w, http.StatusNotFound, "Payout not found or already paid")
+			return
+		} else if err != nil {
+			log.Printf("Error marking resale payout %d as paid: %v", id, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to mark payout as paid")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]string{"message": "Payout marked as paid"})
+	}
+}
@@ -1,8 +1,11 @@
 package adminHandlers
 
 import (
+	"TickVibe-EventTix-backend/internal/handlers"
 	"TickVibe-EventTix-backend/internal/middleware"
 	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/pricing"
+	"TickVibe-EventTix-backend/internal/refunds"
 	"TickVibe-EventTix-backend/internal/utils"
 	"database/sql"
 	"encoding/json"
@@ -45,22 +48,96 @@ func AdminCreatorUpdateEventHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
-		var updatedEvent models.Event
+		// Ticket types are optional; listed ones get their purchase limits, sales
+		// window and entry rules replaced, their capacity when total_quantity is sent, and their
+		// price tiers when price_tiers is sent
+		var updatedEvent struct {
+			models.Event
+			TicketTypes []models.TicketTypeUpdateIn `json:"ticket_types"`
+		}
 		err = json.NewDecoder(r.Body).Decode(&updatedEvent)
 		if err != nil {
 			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 			return
 		}
+		for _, tt := range updatedEvent.TicketTypes {
+			if tt.ID == nil {
+				respondWithError(w, http.StatusBadRequest, "Ticket type ID is required")
+				return
+			}
+			if err := utils.ValidatePurchaseLimits(tt.PurchaseLimits); err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := utils.ValidateSales(tt.SalesWindow, tt.PriceTiers); err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := utils.ValidateServiceFees(tt.ServiceFees); err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := utils.ValidateEntryRules(tt.EntryRules); err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if tt.PlatformFeeCents != nil && claims.Role != "admin" {
+				respondWithError(w, http.StatusForbidden, "Only admins can set platform fees")
+				return
+			}
+		}
+		if err := utils.ValidateRefundPolicy(updatedEvent.RefundPolicy); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if updatedEvent.ResaleCapPercent != nil {
+			if err := utils.ValidateResaleCap(*updatedEvent.ResaleCapPercent); err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if updatedEvent.VATRateBps != nil {
+			if err := utils.ValidateVATRate(*updatedEvent.VATRateBps); err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
 
-		// Fetch the current image URL from the database
-		var currentImagePath string
-		err = db.QueryRow("SELECT image_url FROM events WHERE id = $1", eventIDParsed).Scan(&currentImagePath)
+		// Fetch the current image URL and currency from the database
+		var currentImagePath, currentCurrency string
+		err = db.QueryRow("SELECT image_url, currency FROM events WHERE id = $1", eventIDParsed).Scan(&currentImagePath, &currentCurrency)
 		if err != nil {
 			log.Println("Error fetching current image:", err)
 			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve event data")
 			return
 		}
 
+		// Prices and past orders are stored in the event's currency, so it can only
+		// change while nothing has been sold or put into checkout yet
+		currency := currentCurrency
+		if updatedEvent.Currency != "" {
+			currency, err = utils.NormalizeCurrency(updatedEvent.Currency)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid currency")
+				return
+			}
+		}
+		if currency != currentCurrency {
+			var hasSales bool
+			err = db.QueryRow(`
+				SELECT EXISTS(SELECT 1 FROM orders WHERE event_id = $1)
+				    OR EXISTS(SELECT 1 FROM checkout_session_lines WHERE event_id = $1)`, eventIDParsed).Scan(&hasSales)
+			if err != nil {
+				log.Println("Error checking event sales:", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to retrieve event data")
+				return
+			}
+			if hasSales {
+				respondWithError(w, http.StatusConflict, "Currency cannot be changed after tickets have been sold")
+				return
+			}
+		}
+
 		// Handle new image replacement if provided
 		imagePathToSave := currentImagePath
 		if updatedEvent.ImageURL != nil && strings.HasPrefix(*updatedEvent.ImageURL, "data:image/") {
@@ -96,14 +173,17 @@ func AdminCreatorUpdateEventHandler(db *sql.DB) http.HandlerFunc {
 		currentTime := time.Now().UTC()
 		result, err := db.Exec(`UPDATE events SET
 			title = $1, slug = $2, description = $3, start_time = $4, 
-			location_name = $5, location_address = $6, image_url = $7, is_published = $8, updated_at = $9
+			location_name = $5, location_address = $6, image_url = $7, is_published = $8, updated_at = $9,
+			currency = $11, vat_rate_bps = COALESCE($12, vat_rate_bps),
+			transfers_enabled = COALESCE($13, transfers_enabled), resale_cap_percent = COALESCE($14, resale_cap_percent)
 			WHERE id = $10`,
 			updatedEvent.Title, updatedEvent.Slug, updatedEvent.Description,
 			updatedEvent.StartTime,
 			sql.NullString{String: ptrToString(updatedEvent.LocationName), Valid: updatedEvent.LocationName != nil},
 			sql.NullString{String: ptrToString(updatedEvent.LocationAddress), Valid: updatedEvent.LocationAddress != nil},
 			sql.NullString{String: imagePathToSave, Valid: imagePathToSave != ""},
-			updatedEvent.IsPublished, currentTime, eventIDParsed,
+			updatedEvent.IsPublished, currentTime, eventIDParsed, currency, updatedEvent.VATRateBps,
+			updatedEvent.TransfersEnabled, updatedEvent.ResaleCapPercent,
 		)
 		if err != nil {
 			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
@@ -125,6 +205,97 @@ func AdminCreatorUpdateEventHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if updatedEvent.RefundPolicy != nil {
+			if err := replaceRefundPolicy(db, eventIDParsed.String(), updatedEvent.RefundPolicy); err != nil {
+				log.Println("Error replacing refund policy:", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to update refund policy")
+				return
+			}
+		}
+
+		if len(updatedEvent.TicketTypes) > 0 {
+			if status, msg := updateTicketTypeSales(db, eventIDParsed.String(), updatedEvent.TicketTypes); status != 0 {
+				respondWithError(w, status, msg)
+				return
+			}
+		}
+
 		respondWithJSON(w, http.StatusOK, map[string]string{"message": "Event updated successfully"})
 	}
 }
+
+// replaceRefundPolicy swaps an event's refund rules in one transaction. Orders
+// cancelled later are refunded under the new rules.
+func replaceRefundPolicy(db *sql.DB, eventID string, rules []models.RefundRule) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := refunds.ReplacePolicy(tx, eventID, rules); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateTicketTypeSales replaces the capacity, purchase limits, sales windows, entry
+// rules and, when sent, service fees and price tiers of an event's ticket types in
+// one transaction. It returns a non-zero status and message when the update was
+// refused.
+func updateTicketTypeSales(db *sql.DB, eventID string, ticketTypes []models.TicketTypeUpdateIn) (int, string) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Error starting ticket type update:", err)
+		return http.StatusInternalServerError, "Failed to update ticket types"
+	}
+	defer tx.Rollback()
+
+	for _, tt := range ticketTypes {
+		// A changed total_quantity moves available_quantity by the same amount; it
+		// cannot drop below the tickets that are already sold or held.
+		res, err := tx.Exec(`
+			UPDATE ticket_types
+			SET min_per_order = $1, max_per_order = $2, max_per_customer = $3,
+			    sales_start = $4, sales_end = $5,
+			    entry_policy = $11, max_entries = $12, valid_from = $13, valid_until = $14,
+			    platform_fee_cents = COALESCE($9, platform_fee_cents), organizer_fee_cents = COALESCE($10, organizer_fee_cents),
+			    total_quantity = CASE WHEN $8 > 0 THEN $8 ELSE total_quantity END,
+			    available_quantity = CASE WHEN $8 > 0 THEN available_quantity + $8 - total_quantity ELSE available_quantity END,
+			    updated_at = NOW()
+			WHERE id = $6 AND event_id = $7 AND ($8 = 0 OR available_quantity + $8 - total_quantity >= 0)`,
+			tt.MinOrDefault(), tt.MaxPerOrder, tt.MaxPerCustomer, tt.SalesStart, tt.SalesEnd, *tt.ID, eventID, tt.TotalQuantity,
+			tt.PlatformFeeCents, tt.OrganizerFeeCents,
+			tt.PolicyOrDefault(), tt.MaxEntries, tt.ValidFrom, tt.ValidUntil)
+		if err != nil {
+			log.Printf("Error updating ticket type %d: %v", *tt.ID, err)
+			return http.StatusInternalServerError, "Failed to update ticket types"
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var exists bool
+			if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM ticket_types WHERE id = $1 AND event_id = $2)`,
+				*tt.ID, eventID).Scan(&exists); err != nil {
+				log.Printf("Error checking ticket type %d: %v", *tt.ID, err)
+				return http.StatusInternalServerError, "Failed to update ticket types"
+			}
+			if exists {
+				return http.StatusConflict, "total_quantity cannot be below the tickets already sold or held"
+			}
+			return http.StatusBadRequest, "Ticket type does not belong to this event"
+		}
+		if tt.PriceTiers != nil {
+			if err := pricing.ReplaceTiers(tx, *tt.ID, tt.PriceTiers); err != nil {
+				log.Printf("Error replacing price tiers of ticket type %d: %v", *tt.ID, err)
+				return http.StatusInternalServerError, "Failed to update ticket types"
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing ticket type update:", err)
+		return http.StatusInternalServerError, "Failed to update ticket types"
+	}
+
+	// Added capacity goes to the waitlist before anyone else
+	go handlers.OfferReleasedStock(db)
+	return 0, ""
+}
@@ -44,6 +44,9 @@ func VerifyEmail(db *sql.DB) http.HandlerFunc {
 		// 5. Delete token
 		_, _ = db.Exec(`DELETE FROM email_verification_tokens WHERE user_id = $1`, userID)
 
+		// Guest orders bought with this address now belong to the account
+		claimGuestOrders(db, userID)
+
 		// 6. Respond
 		sendSuccessResponse(w, map[string]interface{}{
 			"success": true,
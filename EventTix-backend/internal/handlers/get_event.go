@@ -1,35 +1,61 @@
 package handlers
 
 import (
+	"TickVibe-EventTix-backend/internal/models"
+	"TickVibe-EventTix-backend/internal/pricing"
+	"TickVibe-EventTix-backend/internal/refunds"
+	"TickVibe-EventTix-backend/internal/resale"
+	"TickVibe-EventTix-backend/internal/seating"
 	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 )
 
+// TicketType is a ticket type as buyers see it. PriceCents is the price charged right
+// now, RegularPriceCents the price once no tier applies any more.
 type TicketType struct {
-	Id                int    `json:"id"`
-	Name              string `json:"name"`
-	Description       string `json:"description,omitempty"`
-	PriceCents        int    `json:"price_cents"`
-	TotalQuantity     int    `json:"total_quantity"`
-	AvailableQuantity int    `json:"available_quantity"`
+	Id                int                  `json:"id"`
+	Name              string               `json:"name"`
+	Description       string               `json:"description,omitempty"`
+	PriceCents        int                  `json:"price_cents"`
+	RegularPriceCents int                  `json:"regular_price_cents"`
+	ServiceFeeCents   int64                `json:"service_fee_cents"` // charged per ticket on top of PriceCents
+	TotalQuantity     int                  `json:"total_quantity"`
+	AvailableQuantity int                  `json:"available_quantity"`
+	MinPerOrder       int                  `json:"min_per_order"`
+	MaxPerOrder       *int                 `json:"max_per_order,omitempty"`
+	MaxPerCustomer    *int                 `json:"max_per_customer,omitempty"`
+	SalesStatus       string               `json:"sales_status"`
+	SalesStart        *time.Time           `json:"sales_start,omitempty"`
+	SalesEnd          *time.Time           `json:"sales_end,omitempty"`
+	TierName          string               `json:"tier_name,omitempty"`
+	TierEndsAt        *time.Time           `json:"tier_ends_at,omitempty"`
+	TierRemaining     *int                 `json:"tier_remaining,omitempty"` // tickets left at the tier price
+	Resale            *resale.Availability `json:"resale,omitempty"`         // fan resale, shown once sold out
+	Seated            bool                 `json:"seated"`                   // bought by picking seats on the seat map
+	models.EntryRules                      // how often and when the ticket admits its holder
 }
 
 type EventDetail struct {
-	ID              string       `json:"id"`
-	Title           string       `json:"title"`
-	Slug            string       `json:"slug"`
-	Description     string       `json:"description,omitempty"`
-	CityID          int          `json:"city_id"`
-	CityName        string       `json:"city_name"`
-	VoivodeshipName string       `json:"voivodeship_name"`
-	StartTime       string       `json:"start_time"`
-	LocationName    string       `json:"location_name"`
-	ImageURL        string       `json:"image_url,omitempty"`
-	CategorySlugs   []string     `json:"category_slugs,omitempty"`
-	TicketTypes     []TicketType `json:"ticket_types,omitempty"`
+	ID               string              `json:"id"`
+	Title            string              `json:"title"`
+	Slug             string              `json:"slug"`
+	Description      string              `json:"description,omitempty"`
+	CityID           int                 `json:"city_id"`
+	CityName         string              `json:"city_name"`
+	VoivodeshipName  string              `json:"voivodeship_name"`
+	StartTime        string              `json:"start_time"`
+	LocationName     string              `json:"location_name"`
+	ImageURL         string              `json:"image_url,omitempty"`
+	Currency         string              `json:"currency"` // ticket prices are in this currency's minor unit
+	CategorySlugs    []string            `json:"category_slugs,omitempty"`
+	TicketTypes      []TicketType        `json:"ticket_types,omitempty"`
+	RefundPolicy     []models.RefundRule `json:"refund_policy,omitempty"` // largest threshold first
+	TransfersEnabled bool                `json:"transfers_enabled"`
+	Seated           bool                `json:"seated"` // the seat map is at /api/events/{slug}/seats
 }
 
 func GetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
@@ -45,7 +71,8 @@ func GetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 		err := db.QueryRow(`
 			SELECT 
 			e.id, e.title, e.slug, e.description, e.start_time, e.location_name, e.image_url,
-			e.city_id, c.name AS city_name, v.name AS voivodeship_name
+			e.city_id, c.name AS city_name, v.name AS voivodeship_name, e.currency, e.transfers_enabled,
+			e.venue_id IS NOT NULL
 			FROM events e
 			LEFT JOIN cities c ON e.city_id = c.id
 			LEFT JOIN voivodeships v ON c.voivodeship_id = v.id
@@ -53,7 +80,8 @@ func GetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 			`, slug).Scan(
 			&event.ID, &event.Title, &event.Slug, &event.Description,
 			&event.StartTime, &event.LocationName, &event.ImageURL,
-			&event.CityID, &event.CityName, &event.VoivodeshipName,
+			&event.CityID, &event.CityName, &event.VoivodeshipName, &event.Currency, &event.TransfersEnabled,
+			&event.Seated,
 		)
 
 		if err == sql.ErrNoRows {
@@ -67,7 +95,10 @@ func GetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 
 		// Fetch ticket types
 		rows, err := db.Query(`
-			SELECT id, name, description, price_cents, total_quantity, available_quantity
+			SELECT id, name, description, price_cents, total_quantity, available_quantity,
+			       min_per_order, max_per_order, max_per_customer, sales_start, sales_end,
+			       platform_fee_cents + organizer_fee_cents,
+			       entry_policy, max_entries, valid_from, valid_until
 			FROM ticket_types
 			WHERE event_id = $1
 		`, event.ID)
@@ -75,13 +106,82 @@ func GetEventBySlugHandler(db *sql.DB) http.HandlerFunc {
 			defer rows.Close()
 			for rows.Next() {
 				var t TicketType
-				if err := rows.Scan(&t.Id, &t.Name, &t.Description, &t.PriceCents, &t.TotalQuantity, &t.AvailableQuantity); err == nil {
+				if err := rows.Scan(&t.Id, &t.Name, &t.Description, &t.PriceCents, &t.TotalQuantity, &t.AvailableQuantity,
+					&t.MinPerOrder, &t.MaxPerOrder, &t.MaxPerCustomer, &t.SalesStart, &t.SalesEnd, &t.ServiceFeeCents,
+					&t.Policy, &t.MaxEntries, &t.ValidFrom, &t.ValidUntil); err == nil {
 					event.TicketTypes = append(event.TicketTypes, t)
 				}
 			}
 		}
+		if err := applyPricing(db, event.TicketTypes, time.Now()); err != nil {
+			log.Println("Error loading price tiers:", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		policies, err := refunds.LoadPolicies(db, []string{event.ID})
+		if err != nil {
+			log.Println("Error loading refund policy:", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		event.RefundPolicy = policies[event.ID]
+
+		// Sold-out ticket types point buyers to tickets resold by other fans
+		availability, err := resale.AvailabilityByType(db, event.ID)
+		if err != nil {
+			log.Println("Error loading resale listings:", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		for i := range event.TicketTypes {
+			if a, ok := availability[event.TicketTypes[i].Id]; ok && event.TicketTypes[i].AvailableQuantity == 0 {
+				event.TicketTypes[i].Resale = &a
+			}
+		}
+
+		seated, err := seating.SeatedTypes(db, event.ID)
+		if err != nil {
+			log.Println("Error loading seated ticket types:", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		for i := range event.TicketTypes {
+			event.TicketTypes[i].Seated = seated[event.TicketTypes[i].Id]
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(event)
 	}
 }
+
+// applyPricing fills in the sales status and the price tier in effect at now, the
+// same tier inventory.Reserve would charge for the next ticket.
+func applyPricing(db *sql.DB, ticketTypes []TicketType, now time.Time) error {
+	ids := make([]int, 0, len(ticketTypes))
+	for _, t := range ticketTypes {
+		ids = append(ids, t.Id)
+	}
+	tiers, err := pricing.LoadTiers(db, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range ticketTypes {
+		t := &ticketTypes[i]
+		t.SalesStatus = pricing.Status(models.SalesWindow{SalesStart: t.SalesStart, SalesEnd: t.SalesEnd}, t.AvailableQuantity, now)
+		t.RegularPriceCents = t.PriceCents
+
+		sold := t.TotalQuantity - t.AvailableQuantity
+		if tier := pricing.Current(tiers[t.Id], sold, now); tier != nil {
+			t.PriceCents = tier.PriceCents
+			t.TierName = tier.Name
+			t.TierEndsAt = tier.EndsAt
+			if tier.UntilSold != nil {
+				remaining := min(*tier.UntilSold-sold, t.AvailableQuantity)
+				t.TierRemaining = &remaining
+			}
+		}
+	}
+	return nil
+}
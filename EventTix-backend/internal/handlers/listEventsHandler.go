@@ -24,6 +24,7 @@ type EventResponse struct {
 	CityName        string    `json:"city_name"`
 	VoivodeshipID   int       `json:"voivodeship_id"`
 	VoivodeshipName string    `json:"voivodeship_name"`
+	Currency        string    `json:"currency"`
 	CategoryIDs     []int     `json:"category_ids"` // Note: This is still an empty slice in the scan loop
 }
 
@@ -80,7 +81,7 @@ func GetEventsHandler(db *sql.DB) http.HandlerFunc {
                 e.id, e.title, e.slug, e.description, e.start_time,
                 e.location_name, e.location_address, e.image_url,
                 e.city_id, c.name AS city_name,
-                v.id AS voivodeship_id, v.name AS voivodeship_name
+                v.id AS voivodeship_id, v.name AS voivodeship_name, e.currency
             FROM events e
             JOIN cities c ON e.city_id = c.id
             JOIN voivodeships v ON c.voivodeship_id = v.id
@@ -272,7 +273,7 @@ func GetEventsHandler(db *sql.DB) http.HandlerFunc {
 			err := rows.Scan(
 				&e.ID, &e.Title, &e.Slug, &e.Description, &e.StartTime,
 				&e.LocationName, &e.LocationAddress, &e.ImageURL,
-				&e.CityID, &e.CityName, &e.VoivodeshipID, &e.VoivodeshipName,
+				&e.CityID, &e.CityName, &e.VoivodeshipID, &e.VoivodeshipName, &e.Currency,
 			)
 			if err != nil {
 				log.Println("Error scanning row:", err)
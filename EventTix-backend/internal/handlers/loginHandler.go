@@ -89,6 +89,11 @@ func Login(db *sql.DB) http.HandlerFunc {
 			    account_locked_until = NULL 
 			WHERE email = $1`, request.Email)
 
+		// Picks up guest purchases made with this address since the last login
+		if isEmailVerified {
+			go claimGuestOrders(db, userID)
+		}
+
 		tokenString, err := utils.GenerateJWT(userID, userRole, request.Email, isEmailVerified, fullName)
 		if err != nil {
 			sendErrorResponse(writer, "Failed to generate token", http.StatusInternalServerError)
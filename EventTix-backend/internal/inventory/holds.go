@@ -0,0 +1,335 @@
+// Package inventory reserves ticket_types stock for open checkout sessions.
+//
+// Reserving decrements available_quantity immediately with a conditional UPDATE,
+// so concurrent checkouts can never take more tickets than exist. Each reservation
+// is recorded as inventory_holds rows that are later converted into a sale or
+// released back into available_quantity.
+package inventory
+
+import (
+	"TickVibe-EventTix-backend/internal/pricing"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Hold statuses stored in inventory_holds.status.
+const (
+	StatusActive    = "active"
+	StatusConverted = "converted"
+	StatusReleased  = "released"
+)
+
+var (
+	// ErrInsufficientStock is returned when a ticket type cannot cover the requested quantity.
+	ErrInsufficientStock = errors.New("not enough tickets available")
+	// ErrUnknownTicketType is returned when a ticket type does not belong to the event.
+	ErrUnknownTicketType = errors.New("invalid ticket type")
+	// ErrInvalidQuantity is returned for empty selections and non-positive quantities.
+	ErrInvalidQuantity = errors.New("invalid ticket quantity")
+	// ErrNotOnSale is returned outside a ticket type's sales window.
+	ErrNotOnSale = errors.New("ticket type is not on sale")
+	// ErrPriceTierEnds is returned when a line runs past the end of the price tier
+	// its first ticket is sold in, so its tickets would not all cost the same.
+	ErrPriceTierEnds = errors.New("not enough tickets left at the current price")
+	// ErrStockGone is returned by Convert when a hold the sweeper released was sold
+	// to someone else before its payment was confirmed.
+	ErrStockGone = errors.New("released stock is no longer available")
+)
+
+// Line is a requested quantity of a single ticket type.
+type Line struct {
+	TicketTypeID int
+	Quantity     int
+}
+
+// EventLines is what a checkout takes from one event.
+type EventLines struct {
+	EventID string
+	Lines   []Line
+}
+
+// ReservedLine is a line that was successfully reserved, with the ticket type's
+// name and price as they were at the moment of reservation. PriceCents is in the
+// minor unit of the event's Currency.
+type ReservedLine struct {
+	EventID      string
+	EventTitle   string
+	TicketTypeID int
+	Quantity     int
+	Name         string
+	PriceCents   int64
+	Currency     string
+	Tier         string // name of the price tier PriceCents comes from, if any
+
+	PlatformFeeCents  int64 // per ticket
+	OrganizerFeeCents int64 // per ticket
+	VATRateBps        int   // the event's VAT rate
+}
+
+// Reserve atomically takes stock for every line of a checkout. Either all lines are
+// reserved or none are. It returns the reservation ID that groups the holds.
+func Reserve(db *sql.DB, eventID string, lines []Line, expiresAt time.Time) (string, []ReservedLine, error) {
+	return ReserveCart(db, []EventLines{{EventID: eventID, Lines: lines}}, expiresAt)
+}
+
+// ReserveCart is Reserve for a cart holding lines from several events, which are
+// all reserved under one reservation ID or not at all.
+func ReserveCart(db *sql.DB, events []EventLines, expiresAt time.Time) (string, []ReservedLine, error) {
+	type eventLine struct {
+		eventID string
+		Line
+	}
+	var merged []eventLine
+	for _, e := range events {
+		for _, l := range e.Lines {
+			if l.Quantity <= 0 {
+				return "", nil, fmt.Errorf("%w: %d for ticket type %d", ErrInvalidQuantity, l.Quantity, l.TicketTypeID)
+			}
+		}
+		for _, l := range MergeLines(e.Lines) {
+			merged = append(merged, eventLine{eventID: e.EventID, Line: l})
+		}
+	}
+	if len(merged) == 0 {
+		return "", nil, fmt.Errorf("%w: no tickets requested", ErrInvalidQuantity)
+	}
+	// Rows are locked in ticket type order across events too
+	sort.Slice(merged, func(i, j int) bool { return merged[i].TicketTypeID < merged[j].TicketTypeID })
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	reservationID := uuid.New().String()
+	reserved := make([]ReservedLine, 0, len(merged))
+	now := time.Now()
+
+	for _, l := range merged {
+		// The row stays locked until commit, so the sold count that picks the price
+		// tier cannot change under us.
+		r := ReservedLine{EventID: l.eventID, TicketTypeID: l.TicketTypeID, Quantity: l.Quantity}
+		var sold int
+		err := tx.QueryRow(`
+			UPDATE ticket_types tt
+			SET available_quantity = tt.available_quantity - $1
+			FROM events e
+			WHERE tt.id = $2 AND tt.event_id = $3 AND e.id = tt.event_id AND tt.available_quantity >= $1
+			  AND (tt.sales_start IS NULL OR tt.sales_start <= $4)
+			  AND (tt.sales_end IS NULL OR tt.sales_end > $4)
+			RETURNING tt.name, tt.price_cents, e.currency, tt.total_quantity - tt.available_quantity - $1,
+			          tt.platform_fee_cents, tt.organizer_fee_cents, e.vat_rate_bps, e.title`,
+			l.Quantity, l.TicketTypeID, l.eventID, now).Scan(&r.Name, &r.PriceCents, &r.Currency, &sold,
+			&r.PlatformFeeCents, &r.OrganizerFeeCents, &r.VATRateBps, &r.EventTitle)
+		if err == sql.ErrNoRows {
+			var exists, onSale bool
+			if err := tx.QueryRow(`
+				SELECT COUNT(*) > 0,
+				       COALESCE(BOOL_AND((sales_start IS NULL OR sales_start <= $3) AND (sales_end IS NULL OR sales_end > $3)), FALSE)
+				FROM ticket_types WHERE id = $1 AND event_id = $2`,
+				l.TicketTypeID, l.eventID, now).Scan(&exists, &onSale); err != nil {
+				return "", nil, err
+			}
+			if !exists {
+				return "", nil, ErrUnknownTicketType
+			}
+			if !onSale {
+				return "", nil, fmt.Errorf("%w: ticket type %d", ErrNotOnSale, l.TicketTypeID)
+			}
+			return "", nil, ErrInsufficientStock
+		} else if err != nil {
+			return "", nil, err
+		}
+
+		tiers, err := pricing.LoadTiers(tx, []int{l.TicketTypeID})
+		if err != nil {
+			return "", nil, err
+		}
+		price, tier := pricing.Price(r.PriceCents, tiers[l.TicketTypeID], sold, now)
+		// A line is sold at one price, so it may not run past its tier's until_sold
+		if last, _ := pricing.Price(r.PriceCents, tiers[l.TicketTypeID], sold+l.Quantity-1, now); last != price {
+			left := l.Quantity
+			for left > 0 {
+				if p, _ := pricing.Price(r.PriceCents, tiers[l.TicketTypeID], sold+left-1, now); p == price {
+					break
+				}
+				left--
+			}
+			return "", nil, fmt.Errorf("%w: %d of ticket type %d", ErrPriceTierEnds, left, l.TicketTypeID)
+		}
+		r.PriceCents = price
+		if tier != nil {
+			r.Tier = tier.Name
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO inventory_holds (reservation_id, ticket_type_id, quantity, status, expires_at)
+			VALUES ($1, $2, $3, $4, $5)`,
+			reservationID, l.TicketTypeID, l.Quantity, StatusActive, expiresAt); err != nil {
+			return "", nil, err
+		}
+
+		reserved = append(reserved, r)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", nil, err
+	}
+	return reservationID, reserved, nil
+}
+
+// AttachSession links a reservation to its payment session and aligns the hold
+// expiry with the session's own expiry.
+func AttachSession(db *sql.DB, reservationID, sessionID string, expiresAt time.Time) error {
+	_, err := db.Exec(`
+		UPDATE inventory_holds
+		SET checkout_session_id = $1, expires_at = $2, updated_at = NOW()
+		WHERE reservation_id = $3 AND status = $4`,
+		sessionID, expiresAt, reservationID, StatusActive)
+	return err
+}
+
+// Convert turns a reservation into sold stock once it has been paid for. Holds that
+// the sweeper already released are taken again; if the stock is gone by then it
+// returns ErrStockGone and the caller must not sell the tickets. It runs in the
+// caller's transaction, so the stock is only sold if the order is written as well.
+func Convert(tx *sql.Tx, reservationID string) error {
+	rows, err := tx.Query(`
+		SELECT id, ticket_type_id, quantity, status
+		FROM inventory_holds
+		WHERE reservation_id = $1 AND status <> $2
+		ORDER BY ticket_type_id
+		FOR UPDATE`, reservationID, StatusConverted)
+	if err != nil {
+		return err
+	}
+
+	type hold struct {
+		id           int64
+		ticketTypeID int
+		quantity     int
+		status       string
+	}
+	var holds []hold
+	for rows.Next() {
+		var h hold
+		if err := rows.Scan(&h.id, &h.ticketTypeID, &h.quantity, &h.status); err != nil {
+			rows.Close()
+			return err
+		}
+		holds = append(holds, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, h := range holds {
+		if h.status == StatusReleased {
+			res, err := tx.Exec(`
+				UPDATE ticket_types
+				SET available_quantity = available_quantity - $1
+				WHERE id = $2 AND available_quantity >= $1`, h.quantity, h.ticketTypeID)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return fmt.Errorf("%w: hold %d of %d tickets of type %d expired before payment was confirmed",
+					ErrStockGone, h.id, h.quantity, h.ticketTypeID)
+			}
+		}
+
+		if _, err := tx.Exec(`UPDATE inventory_holds SET status = $1, updated_at = NOW() WHERE id = $2`,
+			StatusConverted, h.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Release gives the stock of a still-active reservation back. It is a no-op for
+// reservations that were already converted or released.
+func Release(db *sql.DB, reservationID string) (int64, error) {
+	return releaseWhere(db, `reservation_id = $2`, reservationID)
+}
+
+// ReleaseBySession releases the reservation attached to a payment session.
+func ReleaseBySession(db *sql.DB, sessionID string) (int64, error) {
+	return releaseWhere(db, `checkout_session_id = $2`, sessionID)
+}
+
+// ReleaseExpired releases every active hold whose expiry has passed.
+func ReleaseExpired(db *sql.DB) (int64, error) {
+	return releaseWhere(db, `expires_at < $2`, time.Now())
+}
+
+// releaseWhere marks matching active holds as released and returns their quantity
+// to ticket_types in a single statement, so a hold can never be released twice.
+func releaseWhere(db *sql.DB, cond string, arg interface{}) (int64, error) {
+	res, err := db.Exec(`
+		WITH released AS (
+			UPDATE inventory_holds
+			SET status = '`+StatusReleased+`', updated_at = NOW()
+			WHERE status = $1 AND `+cond+`
+			RETURNING ticket_type_id, quantity
+		), totals AS (
+			SELECT ticket_type_id, SUM(quantity) AS quantity
+			FROM released
+			GROUP BY ticket_type_id
+		)
+		UPDATE ticket_types tt
+		SET available_quantity = tt.available_quantity + totals.quantity
+		FROM totals
+		WHERE tt.id = totals.ticket_type_id`, StatusActive, arg)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// StartSweeper releases expired holds every interval until ctx is cancelled.
+func StartSweeper(ctx context.Context, db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := ReleaseExpired(db)
+				if err != nil {
+					log.Printf("Inventory sweeper failed: %v", err)
+				} else if n > 0 {
+					log.Printf("Inventory sweeper released expired holds on %d ticket types", n)
+				}
+			}
+		}
+	}()
+}
+
+// MergeLines folds duplicate ticket types together and orders lines by ticket type,
+// so concurrent reservations always lock ticket_types rows in the same order.
+func MergeLines(lines []Line) []Line {
+	byType := make(map[int]int)
+	for _, l := range lines {
+		byType[l.TicketTypeID] += l.Quantity
+	}
+
+	merged := make([]Line, 0, len(byType))
+	for id, qty := range byType {
+		merged = append(merged, Line{TicketTypeID: id, Quantity: qty})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].TicketTypeID < merged[j].TicketTypeID })
+	return merged
+}
@@ -0,0 +1,144 @@
+package inventory
+
+import (
+	"TickVibe-EventTix-backend/internal/testdb"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// buy reserves one ticket and converts the hold, as a paid checkout does.
+func buy(db *sql.DB, eventID string, ticketTypeID int) error {
+	reservationID, _, err := Reserve(db, eventID, []Line{{TicketTypeID: ticketTypeID, Quantity: 1}}, time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	return convert(db, reservationID)
+}
+
+func convert(db *sql.DB, reservationID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := Convert(tx, reservationID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func TestParallelCheckoutsForLastTicket(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	ticketTypeID := testdb.TicketType(t, db, eventID, 1, 1000)
+
+	const buyers = 25
+	errs := make(chan error, buyers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- buy(db, eventID, ticketTypeID)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	sales := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			sales++
+		case errors.Is(err, ErrInsufficientStock):
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if sales != 1 {
+		t.Fatalf("%d sales of the last ticket, want exactly 1", sales)
+	}
+
+	if n := testdb.Count(t, db, `SELECT available_quantity FROM ticket_types WHERE id = $1`, ticketTypeID); n != 0 {
+		t.Errorf("available_quantity = %d, want 0", n)
+	}
+	if n := testdb.Count(t, db, `SELECT COALESCE(SUM(quantity), 0) FROM inventory_holds WHERE ticket_type_id = $1 AND status = $2`,
+		ticketTypeID, StatusConverted); n != 1 {
+		t.Errorf("%d tickets converted, want 1", n)
+	}
+}
+
+func TestConvertRefusesStockSoldAfterRelease(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	ticketTypeID := testdb.TicketType(t, db, eventID, 1, 1000)
+
+	// The first buyer's hold expires before their payment is confirmed, and the
+	// ticket goes to a second buyer
+	late, _, err := Reserve(db, eventID, []Line{{TicketTypeID: ticketTypeID, Quantity: 1}}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("reserving: %v", err)
+	}
+	if _, err := Release(db, late); err != nil {
+		t.Fatalf("releasing: %v", err)
+	}
+	if err := buy(db, eventID, ticketTypeID); err != nil {
+		t.Fatalf("second buyer: %v", err)
+	}
+
+	if err := convert(db, late); !errors.Is(err, ErrStockGone) {
+		t.Fatalf("converting the expired hold: err = %v, want ErrStockGone", err)
+	}
+	if n := testdb.Count(t, db, `SELECT available_quantity FROM ticket_types WHERE id = $1`, ticketTypeID); n != 0 {
+		t.Errorf("available_quantity = %d, want 0", n)
+	}
+	if n := testdb.Count(t, db, `SELECT COUNT(*) FROM inventory_holds WHERE reservation_id = $1 AND status = $2`,
+		late, StatusReleased); n != 1 {
+		t.Errorf("expired hold was not left released")
+	}
+}
+
+func TestReserveRefusesLineAcrossPriceTier(t *testing.T) {
+	db := testdb.Open(t)
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+	ticketTypeID := testdb.TicketType(t, db, eventID, 10, 2000)
+	if _, err := db.Exec(`
+		INSERT INTO ticket_price_tiers (ticket_type_id, position, name, price_cents, until_sold)
+		VALUES ($1, 1, 'Early bird', 1000, 3)`, ticketTypeID); err != nil {
+		t.Fatalf("creating price tier: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+
+	// Two early bird tickets are left after the first one is held
+	if _, _, err := Reserve(db, eventID, []Line{{TicketTypeID: ticketTypeID, Quantity: 1}}, expiresAt); err != nil {
+		t.Fatalf("reserving the first ticket: %v", err)
+	}
+	_, _, err := Reserve(db, eventID, []Line{{TicketTypeID: ticketTypeID, Quantity: 3}}, expiresAt)
+	if !errors.Is(err, ErrPriceTierEnds) {
+		t.Fatalf("reserving across the tier: err = %v, want %v", err, ErrPriceTierEnds)
+	}
+	if n := testdb.Count(t, db, `SELECT available_quantity FROM ticket_types WHERE id = $1`, ticketTypeID); n != 9 {
+		t.Errorf("available_quantity = %d, want 9", n)
+	}
+
+	_, reserved, err := Reserve(db, eventID, []Line{{TicketTypeID: ticketTypeID, Quantity: 2}}, expiresAt)
+	if err != nil {
+		t.Fatalf("reserving the rest of the tier: %v", err)
+	}
+	if reserved[0].PriceCents != 1000 || reserved[0].Tier != "Early bird" {
+		t.Errorf("priced at %d from tier %q, want 1000 from the early bird tier", reserved[0].PriceCents, reserved[0].Tier)
+	}
+	_, reserved, err = Reserve(db, eventID, []Line{{TicketTypeID: ticketTypeID, Quantity: 2}}, expiresAt)
+	if err != nil {
+		t.Fatalf("reserving after the tier: %v", err)
+	}
+	if reserved[0].PriceCents != 2000 {
+		t.Errorf("priced at %d after the tier, want 2000", reserved[0].PriceCents)
+	}
+}
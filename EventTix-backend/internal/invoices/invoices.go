@@ -0,0 +1,204 @@
+// Package invoices issues VAT invoices for orders. Every order gets at most one
+// invoice; it is numbered and rendered to PDF on first request and stored, so later
+// downloads return the same document even if the order or event change.
+package invoices
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrOrderNotFound  = errors.New("order not found")
+	ErrNotInvoiceable = errors.New("order cannot be invoiced")
+)
+
+// Invoice is an issued invoice and its rendered PDF.
+type Invoice struct {
+	Number   string
+	IssuedAt time.Time
+	PDF      []byte
+}
+
+// Party is the seller or buyer printed on an invoice. NIP is empty for private buyers.
+type Party struct {
+	Name    string
+	Address string
+	NIP     string
+}
+
+// line is one order line as printed on the invoice. Fees are line totals.
+type line struct {
+	Name       string
+	Quantity   int
+	FeesCents  int64
+	VATRateBps int
+	NetCents   int64
+	VATCents   int64
+	GrossCents int64
+}
+
+// document is everything the PDF is rendered from.
+type document struct {
+	Number     string
+	IssuedAt   time.Time
+	SoldAt     time.Time
+	EventTitle string
+	Currency   string
+	Seller     Party
+	Buyer      Party
+	Lines      []line
+}
+
+// sellerFromEnv reads the platform's own details, which appear on every invoice.
+func sellerFromEnv() Party {
+	seller := Party{
+		Name:    os.Getenv("INVOICE_SELLER_NAME"),
+		Address: os.Getenv("INVOICE_SELLER_ADDRESS"),
+		NIP:     os.Getenv("INVOICE_SELLER_NIP"),
+	}
+	if seller.Name == "" {
+		seller.Name = "TickVibe EventTix"
+	}
+	return seller
+}
+
+// OrderParties returns the buyer of an order and the creators of the events it is
+// for, for access checks. The buyer is empty for guest orders; a cart order can
+// span events of several creators.
+func OrderParties(db *sql.DB, orderID string) (buyerID string, creatorIDs []string, err error) {
+	err = db.QueryRow(`
+		SELECT COALESCE(o.user_id::text, ''),
+		       ARRAY(SELECT DISTINCT e.creator_id::text
+		             FROM events e
+		             WHERE e.id = o.event_id OR e.id IN (SELECT event_id FROM order_lines WHERE order_id = o.id))
+		FROM orders o
+		WHERE o.id = $1`, orderID).Scan(&buyerID, pq.Array(&creatorIDs))
+	if err == sql.ErrNoRows {
+		return "", nil, ErrOrderNotFound
+	}
+	return buyerID, creatorIDs, err
+}
+
+// ForOrder returns the invoice of an order, issuing it first if there is none yet.
+// The order row is locked while the invoice is issued, so concurrent downloads
+// cannot use up two numbers. Numbers come from a per-year counter that is bumped
+// in the same transaction, which keeps the sequence free of gaps.
+func ForOrder(db *sql.DB, orderID string) (*Invoice, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	doc := document{Seller: sellerFromEnv()}
+	var status, userName, userEmail string
+	var companyName, nip, address sql.NullString
+	var vatRate int
+	var totalCents int64
+	err = tx.QueryRow(`
+		SELECT o.status, o.created_at, o.currency, o.total_amount_cents,
+		       o.buyer_company_name, o.buyer_nip, o.buyer_address,
+		       COALESCE(e.title, (SELECT string_agg(DISTINCT ev.title, ', ')
+		                          FROM order_lines ol JOIN events ev ON ev.id = ol.event_id
+		                          WHERE ol.order_id = o.id), ''),
+		       COALESCE(e.vat_rate_bps, 0), COALESCE(u.username, g.name), COALESCE(u.email, g.email)
+		FROM orders o
+		LEFT JOIN events e ON e.id = o.event_id
+		LEFT JOIN users u ON u.id = o.user_id
+		LEFT JOIN guest_contacts g ON g.id = o.guest_contact_id
+		WHERE o.id = $1
+		FOR UPDATE OF o`, orderID).Scan(
+		&status, &doc.SoldAt, &doc.Currency, &totalCents,
+		&companyName, &nip, &address,
+		&doc.EventTitle, &vatRate, &userName, &userEmail)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	inv := &Invoice{}
+	err = tx.QueryRow(`SELECT number, issued_at, pdf FROM invoices WHERE order_id = $1`, orderID).
+		Scan(&inv.Number, &inv.IssuedAt, &inv.PDF)
+	if err == nil {
+		return inv, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// Orders still being refunded are invoiced once the refund settles. Free
+	// registrations have nothing to invoice.
+	if status == "refund_pending" || totalCents == 0 {
+		return nil, ErrNotInvoiceable
+	}
+
+	if companyName.Valid {
+		doc.Buyer = Party{Name: companyName.String, Address: address.String, NIP: nip.String}
+	} else {
+		doc.Buyer = Party{Name: userName, Address: userEmail}
+	}
+
+	doc.Lines, err = orderLines(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Lines) == 0 {
+		// Orders placed before line breakdowns were stored are invoiced as one line
+		// at the event's current rate.
+		doc.Lines = []line{fallbackLine(doc.EventTitle, totalCents, vatRate)}
+	}
+
+	doc.IssuedAt = time.Now().UTC()
+	var seq int
+	err = tx.QueryRow(`
+		INSERT INTO invoice_sequences (year, last_number) VALUES ($1, 1)
+		ON CONFLICT (year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number`, doc.IssuedAt.Year()).Scan(&seq)
+	if err != nil {
+		return nil, err
+	}
+	doc.Number = fmt.Sprintf("FV/%d/%06d", doc.IssuedAt.Year(), seq)
+
+	pdf, err := render(doc)
+	if err != nil {
+		return nil, fmt.Errorf("render invoice %s: %w", doc.Number, err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO invoices (order_id, number, issued_at, pdf) VALUES ($1, $2, $3, $4)`,
+		orderID, doc.Number, doc.IssuedAt, pdf); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &Invoice{Number: doc.Number, IssuedAt: doc.IssuedAt, PDF: pdf}, nil
+}
+
+// orderLines loads the VAT breakdown stored on an order's lines.
+func orderLines(tx *sql.Tx, orderID string) ([]line, error) {
+	rows, err := tx.Query(`
+		SELECT name, quantity, platform_fee_cents + organizer_fee_cents, vat_rate_bps, net_cents, vat_cents, gross_cents
+		FROM order_lines
+		WHERE order_id = $1
+		ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []line
+	for rows.Next() {
+		var l line
+		if err := rows.Scan(&l.Name, &l.Quantity, &l.FeesCents, &l.VATRateBps, &l.NetCents, &l.VATCents, &l.GrossCents); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
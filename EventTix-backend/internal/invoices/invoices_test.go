@@ -0,0 +1,93 @@
+package invoices
+
+import (
+	"TickVibe-EventTix-backend/internal/testdb"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// paidOrder creates a completed order of a user for an event and returns its ID.
+func paidOrder(t *testing.T, db *sql.DB, userID, eventID string) string {
+	t.Helper()
+	var id string
+	if err := db.QueryRow(`
+		INSERT INTO orders (user_id, event_id, total_amount_cents, currency, status, payment_gateway_charge_id, ticket_quantity)
+		VALUES ($1, $2, 2500, 'PLN', 'completed', $3, 1)
+		RETURNING id`, userID, eventID, "test-"+uuid.New().String()).Scan(&id); err != nil {
+		t.Fatalf("creating order: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM invoices WHERE order_id = $1`, id) })
+	return id
+}
+
+func TestConcurrentInvoicesAreNumberedWithoutGaps(t *testing.T) {
+	db := testdb.Open(t)
+	userID := testdb.User(t, db, "user")
+	eventID := testdb.Event(t, db, testdb.User(t, db, "creator"))
+
+	const orders = 20
+	orderIDs := make([]string, orders)
+	for i := range orderIDs {
+		orderIDs[i] = paidOrder(t, db, userID, eventID)
+	}
+
+	// Every order is downloaded twice at once; the second download gets the same invoice
+	type issued struct {
+		orderID string
+		number  string
+		err     error
+	}
+	results := make(chan issued, 2*orders)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, id := range append(orderIDs, orderIDs...) {
+		wg.Add(1)
+		go func(orderID string) {
+			defer wg.Done()
+			<-start
+			inv, err := ForOrder(db, orderID)
+			if err != nil {
+				results <- issued{orderID: orderID, err: err}
+				return
+			}
+			results <- issued{orderID: orderID, number: inv.Number}
+		}(id)
+	}
+	close(start)
+	wg.Wait()
+	close(results)
+
+	byOrder := make(map[string]string)
+	for r := range results {
+		if r.err != nil {
+			t.Fatalf("issuing invoice of order %s: %v", r.orderID, r.err)
+		}
+		if n, ok := byOrder[r.orderID]; ok && n != r.number {
+			t.Errorf("order %s got invoices %s and %s", r.orderID, n, r.number)
+		}
+		byOrder[r.orderID] = r.number
+	}
+
+	var seqs []int
+	seen := make(map[string]bool)
+	for _, number := range byOrder {
+		if seen[number] {
+			t.Errorf("invoice number %s issued twice", number)
+		}
+		seen[number] = true
+		var year, seq int
+		if _, err := fmt.Sscanf(number, "FV/%d/%d", &year, &seq); err != nil {
+			t.Fatalf("unexpected invoice number %q: %v", number, err)
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	if len(seqs) != orders || seqs[len(seqs)-1]-seqs[0] != orders-1 {
+		t.Errorf("invoice numbers %v are not %d consecutive numbers", seqs, orders)
+	}
+}
@@ -0,0 +1,149 @@
+package invoices
+
+import (
+	"TickVibe-EventTix-backend/internal/pricing"
+	"TickVibe-EventTix-backend/internal/utils"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// polishLetters maps Polish diacritics to plain letters for the built-in PDF
+// fonts, which cannot show them. Setting INVOICE_FONT_PATH to a TrueType font
+// prints names and addresses as entered.
+var polishLetters = strings.NewReplacer(
+	"ą", "a", "ć", "c", "ę", "e", "ł", "l", "ń", "n", "ó", "o", "ś", "s", "ź", "z", "ż", "z",
+	"Ą", "A", "Ć", "C", "Ę", "E", "Ł", "L", "Ń", "N", "Ó", "O", "Ś", "S", "Ź", "Z", "Ż", "Z",
+)
+
+// fallbackLine is the single line of an order that has no stored breakdown.
+func fallbackLine(eventTitle string, grossCents int64, vatRateBps int) line {
+	vat := pricing.VATFromGross(grossCents, vatRateBps)
+	return line{
+		Name:       "Tickets: " + eventTitle,
+		Quantity:   1,
+		VATRateBps: vatRateBps,
+		NetCents:   grossCents - vat,
+		VATCents:   vat,
+		GrossCents: grossCents,
+	}
+}
+
+// formatRate prints a VAT rate in basis points as a percentage, e.g. 2300 as "23%".
+func formatRate(bps int) string {
+	if bps%100 == 0 {
+		return fmt.Sprintf("%d%%", bps/100)
+	}
+	return fmt.Sprintf("%d.%02d%%", bps/100, bps%100)
+}
+
+// render lays out an invoice on one A4 page (more if it has many lines).
+func render(doc document) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	font, text := "Helvetica", polishLetters.Replace
+	if path := os.Getenv("INVOICE_FONT_PATH"); path != "" {
+		pdf.AddUTF8Font("invoice", "", path)
+		pdf.AddUTF8Font("invoice", "B", path)
+		font, text = "invoice", func(s string) string { return s }
+	}
+	pdf.SetMargins(15, 15, 15)
+	pdf.AddPage()
+
+	pdf.SetFont(font, "B", 16)
+	pdf.CellFormat(0, 10, text("VAT invoice "+doc.Number), "", 1, "L", false, 0, "")
+	pdf.SetFont(font, "", 10)
+	pdf.CellFormat(0, 5, "Issue date: "+doc.IssuedAt.Format("2006-01-02"), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 5, "Sale date: "+doc.SoldAt.UTC().Format("2006-01-02"), "", 1, "L", false, 0, "")
+	pdf.Ln(6)
+
+	// Seller and buyer side by side
+	top := pdf.GetY()
+	party := func(x float64, title string, p Party) {
+		pdf.SetXY(x, top)
+		pdf.SetFont(font, "B", 10)
+		pdf.CellFormat(85, 5, title, "", 2, "L", false, 0, "")
+		pdf.SetFont(font, "", 10)
+		pdf.MultiCell(85, 5, text(p.Name), "", "L", false)
+		pdf.SetX(x)
+		if p.Address != "" {
+			pdf.MultiCell(85, 5, text(p.Address), "", "L", false)
+			pdf.SetX(x)
+		}
+		if p.NIP != "" {
+			pdf.CellFormat(85, 5, "NIP: "+p.NIP, "", 2, "L", false, 0, "")
+		}
+	}
+	party(15, "Seller", doc.Seller)
+	sellerBottom := pdf.GetY()
+	party(110, "Buyer", doc.Buyer)
+	if pdf.GetY() < sellerBottom {
+		pdf.SetY(sellerBottom)
+	}
+	pdf.Ln(8)
+
+	pdf.SetFont(font, "", 10)
+	pdf.MultiCell(0, 5, text("Event: "+doc.EventTitle), "", "L", false)
+	pdf.Ln(3)
+
+	widths := []float64{8, 72, 12, 25, 15, 22, 26}
+	header := []string{"#", "Item", "Qty", "Net", "VAT", "VAT amount", "Gross"}
+	pdf.SetFont(font, "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	for i, h := range header {
+		align := "R"
+		if i == 1 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, h, "1", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont(font, "", 9)
+	var net, vat, gross int64
+	for i, l := range doc.Lines {
+		name := l.Name
+		if l.FeesCents > 0 {
+			name += " incl. service fees " + utils.FormatAmount(l.FeesCents, doc.Currency)
+		}
+		cells := []string{
+			fmt.Sprint(i + 1), text(name), fmt.Sprint(l.Quantity),
+			utils.FormatAmount(l.NetCents, doc.Currency), formatRate(l.VATRateBps),
+			utils.FormatAmount(l.VATCents, doc.Currency), utils.FormatAmount(l.GrossCents, doc.Currency),
+		}
+		for j, c := range cells {
+			align := "R"
+			if j == 1 {
+				align = "L"
+				// Long names are cut to the column rather than wrapped
+				for pdf.GetStringWidth(c) > widths[j]-2 && len(c) > 0 {
+					c = strings.TrimSuffix(c[:len(c)-1], " ")
+				}
+			}
+			pdf.CellFormat(widths[j], 7, c, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+		net += l.NetCents
+		vat += l.VATCents
+		gross += l.GrossCents
+	}
+
+	pdf.SetFont(font, "B", 9)
+	pdf.CellFormat(widths[0]+widths[1]+widths[2], 7, "Total", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[3], 7, utils.FormatAmount(net, doc.Currency), "1", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[4], 7, "", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[5], 7, utils.FormatAmount(vat, doc.Currency), "1", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[6], 7, utils.FormatAmount(gross, doc.Currency), "1", 1, "R", false, 0, "")
+	pdf.Ln(6)
+
+	pdf.SetFont(font, "", 10)
+	pdf.CellFormat(0, 5, "Amount paid: "+utils.FormatAmount(gross, doc.Currency), "", 1, "L", false, 0, "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
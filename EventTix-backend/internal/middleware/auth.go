@@ -32,6 +32,19 @@ func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// OptionalAuth adds the logged-in user to the context when the request carries a
+// valid token, and passes the request on as anonymous otherwise.
+func OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if cookie, err := request.Cookie("token"); err == nil {
+			if claims, err := utils.ParseJWT(cookie.Value); err == nil {
+				request = request.WithContext(context.WithValue(request.Context(), userContextKey, claims))
+			}
+		}
+		next(writer, request)
+	}
+}
+
 // GetUserFromContext extracts user info from context
 func GetUserFromContext(r *http.Request) (*utils.Claims, bool) {
 	claims, ok := r.Context().Value(userContextKey).(*utils.Claims)
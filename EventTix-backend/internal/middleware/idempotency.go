@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IdempotencyKeyHeader lets clients retry a request without repeating its effect.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	idempotencyKeyTTL      = 24 * time.Hour
+	maxIdempotentBodyBytes = int64(1 << 20)
+)
+
+// Idempotent replays the stored response when a request is repeated with the same
+// Idempotency-Key, instead of running the handler again. Requests without the
+// header are passed through. Server errors are not stored, so those can be retried.
+// Keys are scoped to the caller, so it must run after the auth middleware.
+func Idempotent(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+		scope := r.Method + " " + r.URL.Path + " " + idempotencyCaller(r, requestHash)
+
+		// Claim the key; a key whose stored response has expired is claimed anew
+		res, err := db.Exec(`
+			INSERT INTO idempotency_keys (key, scope, request_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (key, scope) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_body = NULL,
+			    created_at = NOW(), expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at < NOW()`,
+			key, scope, requestHash, time.Now().Add(idempotencyKeyTTL))
+		if err != nil {
+			log.Printf("Error claiming idempotency key: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			replayIdempotentResponse(w, db, key, scope, requestHash)
+			return
+		}
+
+		// A handler that panics stored nothing, so the key is given back for a retry
+		defer func() {
+			if p := recover(); p != nil {
+				if _, err := db.Exec(`DELETE FROM idempotency_keys WHERE key = $1 AND scope = $2`, key, scope); err != nil {
+					log.Printf("Error releasing idempotency key %q: %v", key, err)
+				}
+				panic(p)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		if rec.status >= http.StatusInternalServerError {
+			_, err = db.Exec(`DELETE FROM idempotency_keys WHERE key = $1 AND scope = $2`, key, scope)
+		} else {
+			_, err = db.Exec(`UPDATE idempotency_keys SET status_code = $1, response_body = $2 WHERE key = $3 AND scope = $4`,
+				rec.status, rec.body.Bytes(), key, scope)
+		}
+		if err != nil {
+			log.Printf("Error storing response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// idempotencyCaller names who sent a request: the logged-in user, or for a guest the
+// request itself, so a guest's key only ever replays the identical request.
+func idempotencyCaller(r *http.Request, requestHash string) string {
+	if claims, ok := GetUserFromContext(r); ok {
+		return "user:" + claims.UserID
+	}
+	return "guest:" + requestHash
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, db *sql.DB, key, scope, requestHash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var body []byte
+	err := db.QueryRow(`SELECT request_hash, status_code, response_body FROM idempotency_keys WHERE key = $1 AND scope = $2`,
+		key, scope).Scan(&storedHash, &status, &body)
+	if err != nil {
+		log.Printf("Error loading idempotency key %q: %v", key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case storedHash != requestHash:
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+	case !status.Valid:
+		http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(int(status.Int64))
+		_, _ = w.Write(body)
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -12,6 +12,7 @@ type AdminTicketInfo struct {
 	TicketTypeID   int       `json:"ticket_type_id"`
 	Code           string    `json:"ticket_code"`
 	Status         bool      `json:"is_used"`
+	IsVoid         bool      `json:"is_void"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"` // Only admin
 	UserEmail      string    `json:"user_email"` // Only admin
@@ -20,12 +21,24 @@ type AdminTicketInfo struct {
 }
 
 type UserTicketInfo struct {
-	ID             uuid.UUID `json:"id"`
-	OrderID        uuid.UUID `json:"order_id"`
-	TicketTypeID   int       `json:"ticket_type_id"`
-	Code           string    `json:"ticket_code"`
-	Status         bool      `json:"is_used"`
-	CreatedAt      time.Time `json:"created_at"`
-	EventTitle     string    `json:"event_title"`
-	TicketTypeName string    `json:"ticket_type_name"`
+	ID               uuid.UUID `json:"id"`
+	OrderID          uuid.UUID `json:"order_id"`
+	TicketTypeID     int       `json:"ticket_type_id"`
+	Code             string    `json:"ticket_code"`
+	Status           bool      `json:"is_used"`
+	IsVoid           bool      `json:"is_void"`
+	CreatedAt        time.Time `json:"created_at"`
+	EventTitle       string    `json:"event_title"`
+	TicketTypeName   string    `json:"ticket_type_name"`
+	EventID          string    `json:"-"`
+	EventStart       time.Time `json:"event_start_time"`
+	RefundPercent    int       `json:"refund_percent"` // refunded if cancelled now; 0 when it cannot be
+	IsBuyer          bool      `json:"-"`
+	TransfersEnabled bool      `json:"transfers_enabled"`
+	TransferTo       *string   `json:"transfer_to"` // recipient of the open transfer, if any
+	FaceValueCents   int64     `json:"-"`
+	ResaleCapPercent int       `json:"-"`
+	ResaleMaxCents   int64     `json:"resale_max_cents"`   // most it may be listed for
+	ListedPriceCents *int64    `json:"listed_price_cents"` // price of the open resale listing, if any
+	Seat             string    `json:"seat,omitempty"`     // empty for general admission
 }
@@ -3,12 +3,17 @@ package models
 import "time"
 
 type TicketTypeOut struct {
-	ID                int       `json:"id"`
-	Name              string    `json:"name"`
-	Description       string    `json:"description"`
-	PriceCents        int       `json:"price_cents"`
-	TotalQuantity     int       `json:"total_quantity"`
-	AvailableQuantity int       `json:"available_quantity"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	PriceCents        int    `json:"price_cents"`
+	TotalQuantity     int    `json:"total_quantity"`
+	AvailableQuantity int    `json:"available_quantity"`
+	PurchaseLimits
+	SalesWindow
+	ServiceFees
+	EntryRules
+	PriceTiers []PriceTier `json:"price_tiers"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
 }
@@ -3,17 +3,22 @@ package models
 import "time"
 
 type Event struct {
-	ID              string     `json:"id"` // UUID
-	Title           string     `json:"title"`
-	Slug            string     `json:"slug"`
-	Description     string     `json:"description"`
-	StartTime       time.Time  `json:"start_time"`
-	LocationName    *string    `json:"location_name"`    // Pointer to allow NULL in DB
-	LocationAddress *string    `json:"location_address"` // Pointer to allow NULL in DB
-	ImageURL        *string    `json:"image_url"`        // Pointer to allow NULL in DB
-	IsPublished     bool       `json:"is_published"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       *time.Time `json:"updated_at"` // Pointer to allow NULL in DB
+	ID               string       `json:"id"` // UUID
+	Title            string       `json:"title"`
+	Slug             string       `json:"slug"`
+	Description      string       `json:"description"`
+	StartTime        time.Time    `json:"start_time"`
+	LocationName     *string      `json:"location_name"`    // Pointer to allow NULL in DB
+	LocationAddress  *string      `json:"location_address"` // Pointer to allow NULL in DB
+	ImageURL         *string      `json:"image_url"`        // Pointer to allow NULL in DB
+	IsPublished      bool         `json:"is_published"`
+	Currency         string       `json:"currency"`           // ISO 4217; empty keeps the current currency on update
+	VATRateBps       *int         `json:"vat_rate_bps"`       // basis points, 2300 = 23%; nil keeps the current rate on update
+	RefundPolicy     []RefundRule `json:"refund_policy"`      // nil keeps the current policy on update, [] removes it
+	TransfersEnabled *bool        `json:"transfers_enabled"`  // nil keeps the current setting on update
+	ResaleCapPercent *int         `json:"resale_cap_percent"` // markup allowed on resale; nil keeps the current cap on update
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        *time.Time   `json:"updated_at"` // Pointer to allow NULL in DB
 }
 
 // In internal/adminHandlers or internal/models
@@ -36,5 +41,10 @@ type TicketTypeUpdateIn struct {
 	Description   *string `json:"description"` // Description can be optional/nullable
 	PriceCents    int     `json:"price_cents"`
 	TotalQuantity int     `json:"total_quantity"`
+	PurchaseLimits
+	SalesWindow
+	ServiceFees
+	EntryRules
+	PriceTiers []PriceTier `json:"price_tiers"` // nil keeps the current tiers, [] removes them
 	// Note: AvailableQuantity is calculated on the server side, not sent by the client
 }
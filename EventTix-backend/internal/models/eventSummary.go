@@ -12,6 +12,7 @@ type EventSummary struct {
 	ImageURL        *string `json:"image_url,omitempty"`
 
 	IsPublished *bool  `json:"is_published"`
+	Currency    string `json:"currency"`
 	CreatorID   string `json:"creator_id"` // always included for authorization checks
 
 	CreatedAt string `json:"created_at"`
@@ -8,34 +8,43 @@ import (
 )
 
 type EventDetails struct {
-	ID              string         `json:"id"`
-	CreatorID       string         `json:"creator_id"`
-	Title           string         `json:"title"`
-	Slug            string         `json:"slug"`
-	Description     string         `json:"description,omitempty"`
-	StartTime       time.Time      `json:"start_time"`
-	LocationName    sql.NullString `json:"location_name,omitempty"`
-	LocationAddress sql.NullString `json:"location_address,omitempty"`
-	ImageURL        sql.NullString `json:"image_url,omitempty"`
-	IsPublished     bool           `json:"is_published"`
-	CreatedAt       *time.Time     `json:"created_at,omitempty"`
-	UpdatedAt       *time.Time     `json:"updated_at,omitempty"`
+	ID               string         `json:"id"`
+	CreatorID        string         `json:"creator_id"`
+	Title            string         `json:"title"`
+	Slug             string         `json:"slug"`
+	Description      string         `json:"description,omitempty"`
+	StartTime        time.Time      `json:"start_time"`
+	LocationName     sql.NullString `json:"location_name,omitempty"`
+	LocationAddress  sql.NullString `json:"location_address,omitempty"`
+	ImageURL         sql.NullString `json:"image_url,omitempty"`
+	IsPublished      bool           `json:"is_published"`
+	Currency         string         `json:"currency"`
+	VATRateBps       int            `json:"vat_rate_bps"`
+	TransfersEnabled bool           `json:"transfers_enabled"`
+	ResaleCapPercent int            `json:"resale_cap_percent"`
+	CreatedAt        *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt        *time.Time     `json:"updated_at,omitempty"`
 
 	Categories  []Category   `json:"categories,omitempty"`
 	TicketTypes []TicketType `json:"ticket_types,omitempty"`
 }
 
 type EventDetailsResponse struct {
-	ID              string    `json:"id"`
-	CreatorID       string    `json:"creator_id"`
-	Title           string    `json:"title"`
-	Slug            string    `json:"slug"`
-	Description     string    `json:"description"`
-	StartTime       time.Time `json:"start_time"`
-	LocationName    *string   `json:"location_name"`
-	LocationAddress *string   `json:"location_address"`
-	ImageURL        *string   `json:"image_url"`
-	IsPublished     bool      `json:"is_published"`
+	ID               string       `json:"id"`
+	CreatorID        string       `json:"creator_id"`
+	Title            string       `json:"title"`
+	Slug             string       `json:"slug"`
+	Description      string       `json:"description"`
+	StartTime        time.Time    `json:"start_time"`
+	LocationName     *string      `json:"location_name"`
+	LocationAddress  *string      `json:"location_address"`
+	ImageURL         *string      `json:"image_url"`
+	IsPublished      bool         `json:"is_published"`
+	Currency         string       `json:"currency"`
+	VATRateBps       int          `json:"vat_rate_bps"`
+	TransfersEnabled bool         `json:"transfers_enabled"`
+	ResaleCapPercent int          `json:"resale_cap_percent"`
+	RefundPolicy     []RefundRule `json:"refund_policy"`
 }
 
 type Category struct {
@@ -6,10 +6,15 @@ import (
 
 type OrderInfo struct {
 	ID          string    `json:"id"`
-	UserID      string    `json:"user_id"`
+	UserID      string    `json:"user_id"`    // empty for guest orders
 	BuyerEmail  string    `json:"buyerEmail"` // Notice camelCase here
 	Status      string    `json:"status"`
-	TotalAmount int       `json:"totalAmount"` // frontend expects number in cents
+	TotalAmount int       `json:"totalAmount"`    // frontend expects number in minor units of Currency
+	GrossAmount int       `json:"grossAmount"`    // before discount
+	Discount    int       `json:"discountAmount"` // taken off by PromoCode
+	NetAmount   int       `json:"netAmount"`      // charged, same as TotalAmount
+	PromoCode   *string   `json:"promoCode,omitempty"`
+	Currency    string    `json:"currency"`
 	PaymentRef  string    `json:"paymentRef"`
 	CreatedAt   time.Time `json:"createdAt"`
 }
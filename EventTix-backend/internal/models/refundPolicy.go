@@ -0,0 +1,10 @@
+package models
+
+// RefundRule is one step of an event's refund policy: cancelling at least
+// HoursBeforeStart hours before the event starts refunds RefundPercent of the
+// ticket prices. A policy of a full refund until 14 days before, half until 48
+// hours before and nothing after is [{336, 100}, {48, 50}].
+type RefundRule struct {
+	HoursBeforeStart int `json:"hours_before_start"`
+	RefundPercent    int `json:"refund_percent"`
+}
@@ -24,4 +24,79 @@ type TicketTypeIn struct {
 	Description   *string `json:"description"` // allows null
 	PriceCents    int     `json:"price_cents"`
 	TotalQuantity int     `json:"total_quantity"`
+	PurchaseLimits
+	SalesWindow
+	ServiceFees
+	EntryRules
+	PriceTiers []PriceTier `json:"price_tiers,omitempty"`
+}
+
+// ServiceFees are charged per ticket on top of its price. Only admins set the
+// platform fee; a nil fee is 0 on create and left unchanged on update.
+type ServiceFees struct {
+	PlatformFeeCents  *int64 `json:"platform_fee_cents,omitempty"`
+	OrganizerFeeCents *int64 `json:"organizer_fee_cents,omitempty"`
+}
+
+// SalesWindow limits when a ticket type can be bought. A nil bound is open.
+type SalesWindow struct {
+	SalesStart *time.Time `json:"sales_start,omitempty"`
+	SalesEnd   *time.Time `json:"sales_end,omitempty"`
+}
+
+// PriceTier overrides a ticket type's price until EndsAt and while fewer than
+// UntilSold of its tickets are sold; at least one of the two must be set.
+type PriceTier struct {
+	Name       string     `json:"name"`
+	PriceCents int        `json:"price_cents"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	UntilSold  *int       `json:"until_sold,omitempty"`
+}
+
+// PurchaseLimits bound how many tickets of a type one order and one customer may buy.
+// A nil MinPerOrder means 1; nil maximums mean no limit. A guest's email address is
+// not verified, so a per-customer limit cannot hold for guests: ticket types that
+// have one are sold to logged-in buyers only.
+type PurchaseLimits struct {
+	MinPerOrder    *int `json:"min_per_order,omitempty"`
+	MaxPerOrder    *int `json:"max_per_order,omitempty"`
+	MaxPerCustomer *int `json:"max_per_customer,omitempty"`
+}
+
+// MinOrDefault returns the minimum tickets per order, 1 when unset.
+func (l PurchaseLimits) MinOrDefault() int {
+	if l.MinPerOrder == nil {
+		return 1
+	}
+	return *l.MinPerOrder
+}
+
+// Entry policies of ticket types.
+const (
+	PolicySingle    = "single"    // one entry
+	PolicyMulti     = "multi"     // up to MaxEntries entries
+	PolicyUnlimited = "unlimited" // any number of entries
+	PolicyInOut     = "in_out"    // another entry after each check-out scan
+)
+
+// EntryRules are how often and when a ticket type's tickets admit their holder.
+// An empty Policy is single entry; a nil validity bound is open.
+type EntryRules struct {
+	Policy     string     `json:"entry_policy,omitempty"`
+	MaxEntries *int       `json:"max_entries,omitempty"` // multi entry only
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// PolicyOrDefault returns the entry policy, single entry when unset.
+func (r EntryRules) PolicyOrDefault() string {
+	if r.Policy == "" {
+		return PolicySingle
+	}
+	return r.Policy
+}
+
+// ValidAt reports whether t is within the validity dates.
+func (r EntryRules) ValidAt(t time.Time) bool {
+	return (r.ValidFrom == nil || !t.Before(*r.ValidFrom)) && (r.ValidUntil == nil || t.Before(*r.ValidUntil))
 }
@@ -0,0 +1,194 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeSignatureHeader carries the HMAC-SHA256 of a fake webhook payload.
+const FakeSignatureHeader = "Fake-Signature"
+
+// FakeGateway is an in-process PaymentGateway. Sessions live in memory and are
+// settled by calling Simulate, which the fake checkout page does for local
+// development and tests do directly.
+type FakeGateway struct {
+	baseURL       string
+	webhookSecret string
+
+	mu       sync.Mutex
+	sessions map[string]*fakeSession
+}
+
+type fakeSession struct {
+	session       Session
+	successURL    string
+	cancelURL     string
+	refundedCents int64
+}
+
+// NewFakeGateway creates a fake gateway whose checkout pages are served under baseURL.
+func NewFakeGateway(baseURL, webhookSecret string) *FakeGateway {
+	return &FakeGateway{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		webhookSecret: webhookSecret,
+		sessions:      make(map[string]*fakeSession),
+	}
+}
+
+func (g *FakeGateway) Name() string { return "fake" }
+
+func (g *FakeGateway) CreateSession(p SessionParams) (*Session, error) {
+	if len(p.LineItems) == 0 {
+		return nil, fmt.Errorf("fake gateway: no line items")
+	}
+
+	id := "fake_cs_" + uuid.New().String()
+	s := Session{
+		ID:        id,
+		URL:       g.baseURL + "/payments/fake/checkout/" + id,
+		Status:    SessionOpen,
+		Currency:  p.LineItems[0].Currency,
+		ExpiresAt: p.ExpiresAt,
+		Metadata:  make(map[string]string, len(p.Metadata)),
+	}
+	for _, li := range p.LineItems {
+		s.AmountTotalCents += li.UnitAmountCents * li.Quantity
+	}
+	for k, v := range p.Metadata {
+		s.Metadata[k] = v
+	}
+
+	g.mu.Lock()
+	g.sessions[id] = &fakeSession{
+		session:    s,
+		successURL: strings.ReplaceAll(p.SuccessURL, SessionIDPlaceholder, id),
+		cancelURL:  p.CancelURL,
+	}
+	g.mu.Unlock()
+
+	return &s, nil
+}
+
+func (g *FakeGateway) FetchSession(id string) (*Session, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fs, ok := g.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	s := fs.session
+	return &s, nil
+}
+
+func (g *FakeGateway) ExpireSession(id string) error {
+	_, err := g.Simulate(id, SessionExpired)
+	return err
+}
+
+func (g *FakeGateway) Refund(p RefundParams) (*Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fs, ok := g.sessions[p.SessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if fs.session.Status != SessionPaid {
+		return nil, ErrSessionNotPaid
+	}
+	if p.AmountCents <= 0 || fs.refundedCents+p.AmountCents > fs.session.AmountTotalCents {
+		return nil, fmt.Errorf("fake gateway: refund of %d exceeds refundable amount", p.AmountCents)
+	}
+
+	fs.refundedCents += p.AmountCents
+	return &Refund{ID: "fake_re_" + uuid.New().String(), AmountCents: p.AmountCents, Status: "succeeded"}, nil
+}
+
+func (g *FakeGateway) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if !hmac.Equal([]byte(header.Get(FakeSignatureHeader)), []byte(g.sign(payload))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var ev Event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return nil, fmt.Errorf("decoding fake event: %w", err)
+	}
+	return &ev, nil
+}
+
+// Simulate settles an open session with the given outcome (paid, failed or expired)
+// and returns the event the provider would have sent.
+func (g *FakeGateway) Simulate(id string, outcome SessionStatus) (*Event, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fs, ok := g.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if fs.session.Status != SessionOpen {
+		return nil, fmt.Errorf("fake gateway: session %s is already %s", id, fs.session.Status)
+	}
+	if !fs.session.ExpiresAt.IsZero() && time.Now().After(fs.session.ExpiresAt) {
+		outcome = SessionExpired
+	}
+
+	ev := &Event{ID: "fake_evt_" + uuid.New().String()}
+	switch outcome {
+	case SessionPaid:
+		ev.Type = EventSessionCompleted
+	case SessionFailed:
+		ev.Type = EventPaymentFailed
+	case SessionExpired:
+		ev.Type = EventSessionExpired
+	default:
+		return nil, fmt.Errorf("fake gateway: unsupported outcome %q", outcome)
+	}
+
+	fs.session.Status = outcome
+	ev.Session = fs.session
+	return ev, nil
+}
+
+// RedirectURL is where the buyer is sent after the session was settled.
+func (g *FakeGateway) RedirectURL(id string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fs, ok := g.sessions[id]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+	if fs.session.Status == SessionPaid {
+		return fs.successURL, nil
+	}
+	return fs.cancelURL, nil
+}
+
+// SignedDelivery encodes an event the way the fake provider would deliver it to
+// the webhook endpoint.
+func (g *FakeGateway) SignedDelivery(ev *Event) ([]byte, http.Header, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, g.sign(payload))
+	return payload, header, nil
+}
+
+func (g *FakeGateway) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(g.webhookSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
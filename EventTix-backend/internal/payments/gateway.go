@@ -0,0 +1,139 @@
+// Package payments hides the payment provider behind the PaymentGateway interface.
+//
+// The Stripe implementation talks to Stripe Checkout; the fake implementation runs
+// in-process so the purchase flow works offline in tests and local development.
+// PAYMENT_PROVIDER selects which one the server uses.
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// SessionIDPlaceholder is replaced by the session ID in SessionParams.SuccessURL.
+const SessionIDPlaceholder = "{CHECKOUT_SESSION_ID}"
+
+// SessionStatus is the payment state of a checkout session.
+type SessionStatus string
+
+const (
+	SessionOpen    SessionStatus = "open"
+	SessionPaid    SessionStatus = "paid"
+	SessionExpired SessionStatus = "expired"
+	SessionFailed  SessionStatus = "failed"
+)
+
+// EventType is a provider-neutral webhook event type.
+type EventType string
+
+const (
+	// EventSessionCompleted means the session was paid and can be fulfilled.
+	EventSessionCompleted EventType = "session.completed"
+	// EventSessionExpired means the session was closed without payment.
+	EventSessionExpired EventType = "session.expired"
+	// EventPaymentFailed means a delayed payment for the session failed.
+	EventPaymentFailed EventType = "payment.failed"
+	// EventIgnored is any provider event the application does not act on.
+	EventIgnored EventType = "ignored"
+)
+
+var (
+	// ErrInvalidSignature is returned by ParseWebhook when the payload is not authentic.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrSessionNotFound is returned for unknown session IDs.
+	ErrSessionNotFound = errors.New("payment session not found")
+	// ErrSessionNotPaid is returned when refunding a session that was never paid.
+	ErrSessionNotPaid = errors.New("payment session is not paid")
+)
+
+// LineItem is one priced line of a checkout session.
+type LineItem struct {
+	Name            string
+	Quantity        int64
+	UnitAmountCents int64
+	Currency        string
+}
+
+// SessionParams describes a checkout session to create.
+type SessionParams struct {
+	LineItems         []LineItem
+	SuccessURL        string
+	CancelURL         string
+	ExpiresAt         time.Time
+	ClientReferenceID string
+	CustomerEmail     string // prefills the checkout page; optional
+	Metadata          map[string]string
+}
+
+// Session is the provider's view of a checkout session.
+type Session struct {
+	ID               string
+	URL              string
+	Status           SessionStatus
+	AmountTotalCents int64
+	Currency         string
+	ExpiresAt        time.Time
+	Metadata         map[string]string
+}
+
+// Event is a verified webhook event about a checkout session.
+type Event struct {
+	ID      string
+	Type    EventType
+	Session Session
+}
+
+// RefundParams describes a full or partial refund of a paid session.
+type RefundParams struct {
+	SessionID   string
+	AmountCents int64
+	Reason      string
+}
+
+// Refund is the provider's record of a refund.
+type Refund struct {
+	ID          string
+	AmountCents int64
+	Status      string
+}
+
+// PaymentGateway is implemented by every payment provider.
+type PaymentGateway interface {
+	// Name identifies the provider, e.g. in the webhook route.
+	Name() string
+	CreateSession(params SessionParams) (*Session, error)
+	FetchSession(id string) (*Session, error)
+	// ExpireSession closes an open session so it can no longer be paid.
+	ExpireSession(id string) error
+	Refund(params RefundParams) (*Refund, error)
+	// ParseWebhook verifies a webhook delivery and translates it into an Event.
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// FromEnv builds the gateway selected by PAYMENT_PROVIDER ("stripe" by default, or "fake").
+func FromEnv() (PaymentGateway, error) {
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "", "stripe":
+		key := os.Getenv("STRIPE_SECRET_KEY")
+		if key == "" {
+			return nil, errors.New("STRIPE_SECRET_KEY is not set")
+		}
+		return NewStripeGateway(key, os.Getenv("STRIPE_WEBHOOK_SECRET")), nil
+	case "fake":
+		baseURL := os.Getenv("FAKE_PAYMENTS_BASE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		// Anyone who knows the secret can mark sessions paid, so there is no default
+		secret := os.Getenv("FAKE_PAYMENTS_WEBHOOK_SECRET")
+		if secret == "" {
+			return nil, errors.New("FAKE_PAYMENTS_WEBHOOK_SECRET is not set")
+		}
+		return NewFakeGateway(baseURL, secret), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q", provider)
+	}
+}
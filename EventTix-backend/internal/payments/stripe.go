@@ -0,0 +1,172 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/client"
+	"github.com/stripe/stripe-go/v78/webhook"
+)
+
+// StripeGateway implements PaymentGateway with Stripe Checkout.
+type StripeGateway struct {
+	api           *client.API
+	webhookSecret string
+}
+
+// NewStripeGateway creates a Stripe gateway with its own API client, so the
+// global stripe.Key is never touched.
+func NewStripeGateway(secretKey, webhookSecret string) *StripeGateway {
+	return &StripeGateway{
+		api:           client.New(secretKey, nil),
+		webhookSecret: webhookSecret,
+	}
+}
+
+func (g *StripeGateway) Name() string { return "stripe" }
+
+func (g *StripeGateway) CreateSession(p SessionParams) (*Session, error) {
+	var lineItems []*stripe.CheckoutSessionLineItemParams
+	for _, li := range p.LineItems {
+		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
+			Quantity: stripe.Int64(li.Quantity),
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency:   stripe.String(li.Currency),
+				UnitAmount: stripe.Int64(li.UnitAmountCents),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name: stripe.String(li.Name),
+				},
+			},
+		})
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems:          lineItems,
+		Mode:               stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL:         stripe.String(p.SuccessURL),
+		CancelURL:          stripe.String(p.CancelURL),
+	}
+	if !p.ExpiresAt.IsZero() {
+		params.ExpiresAt = stripe.Int64(p.ExpiresAt.Unix())
+	}
+	if p.ClientReferenceID != "" {
+		params.ClientReferenceID = stripe.String(p.ClientReferenceID)
+	}
+	if p.CustomerEmail != "" {
+		params.CustomerEmail = stripe.String(p.CustomerEmail)
+	}
+	for k, v := range p.Metadata {
+		params.AddMetadata(k, v)
+	}
+
+	s, err := g.api.CheckoutSessions.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return fromStripeSession(s), nil
+}
+
+func (g *StripeGateway) FetchSession(id string) (*Session, error) {
+	s, err := g.api.CheckoutSessions.Get(id, nil)
+	if err != nil {
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return fromStripeSession(s), nil
+}
+
+func (g *StripeGateway) ExpireSession(id string) error {
+	_, err := g.api.CheckoutSessions.Expire(id, nil)
+	return err
+}
+
+func (g *StripeGateway) Refund(p RefundParams) (*Refund, error) {
+	s, err := g.api.CheckoutSessions.Get(p.SessionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.PaymentIntent == nil || s.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		return nil, ErrSessionNotPaid
+	}
+
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(s.PaymentIntent.ID),
+		Amount:        stripe.Int64(p.AmountCents),
+	}
+	if p.Reason != "" {
+		params.AddMetadata("reason", p.Reason)
+	}
+
+	r, err := g.api.Refunds.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &Refund{ID: r.ID, AmountCents: r.Amount, Status: string(r.Status)}, nil
+}
+
+func (g *StripeGateway) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	if g.webhookSecret == "" {
+		return nil, errors.New("STRIPE_WEBHOOK_SECRET is not set")
+	}
+
+	ev, err := webhook.ConstructEventWithOptions(payload, header.Get("Stripe-Signature"), g.webhookSecret,
+		webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	event := &Event{ID: ev.ID, Type: EventIgnored}
+	switch ev.Type {
+	case stripe.EventTypeCheckoutSessionCompleted, stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded:
+		event.Type = EventSessionCompleted
+	case stripe.EventTypeCheckoutSessionExpired:
+		event.Type = EventSessionExpired
+	case stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
+		event.Type = EventPaymentFailed
+	default:
+		return event, nil
+	}
+
+	var s stripe.CheckoutSession
+	if err := json.Unmarshal(ev.Data.Raw, &s); err != nil {
+		return nil, fmt.Errorf("decoding checkout session: %w", err)
+	}
+	event.Session = *fromStripeSession(&s)
+
+	// Delayed payment methods complete the session before the money arrives;
+	// those are reported again by async_payment_succeeded.
+	if event.Type == EventSessionCompleted && event.Session.Status != SessionPaid {
+		event.Type = EventIgnored
+	}
+	return event, nil
+}
+
+func fromStripeSession(s *stripe.CheckoutSession) *Session {
+	session := &Session{
+		ID:               s.ID,
+		URL:              s.URL,
+		AmountTotalCents: s.AmountTotal,
+		Currency:         string(s.Currency),
+		Metadata:         s.Metadata,
+		Status:           SessionOpen,
+	}
+	if s.ExpiresAt > 0 {
+		session.ExpiresAt = time.Unix(s.ExpiresAt, 0)
+	}
+
+	switch {
+	case s.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid:
+		session.Status = SessionPaid
+	case s.Status == stripe.CheckoutSessionStatusExpired:
+		session.Status = SessionExpired
+	}
+	return session
+}
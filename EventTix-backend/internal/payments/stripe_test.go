@@ -0,0 +1,100 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stripe/stripe-go/v78/webhook"
+)
+
+const testWebhookSecret = "whsec_test_secret"
+
+func signedHeader(payload []byte, secret string) http.Header {
+	header := http.Header{}
+	header.Set("Stripe-Signature", webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: payload,
+		Secret:  secret,
+	}).Header)
+	return header
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	gateway := NewStripeGateway("sk_test_unused", testWebhookSecret)
+
+	tests := []struct {
+		name    string
+		payload string
+		want    EventType
+		status  SessionStatus
+	}{
+		{
+			name: "completed and paid",
+			payload: `{"id": "evt_1", "object": "event", "type": "checkout.session.completed",
+				"data": {"object": {"id": "cs_1", "object": "checkout.session", "status": "complete",
+				"payment_status": "paid", "amount_total": 5000, "currency": "pln",
+				"metadata": {"checkout_session_id": "checkout-1"}}}}`,
+			want:   EventSessionCompleted,
+			status: SessionPaid,
+		},
+		{
+			name: "completed but payment delayed",
+			payload: `{"id": "evt_2", "object": "event", "type": "checkout.session.completed",
+				"data": {"object": {"id": "cs_2", "object": "checkout.session", "status": "complete",
+				"payment_status": "unpaid", "amount_total": 5000, "currency": "pln", "metadata": {}}}}`,
+			want:   EventIgnored,
+			status: SessionOpen,
+		},
+		{
+			name: "expired",
+			payload: `{"id": "evt_3", "object": "event", "type": "checkout.session.expired",
+				"data": {"object": {"id": "cs_3", "object": "checkout.session", "status": "expired",
+				"payment_status": "unpaid", "amount_total": 5000, "currency": "pln", "metadata": {}}}}`,
+			want:   EventSessionExpired,
+			status: SessionExpired,
+		},
+		{
+			name: "async payment failed",
+			payload: `{"id": "evt_4", "object": "event", "type": "checkout.session.async_payment_failed",
+				"data": {"object": {"id": "cs_4", "object": "checkout.session", "status": "complete",
+				"payment_status": "unpaid", "amount_total": 5000, "currency": "pln", "metadata": {}}}}`,
+			want:   EventPaymentFailed,
+			status: SessionOpen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(tt.payload)
+			ev, err := gateway.ParseWebhook(payload, signedHeader(payload, testWebhookSecret))
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+			if ev.Type != tt.want {
+				t.Errorf("type = %q, want %q", ev.Type, tt.want)
+			}
+			if ev.Session.Status != tt.status {
+				t.Errorf("session status = %q, want %q", ev.Session.Status, tt.status)
+			}
+		})
+	}
+
+	t.Run("metadata and amount", func(t *testing.T) {
+		payload := []byte(tests[0].payload)
+		ev, err := gateway.ParseWebhook(payload, signedHeader(payload, testWebhookSecret))
+		if err != nil {
+			t.Fatalf("ParseWebhook: %v", err)
+		}
+		if ev.ID != "evt_1" || ev.Session.ID != "cs_1" || ev.Session.AmountTotalCents != 5000 ||
+			ev.Session.Metadata["checkout_session_id"] != "checkout-1" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		payload := []byte(tests[0].payload)
+		_, err := gateway.ParseWebhook(payload, signedHeader(payload, "whsec_other"))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("err = %v, want ErrInvalidSignature", err)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+// Package pricing resolves what a ticket type costs right now: whether it is on
+// sale at all, and which of its price tiers is in effect.
+//
+// Time-based tiers end at a fixed moment; quantity-based tiers end once a number
+// of the ticket type's tickets are sold. Stock held by open checkouts counts as
+// sold, the same way it is missing from available_quantity.
+package pricing
+
+import (
+	"TickVibe-EventTix-backend/internal/models"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Sales statuses of a ticket type.
+const (
+	StatusOnSale     = "on_sale"
+	StatusOnSaleSoon = "on_sale_soon"
+	StatusSalesEnded = "sales_ended"
+	StatusSoldOut    = "sold_out"
+)
+
+// Status reports whether a ticket type with the given window and stock can be bought at now.
+func Status(w models.SalesWindow, available int, now time.Time) string {
+	switch {
+	case w.SalesStart != nil && now.Before(*w.SalesStart):
+		return StatusOnSaleSoon
+	case w.SalesEnd != nil && !now.Before(*w.SalesEnd):
+		return StatusSalesEnded
+	case available <= 0:
+		return StatusSoldOut
+	}
+	return StatusOnSale
+}
+
+// Current returns the tier in effect once sold tickets are gone, or nil when none
+// applies and the ticket type's own price is charged.
+func Current(tiers []models.PriceTier, sold int, now time.Time) *models.PriceTier {
+	for i := range tiers {
+		t := &tiers[i]
+		if t.EndsAt != nil && !now.Before(*t.EndsAt) {
+			continue
+		}
+		if t.UntilSold != nil && sold >= *t.UntilSold {
+			continue
+		}
+		return t
+	}
+	return nil
+}
+
+// Price returns the unit price charged at now and the tier it comes from, if any.
+func Price(basePriceCents int64, tiers []models.PriceTier, sold int, now time.Time) (int64, *models.PriceTier) {
+	if t := Current(tiers, sold, now); t != nil {
+		return int64(t.PriceCents), t
+	}
+	return basePriceCents, nil
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// LoadTiers returns the price tiers of the given ticket types in position order.
+// It accepts a transaction so tiers are read alongside a stock update.
+func LoadTiers(q querier, ticketTypeIDs []int) (map[int][]models.PriceTier, error) {
+	rows, err := q.Query(`
+		SELECT ticket_type_id, name, price_cents, ends_at, until_sold
+		FROM ticket_price_tiers
+		WHERE ticket_type_id = ANY($1)
+		ORDER BY ticket_type_id, position`, pq.Array(ticketTypeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := make(map[int][]models.PriceTier)
+	for rows.Next() {
+		var id int
+		var t models.PriceTier
+		if err := rows.Scan(&id, &t.Name, &t.PriceCents, &t.EndsAt, &t.UntilSold); err != nil {
+			return nil, err
+		}
+		tiers[id] = append(tiers[id], t)
+	}
+	return tiers, rows.Err()
+}
+
+// ReplaceTiers swaps a ticket type's price tiers for the given ones, keeping their order.
+func ReplaceTiers(tx *sql.Tx, ticketTypeID int, tiers []models.PriceTier) error {
+	if _, err := tx.Exec(`DELETE FROM ticket_price_tiers WHERE ticket_type_id = $1`, ticketTypeID); err != nil {
+		return err
+	}
+	for i, t := range tiers {
+		if _, err := tx.Exec(`
+			INSERT INTO ticket_price_tiers (ticket_type_id, position, name, price_cents, ends_at, until_sold)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			ticketTypeID, i+1, t.Name, t.PriceCents, t.EndsAt, t.UntilSold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VATFromGross returns the VAT contained in a gross amount at a rate in basis
+// points, rounded half up to the minor unit.
+func VATFromGross(grossCents int64, rateBps int) int64 {
+	if rateBps <= 0 || grossCents <= 0 {
+		return 0
+	}
+	return (2*grossCents*int64(rateBps) + 10000 + int64(rateBps)) / (2 * (10000 + int64(rateBps)))
+}
@@ -0,0 +1,82 @@
+package pricing
+
+import (
+	"TickVibe-EventTix-backend/internal/models"
+	"testing"
+	"time"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestCurrentAndPrice(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	yesterday, tomorrow := now.Add(-24*time.Hour), now.Add(24*time.Hour)
+	tiers := []models.PriceTier{
+		{Name: "Early bird", PriceCents: 1000, UntilSold: intPtr(10)},
+		{Name: "Presale", PriceCents: 1500, EndsAt: &tomorrow},
+	}
+
+	tests := []struct {
+		name  string
+		tiers []models.PriceTier
+		sold  int
+		now   time.Time
+		price int64
+		tier  string
+	}{
+		{"no tiers", nil, 0, now, 2000, ""},
+		{"first tier", tiers, 0, now, 1000, "Early bird"},
+		{"last ticket of first tier", tiers, 9, now, 1000, "Early bird"},
+		{"first tier sold out", tiers, 10, now, 1500, "Presale"},
+		{"presale ended", tiers, 10, tomorrow, 2000, ""},
+		{"presale ends exactly now", tiers, 10, tomorrow.Add(-time.Nanosecond), 1500, "Presale"},
+		{"expired tier is skipped", []models.PriceTier{
+			{Name: "Past", PriceCents: 500, EndsAt: &yesterday},
+			{Name: "Now", PriceCents: 1200},
+		}, 0, now, 1200, "Now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, tier := Price(2000, tt.tiers, tt.sold, tt.now)
+			if price != tt.price {
+				t.Errorf("price = %d, want %d", price, tt.price)
+			}
+			var name string
+			if tier != nil {
+				name = tier.Name
+			}
+			if name != tt.tier {
+				t.Errorf("tier = %q, want %q", name, tt.tier)
+			}
+			if current := Current(tt.tiers, tt.sold, tt.now); current != tier {
+				t.Errorf("Current returned %v, Price used %v", current, tier)
+			}
+		})
+	}
+}
+
+func TestVATFromGross(t *testing.T) {
+	tests := []struct {
+		name    string
+		gross   int64
+		rateBps int
+		want    int64
+	}{
+		{"exact", 12300, 2300, 2300},
+		{"rounded down", 1, 2300, 0},
+		{"rounded up", 100, 2300, 19},
+		{"half rounded up", 3, 2000, 1},
+		{"odd half rounded up", 9, 2000, 2},
+		{"reduced rate", 10800, 800, 800},
+		{"no VAT", 5000, 0, 0},
+		{"negative rate", 5000, -100, 0},
+		{"nothing charged", 0, 2300, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VATFromGross(tt.gross, tt.rateBps); got != tt.want {
+				t.Errorf("VATFromGross(%d, %d) = %d, want %d", tt.gross, tt.rateBps, got, tt.want)
+			}
+		})
+	}
+}
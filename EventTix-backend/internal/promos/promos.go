@@ -0,0 +1,356 @@
+// Package promos manages per-event discount codes and their redemptions.
+//
+// A checkout that uses a code reserves a redemption while its payment session is
+// open. Reserved redemptions count against the code's caps until they expire, are
+// released or are confirmed by a paid order, so two buyers can never both take the
+// last use of a code.
+package promos
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Discount types stored in promo_codes.discount_type.
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// Redemption statuses stored in promo_redemptions.status.
+const (
+	StatusReserved = "reserved"
+	StatusRedeemed = "redeemed"
+	StatusReleased = "released"
+)
+
+var (
+	ErrInvalidCode      = errors.New("invalid promo code")
+	ErrCodeNotActive    = errors.New("promo code is not valid at this time")
+	ErrCodeExhausted    = errors.New("promo code has been fully redeemed")
+	ErrUserLimitReached = errors.New("promo code usage limit reached for this user")
+	ErrNotApplicable    = errors.New("promo code does not apply to the selected tickets")
+	ErrDuplicateCode    = errors.New("promo code already exists for this event")
+	ErrInvalidPromo     = errors.New("invalid promo code definition")
+)
+
+// Code is a discount code of an event. DiscountValue is a percentage for percent
+// codes and an amount in the event currency's minor unit for fixed codes.
+type Code struct {
+	ID                    int        `json:"id"`
+	EventID               string     `json:"event_id"`
+	Code                  string     `json:"code"`
+	DiscountType          string     `json:"discount_type"`
+	DiscountValue         int64      `json:"discount_value"`
+	TicketTypeIDs         []int      `json:"ticket_type_ids,omitempty"`
+	MaxRedemptions        *int       `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerUser *int       `json:"max_redemptions_per_user,omitempty"`
+	StartsAt              *time.Time `json:"starts_at,omitempty"`
+	EndsAt                *time.Time `json:"ends_at,omitempty"`
+	IsActive              bool       `json:"is_active"`
+	Redemptions           int        `json:"redemptions"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// Line is a priced checkout line a code may apply to.
+type Line struct {
+	TicketTypeID   int
+	Quantity       int
+	UnitPriceCents int64
+}
+
+// Redemption is a code applied to a checkout. LineDiscounts holds the discount of
+// each ticket type's line in total, not per ticket.
+type Redemption struct {
+	PromoCodeID   int
+	Code          string
+	DiscountCents int64
+	LineDiscounts map[int]int64
+}
+
+// Validate checks a code definition before it is stored and normalises its code.
+func (c *Code) Validate() error {
+	c.Code = strings.ToUpper(strings.TrimSpace(c.Code))
+	switch {
+	case c.Code == "" || len(c.Code) > 64:
+		return fmt.Errorf("%w: code must be 1-64 characters", ErrInvalidPromo)
+	case c.DiscountType != DiscountPercent && c.DiscountType != DiscountFixed:
+		return fmt.Errorf("%w: discount_type must be percent or fixed", ErrInvalidPromo)
+	case c.DiscountValue <= 0:
+		return fmt.Errorf("%w: discount_value must be positive", ErrInvalidPromo)
+	case c.DiscountType == DiscountPercent && c.DiscountValue > 100:
+		return fmt.Errorf("%w: a percentage cannot exceed 100", ErrInvalidPromo)
+	case c.MaxRedemptions != nil && *c.MaxRedemptions <= 0,
+		c.MaxRedemptionsPerUser != nil && *c.MaxRedemptionsPerUser <= 0:
+		return fmt.Errorf("%w: redemption caps must be positive", ErrInvalidPromo)
+	case c.StartsAt != nil && c.EndsAt != nil && !c.EndsAt.After(*c.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromo)
+	}
+	return nil
+}
+
+// Create stores a new code for an event. Restricted ticket types must belong to it.
+func Create(db *sql.DB, c *Code, createdBy string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if len(c.TicketTypeIDs) > 0 {
+		var matching int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ticket_types WHERE event_id = $1 AND id = ANY($2)`,
+			c.EventID, pq.Array(c.TicketTypeIDs)).Scan(&matching); err != nil {
+			return err
+		}
+		if matching != len(uniqueInts(c.TicketTypeIDs)) {
+			return fmt.Errorf("%w: ticket types must belong to the event", ErrInvalidPromo)
+		}
+	}
+
+	var ticketTypeIDs interface{}
+	if len(c.TicketTypeIDs) > 0 {
+		ticketTypeIDs = pq.Array(c.TicketTypeIDs)
+	}
+	err := db.QueryRow(`
+		INSERT INTO promo_codes (event_id, code, discount_type, discount_value, ticket_type_ids,
+		                         max_redemptions, max_redemptions_per_user, starts_at, ends_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, is_active, created_at`,
+		c.EventID, c.Code, c.DiscountType, c.DiscountValue, ticketTypeIDs,
+		c.MaxRedemptions, c.MaxRedemptionsPerUser, c.StartsAt, c.EndsAt, createdBy,
+	).Scan(&c.ID, &c.IsActive, &c.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicateCode
+	}
+	return err
+}
+
+// List returns the codes of an event with their current number of redemptions.
+func List(db *sql.DB, eventID string) ([]Code, error) {
+	rows, err := db.Query(`
+		SELECT pc.id, pc.event_id, pc.code, pc.discount_type, pc.discount_value, pc.ticket_type_ids,
+		       pc.max_redemptions, pc.max_redemptions_per_user, pc.starts_at, pc.ends_at,
+		       pc.is_active, pc.created_at,
+		       (SELECT COUNT(*) FROM promo_redemptions pr WHERE pr.promo_code_id = pc.id AND pr.status = $2)
+		FROM promo_codes pc
+		WHERE pc.event_id = $1
+		ORDER BY pc.created_at DESC`, eventID, StatusRedeemed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []Code{}
+	for rows.Next() {
+		var c Code
+		var ticketTypeIDs pq.Int64Array
+		if err := rows.Scan(&c.ID, &c.EventID, &c.Code, &c.DiscountType, &c.DiscountValue, &ticketTypeIDs,
+			&c.MaxRedemptions, &c.MaxRedemptionsPerUser, &c.StartsAt, &c.EndsAt,
+			&c.IsActive, &c.CreatedAt, &c.Redemptions); err != nil {
+			return nil, err
+		}
+		for _, id := range ticketTypeIDs {
+			c.TicketTypeIDs = append(c.TicketTypeIDs, int(id))
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+// Deactivate stops a code from being used in new checkouts. It reports whether the
+// code exists on the event.
+func Deactivate(db *sql.DB, eventID string, id int) (bool, error) {
+	res, err := db.Exec(`UPDATE promo_codes SET is_active = FALSE, updated_at = NOW() WHERE id = $1 AND event_id = $2`,
+		id, eventID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Redeem applies a code to a checkout and reserves one use of it until expiresAt.
+// The code row is locked while its caps are checked, so concurrent checkouts are
+// counted one after the other. Guest checkouts pass an empty userID and their
+// guest contact, which the per-user cap then counts by.
+func Redeem(db *sql.DB, eventID, userID, guestContactID, code, checkoutSessionID string, lines []Line, expiresAt time.Time) (*Redemption, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c Code
+	var ticketTypeIDs pq.Int64Array
+	err = tx.QueryRow(`
+		SELECT id, code, discount_type, discount_value, ticket_type_ids,
+		       max_redemptions, max_redemptions_per_user, starts_at, ends_at, is_active
+		FROM promo_codes
+		WHERE event_id = $1 AND UPPER(code) = UPPER($2)
+		FOR UPDATE`, eventID, strings.TrimSpace(code)).Scan(
+		&c.ID, &c.Code, &c.DiscountType, &c.DiscountValue, &ticketTypeIDs,
+		&c.MaxRedemptions, &c.MaxRedemptionsPerUser, &c.StartsAt, &c.EndsAt, &c.IsActive)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCode
+	} else if err != nil {
+		return nil, err
+	}
+	for _, id := range ticketTypeIDs {
+		c.TicketTypeIDs = append(c.TicketTypeIDs, int(id))
+	}
+
+	now := time.Now()
+	if !c.IsActive || (c.StartsAt != nil && now.Before(*c.StartsAt)) || (c.EndsAt != nil && !now.Before(*c.EndsAt)) {
+		return nil, ErrCodeNotActive
+	}
+
+	// Expired reservations no longer count; they simply age out instead of being swept
+	if c.MaxRedemptions != nil || c.MaxRedemptionsPerUser != nil {
+		var total, byUser int
+		if err := tx.QueryRow(`
+			SELECT COUNT(*), COUNT(*) FILTER (WHERE user_id = NULLIF($2, '')::uuid OR guest_contact_id = NULLIF($5, '')::uuid)
+			FROM promo_redemptions
+			WHERE promo_code_id = $1
+			  AND (status = $3 OR (status = $4 AND expires_at > NOW()))`,
+			c.ID, userID, StatusRedeemed, StatusReserved, guestContactID).Scan(&total, &byUser); err != nil {
+			return nil, err
+		}
+		if c.MaxRedemptions != nil && total >= *c.MaxRedemptions {
+			return nil, ErrCodeExhausted
+		}
+		if c.MaxRedemptionsPerUser != nil && byUser >= *c.MaxRedemptionsPerUser {
+			return nil, ErrUserLimitReached
+		}
+	}
+
+	r := &Redemption{PromoCodeID: c.ID, Code: c.Code, LineDiscounts: discountLines(c, lines)}
+	for _, d := range r.LineDiscounts {
+		r.DiscountCents += d
+	}
+	if r.DiscountCents == 0 {
+		return nil, ErrNotApplicable
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO promo_redemptions (promo_code_id, checkout_session_id, user_id, guest_contact_id, discount_cents, status, expires_at)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid, $5, $6, $7)`,
+		c.ID, checkoutSessionID, userID, guestContactID, r.DiscountCents, StatusReserved, expiresAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Confirm marks the redemption of a paid checkout as used by the order, inside the
+// transaction that writes the order. A reservation that expired in the meantime is
+// still honoured, like its tickets.
+func Confirm(tx *sql.Tx, checkoutSessionID, orderID string) error {
+	var previous string
+	err := tx.QueryRow(`
+		WITH previous AS (
+			SELECT id, status FROM promo_redemptions WHERE checkout_session_id = $1 FOR UPDATE
+		)
+		UPDATE promo_redemptions pr
+		SET status = $2, order_id = $3, updated_at = NOW()
+		FROM previous
+		WHERE pr.id = previous.id AND previous.status <> $2
+		RETURNING previous.status`, checkoutSessionID, StatusRedeemed, orderID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if previous == StatusReleased {
+		log.Printf("Promo redemption of checkout %s was released before payment was confirmed; honouring it", checkoutSessionID)
+	}
+	return nil
+}
+
+// Release gives back the use of a code held by a checkout that was not paid.
+func Release(db *sql.DB, checkoutSessionID string) error {
+	_, err := db.Exec(`
+		UPDATE promo_redemptions SET status = $1, updated_at = NOW()
+		WHERE checkout_session_id = $2 AND status = $3`,
+		StatusReleased, checkoutSessionID, StatusReserved)
+	return err
+}
+
+// discountLines computes the discount of every line the code applies to. Percent
+// codes are rounded down per ticket; fixed codes come off the eligible subtotal,
+// split across lines in proportion to their amount.
+func discountLines(c Code, lines []Line) map[int]int64 {
+	eligible := make(map[int]bool, len(c.TicketTypeIDs))
+	for _, id := range c.TicketTypeIDs {
+		eligible[id] = true
+	}
+
+	var applicable []Line
+	var subtotal int64
+	for _, l := range lines {
+		if len(eligible) == 0 || eligible[l.TicketTypeID] {
+			applicable = append(applicable, l)
+			subtotal += l.UnitPriceCents * int64(l.Quantity)
+		}
+	}
+
+	discounts := make(map[int]int64)
+	if subtotal == 0 {
+		return discounts
+	}
+
+	if c.DiscountType == DiscountPercent {
+		for _, l := range applicable {
+			if d := l.UnitPriceCents * c.DiscountValue / 100 * int64(l.Quantity); d > 0 {
+				discounts[l.TicketTypeID] = d
+			}
+		}
+		return discounts
+	}
+
+	amount := c.DiscountValue
+	if amount > subtotal {
+		amount = subtotal
+	}
+	var allocated int64
+	for _, l := range applicable {
+		d := amount * l.UnitPriceCents * int64(l.Quantity) / subtotal
+		discounts[l.TicketTypeID] = d
+		allocated += d
+	}
+	// Hand out what rounding left over to lines that still have room for it
+	for _, l := range applicable {
+		if allocated == amount {
+			break
+		}
+		room := l.UnitPriceCents*int64(l.Quantity) - discounts[l.TicketTypeID]
+		extra := amount - allocated
+		if extra > room {
+			extra = room
+		}
+		discounts[l.TicketTypeID] += extra
+		allocated += extra
+	}
+	for id, d := range discounts {
+		if d == 0 {
+			delete(discounts, id)
+		}
+	}
+	return discounts
+}
+
+func uniqueInts(ids []int) map[int]struct{} {
+	set := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,111 @@
+package promos
+
+import (
+	"TickVibe-EventTix-backend/internal/testdb"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDiscountLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  Code
+		lines []Line
+		want  map[int]int64
+	}{
+		{"percent rounds down per ticket",
+			Code{DiscountType: DiscountPercent, DiscountValue: 10},
+			[]Line{{1, 2, 1999}, {2, 1, 5}},
+			map[int]int64{1: 398}},
+		{"percent on restricted ticket types",
+			Code{DiscountType: DiscountPercent, DiscountValue: 50, TicketTypeIDs: []int{2}},
+			[]Line{{1, 1, 1000}, {2, 3, 1000}},
+			map[int]int64{2: 1500}},
+		{"full percent",
+			Code{DiscountType: DiscountPercent, DiscountValue: 100},
+			[]Line{{1, 2, 1234}},
+			map[int]int64{1: 2468}},
+		{"fixed split by amount",
+			Code{DiscountType: DiscountFixed, DiscountValue: 1000},
+			[]Line{{1, 2, 1500}, {2, 1, 1000}},
+			map[int]int64{1: 750, 2: 250}},
+		{"fixed rounding remainder goes to the first line",
+			Code{DiscountType: DiscountFixed, DiscountValue: 100},
+			[]Line{{1, 1, 333}, {2, 1, 333}, {3, 1, 334}},
+			map[int]int64{1: 34, 2: 33, 3: 33}},
+		{"fixed capped at the eligible subtotal",
+			Code{DiscountType: DiscountFixed, DiscountValue: 5000, TicketTypeIDs: []int{1}},
+			[]Line{{1, 1, 1000}, {2, 1, 1000}},
+			map[int]int64{1: 1000}},
+		{"no eligible line",
+			Code{DiscountType: DiscountFixed, DiscountValue: 500, TicketTypeIDs: []int{9}},
+			[]Line{{1, 1, 1000}},
+			map[int]int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := discountLines(tt.code, tt.lines)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("discounts = %v, want %v", got, tt.want)
+			}
+			var total, subtotal int64
+			for _, d := range got {
+				total += d
+			}
+			for _, l := range tt.lines {
+				subtotal += l.UnitPriceCents * int64(l.Quantity)
+			}
+			if tt.code.DiscountType == DiscountFixed && total > tt.code.DiscountValue || total > subtotal {
+				t.Errorf("total discount %d exceeds the code or the subtotal %d", total, subtotal)
+			}
+		})
+	}
+}
+
+func TestRedeemEnforcesCaps(t *testing.T) {
+	db := testdb.Open(t)
+	creatorID := testdb.User(t, db, "creator")
+	eventID := testdb.Event(t, db, creatorID)
+	typeID := testdb.TicketType(t, db, eventID, 10, 2000)
+	total, perUser := 2, 1
+	code := &Code{EventID: eventID, Code: "cap-test", DiscountType: DiscountPercent, DiscountValue: 10,
+		MaxRedemptions: &total, MaxRedemptionsPerUser: &perUser}
+	if err := Create(db, code, creatorID); err != nil {
+		t.Fatalf("creating code: %v", err)
+	}
+
+	first, second, third := testdb.User(t, db, "user"), testdb.User(t, db, "user"), testdb.User(t, db, "user")
+	lines := []Line{{TicketTypeID: typeID, Quantity: 1, UnitPriceCents: 2000}}
+	expiresAt := time.Now().Add(time.Hour)
+	redeem := func(userID string) (string, error) {
+		checkoutSessionID := uuid.New().String()
+		_, err := Redeem(db, eventID, userID, "", " Cap-Test ", checkoutSessionID, lines, expiresAt)
+		return checkoutSessionID, err
+	}
+
+	if _, err := redeem(first); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := redeem(first); !errors.Is(err, ErrUserLimitReached) {
+		t.Fatalf("second use by the same user: err = %v, want %v", err, ErrUserLimitReached)
+	}
+	secondSession, err := redeem(second)
+	if err != nil {
+		t.Fatalf("use by another user: %v", err)
+	}
+	if _, err := redeem(third); !errors.Is(err, ErrCodeExhausted) {
+		t.Fatalf("third use: err = %v, want %v", err, ErrCodeExhausted)
+	}
+
+	// An unpaid checkout gives its use back
+	if err := Release(db, secondSession); err != nil {
+		t.Fatalf("releasing: %v", err)
+	}
+	if _, err := redeem(third); err != nil {
+		t.Fatalf("use after a release: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package refunds
+
+import (
+	"TickVibe-EventTix-backend/internal/models"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// LoadPolicies returns the refund rules of the given events, largest threshold first.
+func LoadPolicies(q querier, eventIDs []string) (map[string][]models.RefundRule, error) {
+	rows, err := q.Query(`
+		SELECT event_id, hours_before_start, refund_percent
+		FROM event_refund_rules
+		WHERE event_id = ANY($1)
+		ORDER BY event_id, hours_before_start DESC`, pq.Array(eventIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make(map[string][]models.RefundRule)
+	for rows.Next() {
+		var eventID string
+		var r models.RefundRule
+		if err := rows.Scan(&eventID, &r.HoursBeforeStart, &r.RefundPercent); err != nil {
+			return nil, err
+		}
+		policies[eventID] = append(policies[eventID], r)
+	}
+	return policies, rows.Err()
+}
+
+// ReplacePolicy swaps an event's refund rules for the given ones.
+func ReplacePolicy(tx *sql.Tx, eventID string, rules []models.RefundRule) error {
+	if _, err := tx.Exec(`DELETE FROM event_refund_rules WHERE event_id = $1`, eventID); err != nil {
+		return err
+	}
+	for _, r := range rules {
+		if _, err := tx.Exec(`
+			INSERT INTO event_refund_rules (event_id, hours_before_start, refund_percent)
+			VALUES ($1, $2, $3)`, eventID, r.HoursBeforeStart, r.RefundPercent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PercentAt returns the share of the ticket prices refunded when cancelling at now,
+// given rules sorted by LoadPolicies. Nothing is refunded once the event started.
+func PercentAt(rules []models.RefundRule, startTime, now time.Time) int {
+	left := startTime.Sub(now)
+	if left <= 0 {
+		return 0
+	}
+	for _, r := range rules {
+		if left >= time.Duration(r.HoursBeforeStart)*time.Hour {
+			return r.RefundPercent
+		}
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package refunds
+
+import (
+	"TickVibe-EventTix-backend/internal/models"
+	"testing"
+	"time"
+)
+
+func TestPercentAt(t *testing.T) {
+	start := time.Date(2026, 6, 1, 20, 0, 0, 0, time.UTC)
+	// Sorted largest threshold first, as LoadPolicies returns them
+	rules := []models.RefundRule{
+		{HoursBeforeStart: 168, RefundPercent: 100},
+		{HoursBeforeStart: 48, RefundPercent: 50},
+		{HoursBeforeStart: 0, RefundPercent: 10},
+	}
+
+	tests := []struct {
+		name  string
+		rules []models.RefundRule
+		left  time.Duration
+		want  int
+	}{
+		{"well ahead", rules, 30 * 24 * time.Hour, 100},
+		{"exactly a week ahead", rules, 168 * time.Hour, 100},
+		{"just under a week", rules, 168*time.Hour - time.Second, 50},
+		{"exactly two days ahead", rules, 48 * time.Hour, 50},
+		{"just under two days", rules, 48*time.Hour - time.Second, 10},
+		{"a second before start", rules, time.Second, 10},
+		{"at start", rules, 0, 0},
+		{"after start", rules, -time.Hour, 0},
+		{"no rules", nil, 30 * 24 * time.Hour, 0},
+		{"too late for any rule", rules[:2], time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PercentAt(tt.rules, start, start.Add(-tt.left)); got != tt.want {
+				t.Errorf("PercentAt(%v before start) = %d, want %d", tt.left, got, tt.want)
+			}
+		})
+	}
+}
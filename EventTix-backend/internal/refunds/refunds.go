@@ -0,0 +1,336 @@
+// Package refunds refunds whole orders or individual tickets through the payment
+// provider, voids the refunded tickets and returns their stock to ticket_types.
+package refunds
+
+import (
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/seating"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// Order statuses involved in refunds.
+const (
+	OrderStatusCompleted         = "completed"
+	OrderStatusRefundPending     = "refund_pending"
+	OrderStatusPartiallyRefunded = "partially_refunded"
+	OrderStatusRefunded          = "refunded"
+)
+
+// Refund statuses stored in refunds.status.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrNotRefundable    = errors.New("order cannot be refunded in its current state")
+	ErrNoTickets        = errors.New("no refundable tickets selected")
+	ErrProviderDeclined = errors.New("payment provider rejected the refund")
+	ErrForeignTicket    = errors.New("ticket does not belong to this order")
+	ErrTicketUsed       = errors.New("ticket was already used")
+	ErrTicketListed     = errors.New("ticket is listed for resale")
+)
+
+// Request describes a refund. An empty TicketIDs refunds every ticket of the order
+// that has not been voided yet. Percent is the share of the ticket prices paid back,
+// as set by a refund policy; zero pays them back in full. A non-empty Holder only
+// refunds tickets that user still holds, unused and not listed for resale.
+type Request struct {
+	OrderID     string
+	TicketIDs   []string
+	Reason      string
+	RequestedBy string
+	Percent     int
+	Holder      string
+}
+
+// Result summarises a completed refund.
+type Result struct {
+	RefundID        string   `json:"refund_id"`
+	OrderID         string   `json:"order_id"`
+	AmountCents     int64    `json:"amount_cents"`
+	OrderStatus     string   `json:"order_status"`
+	VoidedTicketIDs []string `json:"voided_ticket_ids"`
+}
+
+// OrderEventIDs returns the events an order is for, for ownership checks. A cart
+// order can span several.
+func OrderEventIDs(db *sql.DB, orderID string) ([]string, error) {
+	var eventIDs []string
+	err := db.QueryRow(`
+		SELECT ARRAY(SELECT o.event_id::text WHERE o.event_id IS NOT NULL
+		             UNION
+		             SELECT event_id::text FROM order_lines WHERE order_id = o.id AND event_id IS NOT NULL)
+		FROM orders o
+		WHERE o.id = $1`, orderID).Scan(pq.Array(&eventIDs))
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	return eventIDs, err
+}
+
+// Pending reports whether a refund of a ticket is waiting for the payment provider.
+// Callers acting on the answer lock the ticket first: a refund takes the same lock
+// while it is recorded.
+func Pending(q querier, ticketID string) (bool, error) {
+	var pending bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM refund_tickets rt
+			JOIN refunds r ON r.id = rt.refund_id
+			WHERE rt.ticket_id = $1 AND r.status = $2)`, ticketID, StatusPending).Scan(&pending)
+	return pending, err
+}
+
+type refundTicket struct {
+	id           string
+	ticketTypeID int
+	priceCents   int64
+	resold       bool // issued by a resale, so it never came out of the ticket type's stock
+}
+
+// Issue runs a refund in three steps: the order is moved to refund_pending and the
+// refund recorded, the provider is asked to pay it back, and only after it agreed
+// are the tickets voided and their stock restored. A declined refund puts the
+// order back into its previous state.
+func Issue(db *sql.DB, gateway payments.PaymentGateway, req Request) (*Result, error) {
+	refundID, sessionID, previousStatus, tickets, amount, err := begin(db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var gatewayRefundID string
+	if amount > 0 {
+		refund, err := gateway.Refund(payments.RefundParams{
+			SessionID:   sessionID,
+			AmountCents: amount,
+			Reason:      req.Reason,
+		})
+		if err != nil {
+			log.Printf("Refund %s of order %s rejected by %s: %v", refundID, req.OrderID, gateway.Name(), err)
+			if err := abort(db, refundID, req.OrderID, previousStatus); err != nil {
+				log.Printf("Error rolling back refund %s: %v", refundID, err)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrProviderDeclined, err)
+		}
+		gatewayRefundID = refund.ID
+	}
+
+	status, err := complete(db, refundID, req.OrderID, gatewayRefundID, tickets, amount)
+	if err != nil {
+		// The money is already on its way back; leave the order in refund_pending
+		// so it is visible and can be finished by hand.
+		return nil, fmt.Errorf("refund %s was paid out but could not be recorded: %w", refundID, err)
+	}
+
+	result := &Result{RefundID: refundID, OrderID: req.OrderID, AmountCents: amount, OrderStatus: status}
+	for _, t := range tickets {
+		result.VoidedTicketIDs = append(result.VoidedTicketIDs, t.id)
+	}
+	return result, nil
+}
+
+// begin locks the order, selects the tickets to refund and records a pending refund.
+func begin(db *sql.DB, req Request) (refundID, sessionID, previousStatus string, tickets []refundTicket, amount int64, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	var totalCents, refundedCents int64
+	err = tx.QueryRow(`
+		SELECT status, payment_gateway_charge_id, total_amount_cents, refunded_amount_cents
+		FROM orders WHERE id = $1
+		FOR UPDATE`, req.OrderID).Scan(&previousStatus, &sessionID, &totalCents, &refundedCents)
+	if err == sql.ErrNoRows {
+		err = ErrOrderNotFound
+		return
+	} else if err != nil {
+		return
+	}
+	if previousStatus != OrderStatusCompleted && previousStatus != OrderStatusPartiallyRefunded {
+		err = ErrNotRefundable
+		return
+	}
+
+	// Tickets issued before prices were stored per ticket fall back to the ticket type
+	// price. They stay locked until the pending refund is recorded, which check-in
+	// and resale then respect, so a ticket cannot be used while it is refunded.
+	query := `
+		SELECT t.id, t.ticket_type_id,
+		       CASE WHEN t.price_cents > 0 THEN t.price_cents ELSE tt.price_cents END,
+		       COALESCE(t.user_id::text, ''), t.is_used,
+		       EXISTS(SELECT 1 FROM resale_listings l WHERE l.ticket_id = t.id AND l.status IN ('active', 'reserved')),
+		       EXISTS(SELECT 1 FROM resale_listings l WHERE l.sold_ticket_id = t.id)
+		FROM tickets t
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		WHERE t.order_id = $1 AND t.is_void = FALSE`
+	args := []interface{}{req.OrderID}
+	if len(req.TicketIDs) > 0 {
+		query += ` AND t.id = ANY($2)`
+		args = append(args, pq.Array(req.TicketIDs))
+	}
+	query += ` ORDER BY t.id FOR UPDATE OF t`
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var t refundTicket
+		var holderID string
+		var used, listed bool
+		if err = rows.Scan(&t.id, &t.ticketTypeID, &t.priceCents, &holderID, &used, &listed, &t.resold); err != nil {
+			rows.Close()
+			return
+		}
+		if req.Holder != "" {
+			switch {
+			case holderID != req.Holder:
+				err = ErrForeignTicket
+			case used:
+				err = ErrTicketUsed
+			case listed:
+				err = ErrTicketListed
+			}
+			if err != nil {
+				rows.Close()
+				return
+			}
+		}
+		tickets = append(tickets, t)
+		amount += t.priceCents
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	if len(tickets) == 0 {
+		err = ErrNoTickets
+		return
+	}
+	if len(req.TicketIDs) > 0 && len(tickets) != len(req.TicketIDs) {
+		err = ErrForeignTicket
+		return
+	}
+	if req.Percent > 0 && req.Percent < 100 {
+		amount = amount * int64(req.Percent) / 100
+	}
+	if remaining := totalCents - refundedCents; amount > remaining {
+		amount = remaining
+	}
+
+	var requestedBy interface{}
+	if req.RequestedBy != "" {
+		requestedBy = req.RequestedBy
+	}
+	if err = tx.QueryRow(`
+		INSERT INTO refunds (order_id, amount_cents, status, reason, requested_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		req.OrderID, amount, StatusPending, req.Reason, requestedBy).Scan(&refundID); err != nil {
+		return
+	}
+	for _, t := range tickets {
+		if _, err = tx.Exec(`INSERT INTO refund_tickets (refund_id, ticket_id) VALUES ($1, $2)`, refundID, t.id); err != nil {
+			return
+		}
+	}
+
+	if _, err = tx.Exec(`UPDATE orders SET status = $1 WHERE id = $2`, OrderStatusRefundPending, req.OrderID); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// complete voids the refunded tickets, restores their stock and seats and settles the
+// order status. Listings of the tickets are taken off the market; a buyer checking
+// one out is refunded when their payment arrives. Tickets bought on resale are not
+// restocked, the ticket they replaced was sold from stock already.
+func complete(db *sql.DB, refundID, orderID, gatewayRefundID string, tickets []refundTicket, amount int64) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	restock := make(map[int]int)
+	for _, t := range tickets {
+		if _, err := tx.Exec(`UPDATE tickets SET is_void = TRUE, voided_at = NOW() WHERE id = $1`, t.id); err != nil {
+			return "", err
+		}
+		if err := seating.Free(tx, t.id); err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec(`
+			UPDATE resale_listings
+			SET status = 'cancelled', checkout_session_id = NULL, reserved_until = NULL, updated_at = NOW()
+			WHERE ticket_id = $1 AND status IN ('active', 'reserved')`, t.id); err != nil {
+			return "", err
+		}
+		if !t.resold {
+			restock[t.ticketTypeID]++
+		}
+	}
+	for ticketTypeID, quantity := range restock {
+		if _, err := tx.Exec(`
+			UPDATE ticket_types
+			SET available_quantity = LEAST(available_quantity + $1, total_quantity)
+			WHERE id = $2`, quantity, ticketTypeID); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE refunds SET status = $1, gateway_refund_id = NULLIF($2, ''), updated_at = NOW()
+		WHERE id = $3`, StatusSucceeded, gatewayRefundID, refundID); err != nil {
+		return "", err
+	}
+
+	var status string
+	if err := tx.QueryRow(`
+		UPDATE orders
+		SET refunded_amount_cents = refunded_amount_cents + $1,
+		    status = CASE
+		        WHEN EXISTS (SELECT 1 FROM tickets WHERE order_id = $2 AND is_void = FALSE) THEN $3
+		        ELSE $4
+		    END
+		WHERE id = $2
+		RETURNING status`,
+		amount, orderID, OrderStatusPartiallyRefunded, OrderStatusRefunded).Scan(&status); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// abort marks a refund as failed and restores the order's previous status.
+func abort(db *sql.DB, refundID, orderID, previousStatus string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE refunds SET status = $1, updated_at = NOW() WHERE id = $2`, StatusFailed, refundID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE orders SET status = $1 WHERE id = $2`, previousStatus, orderID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,458 @@
+// Package resale runs the fan-to-fan resale marketplace.
+//
+// A holder lists a ticket at a price of at most its face value plus the event's
+// resale cap. A buyer reserves the listing for the length of a regular checkout
+// session; once paid, the listed ticket is voided, a new one is issued to the buyer
+// and the sale is written to the ledger, which keeps what the seller is owed after
+// the platform's fee until it has been paid out.
+package resale
+
+import (
+	"TickVibe-EventTix-backend/internal/refunds"
+	"TickVibe-EventTix-backend/internal/scancodes"
+	"TickVibe-EventTix-backend/internal/seating"
+	"TickVibe-EventTix-backend/internal/transfers"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Listing statuses stored in resale_listings.status.
+const (
+	StatusActive    = "active"
+	StatusReserved  = "reserved"
+	StatusSold      = "sold"
+	StatusCancelled = "cancelled"
+)
+
+// ActionResold is the ticket_history action of a resale, recorded on both the
+// voided ticket and the one issued to the buyer.
+const ActionResold = "resold"
+
+// defaultFeeBps is the platform's share of a resale when RESALE_FEE_BPS is unset.
+const defaultFeeBps = 1000
+
+var (
+	ErrTicketNotFound  = errors.New("ticket not found")
+	ErrResaleDisabled  = errors.New("tickets of this event cannot be resold")
+	ErrNotResellable   = errors.New("ticket can no longer be resold")
+	ErrInvalidPrice    = errors.New("price must be positive")
+	ErrPriceAboveCap   = errors.New("price is above what this event allows")
+	ErrAlreadyListed   = errors.New("ticket is already listed for resale")
+	ErrTransferPending = errors.New("ticket has an open transfer")
+	ErrListingNotFound = errors.New("listing not found or no longer available")
+	ErrListingReserved = errors.New("someone is buying this ticket right now")
+	ErrOwnListing      = errors.New("you cannot buy your own listing")
+	ErrLedgerNotFound  = errors.New("unpaid ledger entry not found")
+)
+
+// Listing is one ticket offered for resale.
+type Listing struct {
+	ID             int64     `json:"id"`
+	TicketID       string    `json:"-"`
+	SellerID       string    `json:"-"`
+	EventID        string    `json:"event_id"`
+	TicketTypeID   int       `json:"ticket_type_id"`
+	TicketTypeName string    `json:"ticket_type_name"`
+	PriceCents     int64     `json:"price_cents"`
+	Currency       string    `json:"currency"`
+	VATRateBps     int       `json:"-"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Availability sums up the open listings of one ticket type.
+type Availability struct {
+	Listings  int   `json:"listings"`
+	FromCents int64 `json:"from_cents"`
+}
+
+// LedgerEntry is one completed resale and what the seller is owed for it.
+type LedgerEntry struct {
+	ID          int64      `json:"id"`
+	ListingID   int64      `json:"listing_id"`
+	OrderID     string     `json:"order_id"`
+	SellerEmail string     `json:"seller_email,omitempty"`
+	Currency    string     `json:"currency"`
+	GrossCents  int64      `json:"gross_cents"`
+	FeeCents    int64      `json:"fee_cents"`
+	PayoutCents int64      `json:"payout_cents"`
+	PaidOutAt   *time.Time `json:"paid_out_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// openCondition matches listings that can be bought: active ones, and reserved
+// ones whose checkout ran out.
+const openCondition = `(l.status = 'active' OR (l.status = 'reserved' AND l.reserved_until < NOW()))`
+
+// FeeBps returns the platform's share of a resale in basis points, from
+// RESALE_FEE_BPS.
+func FeeBps() int {
+	if bps, err := strconv.Atoi(os.Getenv("RESALE_FEE_BPS")); err == nil && bps >= 0 && bps <= 10000 {
+		return bps
+	}
+	return defaultFeeBps
+}
+
+// FeeCents returns the platform's fee on a resale at the given price.
+func FeeCents(priceCents int64) int64 {
+	return priceCents * int64(FeeBps()) / 10000
+}
+
+// MaxPriceCents returns the most a ticket of the given face value may be resold for.
+func MaxPriceCents(faceValueCents int64, capPercent int) int64 {
+	return faceValueCents * int64(100+capPercent) / 100
+}
+
+// List puts a user's ticket up for resale. Resale follows the event's transfer
+// setting, since a sale is a transfer to a stranger.
+func List(db *sql.DB, ticketID, sellerID string, priceCents int64) (*Listing, error) {
+	if priceCents <= 0 {
+		return nil, ErrInvalidPrice
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	l := &Listing{TicketID: ticketID, SellerID: sellerID, PriceCents: priceCents, Status: StatusActive}
+	var ownerID sql.NullString
+	var used, void, enabled, transferPending bool
+	var faceValue int64
+	var capPercent int
+	var startTime time.Time
+	err = tx.QueryRow(`
+		SELECT t.user_id, t.is_used, t.is_void, COALESCE(t.face_value_cents, t.price_cents, tt.price_cents),
+		       e.transfers_enabled, e.resale_cap_percent, e.start_time, e.currency,
+		       t.event_id, t.ticket_type_id, tt.name,
+		       EXISTS(SELECT 1 FROM ticket_transfers tr
+		              WHERE tr.ticket_id = t.id AND tr.status = $2 AND tr.expires_at > NOW())
+		FROM tickets t
+		JOIN events e ON e.id = t.event_id
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		WHERE t.id = $1
+		FOR UPDATE OF t`, ticketID, transfers.StatusPending).Scan(&ownerID, &used, &void, &faceValue,
+		&enabled, &capPercent, &startTime, &l.Currency, &l.EventID, &l.TicketTypeID, &l.TicketTypeName, &transferPending)
+	if err == sql.ErrNoRows || (err == nil && ownerID.String != sellerID) {
+		return nil, ErrTicketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	refunding, err := refunds.Pending(tx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !enabled:
+		return nil, ErrResaleDisabled
+	case refunding:
+		return nil, ErrNotResellable
+	case used || void || !startTime.After(time.Now()):
+		return nil, ErrNotResellable
+	case transferPending:
+		return nil, ErrTransferPending
+	case priceCents > MaxPriceCents(faceValue, capPercent):
+		return nil, ErrPriceAboveCap
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO resale_listings (ticket_id, seller_id, event_id, ticket_type_id, price_cents, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		ticketID, sellerID, l.EventID, l.TicketTypeID, priceCents, StatusActive).Scan(&l.ID, &l.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrAlreadyListed
+	} else if err != nil {
+		return nil, err
+	}
+	return l, tx.Commit()
+}
+
+// Cancel takes a user's ticket off the market. A listing someone is checking out
+// cannot be withdrawn until their checkout ends.
+func Cancel(db *sql.DB, ticketID, sellerID string) error {
+	res, err := db.Exec(`
+		UPDATE resale_listings l
+		SET status = $3, checkout_session_id = NULL, updated_at = NOW()
+		WHERE l.ticket_id = $1 AND l.seller_id = $2 AND `+openCondition,
+		ticketID, sellerID, StatusCancelled)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var reserved bool
+	if err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM resale_listings WHERE ticket_id = $1 AND seller_id = $2 AND status = $3)`,
+		ticketID, sellerID, StatusReserved).Scan(&reserved); err != nil {
+		return err
+	}
+	if reserved {
+		return ErrListingReserved
+	}
+	return ErrListingNotFound
+}
+
+// ForEvent returns the listings of an event that can be bought, cheapest first.
+func ForEvent(db *sql.DB, eventID string) ([]Listing, error) {
+	rows, err := db.Query(`
+		SELECT l.id, l.event_id, l.ticket_type_id, tt.name, l.price_cents, e.currency, l.created_at
+		FROM resale_listings l
+		JOIN ticket_types tt ON tt.id = l.ticket_type_id
+		JOIN events e ON e.id = l.event_id
+		WHERE l.event_id = $1 AND `+openCondition+`
+		ORDER BY l.price_cents, l.created_at`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	listings := []Listing{}
+	for rows.Next() {
+		l := Listing{Status: StatusActive}
+		if err := rows.Scan(&l.ID, &l.EventID, &l.TicketTypeID, &l.TicketTypeName, &l.PriceCents, &l.Currency, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		listings = append(listings, l)
+	}
+	return listings, rows.Err()
+}
+
+// AvailabilityByType counts the open listings of an event per ticket type.
+func AvailabilityByType(db *sql.DB, eventID string) (map[int]Availability, error) {
+	rows, err := db.Query(`
+		SELECT l.ticket_type_id, COUNT(*), MIN(l.price_cents)
+		FROM resale_listings l
+		WHERE l.event_id = $1 AND `+openCondition+`
+		GROUP BY l.ticket_type_id`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	availability := make(map[int]Availability)
+	for rows.Next() {
+		var id int
+		var a Availability
+		if err := rows.Scan(&id, &a.Listings, &a.FromCents); err != nil {
+			return nil, err
+		}
+		availability[id] = a
+	}
+	return availability, rows.Err()
+}
+
+// Reserve holds a listing for a buyer's checkout session until the given time.
+// The listed ticket must still be valid and the event not have started.
+func Reserve(db *sql.DB, listingID int64, buyerID, checkoutSessionID string, until time.Time) (*Listing, error) {
+	l := &Listing{ID: listingID, Status: StatusReserved}
+	err := db.QueryRow(`
+		UPDATE resale_listings l
+		SET status = $4, checkout_session_id = $3, reserved_until = $5, updated_at = NOW()
+		FROM tickets t, events e, ticket_types tt
+		WHERE l.id = $1 AND l.seller_id <> $2 AND `+openCondition+`
+		  AND t.id = l.ticket_id AND NOT t.is_used AND NOT t.is_void
+		  AND e.id = l.event_id AND e.start_time > NOW()
+		  AND tt.id = l.ticket_type_id
+		RETURNING l.ticket_id, l.seller_id, l.event_id, l.ticket_type_id, tt.name, l.price_cents,
+		          e.currency, e.vat_rate_bps, l.created_at`,
+		listingID, buyerID, checkoutSessionID, StatusReserved, until).Scan(&l.TicketID, &l.SellerID, &l.EventID,
+		&l.TicketTypeID, &l.TicketTypeName, &l.PriceCents, &l.Currency, &l.VATRateBps, &l.CreatedAt)
+	if err != sql.ErrNoRows {
+		return l, err
+	}
+
+	var sellerID, status string
+	var reservedUntil sql.NullTime
+	err = db.QueryRow(`SELECT seller_id, status, reserved_until FROM resale_listings WHERE id = $1`,
+		listingID).Scan(&sellerID, &status, &reservedUntil)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrListingNotFound
+	case err != nil:
+		return nil, err
+	case sellerID == buyerID:
+		return nil, ErrOwnListing
+	case status == StatusReserved && reservedUntil.Valid && reservedUntil.Time.After(time.Now()):
+		return nil, ErrListingReserved
+	}
+	return nil, ErrListingNotFound
+}
+
+// Release puts a listing reserved by a checkout that was not paid back on the market.
+func Release(db *sql.DB, checkoutSessionID string) error {
+	_, err := db.Exec(`
+		UPDATE resale_listings
+		SET status = $2, checkout_session_id = NULL, reserved_until = NULL, updated_at = NOW()
+		WHERE checkout_session_id = $1 AND status = $3`, checkoutSessionID, StatusActive, StatusReserved)
+	return err
+}
+
+// Withdraw takes the listing reserved by a checkout off the market, for when its
+// ticket turned out to be no longer resellable.
+func Withdraw(db *sql.DB, checkoutSessionID string) error {
+	_, err := db.Exec(`
+		UPDATE resale_listings
+		SET status = $2, checkout_session_id = NULL, reserved_until = NULL, updated_at = NOW()
+		WHERE checkout_session_id = $1 AND status = $3`, checkoutSessionID, StatusCancelled, StatusReserved)
+	return err
+}
+
+// Sale is the ticket a paid resale issued to its buyer.
+type Sale struct {
+	TicketID       string
+	TicketTypeName string
+	QRCode         string // base64 PNG
+}
+
+// Complete carries out the resale reserved by a paid checkout session as part of the
+// order's transaction: the listed ticket is voided, a new one with a code of its
+// own is issued to the buyer under the order, and the seller's payout is recorded.
+func Complete(tx *sql.Tx, checkoutSessionID, orderID, buyerID, newTicketID string) (*Sale, error) {
+	var listingID, priceCents int64
+	var ticketID, sellerID, currency, eventID string
+	var ticketTypeID int
+	sale := &Sale{TicketID: newTicketID}
+	err := tx.QueryRow(`
+		SELECT l.id, l.ticket_id, l.seller_id, l.price_cents, e.currency, l.event_id, l.ticket_type_id, tt.name
+		FROM resale_listings l
+		JOIN events e ON e.id = l.event_id
+		JOIN ticket_types tt ON tt.id = l.ticket_type_id
+		WHERE l.checkout_session_id = $1 AND l.status = $2
+		FOR UPDATE OF l`, checkoutSessionID, StatusReserved).Scan(&listingID, &ticketID, &sellerID, &priceCents,
+		&currency, &eventID, &ticketTypeID, &sale.TicketTypeName)
+	if err == sql.ErrNoRows {
+		return nil, ErrListingNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The seller may have used the ticket, or had it refunded, while the buyer paid
+	res, err := tx.Exec(`
+		UPDATE tickets SET is_void = TRUE, voided_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND NOT is_used AND NOT is_void`, ticketID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotResellable
+	}
+
+	key, err := scancodes.ActiveKey(tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	code, err := key.Sign(newTicketID, ticketTypeID, 1)
+	if err != nil {
+		return nil, err
+	}
+	sale.QRCode = code.Image
+
+	// The new ticket keeps the seat and the face value of the one it replaces; the
+	// face value caps its price if it is resold again
+	if _, err := tx.Exec(`
+		INSERT INTO tickets (id, order_id, event_id, user_id, ticket_type_id, ticket_code, price_cents, scan_code,
+		                     face_value_cents, seat_id)
+		SELECT $1, $2, t.event_id, $3, t.ticket_type_id, $4, $5, $6, COALESCE(t.face_value_cents, t.price_cents, tt.price_cents),
+		       t.seat_id
+		FROM tickets t
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		WHERE t.id = $7`,
+		newTicketID, orderID, buyerID, code.Image, priceCents, code.Value, ticketID); err != nil {
+		return nil, err
+	}
+	if err := seating.Reassign(tx, ticketID, newTicketID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE resale_listings SET status = $2, sold_ticket_id = $3, updated_at = NOW() WHERE id = $1`,
+		listingID, StatusSold, newTicketID); err != nil {
+		return nil, err
+	}
+
+	fee := FeeCents(priceCents)
+	if _, err := tx.Exec(`
+		INSERT INTO resale_ledger (listing_id, order_id, seller_id, currency, gross_cents, fee_cents, payout_cents)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		listingID, orderID, sellerID, currency, priceCents, fee, priceCents-fee); err != nil {
+		return nil, err
+	}
+
+	for _, id := range []string{ticketID, newTicketID} {
+		if err := transfers.RecordHistory(tx, id, ActionResold, sellerID, buyerID); err != nil {
+			return nil, err
+		}
+	}
+	return sale, nil
+}
+
+// Listed returns the open listings of a user's tickets, by ticket ID.
+func Listed(db *sql.DB, sellerID string) (map[string]Listing, error) {
+	rows, err := db.Query(`
+		SELECT l.id, l.ticket_id, l.price_cents, l.status
+		FROM resale_listings l
+		WHERE l.seller_id = $1 AND l.status IN ($2, $3)`, sellerID, StatusActive, StatusReserved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	listed := make(map[string]Listing)
+	for rows.Next() {
+		var l Listing
+		if err := rows.Scan(&l.ID, &l.TicketID, &l.PriceCents, &l.Status); err != nil {
+			return nil, err
+		}
+		listed[l.TicketID] = l
+	}
+	return listed, rows.Err()
+}
+
+// Ledger returns resale ledger entries, newest first: a seller's when sellerID is
+// set, otherwise every entry still waiting to be paid out.
+func Ledger(db *sql.DB, sellerID string) ([]LedgerEntry, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.listing_id, r.order_id, COALESCE(u.email, ''), r.currency,
+		       r.gross_cents, r.fee_cents, r.payout_cents, r.paid_out_at, r.created_at
+		FROM resale_ledger r
+		LEFT JOIN users u ON u.id = r.seller_id
+		WHERE ($1 = '' AND r.paid_out_at IS NULL) OR r.seller_id::text = $1
+		ORDER BY r.created_at DESC`, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.ListingID, &e.OrderID, &e.SellerEmail, &e.Currency,
+			&e.GrossCents, &e.FeeCents, &e.PayoutCents, &e.PaidOutAt, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// MarkPaidOut records that the seller of a ledger entry has been paid.
+func MarkPaidOut(db *sql.DB, entryID int64) error {
+	res, err := db.Exec(`UPDATE resale_ledger SET paid_out_at = NOW() WHERE id = $1 AND paid_out_at IS NULL`, entryID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLedgerNotFound
+	}
+	return nil
+}
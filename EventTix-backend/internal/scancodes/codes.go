@@ -0,0 +1,194 @@
+package scancodes
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	prefix      = "tv1."
+	payloadSize = 44
+)
+
+var ErrInvalidCode = errors.New("ticket code is not genuine")
+
+// Claims is what a signed code says about its ticket.
+type Claims struct {
+	KeyID        int64
+	TicketID     string
+	EventID      string
+	TicketTypeID int
+	Version      int
+}
+
+// Code is a ticket's scan code and its rendered QR image.
+type Code struct {
+	Value string // stored in tickets.scan_code
+	Image string // base64 PNG, stored in tickets.ticket_code
+}
+
+// Sign issues the code of a ticket of the key's event.
+func (k *Key) Sign(ticketID string, ticketTypeID, version int) (Code, error) {
+	ticket, err := uuid.Parse(ticketID)
+	if err != nil {
+		return Code{}, err
+	}
+	event, err := uuid.Parse(k.EventID)
+	if err != nil {
+		return Code{}, err
+	}
+
+	payload := make([]byte, 0, payloadSize)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(k.ID))
+	payload = append(payload, ticket[:]...)
+	payload = append(payload, event[:]...)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(ticketTypeID))
+	payload = binary.BigEndian.AppendUint32(payload, uint32(version))
+
+	value := prefix + base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(ed25519.Sign(k.private, payload))
+	png, err := qrcode.Encode(value, qrcode.Medium, 256)
+	if err != nil {
+		return Code{}, err
+	}
+	return Code{Value: value, Image: base64.StdEncoding.EncodeToString(png)}, nil
+}
+
+// SignPayload signs other data scanners check with the event's key, such as
+// offline manifests.
+func (k *Key) SignPayload(payload []byte) []byte {
+	return ed25519.Sign(k.private, payload)
+}
+
+// IsSigned reports whether a scanned value has the form of a signed code, as
+// opposed to the unsigned codes of tickets issued before codes were signed.
+func IsSigned(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Verify checks the signature of a scanned code against the event key it names
+// and returns what the code says. It does not check that the code is the ticket's
+// current one.
+func Verify(q querier, value string) (*Claims, error) {
+	return verify(value, func(id int64) (*Key, error) { return keyByID(q, id) })
+}
+
+// verify is Verify with the keys looked up by ID through key.
+func verify(value string, key func(id int64) (*Key, error)) (*Claims, error) {
+	claims, payload, signature, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	k, err := key(claims.KeyID)
+	if err == ErrKeyNotFound {
+		return nil, ErrInvalidCode
+	} else if err != nil {
+		return nil, err
+	}
+	if k.EventID != claims.EventID || !ed25519.Verify(k.PublicKey, payload, signature) {
+		return nil, ErrInvalidCode
+	}
+	return claims, nil
+}
+
+func parse(value string) (*Claims, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ".")
+	if !IsSigned(value) || len(parts) != 2 {
+		return nil, nil, nil, ErrInvalidCode
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(payload) != payloadSize {
+		return nil, nil, nil, ErrInvalidCode
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, nil, nil, ErrInvalidCode
+	}
+
+	ticket, _ := uuid.FromBytes(payload[4:20])
+	event, _ := uuid.FromBytes(payload[20:36])
+	return &Claims{
+		KeyID:        int64(binary.BigEndian.Uint32(payload[0:4])),
+		TicketID:     ticket.String(),
+		EventID:      event.String(),
+		TicketTypeID: int(binary.BigEndian.Uint32(payload[36:40])),
+		Version:      int(binary.BigEndian.Uint32(payload[40:44])),
+	}, payload, signature, nil
+}
+
+// Reissue gives a ticket a new code under the next issue version, signed with its
+// event's active key, as part of tx. The ticket's previous codes stop working.
+func Reissue(tx *sql.Tx, ticketID string) (Code, error) {
+	var eventID string
+	var ticketTypeID, version int
+	if err := tx.QueryRow(`
+		UPDATE tickets SET code_version = code_version + 1
+		WHERE id = $1
+		RETURNING event_id, ticket_type_id, code_version`, ticketID).Scan(&eventID, &ticketTypeID, &version); err != nil {
+		return Code{}, err
+	}
+	key, err := ActiveKey(tx, eventID)
+	if err != nil {
+		return Code{}, err
+	}
+	code, err := key.Sign(ticketID, ticketTypeID, version)
+	if err != nil {
+		return Code{}, err
+	}
+	_, err = tx.Exec(`UPDATE tickets SET scan_code = $2, ticket_code = $3 WHERE id = $1`, ticketID, code.Value, code.Image)
+	return code, err
+}
+
+// ReissueUnsigned gives up to limit tickets that still carry an unsigned code a
+// signed one, and returns how many it reissued. It is run until none are left to
+// move tickets issued before codes were signed over; their QR codes, including
+// those in ticket emails, stop working and holders find the new ones in their
+// account or order link.
+func ReissueUnsigned(db *sql.DB, limit int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ids, err := ticketIDs(tx, `
+		SELECT id FROM tickets
+		WHERE scan_code NOT LIKE 'tv1.%'
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if _, err := Reissue(tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+func ticketIDs(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,122 @@
+package scancodes
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testKey generates a signing key of an event that never touches the database.
+func testKey(t *testing.T, id int64, eventID string) *Key {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	return &Key{ID: id, EventID: eventID, Algorithm: Algorithm, PublicKey: public, private: private}
+}
+
+// sign issues a code with a key, failing the test on error.
+func sign(t *testing.T, k *Key, ticketID string) string {
+	t.Helper()
+	code, err := k.Sign(ticketID, 42, 3)
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	return code.Value
+}
+
+// tamper decodes one part of a code, lets change alter it and encodes it again.
+func tamper(value string, part int, change func([]byte)) string {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ".")
+	b, _ := base64.RawURLEncoding.DecodeString(parts[part])
+	change(b)
+	parts[part] = base64.RawURLEncoding.EncodeToString(b)
+	return prefix + strings.Join(parts, ".")
+}
+
+func TestVerify(t *testing.T) {
+	eventA, eventB := uuid.NewString(), uuid.NewString()
+	keyA, keyB := testKey(t, 1, eventA), testKey(t, 2, eventB)
+	keys := map[int64]*Key{keyA.ID: keyA, keyB.ID: keyB}
+	lookup := func(id int64) (*Key, error) {
+		if k, ok := keys[id]; ok {
+			return k, nil
+		}
+		return nil, ErrKeyNotFound
+	}
+
+	ticketID := uuid.NewString()
+	valid := sign(t, keyA, ticketID)
+	parts := strings.Split(strings.TrimPrefix(valid, prefix), ".")
+	payload, signature := parts[0], parts[1]
+
+	// Event B's key signing a code that claims to be of event A
+	otherEvent := sign(t, &Key{ID: keyB.ID, EventID: eventA, private: keyB.private}, ticketID)
+	// Event A's key signing a code that names event B's key
+	otherKey := sign(t, &Key{ID: keyB.ID, EventID: eventB, private: keyA.private}, ticketID)
+	unknownKey := sign(t, &Key{ID: 99, EventID: eventA, private: keyA.private}, ticketID)
+
+	claims, err := verify(valid, lookup)
+	if err != nil {
+		t.Fatalf("valid code: %v", err)
+	}
+	want := Claims{KeyID: keyA.ID, TicketID: ticketID, EventID: eventA, TicketTypeID: 42, Version: 3}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+
+	invalid := []struct {
+		name  string
+		value string
+	}{
+		{"tampered payload", tamper(valid, 0, func(b []byte) { b[len(b)-1]++ })},
+		{"tampered ticket ID", tamper(valid, 0, func(b []byte) { b[4] ^= 0xff })},
+		{"tampered signature", tamper(valid, 1, func(b []byte) { b[0] ^= 0x01 })},
+		{"another event's key", otherEvent},
+		{"signed with a different key", otherKey},
+		{"unknown key", unknownKey},
+		{"prefix only", prefix},
+		{"no signature", prefix + payload},
+		{"extra part", valid + ".x"},
+		{"other version", "tv2." + strings.TrimPrefix(valid, prefix)},
+		{"payload not base64", prefix + "!!!." + signature},
+		{"short payload", prefix + payload[:16] + "." + signature},
+		{"short signature", prefix + payload + "." + signature[:len(signature)-4]},
+		{"unsigned code", "A1B2C3D4"},
+		{"empty", ""},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verify(tt.value, lookup); !errors.Is(err, ErrInvalidCode) {
+				t.Errorf("verify(%q) error = %v, want %v", tt.value, err, ErrInvalidCode)
+			}
+		})
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	t.Setenv("TICKET_SIGNING_SECRET", "")
+	if err := CheckSecret(); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("CheckSecret without a secret = %v, want %v", err, ErrNoSecret)
+	}
+	if _, err := seal([]byte("seed")); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("seal without a secret = %v, want %v", err, ErrNoSecret)
+	}
+
+	t.Setenv("TICKET_SIGNING_SECRET", "test-signing-secret")
+	if err := CheckSecret(); err != nil {
+		t.Errorf("CheckSecret with a secret = %v", err)
+	}
+	sealed, err := seal([]byte("seed"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if plain, err := open(sealed); err != nil || string(plain) != "seed" {
+		t.Errorf("open(seal(seed)) = %q, %v", plain, err)
+	}
+}
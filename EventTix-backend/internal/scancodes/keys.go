@@ -0,0 +1,202 @@
+// Package scancodes issues and checks the codes in ticket QR codes.
+//
+// A scan code is a token signed with the Ed25519 key of the ticket's event:
+//
+//	tv1.<payload>.<signature>
+//
+// Both parts are base64url without padding. The 44-byte payload holds the signing
+// key's ID (4 bytes), the ticket ID and the event ID (16 bytes each), the ticket
+// type ID and the ticket's issue version (4 bytes each), integers big-endian; the
+// signature covers the payload. A scanner holding the event's public key can thus
+// tell a genuine code from a guessed or altered one without the database. Giving a
+// ticket a new code bumps its issue version; which version is current only the
+// database knows, so codes replaced since are turned away when scanning online.
+package scancodes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"os"
+	"time"
+)
+
+// Algorithm is the signature algorithm of the codes.
+const Algorithm = "Ed25519"
+
+var (
+	ErrKeyNotFound = errors.New("signing key not found")
+	ErrNoSecret    = errors.New("TICKET_SIGNING_SECRET is not set")
+)
+
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Key is a signing key of an event. Only the public half leaves the server, for
+// scanners to check codes with.
+type Key struct {
+	ID        int64             `json:"key_id"`
+	EventID   string            `json:"event_id"`
+	Algorithm string            `json:"algorithm"`
+	PublicKey ed25519.PublicKey `json:"public_key"` // base64 in JSON
+	CreatedAt time.Time         `json:"created_at"`
+	private   ed25519.PrivateKey
+}
+
+// ActiveKey returns the key an event's codes are signed with, creating it for the
+// event's first ticket.
+func ActiveKey(q querier, eventID string) (*Key, error) {
+	key, err := activeKey(q, eventID)
+	if err != ErrKeyNotFound {
+		return key, err
+	}
+	// Two first tickets may be issued at once; the second one uses the first's key
+	if err := createKey(q, eventID); err != nil {
+		return nil, err
+	}
+	return activeKey(q, eventID)
+}
+
+func activeKey(q querier, eventID string) (*Key, error) {
+	return scanKey(q.QueryRow(`
+		SELECT id, event_id, public_key, sealed_private_key, created_at
+		FROM event_signing_keys
+		WHERE event_id = $1 AND retired_at IS NULL`, eventID))
+}
+
+// keyByID returns an unretired key. Codes signed with a retired key were all
+// replaced when it was retired.
+func keyByID(q querier, id int64) (*Key, error) {
+	return scanKey(q.QueryRow(`
+		SELECT id, event_id, public_key, sealed_private_key, created_at
+		FROM event_signing_keys
+		WHERE id = $1 AND retired_at IS NULL`, id))
+}
+
+func scanKey(row *sql.Row) (*Key, error) {
+	key := &Key{Algorithm: Algorithm}
+	var public, sealed []byte
+	err := row.Scan(&key.ID, &key.EventID, &public, &sealed, &key.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	seed, err := open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	key.PublicKey = ed25519.PublicKey(public)
+	key.private = ed25519.NewKeyFromSeed(seed)
+	return key, nil
+}
+
+func createKey(q querier, eventID string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(private.Seed())
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`
+		INSERT INTO event_signing_keys (event_id, public_key, sealed_private_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (event_id) WHERE retired_at IS NULL DO NOTHING`, eventID, []byte(public), sealed)
+	return err
+}
+
+// Rotate retires an event's key and gives every ticket of the event a new code
+// signed with a new one. Holders find the new codes in their account or order
+// link; QR codes handed out before, including those in ticket emails, stop
+// working. It returns the new key and the number of tickets reissued.
+func Rotate(db *sql.DB, eventID string) (*Key, int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE event_signing_keys SET retired_at = NOW()
+		WHERE event_id = $1 AND retired_at IS NULL`, eventID); err != nil {
+		return nil, 0, err
+	}
+	key, err := ActiveKey(tx, eventID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ticketIDs, err := ticketIDs(tx, `SELECT id FROM tickets WHERE event_id = $1 ORDER BY id`, eventID)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, id := range ticketIDs {
+		if _, err := Reissue(tx, id); err != nil {
+			return nil, 0, err
+		}
+	}
+	return key, len(ticketIDs), tx.Commit()
+}
+
+// CheckSecret reports whether the secret signing keys are sealed with is set. The
+// server refuses to start without it rather than seal keys under an empty one.
+func CheckSecret() error {
+	if os.Getenv("TICKET_SIGNING_SECRET") == "" {
+		return ErrNoSecret
+	}
+	return nil
+}
+
+// sealingKey derives the key private keys are encrypted with at rest.
+func sealingKey() ([]byte, error) {
+	if err := CheckSecret(); err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256([]byte(os.Getenv("TICKET_SIGNING_SECRET")))
+	return key[:], nil
+}
+
+// seal encrypts with AES-GCM, prefixing the nonce.
+func seal(plain []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func open(sealed []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed signing key is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM() (cipher.AEAD, error) {
+	key, err := sealingKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,197 @@
+package seating
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// querier is what the read helpers need, so they run on a *sql.DB or in a transaction.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// AssignedSeat is a seat held for, or sold to, a ticket.
+type AssignedSeat struct {
+	SeatID       int64
+	TicketTypeID int
+	Label        string
+}
+
+// SeatedTypes returns the ticket types of an event that are sold by seat.
+func SeatedTypes(q querier, eventID string) (map[int]bool, error) {
+	rows, err := q.Query(`SELECT DISTINCT ticket_type_id FROM event_seats WHERE event_id = $1`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seated := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		seated[id] = true
+	}
+	return seated, rows.Err()
+}
+
+// Count returns how many of the picked seats are sold as each ticket type. Every
+// seat must be sold by the event and picked only once.
+func Count(db *sql.DB, eventID string, seatIDs []int64) (map[int]int, error) {
+	picked := make(map[int64]bool, len(seatIDs))
+	for _, id := range seatIDs {
+		if picked[id] {
+			return nil, fmt.Errorf("%w: seat %d picked twice", ErrInvalidSeats, id)
+		}
+		picked[id] = true
+	}
+
+	rows, err := db.Query(`
+		SELECT ticket_type_id, COUNT(*)
+		FROM event_seats
+		WHERE event_id = $1 AND seat_id = ANY($2)
+		GROUP BY ticket_type_id`, eventID, pq.Array(seatIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	found := 0
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+		found += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if found != len(seatIDs) {
+		return nil, fmt.Errorf("%w: seats not sold for this event", ErrInvalidSeats)
+	}
+	return counts, nil
+}
+
+// Hold takes the picked seats of an event for a reservation until the given time.
+// Either every seat is held or none is.
+func Hold(db *sql.DB, eventID, reservationID string, seatIDs []int64, until time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE event_seats
+		SET status = $4, reservation_id = $3, held_until = $5
+		WHERE event_id = $1 AND seat_id = ANY($2)
+		  AND (status = $6 OR (status = $4 AND held_until < NOW()))`,
+		eventID, pq.Array(seatIDs), reservationID, StatusHeld, until, StatusAvailable)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != int64(len(seatIDs)) {
+		return ErrSeatTaken
+	}
+	return tx.Commit()
+}
+
+// Release frees the seats still held for a reservation that was not paid.
+func Release(db *sql.DB, reservationID string) error {
+	_, err := db.Exec(`
+		UPDATE event_seats
+		SET status = $2, reservation_id = NULL, held_until = NULL
+		WHERE reservation_id = $1 AND status = $3`, reservationID, StatusAvailable, StatusHeld)
+	return err
+}
+
+// Held returns the seats held for a reservation, grouped by ticket type, and locks
+// them for the caller's transaction. A seat stays with its reservation past
+// held_until until someone else picks it.
+func Held(tx *sql.Tx, reservationID string) (map[int][]AssignedSeat, error) {
+	rows, err := tx.Query(`
+		SELECT es.seat_id, es.ticket_type_id, vs.name, s.row_label, s.seat_number
+		FROM event_seats es
+		JOIN venue_seats s ON s.id = es.seat_id
+		JOIN venue_sections vs ON vs.id = s.section_id
+		WHERE es.reservation_id = $1 AND es.status = $2
+		ORDER BY vs.sort_order, s.id
+		FOR UPDATE OF es`, reservationID, StatusHeld)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	held := make(map[int][]AssignedSeat)
+	for rows.Next() {
+		var a AssignedSeat
+		var section, row, number string
+		if err := rows.Scan(&a.SeatID, &a.TicketTypeID, &section, &row, &number); err != nil {
+			return nil, err
+		}
+		a.Label = Label(section, row, number)
+		held[a.TicketTypeID] = append(held[a.TicketTypeID], a)
+	}
+	return held, rows.Err()
+}
+
+// Sell marks a held seat as sold to the ticket issued for it, as part of the
+// order's transaction.
+func Sell(tx *sql.Tx, reservationID string, seatID int64, ticketID string) error {
+	res, err := tx.Exec(`
+		UPDATE event_seats
+		SET status = $4, ticket_id = $3, held_until = NULL
+		WHERE reservation_id = $1 AND seat_id = $2 AND status = $5`,
+		reservationID, seatID, ticketID, StatusSold, StatusHeld)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSeatTaken
+	}
+	return nil
+}
+
+// Free puts the seat of a voided ticket back on sale. Tickets without a seat are
+// a no-op.
+func Free(tx *sql.Tx, ticketID string) error {
+	_, err := tx.Exec(`
+		UPDATE event_seats
+		SET status = $2, ticket_id = NULL, reservation_id = NULL, held_until = NULL
+		WHERE ticket_id = $1`, ticketID, StatusAvailable)
+	return err
+}
+
+// Reassign moves the seat of a ticket that was reissued to its replacement.
+func Reassign(tx *sql.Tx, oldTicketID, newTicketID string) error {
+	_, err := tx.Exec(`UPDATE event_seats SET ticket_id = $2 WHERE ticket_id = $1`, oldTicketID, newTicketID)
+	return err
+}
+
+// TicketSeat returns the label of the seat a ticket is for and whether the event's
+// seat map still has that seat sold to it. ok is false for tickets without a seat.
+func TicketSeat(q querier, ticketID string) (label string, assigned, ok bool, err error) {
+	var section, row, number string
+	err = q.QueryRow(`
+		SELECT vs.name, s.row_label, s.seat_number,
+		       EXISTS(SELECT 1 FROM event_seats es
+		              WHERE es.event_id = t.event_id AND es.seat_id = t.seat_id AND es.ticket_id = t.id AND es.status = $2)
+		FROM tickets t
+		JOIN venue_seats s ON s.id = t.seat_id
+		JOIN venue_sections vs ON vs.id = s.section_id
+		WHERE t.id = $1`, ticketID, StatusSold).Scan(&section, &row, &number, &assigned)
+	if err == sql.ErrNoRows {
+		return "", false, false, nil
+	} else if err != nil {
+		return "", false, false, err
+	}
+	return Label(section, row, number), assigned, true, nil
+}
@@ -0,0 +1,413 @@
+// Package seating lays out seated venues and sells their seats.
+//
+// A venue is made of sections, rows and seats. An event at a seated venue maps
+// its seats to ticket types, which act as the event's price zones, and the stock
+// of a mapped ticket type is exactly its number of seats. Buyers pick seats in
+// checkout: the stock is reserved through the inventory package as usual, and
+// every picked seat is additionally held for the reservation until the ticket
+// issued for it is written or the hold runs out.
+package seating
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Seat statuses stored in event_seats.status. A seat map also shows venue seats
+// the event does not sell as unavailable.
+const (
+	StatusAvailable   = "available"
+	StatusHeld        = "held"
+	StatusSold        = "sold"
+	StatusUnavailable = "unavailable"
+)
+
+var (
+	ErrInvalidVenue   = errors.New("invalid venue layout")
+	ErrVenueNotFound  = errors.New("venue not found")
+	ErrInvalidZones   = errors.New("invalid seat mapping")
+	ErrSeatingLocked  = errors.New("seats cannot be remapped once tickets have been reserved or sold")
+	ErrNotSeated      = errors.New("event has no seat map")
+	ErrInvalidSeats   = errors.New("invalid seat selection")
+	ErrSeatTaken      = errors.New("some of the selected seats are no longer available")
+	ErrSeatsRequired  = errors.New("pick seats for this ticket type")
+	ErrSeatedWaitlist = errors.New("seated ticket types have no waitlist")
+)
+
+// Seat is one seat of a venue. TicketTypeID and Status describe it for a given
+// event and are only set on seat maps.
+type Seat struct {
+	ID           int64  `json:"id"`
+	Number       string `json:"number"`
+	X            int    `json:"x"`
+	Y            int    `json:"y"`
+	Accessible   bool   `json:"accessible"`
+	Obstructed   bool   `json:"obstructed"`
+	TicketTypeID *int   `json:"ticket_type_id,omitempty"`
+	Status       string `json:"status,omitempty"`
+}
+
+// Row is a row of seats in a section.
+type Row struct {
+	Label string `json:"label"`
+	Seats []Seat `json:"seats"`
+}
+
+// Section is a named block of rows.
+type Section struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Rows []Row  `json:"rows"`
+}
+
+// Venue is a seated venue. Seats counts the seats of all sections.
+type Venue struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address,omitempty"`
+	Seats     int       `json:"seats"`
+	Sections  []Section `json:"sections,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Label describes a seat the way it is printed on tickets.
+func Label(section, row, number string) string {
+	return fmt.Sprintf("Section %s, Row %s, Seat %s", section, row, number)
+}
+
+// validate trims the venue's names and checks that every section, row and seat
+// is named and that no seat appears twice.
+func (v *Venue) validate() error {
+	v.Name = strings.TrimSpace(v.Name)
+	v.Address = strings.TrimSpace(v.Address)
+	if v.Name == "" || len(v.Sections) == 0 {
+		return fmt.Errorf("%w: a venue needs a name and at least one section", ErrInvalidVenue)
+	}
+	sections := make(map[string]bool)
+	for i := range v.Sections {
+		s := &v.Sections[i]
+		s.Name = strings.TrimSpace(s.Name)
+		if s.Name == "" || sections[s.Name] {
+			return fmt.Errorf("%w: sections need distinct names", ErrInvalidVenue)
+		}
+		sections[s.Name] = true
+		if len(s.Rows) == 0 {
+			return fmt.Errorf("%w: section %s has no rows", ErrInvalidVenue, s.Name)
+		}
+		seats := make(map[string]bool)
+		for j := range s.Rows {
+			row := &s.Rows[j]
+			row.Label = strings.TrimSpace(row.Label)
+			if row.Label == "" || len(row.Seats) == 0 {
+				return fmt.Errorf("%w: rows of section %s need a label and seats", ErrInvalidVenue, s.Name)
+			}
+			for k := range row.Seats {
+				seat := &row.Seats[k]
+				seat.Number = strings.TrimSpace(seat.Number)
+				key := row.Label + "/" + seat.Number
+				if seat.Number == "" || seats[key] {
+					return fmt.Errorf("%w: seats of row %s in section %s need distinct numbers", ErrInvalidVenue, row.Label, s.Name)
+				}
+				seats[key] = true
+			}
+		}
+	}
+	return nil
+}
+
+// CreateVenue stores a venue with its whole layout and fills in the IDs.
+func CreateVenue(db *sql.DB, v *Venue, creatorID string) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(`
+		INSERT INTO venues (name, address, creator_id)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::uuid)
+		RETURNING id, created_at`, v.Name, v.Address, creatorID).Scan(&v.ID, &v.CreatedAt); err != nil {
+		return err
+	}
+
+	v.Seats = 0
+	for i := range v.Sections {
+		s := &v.Sections[i]
+		if err := tx.QueryRow(`
+			INSERT INTO venue_sections (venue_id, name, sort_order) VALUES ($1, $2, $3) RETURNING id`,
+			v.ID, s.Name, i).Scan(&s.ID); err != nil {
+			return err
+		}
+		for j := range s.Rows {
+			for k := range s.Rows[j].Seats {
+				seat := &s.Rows[j].Seats[k]
+				if err := tx.QueryRow(`
+					INSERT INTO venue_seats (section_id, row_label, seat_number, x, y, accessible, obstructed)
+					VALUES ($1, $2, $3, $4, $5, $6, $7)
+					RETURNING id`,
+					s.ID, s.Rows[j].Label, seat.Number, seat.X, seat.Y, seat.Accessible, seat.Obstructed).Scan(&seat.ID); err != nil {
+					return err
+				}
+				v.Seats++
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Venues lists venues without their layout: a creator's own when creatorID is
+// set, otherwise all of them.
+func Venues(db *sql.DB, creatorID string) ([]Venue, error) {
+	rows, err := db.Query(`
+		SELECT v.id, v.name, COALESCE(v.address, ''), v.created_at,
+		       (SELECT COUNT(*) FROM venue_seats s JOIN venue_sections vs ON vs.id = s.section_id WHERE vs.venue_id = v.id)
+		FROM venues v
+		WHERE $1 = '' OR v.creator_id::text = $1
+		ORDER BY v.name`, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	venues := []Venue{}
+	for rows.Next() {
+		var v Venue
+		if err := rows.Scan(&v.ID, &v.Name, &v.Address, &v.CreatedAt, &v.Seats); err != nil {
+			return nil, err
+		}
+		venues = append(venues, v)
+	}
+	return venues, rows.Err()
+}
+
+// Zone maps seats to a ticket type: every seat of the listed sections and the
+// individually listed seats.
+type Zone struct {
+	TicketTypeID int     `json:"ticket_type_id"`
+	SectionIDs   []int   `json:"section_ids"`
+	SeatIDs      []int64 `json:"seat_ids"`
+}
+
+// AssignSeats seats an event at a venue, selling the seats of each zone as its
+// ticket type. The stock of every mapped ticket type becomes its number of seats,
+// and ticket types that lose their seats are left with none. The mapping can only
+// change while none of the ticket types involved has stock reserved or sold.
+func AssignSeats(db *sql.DB, eventID string, venueID int, zones []Zone) (map[int]int, error) {
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("%w: map seats to at least one ticket type", ErrInvalidZones)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM venues WHERE id = $1)`, venueID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrVenueNotFound
+	}
+
+	// Ticket types seated before that get no seats now are emptied below
+	var typeIDs []int64
+	if err := tx.QueryRow(`
+		SELECT COALESCE(array_agg(DISTINCT ticket_type_id), '{}') FROM event_seats WHERE event_id = $1`,
+		eventID).Scan(pq.Array(&typeIDs)); err != nil {
+		return nil, err
+	}
+	previous := make(map[int]bool, len(typeIDs))
+	for _, id := range typeIDs {
+		previous[int(id)] = true
+	}
+
+	counts := make(map[int]int)
+	seen := make(map[int64]bool)
+	for _, z := range zones {
+		var ok bool
+		if err := tx.QueryRow(`
+			SELECT total_quantity = available_quantity
+			       AND NOT EXISTS (SELECT 1 FROM inventory_holds WHERE ticket_type_id = tt.id AND status = 'active')
+			FROM ticket_types tt
+			WHERE id = $1 AND event_id = $2
+			FOR UPDATE`, z.TicketTypeID, eventID).Scan(&ok); err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: ticket type %d is not part of the event", ErrInvalidZones, z.TicketTypeID)
+		} else if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrSeatingLocked
+		}
+
+		rows, err := tx.Query(`
+			SELECT s.id
+			FROM venue_seats s
+			JOIN venue_sections vs ON vs.id = s.section_id
+			WHERE vs.venue_id = $1 AND (vs.id = ANY($2) OR s.id = ANY($3))`,
+			venueID, pq.Array(z.SectionIDs), pq.Array(z.SeatIDs))
+		if err != nil {
+			return nil, err
+		}
+		var seatIDs []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			seatIDs = append(seatIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if len(seatIDs) == 0 {
+			return nil, fmt.Errorf("%w: no seats of the venue selected for ticket type %d", ErrInvalidZones, z.TicketTypeID)
+		}
+		for _, id := range seatIDs {
+			if seen[id] {
+				return nil, fmt.Errorf("%w: seat %d is mapped to more than one ticket type", ErrInvalidZones, id)
+			}
+			seen[id] = true
+		}
+		counts[z.TicketTypeID] += len(seatIDs)
+	}
+
+	for id := range previous {
+		if _, mapped := counts[id]; mapped {
+			continue
+		}
+		var ok bool
+		if err := tx.QueryRow(`
+			SELECT total_quantity = available_quantity FROM ticket_types WHERE id = $1 FOR UPDATE`, id).Scan(&ok); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrSeatingLocked
+		}
+		counts[id] = 0
+	}
+
+	if _, err := tx.Exec(`DELETE FROM event_seats WHERE event_id = $1`, eventID); err != nil {
+		return nil, err
+	}
+	for _, z := range zones {
+		if _, err := tx.Exec(`
+			INSERT INTO event_seats (event_id, seat_id, ticket_type_id)
+			SELECT $1, s.id, $2
+			FROM venue_seats s
+			JOIN venue_sections vs ON vs.id = s.section_id
+			WHERE vs.venue_id = $3 AND (vs.id = ANY($4) OR s.id = ANY($5))`,
+			eventID, z.TicketTypeID, venueID, pq.Array(z.SectionIDs), pq.Array(z.SeatIDs)); err != nil {
+			return nil, err
+		}
+	}
+	for id, n := range counts {
+		if _, err := tx.Exec(`UPDATE ticket_types SET total_quantity = $1, available_quantity = $1 WHERE id = $2`,
+			n, id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE events SET venue_id = $1 WHERE id = $2`, venueID, eventID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetVenue returns a venue with its whole layout.
+func GetVenue(db *sql.DB, venueID int) (*Venue, error) {
+	v := &Venue{}
+	err := db.QueryRow(`SELECT id, name, COALESCE(address, ''), created_at FROM venues WHERE id = $1`,
+		venueID).Scan(&v.ID, &v.Name, &v.Address, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrVenueNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return v, loadLayout(db, v, "")
+}
+
+// Map returns the layout of an event's venue with the ticket type and current
+// status of every seat, for the client to render.
+func Map(db *sql.DB, eventID string) (*Venue, error) {
+	v := &Venue{}
+	err := db.QueryRow(`
+		SELECT v.id, v.name, COALESCE(v.address, ''), v.created_at
+		FROM events e
+		JOIN venues v ON v.id = e.venue_id
+		WHERE e.id = $1`, eventID).Scan(&v.ID, &v.Name, &v.Address, &v.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotSeated
+	} else if err != nil {
+		return nil, err
+	}
+	return v, loadLayout(db, v, eventID)
+}
+
+// loadLayout fills in the sections, rows and seats of a venue. With an eventID
+// every seat also gets its ticket type and status for that event.
+func loadLayout(db *sql.DB, v *Venue, eventID string) error {
+	rows, err := db.Query(`
+		SELECT vs.id, vs.name, s.row_label, s.id, s.seat_number, s.x, s.y, s.accessible, s.obstructed,
+		       es.ticket_type_id,
+		       CASE
+		           WHEN $2 = '' THEN ''
+		           WHEN es.seat_id IS NULL THEN $3
+		           WHEN es.status = $4 AND es.held_until < NOW() THEN $5
+		           ELSE es.status
+		       END
+		FROM venue_sections vs
+		JOIN venue_seats s ON s.section_id = vs.id
+		LEFT JOIN event_seats es ON es.seat_id = s.id AND es.event_id::text = $2
+		WHERE vs.venue_id = $1
+		ORDER BY vs.sort_order, vs.id, s.id`,
+		v.ID, eventID, StatusUnavailable, StatusHeld, StatusAvailable)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	v.Seats = 0
+	for rows.Next() {
+		var sectionID int
+		var sectionName, rowLabel string
+		var seat Seat
+		var ticketTypeID sql.NullInt64
+		if err := rows.Scan(&sectionID, &sectionName, &rowLabel, &seat.ID, &seat.Number, &seat.X, &seat.Y,
+			&seat.Accessible, &seat.Obstructed, &ticketTypeID, &seat.Status); err != nil {
+			return err
+		}
+		if ticketTypeID.Valid {
+			id := int(ticketTypeID.Int64)
+			seat.TicketTypeID = &id
+		}
+
+		if n := len(v.Sections); n == 0 || v.Sections[n-1].ID != sectionID {
+			v.Sections = append(v.Sections, Section{ID: sectionID, Name: sectionName})
+		}
+		s := &v.Sections[len(v.Sections)-1]
+		if n := len(s.Rows); n == 0 || s.Rows[n-1].Label != rowLabel {
+			s.Rows = append(s.Rows, Row{Label: rowLabel})
+		}
+		r := &s.Rows[len(s.Rows)-1]
+		r.Seats = append(r.Seats, seat)
+		v.Seats++
+	}
+	return rows.Err()
+}
@@ -0,0 +1,273 @@
+// Package staff gives door staff access to the scanners of the events they work.
+//
+// A creator invites someone by email to scan tickets of one event during a time
+// window. Whoever accepts the emailed link while logged in with that address is
+// assigned to the event; the account's role stays as it was. A scan needs an
+// assignment to the event that is open at the time, unless the scanner is the
+// event's creator or an admin, so access ends with the window or on revocation.
+package staff
+
+import (
+	"TickVibe-EventTix-backend/internal/utils"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Default window of an invitation, around the event's start.
+const (
+	DefaultLeadTime = 4 * time.Hour
+	DefaultShift    = 16 * time.Hour
+)
+
+var (
+	ErrEventNotFound      = errors.New("event not found")
+	ErrInvalidEmail       = errors.New("a valid email address is required")
+	ErrInvalidWindow      = errors.New("the window must end after it starts, and in the future")
+	ErrInvitationNotFound = errors.New("invitation link is invalid or no longer valid")
+	ErrWrongAccount       = errors.New("this invitation was sent to a different email address")
+	ErrAssignmentNotFound = errors.New("staff assignment not found")
+)
+
+// Assignment is a person's access to the scanners of one event.
+type Assignment struct {
+	ID         int64      `json:"id"`
+	EventID    string     `json:"event_id"`
+	EventTitle string     `json:"event_title"`
+	EventStart time.Time  `json:"event_start"`
+	Email      string     `json:"email"`
+	StartsAt   time.Time  `json:"starts_at"`
+	EndsAt     time.Time  `json:"ends_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+const selectAssignment = `
+	SELECT s.id, s.event_id, e.title, e.start_time, s.email, s.starts_at, s.ends_at, s.accepted_at
+	FROM event_staff s
+	JOIN events e ON e.id = s.event_id`
+
+func scanAssignment(row interface{ Scan(...interface{}) error }) (*Assignment, error) {
+	a := &Assignment{}
+	var acceptedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.EventID, &a.EventTitle, &a.EventStart, &a.Email, &a.StartsAt, &a.EndsAt, &acceptedAt); err != nil {
+		return nil, err
+	}
+	if acceptedAt.Valid {
+		a.AcceptedAt = &acceptedAt.Time
+	}
+	return a, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AcceptURL is the page an invitation link opens.
+func AcceptURL(token string) string {
+	return "http://localhost:5173/staff-invitations/" + token
+}
+
+// Invite invites an email address to scan an event's tickets between startsAt and
+// endsAt; zero times default to a window around the event's start. Inviting an
+// address again updates its window and replaces its link. It returns the
+// assignment and the token of its link.
+func Invite(db *sql.DB, eventID, email, invitedBy string, startsAt, endsAt time.Time) (*Assignment, string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return nil, "", ErrInvalidEmail
+	}
+
+	var startTime time.Time
+	err = db.QueryRow(`SELECT start_time FROM events WHERE id = $1`, eventID).Scan(&startTime)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrEventNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	if startsAt.IsZero() {
+		startsAt = startTime.Add(-DefaultLeadTime)
+	}
+	if endsAt.IsZero() {
+		endsAt = startTime.Add(DefaultShift - DefaultLeadTime)
+	}
+	if !endsAt.After(startsAt) || !endsAt.After(time.Now()) {
+		return nil, "", ErrInvalidWindow
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	var id int64
+	err = db.QueryRow(`
+		INSERT INTO event_staff (event_id, email, invited_by, token_hash, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (event_id, email) WHERE revoked_at IS NULL DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at
+		RETURNING id`, eventID, strings.ToLower(addr.Address), invitedBy, hashToken(token), startsAt, endsAt).Scan(&id)
+	if err != nil {
+		return nil, "", err
+	}
+	a, err := scanAssignment(db.QueryRow(selectAssignment+` WHERE s.id = $1`, id))
+	return a, token, err
+}
+
+// Preview returns the live invitation of a link.
+func Preview(db *sql.DB, token string) (*Assignment, error) {
+	a, err := scanAssignment(db.QueryRow(selectAssignment+`
+		WHERE s.token_hash = $1 AND s.revoked_at IS NULL AND s.ends_at > NOW()`, hashToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationNotFound
+	}
+	return a, err
+}
+
+// Accept assigns the invitation of a link to the logged-in user, who must be
+// logged in with the invited address.
+func Accept(db *sql.DB, token, userID, userEmail string) (*Assignment, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a, err := scanAssignment(tx.QueryRow(selectAssignment+`
+		WHERE s.token_hash = $1 AND s.revoked_at IS NULL AND s.ends_at > NOW()
+		FOR UPDATE OF s`, hashToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(a.Email, strings.TrimSpace(userEmail)) {
+		return nil, ErrWrongAccount
+	}
+
+	var acceptedAt time.Time
+	if err := tx.QueryRow(`
+		UPDATE event_staff SET user_id = $2, accepted_at = COALESCE(accepted_at, NOW())
+		WHERE id = $1
+		RETURNING accepted_at`, a.ID, userID).Scan(&acceptedAt); err != nil {
+		return nil, err
+	}
+	a.AcceptedAt = &acceptedAt
+	return a, tx.Commit()
+}
+
+// List returns the live invitations and assignments of an event, by start.
+func List(db *sql.DB, eventID string) ([]Assignment, error) {
+	return list(db, selectAssignment+`
+		WHERE s.event_id = $1 AND s.revoked_at IS NULL
+		ORDER BY s.starts_at, s.email`, eventID)
+}
+
+// Assigned returns the accepted assignments of a user that have not ended, by start.
+func Assigned(db *sql.DB, userID string) ([]Assignment, error) {
+	return list(db, selectAssignment+`
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL AND s.accepted_at IS NOT NULL AND s.ends_at > NOW()
+		ORDER BY s.starts_at`, userID)
+}
+
+func list(db *sql.DB, query string, args ...interface{}) ([]Assignment, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []Assignment{}
+	for rows.Next() {
+		a, err := scanAssignment(rows)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, *a)
+	}
+	return assignments, rows.Err()
+}
+
+// Revoke ends an assignment of an event; its link stops working too.
+func Revoke(db *sql.DB, eventID string, id int64) error {
+	res, err := db.Exec(`
+		UPDATE event_staff SET revoked_at = NOW()
+		WHERE id = $1 AND event_id = $2 AND revoked_at IS NULL`, id, eventID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAssignmentNotFound
+	}
+	return nil
+}
+
+// CanScan reports whether a user may scan tickets of an event now: admins may scan
+// every event, creators their own, and everyone else those they are assigned to
+// for the current window.
+func CanScan(db *sql.DB, claims *utils.Claims, eventID string) (bool, error) {
+	if claims.Role == "admin" {
+		return true, nil
+	}
+	var ok bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM events WHERE id = $1 AND creator_id = $2 AND $3 = 'creator')
+		    OR EXISTS(SELECT 1 FROM event_staff
+		              WHERE event_id = $1 AND user_id = $2 AND revoked_at IS NULL AND accepted_at IS NOT NULL
+		                AND starts_at <= NOW() AND ends_at > NOW())`,
+		eventID, claims.UserID, claims.Role).Scan(&ok)
+	return ok, err
+}
+
+// Event is an event a user may open the scanner for.
+type Event struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	StartTime time.Time  `json:"start_time"`
+	StartsAt  *time.Time `json:"starts_at,omitempty"` // window of a staff assignment
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+}
+
+// ScannerEvents returns the events a user may scan that have not long passed, by
+// start: admins get every event, creators their own, others their assignments.
+func ScannerEvents(db *sql.DB, claims *utils.Claims) ([]Event, error) {
+	if claims.Role != "admin" && claims.Role != "creator" {
+		assignments, err := Assigned(db, claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]Event, 0, len(assignments))
+		for _, a := range assignments {
+			events = append(events, Event{ID: a.EventID, Title: a.EventTitle, StartTime: a.EventStart,
+				StartsAt: &a.StartsAt, EndsAt: &a.EndsAt})
+		}
+		return events, nil
+	}
+
+	var creatorID string
+	if claims.Role == "creator" {
+		creatorID = claims.UserID
+	}
+	rows, err := db.Query(`
+		SELECT id, title, start_time
+		FROM events
+		WHERE start_time > NOW() - INTERVAL '1 day' AND ($1 = '' OR creator_id::text = $1)
+		ORDER BY start_time`, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.Title, &e.StartTime); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,302 @@
+// Package transfers moves tickets between accounts.
+//
+// The owner of a ticket offers it to an email address; whoever opens the emailed
+// link and accepts while logged in becomes the new owner. Accepting gives the
+// ticket a new scan code, so QR codes of the previous owner stop working. Every
+// change of owner is kept in the ticket's history.
+package transfers
+
+import (
+	"TickVibe-EventTix-backend/internal/scancodes"
+	"TickVibe-EventTix-backend/internal/utils"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Transfer statuses stored in ticket_transfers.status.
+const (
+	StatusPending   = "pending"
+	StatusAccepted  = "accepted"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+// ActionTransferred is the ticket_history action of an accepted transfer.
+const ActionTransferred = "transferred"
+
+// OfferTTL is how long a recipient has to accept, at most until the event starts.
+const OfferTTL = 72 * time.Hour
+
+var (
+	ErrTicketNotFound    = errors.New("ticket not found")
+	ErrTransfersDisabled = errors.New("tickets of this event cannot be transferred")
+	ErrNotTransferable   = errors.New("ticket can no longer be transferred")
+	ErrInvalidRecipient  = errors.New("a valid recipient email address is required")
+	ErrSelfTransfer      = errors.New("tickets cannot be transferred to yourself")
+	ErrTransferNotFound  = errors.New("transfer link is invalid or no longer valid")
+	ErrListedForResale   = errors.New("ticket is listed for resale; take it off the market first")
+	ErrWrongAccount      = errors.New("this ticket was sent to a different email address")
+)
+
+// Transfer is an offer of one ticket to an email address.
+type Transfer struct {
+	ID             int64     `json:"id"`
+	TicketID       string    `json:"ticket_id"`
+	EventTitle     string    `json:"event_title"`
+	TicketTypeName string    `json:"ticket_type_name"`
+	FromName       string    `json:"from_name"`
+	ToEmail        string    `json:"to_email"`
+	Status         string    `json:"status"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// HistoryEntry is one change of a ticket's owner.
+type HistoryEntry struct {
+	Action    string    `json:"action"`
+	FromEmail string    `json:"from_email,omitempty"`
+	ToEmail   string    `json:"to_email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewToken returns a transfer link token and the hash to store.
+func NewToken() (token, hash string, err error) {
+	token, err = utils.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AcceptURL is the page a transfer link opens.
+func AcceptURL(token string) string {
+	return "http://localhost:5173/transfers/" + token
+}
+
+// Offer offers a user's ticket to an email address, replacing any open offer of
+// the same ticket. It returns the transfer and the token of its link.
+func Offer(db *sql.DB, ticketID, fromUserID, toEmail string) (*Transfer, string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(toEmail))
+	if err != nil {
+		return nil, "", ErrInvalidRecipient
+	}
+	t := &Transfer{TicketID: ticketID, ToEmail: strings.ToLower(addr.Address), Status: StatusPending}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var ownerID sql.NullString
+	var fromEmail string
+	var used, void, enabled, listed bool
+	var startTime time.Time
+	err = tx.QueryRow(`
+		SELECT t.user_id, t.is_used, t.is_void, e.transfers_enabled, e.start_time, e.title, tt.name,
+		       COALESCE(u.username, ''), COALESCE(u.email, ''),
+		       EXISTS(SELECT 1 FROM resale_listings l WHERE l.ticket_id = t.id AND l.status IN ('active', 'reserved'))
+		FROM tickets t
+		JOIN events e ON e.id = t.event_id
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		LEFT JOIN users u ON u.id = t.user_id
+		WHERE t.id = $1
+		FOR UPDATE OF t`, ticketID).Scan(&ownerID, &used, &void, &enabled, &startTime,
+		&t.EventTitle, &t.TicketTypeName, &t.FromName, &fromEmail, &listed)
+	if err == sql.ErrNoRows || (err == nil && ownerID.String != fromUserID) {
+		return nil, "", ErrTicketNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	switch {
+	case !enabled:
+		return nil, "", ErrTransfersDisabled
+	case used || void || !startTime.After(now):
+		return nil, "", ErrNotTransferable
+	case listed:
+		return nil, "", ErrListedForResale
+	case strings.EqualFold(fromEmail, t.ToEmail):
+		return nil, "", ErrSelfTransfer
+	}
+
+	if err := closePending(tx, ticketID); err != nil {
+		return nil, "", err
+	}
+
+	token, hash, err := NewToken()
+	if err != nil {
+		return nil, "", err
+	}
+	t.ExpiresAt = now.Add(OfferTTL)
+	if startTime.Before(t.ExpiresAt) {
+		t.ExpiresAt = startTime
+	}
+	err = tx.QueryRow(`
+		INSERT INTO ticket_transfers (ticket_id, from_user_id, to_email, token_hash, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`, ticketID, fromUserID, t.ToEmail, hash, StatusPending, t.ExpiresAt).Scan(&t.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, token, tx.Commit()
+}
+
+// closePending ends the open offer of a ticket, if there is one.
+func closePending(tx *sql.Tx, ticketID string) error {
+	_, err := tx.Exec(`
+		UPDATE ticket_transfers
+		SET status = CASE WHEN expires_at <= NOW() THEN $2 ELSE $3 END, updated_at = NOW()
+		WHERE ticket_id = $1 AND status = $4`, ticketID, StatusExpired, StatusCancelled, StatusPending)
+	return err
+}
+
+// Cancel withdraws the open offer of a user's ticket.
+func Cancel(db *sql.DB, ticketID, fromUserID string) error {
+	res, err := db.Exec(`
+		UPDATE ticket_transfers
+		SET status = $3, updated_at = NOW()
+		WHERE ticket_id = $1 AND from_user_id = $2 AND status = $4`,
+		ticketID, fromUserID, StatusCancelled, StatusPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTransferNotFound
+	}
+	return nil
+}
+
+// Pending returns the open, unexpired offer of a ticket, or nil.
+func Pending(db *sql.DB, ticketID string) (*Transfer, error) {
+	t := &Transfer{TicketID: ticketID}
+	err := db.QueryRow(`
+		SELECT id, to_email, status, expires_at
+		FROM ticket_transfers
+		WHERE ticket_id = $1 AND status = $2 AND expires_at > NOW()`,
+		ticketID, StatusPending).Scan(&t.ID, &t.ToEmail, &t.Status, &t.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// Preview returns the open offer a link token stands for, for the recipient to
+// look at before accepting.
+func Preview(db *sql.DB, token string) (*Transfer, error) {
+	t := &Transfer{}
+	err := db.QueryRow(`
+		SELECT tr.id, tr.ticket_id, e.title, tt.name, u.username, tr.to_email, tr.status, tr.expires_at
+		FROM ticket_transfers tr
+		JOIN tickets t ON t.id = tr.ticket_id
+		JOIN events e ON e.id = t.event_id
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		JOIN users u ON u.id = tr.from_user_id
+		WHERE tr.token_hash = $1 AND tr.status = $2 AND tr.expires_at > NOW()`,
+		hashToken(token), StatusPending).Scan(&t.ID, &t.TicketID, &t.EventTitle, &t.TicketTypeName,
+		&t.FromName, &t.ToEmail, &t.Status, &t.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransferNotFound
+	}
+	return t, err
+}
+
+// Accept moves the ticket of an open offer to the accepting user, who must be
+// logged in with the address it was sent to, and gives it a new code. It returns
+// the ticket's ID.
+func Accept(db *sql.DB, token, userID, userEmail string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var transferID int64
+	var ticketID, fromUserID, toEmail string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT id, ticket_id, from_user_id, to_email, expires_at
+		FROM ticket_transfers
+		WHERE token_hash = $1 AND status = $2
+		FOR UPDATE`, hashToken(token), StatusPending).Scan(&transferID, &ticketID, &fromUserID, &toEmail, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && !expiresAt.After(time.Now())) {
+		return "", ErrTransferNotFound
+	} else if err != nil {
+		return "", err
+	}
+	if fromUserID == userID {
+		return "", ErrSelfTransfer
+	}
+	if !strings.EqualFold(toEmail, strings.TrimSpace(userEmail)) {
+		return "", ErrWrongAccount
+	}
+
+	// The ticket must still be the sender's and unused; it may have been refunded,
+	// scanned or given away some other way since the offer was made
+	res, err := tx.Exec(`
+		UPDATE tickets
+		SET user_id = $2, guest_contact_id = NULL
+		WHERE id = $1 AND user_id = $3 AND NOT is_used AND NOT is_void`,
+		ticketID, userID, fromUserID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrNotTransferable
+	}
+	if _, err := scancodes.Reissue(tx, ticketID); err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE ticket_transfers SET status = $2, to_user_id = $3, updated_at = NOW() WHERE id = $1`,
+		transferID, StatusAccepted, userID); err != nil {
+		return "", err
+	}
+	if err := RecordHistory(tx, ticketID, ActionTransferred, fromUserID, userID); err != nil {
+		return "", err
+	}
+	return ticketID, tx.Commit()
+}
+
+// RecordHistory adds a change of owner to a ticket's history.
+func RecordHistory(tx *sql.Tx, ticketID, action, fromUserID, toUserID string) error {
+	_, err := tx.Exec(`
+		INSERT INTO ticket_history (ticket_id, action, from_user_id, to_user_id)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid)`, ticketID, action, fromUserID, toUserID)
+	return err
+}
+
+// History returns the changes of a ticket's owner, oldest first.
+func History(db *sql.DB, ticketID string) ([]HistoryEntry, error) {
+	rows, err := db.Query(`
+		SELECT h.action, COALESCE(f.email, ''), COALESCE(t.email, ''), h.created_at
+		FROM ticket_history h
+		LEFT JOIN users f ON f.id = h.from_user_id
+		LEFT JOIN users t ON t.id = h.to_user_id
+		WHERE h.ticket_id = $1
+		ORDER BY h.created_at, h.id`, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []HistoryEntry{}
+	for rows.Next() {
+		var h HistoryEntry
+		if err := rows.Scan(&h.Action, &h.FromEmail, &h.ToEmail, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
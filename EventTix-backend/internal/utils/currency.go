@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultCurrency is used for events created without an explicit currency.
+const DefaultCurrency = "PLN"
+
+// currencyExponents maps active ISO 4217 codes to their number of minor units.
+// Amounts are always stored in minor units, so for a zero-decimal currency such
+// as JPY a price_cents of 1500 means 1500 yen.
+var currencyExponents = func() map[string]int {
+	m := make(map[string]int)
+	for _, c := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BRL BSD BTN
+		BWP BYN BZD CAD CDF CHF CNY COP CRC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD
+		FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR
+		KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN
+		MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR SBD
+		SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD TWD
+		TZS UAH USD UYU UZS VES WST XCD YER ZAR ZMW ZWL`) {
+		m[c] = 2
+	}
+	for _, c := range strings.Fields(`BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX VND VUV XAF XOF XPF`) {
+		m[c] = 0
+	}
+	for _, c := range strings.Fields(`BHD IQD JOD KWD LYD OMR TND`) {
+		m[c] = 3
+	}
+	return m
+}()
+
+// NormalizeCurrency validates an ISO 4217 code and returns it upper-cased.
+// An empty code falls back to DefaultCurrency.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if _, ok := currencyExponents[code]; !ok {
+		return "", errors.New("unsupported currency code: " + code)
+	}
+	return code, nil
+}
+
+// CurrencyExponent returns the number of minor units of a currency (2 if unknown).
+func CurrencyExponent(code string) int {
+	if exp, ok := currencyExponents[strings.ToUpper(code)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// FormatAmount renders an amount in minor units, e.g. 12550 PLN -> "125.50 PLN",
+// 1500 JPY -> "1500 JPY" and 12345 KWD -> "12.345 KWD".
+func FormatAmount(minorUnits int64, currency string) string {
+	currency = strings.ToUpper(currency)
+	exp := CurrencyExponent(currency)
+
+	sign := ""
+	if minorUnits < 0 {
+		sign = "-"
+		minorUnits = -minorUnits
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d %s", sign, minorUnits, currency)
+	}
+
+	divisor := int64(1)
+	for i := 0; i < exp; i++ {
+		divisor *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, minorUnits/divisor, exp, minorUnits%divisor, currency)
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// FrontendURL returns the base URL of the web client from FRONTEND_URL, without a
+// trailing slash. It defaults to the client's development server.
+func FrontendURL() string {
+	if url := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/"); url != "" {
+		return url
+	}
+	return "http://localhost:5173"
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+var nipWeights = [9]int{6, 5, 7, 2, 3, 4, 5, 6, 7}
+
+// NormalizeNIP strips the separators people type into a Polish tax ID (NIP) and
+// verifies its check digit. A "PL" prefix is accepted and dropped.
+func NormalizeNIP(nip string) (string, error) {
+	nip = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(nip)), "PL")
+	nip = strings.NewReplacer("-", "", " ", "").Replace(nip)
+	if len(nip) != 10 {
+		return "", errors.New("NIP must have 10 digits")
+	}
+
+	sum := 0
+	for i, c := range nip {
+		if c < '0' || c > '9' {
+			return "", errors.New("NIP must have 10 digits")
+		}
+		if i < 9 {
+			sum += int(c-'0') * nipWeights[i]
+		}
+	}
+	if sum%11 == 10 || sum%11 != int(nip[9]-'0') {
+		return "", errors.New("invalid NIP")
+	}
+	return nip, nil
+}
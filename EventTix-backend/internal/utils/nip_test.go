@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestNormalizeNIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		nip     string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "5260250274", "5260250274", false},
+		{"dashes", "526-025-02-74", "5260250274", false},
+		{"spaces and prefix", " PL 526 025 02 74 ", "5260250274", false},
+		{"lower case prefix", "pl1234563218", "1234563218", false},
+		{"wrong check digit", "5260250275", "", true},
+		{"check sum of ten", "1000000160", "", true},
+		{"too short", "526025027", "", true},
+		{"too long", "52602502741", "", true},
+		{"letters", "52602502a4", "", true},
+		{"empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeNIP(tt.nip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeNIP(%q) error = %v, want error %v", tt.nip, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeNIP(%q) = %q, want %q", tt.nip, got, tt.want)
+			}
+		})
+	}
+}
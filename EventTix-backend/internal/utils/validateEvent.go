@@ -19,7 +19,116 @@ func ValidateEventInput(title, slug string, ticketTypes []models.TicketTypeIn, s
 		if tt.PriceCents < 0 || tt.TotalQuantity <= 0 {
 			return errors.New("ticket types must have non-negative price and positive quantity")
 		}
+		if err := ValidatePurchaseLimits(tt.PurchaseLimits); err != nil {
+			return err
+		}
+		if err := ValidateSales(tt.SalesWindow, tt.PriceTiers); err != nil {
+			return err
+		}
+		if err := ValidateServiceFees(tt.ServiceFees); err != nil {
+			return err
+		}
+		if err := ValidateEntryRules(tt.EntryRules); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateServiceFees checks that a ticket type's fees are not negative.
+func ValidateServiceFees(f models.ServiceFees) error {
+	for _, v := range []*int64{f.PlatformFeeCents, f.OrganizerFeeCents} {
+		if v != nil && *v < 0 {
+			return errors.New("service fees cannot be negative")
+		}
 	}
+	return nil
+}
 
+// ValidateVATRate checks a VAT rate given in basis points.
+func ValidateVATRate(bps int) error {
+	if bps < 0 || bps > 10000 {
+		return errors.New("vat_rate_bps must be between 0 and 10000")
+	}
+	return nil
+}
+
+// ValidateResaleCap checks how far above face value an event lets tickets be resold.
+func ValidateResaleCap(percent int) error {
+	if percent < 0 || percent > 100 {
+		return errors.New("resale_cap_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// ValidateRefundPolicy checks that an event's refund rules have distinct thresholds
+// and percentages between 0 and 100.
+func ValidateRefundPolicy(rules []models.RefundRule) error {
+	seen := make(map[int]bool, len(rules))
+	for _, r := range rules {
+		if r.HoursBeforeStart < 0 || r.RefundPercent < 0 || r.RefundPercent > 100 {
+			return errors.New("refund rules need hours_before_start >= 0 and refund_percent between 0 and 100")
+		}
+		if seen[r.HoursBeforeStart] {
+			return errors.New("refund rules must have distinct hours_before_start")
+		}
+		seen[r.HoursBeforeStart] = true
+	}
+	return nil
+}
+
+// ValidateSales checks a ticket type's sales window and price tiers.
+func ValidateSales(w models.SalesWindow, tiers []models.PriceTier) error {
+	if w.SalesStart != nil && w.SalesEnd != nil && !w.SalesEnd.After(*w.SalesStart) {
+		return errors.New("sales_end must be after sales_start")
+	}
+	for _, t := range tiers {
+		if t.Name == "" || t.PriceCents < 0 {
+			return errors.New("price tiers need a name and a non-negative price")
+		}
+		if t.EndsAt == nil && t.UntilSold == nil {
+			return errors.New("price tiers need ends_at, until_sold or both")
+		}
+		if t.UntilSold != nil && *t.UntilSold < 1 {
+			return errors.New("until_sold must be at least 1")
+		}
+	}
+	return nil
+}
+
+// ValidatePurchaseLimits checks that a ticket type's limits are positive and consistent.
+func ValidatePurchaseLimits(l models.PurchaseLimits) error {
+	for _, v := range []*int{l.MinPerOrder, l.MaxPerOrder, l.MaxPerCustomer} {
+		if v != nil && *v < 1 {
+			return errors.New("purchase limits must be at least 1")
+		}
+	}
+	if l.MaxPerOrder != nil && *l.MaxPerOrder < l.MinOrDefault() {
+		return errors.New("max_per_order cannot be below min_per_order")
+	}
+	if l.MaxPerCustomer != nil && *l.MaxPerCustomer < l.MinOrDefault() {
+		return errors.New("max_per_customer cannot be below min_per_order")
+	}
+	return nil
+}
+
+// ValidateEntryRules checks a ticket type's entry policy and validity dates.
+func ValidateEntryRules(r models.EntryRules) error {
+	switch r.PolicyOrDefault() {
+	case models.PolicyMulti:
+		if r.MaxEntries == nil || *r.MaxEntries < 1 {
+			return errors.New("multi entry tickets need max_entries of at least 1")
+		}
+	case models.PolicySingle, models.PolicyUnlimited, models.PolicyInOut:
+		if r.MaxEntries != nil {
+			return errors.New("max_entries is only allowed with the multi entry policy")
+		}
+	default:
+		return errors.New("entry_policy must be single, multi, unlimited or in_out")
+	}
+	if r.ValidFrom != nil && r.ValidUntil != nil && !r.ValidUntil.After(*r.ValidFrom) {
+		return errors.New("valid_until must be after valid_from")
+	}
 	return nil
 }
@@ -0,0 +1,244 @@
+// Package waitlist keeps the queue of users waiting for a sold-out ticket type.
+//
+// Entries are served strictly in the order they joined. Offering stock to an entry
+// is left to the caller, which reserves the tickets and then records the offer
+// with MarkOffered; the queue itself only tracks who is next and for how long
+// their offer stands.
+package waitlist
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Entry statuses stored in waitlist_entries.status.
+const (
+	StatusWaiting   = "waiting"
+	StatusOffered   = "offered"
+	StatusClaimed   = "claimed"
+	StatusExpired   = "expired"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	ErrNotSoldOut     = errors.New("tickets of this type are still available")
+	ErrAlreadyWaiting = errors.New("already on the waitlist for this ticket type")
+	ErrOfferNotFound  = errors.New("waitlist offer not found")
+	ErrOfferExpired   = errors.New("waitlist offer has expired")
+)
+
+// Entry is one user's place in the waitlist of a ticket type. Position counts the
+// entries still waiting ahead of it, starting at 1, and is only set while waiting.
+type Entry struct {
+	ID                int64      `json:"id"`
+	EventID           string     `json:"event_id"`
+	TicketTypeID      int        `json:"ticket_type_id"`
+	TicketTypeName    string     `json:"ticket_type_name"`
+	UserID            string     `json:"-"`
+	Quantity          int        `json:"quantity"`
+	Status            string     `json:"status"`
+	Position          int        `json:"position,omitempty"`
+	CheckoutSessionID string     `json:"-"`
+	OfferExpiresAt    *time.Time `json:"offer_expires_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// Join puts a user at the back of a ticket type's waitlist. It is refused while
+// the ticket type still has enough stock for the requested quantity.
+func Join(db *sql.DB, eventID string, ticketTypeID int, userID string, quantity int) (*Entry, error) {
+	e := &Entry{EventID: eventID, TicketTypeID: ticketTypeID, UserID: userID, Quantity: quantity, Status: StatusWaiting}
+
+	var available int
+	err := db.QueryRow(`SELECT name, available_quantity FROM ticket_types WHERE id = $1 AND event_id = $2`,
+		ticketTypeID, eventID).Scan(&e.TicketTypeName, &available)
+	if err != nil {
+		return nil, err
+	}
+	if available >= quantity {
+		return nil, ErrNotSoldOut
+	}
+
+	err = db.QueryRow(`
+		INSERT INTO waitlist_entries (ticket_type_id, user_id, quantity, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		ticketTypeID, userID, quantity, StatusWaiting).Scan(&e.ID, &e.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrAlreadyWaiting
+	} else if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Leave takes a user off a waitlist. For an entry that was already offered it
+// returns the checkout session holding the offered stock, which the caller must
+// release.
+func Leave(db *sql.DB, entryID int64, userID string) (checkoutSessionID string, found bool, err error) {
+	var cs sql.NullString
+	err = db.QueryRow(`
+		UPDATE waitlist_entries
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2 AND user_id = $3 AND status IN ($4, $5)
+		RETURNING checkout_session_id`,
+		StatusCancelled, entryID, userID, StatusWaiting, StatusOffered).Scan(&cs)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return cs.String, true, nil
+}
+
+// ListForUser returns a user's waiting and offered entries with their place in line.
+func ListForUser(db *sql.DB, userID string) ([]Entry, error) {
+	rows, err := db.Query(`
+		SELECT w.id, tt.event_id, w.ticket_type_id, tt.name, w.quantity, w.status, w.offer_expires_at, w.created_at,
+		       CASE WHEN w.status = $2 THEN (
+		           SELECT COUNT(*) FROM waitlist_entries ahead
+		           WHERE ahead.ticket_type_id = w.ticket_type_id AND ahead.status = $2
+		             AND (ahead.created_at, ahead.id) <= (w.created_at, w.id)
+		       ) ELSE 0 END
+		FROM waitlist_entries w
+		JOIN ticket_types tt ON tt.id = w.ticket_type_id
+		WHERE w.user_id = $1 AND w.status IN ($2, $3)
+		ORDER BY w.created_at`, userID, StatusWaiting, StatusOffered)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		e := Entry{UserID: userID}
+		if err := rows.Scan(&e.ID, &e.EventID, &e.TicketTypeID, &e.TicketTypeName, &e.Quantity, &e.Status,
+			&e.OfferExpiresAt, &e.CreatedAt, &e.Position); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// NextInLine returns the first waiting entry of every ticket type that has stock
+// for it. An entry wanting more than is available blocks the ones behind it, so
+// nobody is overtaken by a smaller request.
+func NextInLine(db *sql.DB) ([]Entry, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (w.ticket_type_id)
+		       w.id, tt.event_id, w.ticket_type_id, tt.name, w.user_id, w.quantity, tt.available_quantity, w.created_at
+		FROM waitlist_entries w
+		JOIN ticket_types tt ON tt.id = w.ticket_type_id
+		WHERE w.status = $1
+		ORDER BY w.ticket_type_id, w.created_at, w.id`, StatusWaiting)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		e := Entry{Status: StatusWaiting}
+		var available int
+		if err := rows.Scan(&e.ID, &e.EventID, &e.TicketTypeID, &e.TicketTypeName, &e.UserID, &e.Quantity,
+			&available, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if available >= e.Quantity {
+			entries = append(entries, e)
+		}
+	}
+	return entries, rows.Err()
+}
+
+// MarkOffered records that stock is held for a waiting entry until expiresAt. It
+// returns false when the entry left the line in the meantime.
+func MarkOffered(db *sql.DB, entryID int64, checkoutSessionID, token string, expiresAt time.Time) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE waitlist_entries
+		SET status = $1, checkout_session_id = $2, offer_token = $3, offer_expires_at = $4, updated_at = NOW()
+		WHERE id = $5 AND status = $6`,
+		StatusOffered, checkoutSessionID, token, expiresAt, entryID, StatusWaiting)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ExpireOffers closes every offer that was not claimed in time and returns the
+// checkout sessions whose stock should be released for the next in line.
+func ExpireOffers(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+		UPDATE waitlist_entries
+		SET status = $1, updated_at = NOW()
+		WHERE status = $2 AND offer_expires_at <= NOW()
+		RETURNING checkout_session_id`, StatusExpired, StatusOffered)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id sql.NullString
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if id.Valid {
+			ids = append(ids, id.String)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// OfferByToken returns the open offer behind an emailed purchase link. An offer
+// past its deadline is ErrOfferExpired whether or not ExpireOffers closed it yet.
+func OfferByToken(db *sql.DB, token string) (*Entry, error) {
+	e := &Entry{}
+	var cs sql.NullString
+	err := db.QueryRow(`
+		SELECT w.id, tt.event_id, w.ticket_type_id, tt.name, w.user_id, w.quantity, w.status,
+		       w.checkout_session_id, w.offer_expires_at, w.created_at
+		FROM waitlist_entries w
+		JOIN ticket_types tt ON tt.id = w.ticket_type_id
+		WHERE w.offer_token = $1`, token).Scan(
+		&e.ID, &e.EventID, &e.TicketTypeID, &e.TicketTypeName, &e.UserID, &e.Quantity, &e.Status,
+		&cs, &e.OfferExpiresAt, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrOfferNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	e.CheckoutSessionID = cs.String
+
+	if e.Status == StatusExpired {
+		return nil, ErrOfferExpired
+	}
+	if e.Status != StatusOffered || !cs.Valid {
+		return nil, ErrOfferNotFound
+	}
+	if e.OfferExpiresAt == nil || !time.Now().Before(*e.OfferExpiresAt) {
+		return nil, ErrOfferExpired
+	}
+	return e, nil
+}
+
+// MarkClaimed closes an offer once its holder has gone on to pay. It returns false
+// when the offer expired or was cancelled in the meantime.
+func MarkClaimed(db *sql.DB, entryID int64) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE waitlist_entries
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2 AND status = $3 AND offer_expires_at > NOW()`,
+		StatusClaimed, entryID, StatusOffered)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -4,7 +4,10 @@ import (
 	"TickVibe-EventTix-backend/database"
 	"TickVibe-EventTix-backend/internal/handlers"
 	"TickVibe-EventTix-backend/internal/handlers/adminHandlers"
+	"TickVibe-EventTix-backend/internal/inventory"
 	"TickVibe-EventTix-backend/internal/middleware"
+	"TickVibe-EventTix-backend/internal/payments"
+	"TickVibe-EventTix-backend/internal/scancodes"
 	"context"
 	"database/sql"
 	"log"
@@ -34,7 +37,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		// Allow necessary methods
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		// Allow necessary headers
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin, Cookie")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin, Cookie, Idempotency-Key")
 		// Always allow credentials
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		// Set max age for preflight cache
@@ -51,7 +54,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func setupRoutes(db *sql.DB) *http.ServeMux {
+func setupRoutes(db *sql.DB, gateway payments.PaymentGateway) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// --- API Routes ---
@@ -82,8 +85,26 @@ func setupRoutes(db *sql.DB) *http.ServeMux {
 	mux.HandleFunc("GET /api/admin/event/{event_id}/ticket-types", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorListTicketTypesHandler(db)))
 	mux.HandleFunc("GET /api/admin/event/{event_id}/tickets", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorListEventTicketsHandler(db)))
 	mux.HandleFunc("GET /api/admin/events/{event_id}/orders", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorListEventOrdersHandler(db)))
+	mux.HandleFunc("POST /api/admin/events/{event_id}/promo-codes", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorCreatePromoCodeHandler(db)))
+	mux.HandleFunc("GET /api/admin/events/{event_id}/promo-codes", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorListPromoCodesHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/events/{event_id}/promo-codes/{id}", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorDeactivatePromoCodeHandler(db)))
+	mux.HandleFunc("POST /api/admin/orders/{id}/refunds", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorRefundOrderHandler(db, gateway)))
 	mux.HandleFunc("PUT /api/admin/events/{id}", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorUpdateEventHandler(db)))
+	mux.HandleFunc("PUT /api/admin/events/{event_id}/seats", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorAssignSeatsHandler(db)))
+	mux.HandleFunc("POST /api/admin/events/{event_id}/staff", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorInviteStaffHandler(db)))
+	mux.HandleFunc("GET /api/admin/events/{event_id}/staff", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorListStaffHandler(db)))
+	mux.HandleFunc("DELETE /api/admin/events/{event_id}/staff/{id}", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorRevokeStaffHandler(db)))
+	mux.HandleFunc("GET /api/admin/events/{event_id}/scan-key", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorEventScanKeyHandler(db)))
+	mux.HandleFunc("POST /api/admin/events/{event_id}/scan-key/rotate", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorRotateScanKeyHandler(db)))
+	mux.HandleFunc("POST /api/admin/scan-codes/reissue", middleware.RequireAdmin(adminHandlers.AdminReissueUnsignedCodesHandler(db)))
+	mux.HandleFunc("POST /api/admin/venues", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorCreateVenueHandler(db)))
+	mux.HandleFunc("GET /api/admin/venues", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorListVenuesHandler(db)))
+	mux.HandleFunc("GET /api/admin/venues/{id}", middleware.RequireAdminOrCreator(adminHandlers.AdminCreatorGetVenueHandler(db)))
 	mux.HandleFunc("DELETE /api/admin/event/{id}", middleware.RequireAdminOrCreator(adminHandlers.AdminDeleteEventHandler(db)))
+	mux.HandleFunc("GET /api/admin/fulfillment-failures", middleware.RequireAdmin(adminHandlers.AdminListFulfillmentFailuresHandler(db)))
+	mux.HandleFunc("POST /api/admin/fulfillment-failures/{id}/retry", middleware.RequireAdmin(adminHandlers.AdminRetryFulfillmentHandler(db)))
+	mux.HandleFunc("GET /api/admin/resale/payouts", middleware.RequireAdmin(adminHandlers.AdminListResalePayoutsHandler(db)))
+	mux.HandleFunc("POST /api/admin/resale/payouts/{id}/paid", middleware.RequireAdmin(adminHandlers.AdminMarkResalePaidOutHandler(db)))
 	mux.HandleFunc("GET /api/admin/users", middleware.RequireAdmin(adminHandlers.AdminGetUsersHandler(db)))
 	mux.HandleFunc("PUT /api/admin/users-update", middleware.RequireAdmin(adminHandlers.AdminUpdateUserHandler(db))) // Example: Update Role
 	mux.HandleFunc("DELETE /api/admin/users/{id}", middleware.RequireAdmin(adminHandlers.AdminDeleteUserHandler(db)))
@@ -91,17 +112,56 @@ func setupRoutes(db *sql.DB) *http.ServeMux {
 	// Single event details route
 	// Matches /event/{slug} - e.g., /event/my-awesome-event
 	mux.HandleFunc("GET /api/events/{slug}", handlers.GetEventBySlugHandler(db))
+	mux.HandleFunc("GET /api/events/{slug}/seats", handlers.EventSeatMapHandler(db))
 	// Handles /{parentCategory} and /{parentCategory}/{subcategory}
 	mux.HandleFunc("GET /api/categories", handlers.GetNestedCategoriesHandler(db))
 	mux.HandleFunc("GET /api/events/upcoming", handlers.GetUpcomingEventsHandler(db))
 	mux.HandleFunc("GET /api/cities", handlers.GetVoivodeshipsWithCities(db))
-	mux.HandleFunc("POST /api/success", handlers.PayTest(db))
+	mux.HandleFunc("GET /api/success", handlers.PaymentStatus(db))
+	mux.HandleFunc("POST /webhooks/"+gateway.Name(), handlers.PaymentWebhookHandler(db, gateway))
 	// purchase
 	mux.HandleFunc("GET /myTickets", middleware.RequireAuth(handlers.UserTicketsHandler(db)))
-	mux.HandleFunc("POST /checkout/create-session", handlers.CreateCheckoutSessionHandler(db))
-	mux.HandleFunc("GET /api/orders/session/", handlers.GetOrderBySessionIDHandler(db))
-	mux.HandleFunc("POST /qrCodeScanning", handlers.QrCodeScanning(db))
-	mux.HandleFunc("POST /validateTicket", handlers.ValidateTicket(db))
+	mux.HandleFunc("POST /checkout/create-session", middleware.OptionalAuth(middleware.Idempotent(db, handlers.CreateCheckoutSessionHandler(db, gateway))))
+	mux.HandleFunc("POST /api/events/{slug}/register", middleware.RequireAuth(middleware.Idempotent(db, handlers.RegisterForEventHandler(db))))
+	mux.HandleFunc("POST /api/events/{slug}/waitlist", middleware.RequireAuth(handlers.JoinWaitlistHandler(db)))
+	mux.HandleFunc("GET /api/waitlist", middleware.RequireAuth(handlers.MyWaitlistHandler(db)))
+	mux.HandleFunc("DELETE /api/waitlist/{id}", middleware.RequireAuth(handlers.LeaveWaitlistHandler(db)))
+	mux.HandleFunc("POST /api/waitlist/offers/{token}/checkout", middleware.RequireAuth(handlers.ClaimWaitlistOfferHandler(db, gateway)))
+	// Guests open their orders through the magic links emailed to them
+	mux.HandleFunc("GET /api/guest/orders/{token}", handlers.GuestOrderHandler(db))
+	mux.HandleFunc("GET /api/guest/orders/{token}/invoice", handlers.GuestOrderInvoiceHandler(db))
+	mux.HandleFunc("POST /api/guest/orders/links", handlers.ResendGuestOrderLinksHandler(db))
+	mux.HandleFunc("POST /checkout/cancel-session", middleware.OptionalAuth(handlers.CancelCheckoutSessionHandler(db, gateway)))
+	if fake, ok := gateway.(*payments.FakeGateway); ok {
+		// Offline stand-in for the provider's hosted checkout page
+		mux.HandleFunc("GET /payments/fake/checkout/{id}", handlers.FakeCheckoutHandler(db, fake))
+	}
+	// Tickets move between accounts through an emailed link the recipient accepts
+	mux.HandleFunc("POST /api/tickets/{id}/transfer", middleware.RequireAuth(handlers.TransferTicketHandler(db)))
+	mux.HandleFunc("DELETE /api/tickets/{id}/transfer", middleware.RequireAuth(handlers.CancelTicketTransferHandler(db)))
+	mux.HandleFunc("GET /api/tickets/{id}/history", middleware.RequireAuth(handlers.TicketHistoryHandler(db)))
+	mux.HandleFunc("GET /api/transfers/{token}", handlers.TicketTransferHandler(db))
+	mux.HandleFunc("POST /api/transfers/{token}/accept", middleware.RequireAuth(handlers.AcceptTicketTransferHandler(db)))
+	// Fans resell tickets to each other at no more than face value plus the event's cap
+	mux.HandleFunc("POST /api/tickets/{id}/resale", middleware.RequireAuth(handlers.ListTicketForResaleHandler(db)))
+	mux.HandleFunc("DELETE /api/tickets/{id}/resale", middleware.RequireAuth(handlers.DelistTicketHandler(db)))
+	mux.HandleFunc("GET /api/events/{slug}/resale", handlers.EventResaleListingsHandler(db))
+	mux.HandleFunc("POST /api/resale/listings/{id}/checkout", middleware.RequireAuth(middleware.Idempotent(db, handlers.ResaleCheckoutHandler(db, gateway))))
+	mux.HandleFunc("GET /api/resale/earnings", middleware.RequireAuth(handlers.ResaleEarningsHandler(db)))
+	mux.HandleFunc("POST /api/orders/{id}/cancel", middleware.RequireAuth(handlers.CancelOrderHandler(db, gateway)))
+	mux.HandleFunc("GET /api/orders/{id}/{resource}", orderRoutes(
+		handlers.GetOrderBySessionIDHandler(db),
+		middleware.RequireAuth(handlers.OrderInvoiceHandler(db)),
+	))
+	// Door staff scan the tickets of the events they are assigned to; whether an
+	// account may scan an event is checked per request, not by its role
+	mux.HandleFunc("GET /api/staff-invitations/{token}", handlers.StaffInvitationHandler(db))
+	mux.HandleFunc("POST /api/staff-invitations/{token}/accept", middleware.RequireAuth(handlers.AcceptStaffInvitationHandler(db)))
+	mux.HandleFunc("GET /api/scanner/events", middleware.RequireAuth(handlers.ScannerEventsHandler(db)))
+	mux.HandleFunc("GET /api/scanner/events/{id}/manifest", middleware.RequireAuth(handlers.ScannerManifestHandler(db)))
+	mux.HandleFunc("POST /api/scanner/events/{id}/scans:batch", middleware.RequireAuth(handlers.ScannerBatchScansHandler(db)))
+	mux.HandleFunc("POST /qrCodeScanning", middleware.RequireAuth(handlers.QrCodeScanning(db)))
+	mux.HandleFunc("POST /validateTicket", middleware.RequireAuth(handlers.ValidateTicket(db)))
 
 	return mux
 }
@@ -121,7 +181,23 @@ func main() {
 		log.Println("Successfully connected to database!")
 	}
 
-	mux := setupRoutes(db)
+	if err := scancodes.CheckSecret(); err != nil {
+		log.Fatalf("Failed to configure ticket codes: %v", err)
+	}
+
+	gateway, err := payments.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure payment provider: %v", err)
+	}
+	log.Println("Using payment provider:", gateway.Name())
+
+	mux := setupRoutes(db, gateway)
+
+	// Release inventory holds of checkout sessions that were never completed
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	inventory.StartSweeper(sweeperCtx, db, time.Minute)
+	handlers.StartWaitlistWorker(sweeperCtx, db, time.Minute)
 
 	// Serve static files first (higher priority)
 	staticDir := "C:/Users/User/Desktop/Sahin_DegreeProject/eventix-client/dist"
@@ -139,7 +215,7 @@ func main() {
 	// Catch-all handler for React Router (should be last)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// List of API prefixes that should return 404 if not handled
-		apiPrefixes := []string{"/api/", "/admin/", "/signup", "/login", "/logout", "/verify", "/resend-verification", "/forgot-password", "/cities", "/success", "/myTickets", "/checkout/", "/qrCodeScanning", "/validateTicket"}
+		apiPrefixes := []string{"/api/", "/admin/", "/signup", "/login", "/logout", "/verify", "/resend-verification", "/forgot-password", "/cities", "/success", "/myTickets", "/checkout/", "/webhooks/", "/payments/", "/qrCodeScanning", "/validateTicket"}
 
 		// Check if it's an API route
 		for _, prefix := range apiPrefixes {
@@ -202,3 +278,18 @@ func main() {
 	}
 	log.Println("Server gracefully stopped") // Log successful shutdown
 }
+
+// orderRoutes serves GET /api/orders/session/{sessionId} and GET /api/orders/{id}/invoice.
+// The mux cannot register both, as either pattern would match /api/orders/session/invoice.
+func orderRoutes(bySession, invoice http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.PathValue("id") == "session":
+			bySession(w, r)
+		case r.PathValue("resource") == "invoice":
+			invoice(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
@@ -20,6 +20,12 @@ import AdminDashboardPage from './pages/Admin/AdminDashboardPage'
 import { AdminRoute } from './components/AdminRoute'
 import QRCode from './pages/QRcodeValidationPage'
 import CheckoutSuccessPage from './pages/CheckoutSuccessPage'
+import WaitlistOfferPage from './pages/WaitlistOfferPage'
+import GuestOrderPage from './pages/GuestOrderPage'
+import TicketTransferPage from './pages/TicketTransferPage'
+import StaffInvitationPage from './pages/StaffInvitationPage'
+import CartPage from './pages/CartPage'
+import { CartProvider } from './contexts/CartContext'
 import { Toaster } from "./components/ui/sonner"
 import ResetPasswordPage from './pages/ResetPasswordPage'; // Adjust the path as needed
 
@@ -29,6 +35,7 @@ const App: React.FC = () => {
     <BrowserRouter>
       <ThemeProvider attribute="class" defaultTheme="light" storageKey="eventix-theme">
         <AuthProvider>
+        <CartProvider>
           <div className="flex min-h-screen flex-col ">
             <Navbar />
             <main className="flex-1">
@@ -41,8 +48,9 @@ const App: React.FC = () => {
                 <Route path="/categories" element={<CategoriesPage />} />
                 <Route path="/categories/:categoryId" element={<CategoryDetailPage />} />
                 <Route path="/categories/:categoryId/:subcategoryId" element={<CategoryDetailPage />} />
-                <Route path="/validateCode" element={<QRCode />} />
                 <Route path="/success" element={<CheckoutSuccessPage />} />
+                <Route path="/guest/orders/:token" element={<GuestOrderPage />} />
+                <Route path="/cart" element={<CartPage />} />
                 {/* If a logged-in user tries to go to these, they will be redirected. */}
 
                 <Route element={<PublicOnlyRoute />}>
@@ -58,6 +66,10 @@ const App: React.FC = () => {
 
                 <Route element={<PrivateRoute />}>
                   <Route path="/profile" element={<UserProfilePage />} />
+                  <Route path="/waitlist/offers/:token" element={<WaitlistOfferPage />} />
+                  <Route path="/transfers/:token" element={<TicketTransferPage />} />
+                  <Route path="/staff-invitations/:token" element={<StaffInvitationPage />} />
+                  <Route path="/validateCode" element={<QRCode />} />
                 </Route>
 
               </Routes>
@@ -66,6 +78,7 @@ const App: React.FC = () => {
             <Toaster />
             <Footer />
           </div>
+        </CartProvider>
         </AuthProvider>
       </ThemeProvider>
     </BrowserRouter>
@@ -16,11 +16,13 @@ import {
   DropdownMenuTrigger,
 } from "../components/ui/dropdown-menu"
 import { useAuth } from "../contexts/AuthContext"
+import { useCart } from "../contexts/CartContext"
 import { CategoriesDropdownDesktop, CategoriesDropdownMobile } from "../components/CategoriesDropdown"
 
 export default function Navbar() {
   const [isSearchOpen, setIsSearchOpen] = useState(false)
   const { currentUser, isLoggedIn, logout, isAdmin, isCreator} = useAuth()
+  const { items: cartItems } = useCart()
   const navigate = useNavigate()
 
   const handleLogout = () => {
@@ -179,9 +181,14 @@ export default function Navbar() {
             </div>
           )}
 
-          <Link to="/checkout">
-            <Button variant="ghost" size="icon">
+          <Link to="/cart">
+            <Button variant="ghost" size="icon" className="relative">
               <ShoppingCart className="h-5 w-5" />
+              {cartItems.length > 0 && (
+                <span className="absolute -right-1 -top-1 rounded-full bg-primary px-1.5 text-xs text-primary-foreground">
+                  {cartItems.length}
+                </span>
+              )}
               <span className="sr-only">Cart</span>
             </Button>
           </Link>
@@ -0,0 +1,64 @@
+import React, { createContext, useContext, useEffect, useState } from 'react';
+
+// A cart collects tickets from several events and pays for them in one checkout.
+// Seated tickets are picked on the seat map and bought straight from the event page.
+export interface CartItem {
+  eventId: number;
+  eventSlug: string;
+  eventTitle: string;
+  ticketTypeId: number;
+  ticketTypeName: string;
+  priceCents: number;
+  serviceFeeCents: number;
+  currency: string;
+  quantity: number;
+}
+
+interface CartContextType {
+  items: CartItem[];
+  addItem: (item: CartItem) => void;
+  removeItem: (ticketTypeId: number) => void;
+  clear: () => void;
+}
+
+const STORAGE_KEY = 'eventix-cart';
+
+export const CartContext = createContext<CartContextType>({
+  items: [],
+  addItem: () => { },
+  removeItem: () => { },
+  clear: () => { },
+});
+
+export const useCart = () => useContext(CartContext);
+
+export const CartProvider: React.FC<{ children: React.ReactNode }> = ({ children }) => {
+  const [items, setItems] = useState<CartItem[]>(() => {
+    try {
+      return JSON.parse(localStorage.getItem(STORAGE_KEY) || '[]');
+    } catch {
+      return [];
+    }
+  });
+
+  useEffect(() => {
+    localStorage.setItem(STORAGE_KEY, JSON.stringify(items));
+  }, [items]);
+
+  // Adding a ticket type that is already in the cart replaces its quantity
+  const addItem = (item: CartItem) => {
+    setItems((current) => [...current.filter((i) => i.ticketTypeId !== item.ticketTypeId), item]);
+  };
+
+  const removeItem = (ticketTypeId: number) => {
+    setItems((current) => current.filter((i) => i.ticketTypeId !== ticketTypeId));
+  };
+
+  const clear = () => setItems([]);
+
+  return (
+    <CartContext.Provider value={{ items, addItem, removeItem, clear }}>
+      {children}
+    </CartContext.Provider>
+  );
+};
@@ -0,0 +1,208 @@
+// Offline scanning. A device downloads the signed manifest of the event it scans
+// for, checks tickets against it when the connection drops, and uploads the scans
+// it made once it is back online.
+
+const API_BASE_URL = "http://localhost:8080"
+
+export interface ManifestTicket {
+  h: string // base64url SHA-256 of the ticket's scan code
+  t: string // ticket ID
+  s: "valid" | "used" | "void" | "wrong_seat"
+  seat?: string
+  p?: "multi" | "unlimited" | "in_out" // entry policy, absent for single entry
+  n?: number // entries left, multi entry only
+  in?: boolean // in/out only: inside when the list was downloaded
+  from?: string // validity dates
+  until?: string
+}
+
+interface Manifest {
+  event_id: string
+  generated_at: string
+  tickets: ManifestTicket[]
+}
+
+interface SignedManifest {
+  key_id: number
+  algorithm: string
+  public_key: string // base64
+  payload: string // base64url
+  signature: string // base64url
+}
+
+export interface OfflineScan {
+  client_id: string
+  code: string // the scanned code, which the server checks again
+  ticket_id: string // for counting this device's entries; not uploaded
+  scanned_at: string
+  gate: string
+  check_out?: boolean // in/out tickets only
+}
+
+export interface StoredManifest extends Manifest {
+  public_key: string
+}
+
+const manifestKey = (eventId: string) => `scanner-manifest-${eventId}`
+const pendingKey = (eventId: string) => `scanner-pending-${eventId}`
+const pinnedKey = (eventId: string) => `scanner-key-${eventId}`
+
+const fromBase64 = (s: string) => Uint8Array.from(atob(s.replace(/-/g, "+").replace(/_/g, "/")), (c) => c.charCodeAt(0))
+
+const toBase64Url = (bytes: ArrayBuffer) =>
+  btoa(String.fromCharCode(...new Uint8Array(bytes))).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "")
+
+// Ed25519 in WebCrypto is missing from some browsers; those skip the signature check
+const verify = async (publicKey: Uint8Array, signature: Uint8Array, data: Uint8Array) => {
+  try {
+    const key = await crypto.subtle.importKey("raw", publicKey, { name: "Ed25519" }, false, ["verify"])
+    return await crypto.subtle.verify({ name: "Ed25519" }, key, signature, data)
+  } catch (e) {
+    if (e instanceof DOMException && e.name === "NotSupportedError") return true
+    throw e
+  }
+}
+
+export const codeHash = async (code: string) =>
+  toBase64Url(await crypto.subtle.digest("SHA-256", new TextEncoder().encode(code)))
+
+// Downloads and checks the event's manifest. The event's public key is pinned on
+// the first download; a manifest signed with another key is refused.
+export async function downloadManifest(eventId: string): Promise<StoredManifest> {
+  const res = await fetch(`${API_BASE_URL}/api/scanner/events/${eventId}/manifest`, { credentials: "include" })
+  if (!res.ok) {
+    throw new Error(`Downloading the ticket list failed with status: ${res.status}`)
+  }
+  const signed: SignedManifest = await res.json()
+  const pinned = localStorage.getItem(pinnedKey(eventId))
+  if (pinned && pinned !== signed.public_key) {
+    throw new Error("The event's signing key has changed. Clear offline data for this event and download again.")
+  }
+
+  const payload = fromBase64(signed.payload)
+  if (!(await verify(fromBase64(signed.public_key), fromBase64(signed.signature), payload))) {
+    throw new Error("The downloaded ticket list is not signed by the event.")
+  }
+  const manifest: StoredManifest = { ...JSON.parse(new TextDecoder().decode(payload)), public_key: signed.public_key }
+  localStorage.setItem(pinnedKey(eventId), signed.public_key)
+  localStorage.setItem(manifestKey(eventId), JSON.stringify(manifest))
+  return manifest
+}
+
+export function storedManifest(eventId: string): StoredManifest | null {
+  const raw = localStorage.getItem(manifestKey(eventId))
+  return raw ? JSON.parse(raw) : null
+}
+
+export function clearOfflineData(eventId: string) {
+  localStorage.removeItem(manifestKey(eventId))
+  localStorage.removeItem(pinnedKey(eventId))
+}
+
+// Checks a signed code (tv1.<payload>.<signature>) against the event's key
+async function genuineCode(code: string, publicKey: string) {
+  if (!code.startsWith("tv1.")) return true // unsigned codes of tickets issued before codes were signed
+  const [payload, signature] = code.slice(4).split(".")
+  if (!payload || !signature) return false
+  try {
+    return await verify(fromBase64(publicKey), fromBase64(signature), fromBase64(payload))
+  } catch {
+    return false
+  }
+}
+
+// How far a ticket is through its entry policy, as the device knows it
+export interface OfflineUsage {
+  entry_policy: string
+  entries_left?: number // absent when entries are not limited
+  inside?: boolean
+}
+
+export type OfflineLookup =
+  | { found: false; message: string }
+  | { found: true; ticket: ManifestTicket; usage: OfflineUsage; outsideValidity: boolean }
+
+// Works out a ticket's entries from the downloaded manifest and the scans this
+// device made since
+function offlineUsage(ticket: ManifestTicket, scans: OfflineScan[]): OfflineUsage {
+  const here = scans.filter((s) => s.ticket_id === ticket.t)
+  const entries = here.filter((s) => !s.check_out).length
+  switch (ticket.p) {
+    case "multi":
+      return { entry_policy: "multi", entries_left: Math.max(0, (ticket.n ?? 0) - entries) }
+    case "unlimited":
+      return { entry_policy: "unlimited" }
+    case "in_out": {
+      const last = here[here.length - 1]
+      return { entry_policy: "in_out", inside: last ? !last.check_out : !!ticket.in }
+    }
+    default:
+      return { entry_policy: "single", entries_left: ticket.s === "used" || entries > 0 ? 0 : 1 }
+  }
+}
+
+// Finds a scanned code in the downloaded manifest; entries made on this device
+// since the download are counted against the ticket
+export async function lookupOffline(eventId: string, code: string): Promise<OfflineLookup> {
+  const manifest = storedManifest(eventId)
+  if (!manifest) {
+    return { found: false, message: "No ticket list downloaded for offline scanning." }
+  }
+  if (!(await genuineCode(code, manifest.public_key))) {
+    return { found: false, message: "Ticket code is not genuine. Do not admit." }
+  }
+  const hash = await codeHash(code)
+  const ticket = manifest.tickets.find((t) => t.h === hash)
+  if (!ticket) {
+    return { found: false, message: "Ticket not in the downloaded list for this event. Do not admit." }
+  }
+  const now = Date.now()
+  const outsideValidity =
+    (!!ticket.from && now < Date.parse(ticket.from)) || (!!ticket.until && now >= Date.parse(ticket.until))
+  return { found: true, ticket, usage: offlineUsage(ticket, pendingScans(eventId)), outsideValidity }
+}
+
+export function pendingScans(eventId: string): OfflineScan[] {
+  return JSON.parse(localStorage.getItem(pendingKey(eventId)) || "[]")
+}
+
+export function recordOfflineScan(eventId: string, code: string, ticketId: string, gate: string, checkOut = false) {
+  const scans = pendingScans(eventId)
+  const scan: OfflineScan = { client_id: crypto.randomUUID(), code, ticket_id: ticketId, scanned_at: new Date().toISOString(), gate }
+  if (checkOut) scan.check_out = true
+  scans.push(scan)
+  localStorage.setItem(pendingKey(eventId), JSON.stringify(scans))
+}
+
+export interface SyncResult {
+  client_id: string
+  outcome: string
+  ticket_id: string
+  first_entry?: { scanned_at: string; gate?: string; device?: string }
+}
+
+// Uploads the scans made offline. Uploading again after a failure is safe: the
+// server recognises scans it already has.
+export async function syncScans(eventId: string, device: string): Promise<SyncResult[]> {
+  const scans = pendingScans(eventId)
+  if (scans.length === 0) return []
+  const res = await fetch(`${API_BASE_URL}/api/scanner/events/${eventId}/scans:batch`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    credentials: "include",
+    body: JSON.stringify({
+      device,
+      scans: scans.map(({ client_id, code, scanned_at, gate, check_out }) => ({ client_id, code, scanned_at, gate, check_out })),
+    }),
+  })
+  const data = await res.json()
+  if (!res.ok) {
+    throw new Error(data.error || `Uploading scans failed with status: ${res.status}`)
+  }
+  const synced = new Set(scans.map((s) => s.client_id))
+  localStorage.setItem(
+    pendingKey(eventId),
+    JSON.stringify(pendingScans(eventId).filter((s) => !synced.has(s.client_id))),
+  )
+  return data.results
+}
@@ -0,0 +1,133 @@
+import { useMemo, useState } from "react"
+import { Link } from "react-router"
+import { Loader2, ShoppingCart, Trash2 } from "lucide-react"
+import { Button } from "../components/ui/button"
+import { Input } from "../components/ui/input"
+import { Card, CardContent, CardHeader, CardTitle } from "../components/ui/card"
+import { toast } from "sonner"
+import { useAuth } from "../contexts/AuthContext"
+import { useCart, type CartItem } from "../contexts/CartContext"
+
+const formatPrice = (price_cents: number, currency: string) => {
+  const { maximumFractionDigits = 2 } = new Intl.NumberFormat("en", { style: "currency", currency }).resolvedOptions();
+  return (price_cents / 10 ** maximumFractionDigits).toFixed(maximumFractionDigits) + " " + currency;
+};
+
+// Tickets from several events, paid for in a single checkout
+export default function CartPage() {
+  const { items, removeItem } = useCart()
+  const { isLoggedIn, currentUser } = useAuth()
+  const [guest, setGuest] = useState({ email: "", name: "" })
+  const [checkingOut, setCheckingOut] = useState(false)
+
+  const events = useMemo(() => {
+    const byEvent = new Map<number, { title: string; slug: string; items: CartItem[] }>()
+    for (const item of items) {
+      const event = byEvent.get(item.eventId) ?? { title: item.eventTitle, slug: item.eventSlug, items: [] }
+      event.items.push(item)
+      byEvent.set(item.eventId, event)
+    }
+    return [...byEvent.entries()]
+  }, [items])
+
+  const currency = items[0]?.currency || "PLN"
+  const total = items.reduce((sum, i) => sum + (i.priceCents + i.serviceFeeCents) * i.quantity, 0)
+  const guestReady = guest.email.trim() !== "" && guest.name.trim() !== ""
+  // One key per cart, so double clicks reuse the same checkout session
+  const checkoutKey = useMemo(() => crypto.randomUUID(), [items])
+
+  const handleCheckout = async () => {
+    if (!isLoggedIn && !guestReady) {
+      toast.info("Enter your email and name, or log in, to check out.")
+      return
+    }
+    setCheckingOut(true)
+    try {
+      const res = await fetch("http://localhost:8080/checkout/create-session", {
+        method: "POST",
+        credentials: "include",
+        headers: { "Content-Type": "application/json", "Idempotency-Key": checkoutKey },
+        body: JSON.stringify({
+          ...(isLoggedIn ? { user_id: currentUser?.userId } : { guest }),
+          events: events.map(([eventId, event]) => ({
+            event_id: eventId,
+            tickets: event.items.map((i) => ({ ticket_type_id: i.ticketTypeId, quantity: i.quantity })),
+          })),
+        }),
+      })
+      const data = await res.json()
+      if (!res.ok) {
+        const lineError = data.lines?.[0]?.error
+        throw new Error(lineError ? `${data.error}: ${lineError}` : data.error || `Checkout failed with status: ${res.status}`)
+      }
+      // The success page empties the cart once this checkout has been paid
+      sessionStorage.setItem("cart_checkout", data.transaction_id)
+      window.location.href = data.url
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Checkout failed.")
+      setCheckingOut(false)
+    }
+  }
+
+  if (items.length === 0) {
+    return (
+      <div className="container mx-auto max-w-2xl px-4 py-16 text-center">
+        <ShoppingCart className="mx-auto h-12 w-12 text-muted-foreground" />
+        <h1 className="mt-4 text-2xl font-bold">Your cart is empty</h1>
+        <Button asChild className="mt-6">
+          <Link to="/events">Browse events</Link>
+        </Button>
+      </div>
+    )
+  }
+
+  return (
+    <div className="container mx-auto max-w-2xl px-4 py-8 space-y-6">
+      <h1 className="text-3xl font-bold">Your cart</h1>
+
+      {events.map(([eventId, event]) => (
+        <Card key={eventId}>
+          <CardHeader>
+            <CardTitle>
+              <Link to={`/events/${event.slug}`} className="hover:underline">{event.title}</Link>
+            </CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-3">
+            {event.items.map((item) => (
+              <div key={item.ticketTypeId} className="flex items-center justify-between">
+                <div>
+                  <div className="font-medium">{item.quantity} × {item.ticketTypeName}</div>
+                  <div className="text-sm text-muted-foreground">
+                    {formatPrice(item.priceCents, item.currency)}
+                    {item.serviceFeeCents > 0 && ` + ${formatPrice(item.serviceFeeCents, item.currency)} service fee`} each
+                  </div>
+                </div>
+                <Button variant="ghost" size="icon" onClick={() => removeItem(item.ticketTypeId)}>
+                  <Trash2 className="h-4 w-4" />
+                  <span className="sr-only">Remove</span>
+                </Button>
+              </div>
+            ))}
+          </CardContent>
+        </Card>
+      ))}
+
+      {!isLoggedIn && (
+        <div className="space-y-2">
+          <p className="text-sm text-muted-foreground">Check out as a guest, or log in</p>
+          <Input placeholder="Email" type="email" value={guest.email} onChange={(e) => setGuest({ ...guest, email: e.target.value })} />
+          <Input placeholder="Full name" value={guest.name} onChange={(e) => setGuest({ ...guest, name: e.target.value })} />
+        </div>
+      )}
+
+      <div className="flex items-center justify-between border-t pt-4">
+        <span className="text-lg font-semibold">Total</span>
+        <span className="text-lg font-semibold">{formatPrice(total, currency)}</span>
+      </div>
+      <Button onClick={handleCheckout} disabled={checkingOut || (!isLoggedIn && !guestReady)} className="w-full">
+        {checkingOut ? <Loader2 className="mr-2 h-4 w-4 animate-spin" /> : null}
+        Check out
+      </Button>
+    </div>
+  )
+}
@@ -11,6 +11,7 @@ import { toast } from "sonner"
 import { format } from "date-fns"
 import { apiService, type OrderResponse, type EventDetail } from "../services/api"
 import { useAuth } from "../contexts/AuthContext"
+import { useCart } from "../contexts/CartContext"
 
 export default function CheckoutSuccessPage() {
   const [searchParams] = useSearchParams()
@@ -21,6 +22,15 @@ export default function CheckoutSuccessPage() {
   const [processingPayment, setProcessingPayment] = useState(true)
 
   const sessionId = searchParams.get("session_id")
+  const { clear: clearCart } = useCart()
+
+  // A paid cart checkout empties the cart
+  useEffect(() => {
+    if (sessionId && sessionStorage.getItem("cart_checkout") === sessionId) {
+      sessionStorage.removeItem("cart_checkout")
+      clearCart()
+    }
+  }, [sessionId])
 
   useEffect(() => {
     const processPayment = async () => {
@@ -49,25 +59,22 @@ export default function CheckoutSuccessPage() {
           console.log("Order not found, creating new order...")
         }
 
-        // Get payment details from sessionStorage (set during checkout)
-        const paymentDataStr = sessionStorage.getItem(`payment_${sessionId}`)
-        if (!paymentDataStr) {
-          throw new Error("Payment data not found. Please contact support.")
+        // The order is written by the Stripe webhook; wait until it has been fulfilled
+        let fulfilled = false
+        for (let attempt = 0; attempt < 15 && !fulfilled; attempt++) {
+          const { status } = await apiService.getPaymentStatus(sessionId)
+          if (status === "needs_attention") {
+            throw new Error("Your payment was received, but we could not issue your tickets yet. Our team has been notified and will get back to you.")
+          }
+          fulfilled = status !== "pending"
+          if (!fulfilled) {
+            await new Promise((resolve) => setTimeout(resolve, 2000))
+          }
+        }
+        if (!fulfilled) {
+          throw new Error("Your payment is still being confirmed. Your tickets will be emailed shortly.")
         }
 
-        const paymentData = JSON.parse(paymentDataStr)
-
-        // Complete the payment by calling your /success endpoint
-        await apiService.completePayment({
-          transactionId: sessionId,
-          eventId: paymentData.eventId,
-          userId: currentUser.userId,
-          totalAmount: paymentData.totalAmount,
-          tickets: paymentData.tickets,
-          totalQuantity: paymentData.totalQuantity,
-        })
-
-        // Clean up sessionStorage
         sessionStorage.removeItem(`payment_${sessionId}`)
 
         // Fetch the created order
@@ -220,6 +227,14 @@ export default function CheckoutSuccessPage() {
             <Download className="mr-2 h-4 w-4" />
             Download PDF
           </Button>
+          {order.total_amount_cents > 0 && (
+            <Button variant="outline" asChild className="w-full">
+              <a href={`http://localhost:8080/api/orders/${order.id}/invoice`}>
+                <Download className="mr-2 h-4 w-4" />
+                Download Invoice
+              </a>
+            </Button>
+          )}
           <Button variant="outline" className="w-full">
             <Calendar className="mr-2 h-4 w-4" />
             Add to Calendar
@@ -2,15 +2,17 @@ import { useState, useEffect, useMemo } from "react"
 import { useParams } from "react-router"
 import { CalendarIcon, MapPinIcon, Clock, Share2, Heart, Info, Loader2, Lock, Ticket } from "lucide-react"
 import { Button } from "../components/ui/button"
+import { Input } from "../components/ui/input"
 import { Badge } from "../components/ui/badge"
 import { Tabs, TabsContent, TabsList, TabsTrigger } from "../components/ui/tabs"
 import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "../components/ui/select"
 import EventCard from "../components/EventCard"
 import Breadcrumb from "../components/Breadcrumb"
-import { apiService, type EventDetail, type EventResponse } from "../services/api"
+import { apiService, type EventDetail, type EventResponse, type SeatMap } from "../services/api"
 import { toast } from "sonner"
 import { format } from "date-fns"
 import { useAuth } from "../contexts/AuthContext"
+import { useCart } from "../contexts/CartContext"
 import MapComponent from "../components/MapComponent"; // Import your new MapComponent
 
 export default function EventDetailPage() {
@@ -22,6 +24,7 @@ export default function EventDetailPage() {
   const [quantity, setQuantity] = useState("1")
   const [checkingOut, setCheckingOut] = useState(false)
   const { isLoggedIn, currentUser } = useAuth()
+  const { addItem } = useCart()
 
   // ... (rest of your existing code)
 
@@ -77,13 +80,136 @@ export default function EventDetailPage() {
     );
   }, [event, selectedTicketId]);
 
+  // The quantity picker only offers what the ticket type's purchase limits allow
+  const minQuantity = selectedTicket?.min_per_order || 1;
+  const maxQuantity = Math.min(
+    selectedTicket?.available_quantity || 0,
+    selectedTicket?.max_per_order ?? Infinity,
+  );
+
+  useEffect(() => {
+    setQuantity(minQuantity.toString());
+  }, [selectedTicketId, minQuantity]);
+
+  // Seated ticket types are bought by picking seats, which sets the quantity
+  const [seatMap, setSeatMap] = useState<SeatMap | null>(null);
+  const [selectedSeats, setSelectedSeats] = useState<number[]>([]);
+
+  useEffect(() => {
+    if (!event?.seated) return;
+    fetch(`http://localhost:8080/api/events/${slug}/seats`)
+      .then((res) => (res.ok ? res.json() : null))
+      .then(setSeatMap)
+      .catch((err) => console.error("Error fetching seat map:", err));
+  }, [event?.seated, slug]);
+
+  useEffect(() => {
+    setSelectedSeats([]);
+  }, [selectedTicketId]);
+
+  useEffect(() => {
+    if (selectedTicket?.seated) setQuantity(selectedSeats.length.toString());
+  }, [selectedTicket, selectedSeats]);
+
+  const toggleSeat = (seatId: number) => {
+    setSelectedSeats((seats) => {
+      if (seats.includes(seatId)) return seats.filter((id) => id !== seatId);
+      if (seats.length >= maxQuantity) {
+        toast.info(`You can pick up to ${maxQuantity} seats.`);
+        return seats;
+      }
+      return [...seats, seatId];
+    });
+  };
+
+  // Buyers who are not logged in check out as a guest with an email address and name
+  const [guest, setGuest] = useState({ email: "", name: "" });
+  const guestReady = guest.email.trim() !== "" && guest.name.trim() !== "";
+  const isFreeTicket = !!selectedTicket && selectedTicket.price_cents + selectedTicket.service_fee_cents === 0;
+  // Guests are known only by an unverified email, so tickets limited per customer need an account
+  const limitedPerCustomer = selectedTicket?.max_per_customer != null;
+  const needsAccount = isFreeTicket || limitedPerCustomer;
+
+  // Company details for a VAT invoice, sent with paid checkouts only
+  const [wantsInvoice, setWantsInvoice] = useState(false);
+  const [invoiceBuyer, setInvoiceBuyer] = useState({ company_name: "", nip: "", address: "" });
+
   const totalPrice = useMemo(() => {
     if (!selectedTicket) return 0;
-    return selectedTicket.price_cents * Number.parseInt(quantity);
+    return (selectedTicket.price_cents + selectedTicket.service_fee_cents) * Number.parseInt(quantity);
   }, [selectedTicket, quantity]);
 
+  // Prices are in the event currency's minor unit, which Intl knows the exponent of
+  // One key per ticket selection, so double clicks reuse the same checkout session
+  const checkoutKey = useMemo(() => crypto.randomUUID(), [selectedTicketId, quantity]);
+
+  // Paid tickets can be collected in the cart with tickets of other events
+  const handleAddToCart = () => {
+    if (!event || !selectedTicket) return;
+    addItem({
+      eventId: event.id,
+      eventSlug: event.slug,
+      eventTitle: event.title,
+      ticketTypeId: selectedTicket.id,
+      ticketTypeName: selectedTicket.name,
+      priceCents: selectedTicket.price_cents,
+      serviceFeeCents: selectedTicket.service_fee_cents,
+      currency: event.currency,
+      quantity: Number.parseInt(quantity),
+    });
+    toast.success(`${selectedTicket.name} added to your cart`);
+  };
+
+  const handleJoinWaitlist = async () => {
+    if (!selectedTicket) return;
+    try {
+      const res = await fetch(`http://localhost:8080/api/events/${slug}/waitlist`, {
+        method: "POST",
+        credentials: "include",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ ticket_type_id: selectedTicket.id, quantity: Number.parseInt(quantity) || 1 }),
+      });
+      const data = await res.json();
+      if (!res.ok) {
+        throw new Error(data.error || `Joining the waitlist failed with status: ${res.status}`);
+      }
+      toast.success("You are on the waitlist. We will email you when tickets become available.");
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Could not join the waitlist.");
+    }
+  };
+
+  // Buys the cheapest fan listing of the selected ticket type through a regular checkout
+  const handleBuyResale = async () => {
+    if (!selectedTicket) return;
+    setCheckingOut(true);
+    try {
+      const listingsRes = await fetch(`http://localhost:8080/api/events/${slug}/resale`);
+      const listings: { id: number; ticket_type_id: number; price_cents: number }[] = await listingsRes.json();
+      const listing = listingsRes.ok ? listings.find((l) => l.ticket_type_id === selectedTicket.id) : undefined;
+      if (!listing) {
+        throw new Error("No resale tickets of this type are left.");
+      }
+      const res = await fetch(`http://localhost:8080/api/resale/listings/${listing.id}/checkout`, {
+        method: "POST",
+        credentials: "include",
+        headers: { "Idempotency-Key": checkoutKey },
+      });
+      const data = await res.json();
+      if (!res.ok) {
+        throw new Error(data.error || `Checkout failed with status: ${res.status}`);
+      }
+      window.location.href = data.url;
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Could not buy the resale ticket.");
+      setCheckingOut(false);
+    }
+  };
+
   const formatPrice = (price_cents: number) => {
-    return (price_cents / 100).toFixed(2) + " PLN";
+    const currency = event?.currency || "PLN";
+    const { maximumFractionDigits = 2 } = new Intl.NumberFormat("en", { style: "currency", currency }).resolvedOptions();
+    return (price_cents / 10 ** maximumFractionDigits).toFixed(maximumFractionDigits) + " " + currency;
   };
 
 const handleShare = () => {
@@ -105,13 +231,16 @@ const handleShare = () => {
   };
 
   const handleCheckout = async () => {
-    if (!isLoggedIn) {
-      toast.info("Please log in to proceed with the checkout.");
+    if (!event || !selectedTicket) return;
+
+    // Guests can buy paid tickets; free registration and tickets limited per customer need an account
+    if (!isLoggedIn && (needsAccount || !guestReady)) {
+      toast.info(isFreeTicket ? "Please log in to register for free tickets."
+        : limitedPerCustomer ? "Please log in to buy tickets limited per customer."
+        : "Enter your email and name, or log in, to check out.");
       return;
     }
 
-    if (!event || !selectedTicket) return;
-
     const quantityNum = Number.parseInt(quantity);
     if (!selectedTicketId || quantityNum <= 0) {
       toast.error("Please select a ticket type and a valid quantity.");
@@ -119,27 +248,51 @@ const handleShare = () => {
     }
 
 
-    const selectedTicketsForCheckout = [
+    const seatIds = selectedTicket.seated ? selectedSeats : [];
+    const selectedTicketsForCheckout = selectedTicket.seated ? [] : [
         { ticket_type_id: Number(selectedTicketId), quantity: quantityNum },
     ];
 
     setCheckingOut(true);
     try {
+        // Free tickets skip the payment provider and are issued straight away
+        if (isFreeTicket) {
+            const res = await fetch(`http://localhost:8080/api/events/${slug}/register`, {
+                method: "POST",
+                credentials: "include",
+                headers: { "Content-Type": "application/json", "Idempotency-Key": checkoutKey },
+                body: JSON.stringify({ tickets: selectedTicketsForCheckout, seat_ids: seatIds }),
+            });
+            const data = await res.json();
+            if (!res.ok) {
+                const lineError = data.lines?.[0]?.error;
+                throw new Error(
+                    lineError ? `${data.error}: ${lineError}` : data.error || `Registration failed with status: ${res.status}`
+                );
+            }
+            window.location.href = `/success?session_id=${data.session_id}`;
+            return;
+        }
+
         const res = await fetch("http://localhost:8080/checkout/create-session", {
             method: "POST",
-            headers: { "Content-Type": "application/json" },
+            credentials: "include",
+            headers: { "Content-Type": "application/json", "Idempotency-Key": checkoutKey },
             body: JSON.stringify({
-                user_id: currentUser?.userId,
+                ...(isLoggedIn ? { user_id: currentUser?.userId } : { guest }),
                 event_id: event.id,
                 tickets: selectedTicketsForCheckout,
+                seat_ids: seatIds,
+                ...(wantsInvoice && { invoice: invoiceBuyer }),
             }),
         });
 
         const data = await res.json();
 
         if (!res.ok) {
+            const lineError = data.lines?.[0]?.error;
             throw new Error(
-                data.error || `Checkout failed with status: ${res.status}`
+                lineError ? `${data.error}: ${lineError}` : data.error || `Checkout failed with status: ${res.status}`
             );
         }
 
@@ -343,12 +496,22 @@ const handleShare = () => {
                       </SelectTrigger>
                       <SelectContent>
                         {event.ticket_types.map((ticket) => (
-                          <SelectItem key={ticket.id} value={ticket.id.toString()} disabled={ticket.available_quantity === 0}>
+                          <SelectItem key={ticket.id} value={ticket.id.toString()} disabled={ticket.sales_status !== "on_sale"}>
                             <div className="flex flex-col">
                               <div className="font-medium">
                                 {ticket.name} - {formatPrice(ticket.price_cents)}
-                                {ticket.available_quantity === 0 && " (Sold Out)"}
+                                {ticket.sales_status === "sold_out" && " (Sold Out)"}
+                                {ticket.sales_status === "sales_ended" && " (Sales Ended)"}
+                                {ticket.sales_status === "on_sale_soon" && ticket.sales_start &&
+                                  ` (On sale ${new Date(ticket.sales_start).toLocaleString()})`}
                               </div>
+                              {ticket.tier_name && ticket.sales_status === "on_sale" && (
+                                <div className="text-xs text-muted-foreground">
+                                  {ticket.tier_name}, regular price {formatPrice(ticket.regular_price_cents)}
+                                  {ticket.tier_ends_at && ` until ${new Date(ticket.tier_ends_at).toLocaleDateString()}`}
+                                  {ticket.tier_remaining !== undefined && `, ${ticket.tier_remaining} left at this price`}
+                                </div>
+                              )}
                             </div>
                           </SelectItem>
                         ))}
@@ -356,21 +519,64 @@ const handleShare = () => {
                     </Select>
                   </div>
 
-                  <div>
-                    <label className="text-sm font-medium">Quantity</label>
-                    <Select value={quantity} onValueChange={setQuantity} disabled={!selectedTicket || selectedTicket.available_quantity === 0}>
-                      <SelectTrigger className="mt-1">
-                        <SelectValue placeholder="Select quantity" />
-                      </SelectTrigger>
-                      <SelectContent>
-                        {[...Array(selectedTicket?.available_quantity || 0)].map((_, i) => (
-                          <SelectItem key={i + 1} value={(i + 1).toString()}>
-                            {i + 1}
-                          </SelectItem>
-                        ))}
-                      </SelectContent>
-                    </Select>
-                  </div>
+                  {selectedTicket?.seated ? (
+                    <div>
+                      <label className="text-sm font-medium">Seats</label>
+                      {seatMap ? (
+                        <div className="mt-1 space-y-3">
+                          {seatMap.sections.map((section) => (
+                            <div key={section.id}>
+                              <div className="text-xs font-medium text-muted-foreground">{section.name}</div>
+                              {section.rows.map((row) => (
+                                <div key={row.label} className="mt-1 flex items-center gap-1">
+                                  <span className="w-6 text-xs text-muted-foreground">{row.label}</span>
+                                  {row.seats.map((seat) => {
+                                    const picked = selectedSeats.includes(seat.id);
+                                    const open = seat.ticket_type_id === selectedTicket.id && seat.status === "available";
+                                    return (
+                                      <button
+                                        key={seat.id}
+                                        type="button"
+                                        disabled={!open && !picked}
+                                        onClick={() => toggleSeat(seat.id)}
+                                        title={`Row ${row.label}, Seat ${seat.number}${seat.accessible ? " (accessible)" : ""}${seat.obstructed ? " (obstructed view)" : ""}`}
+                                        className={`h-6 w-6 rounded text-[10px] ${
+                                          picked ? "bg-primary text-primary-foreground" : open ? "border hover:bg-muted" : "bg-muted text-muted-foreground opacity-50"
+                                        }`}
+                                      >
+                                        {seat.accessible ? "♿" : seat.number}
+                                      </button>
+                                    );
+                                  })}
+                                </div>
+                              ))}
+                            </div>
+                          ))}
+                          <p className="text-xs text-muted-foreground">
+                            {selectedSeats.length === 0 ? "Pick your seats on the map" : `${selectedSeats.length} seat(s) selected`}
+                          </p>
+                        </div>
+                      ) : (
+                        <p className="mt-1 text-sm text-muted-foreground">Loading seat map...</p>
+                      )}
+                    </div>
+                  ) : (
+                    <div>
+                      <label className="text-sm font-medium">Quantity</label>
+                      <Select value={quantity} onValueChange={setQuantity} disabled={!selectedTicket || selectedTicket.sales_status !== "on_sale"}>
+                        <SelectTrigger className="mt-1">
+                          <SelectValue placeholder="Select quantity" />
+                        </SelectTrigger>
+                        <SelectContent>
+                          {[...Array(maxQuantity)].map((_, i) => i + 1).filter((n) => n >= minQuantity).map((n) => (
+                            <SelectItem key={n} value={n.toString()}>
+                              {n}
+                            </SelectItem>
+                          ))}
+                        </SelectContent>
+                      </Select>
+                    </div>
+                  )}
 
                   {selectedTicket && (
                     <div className="rounded-lg bg-muted/50 p-4">
@@ -389,6 +595,12 @@ const handleShare = () => {
                           {formatPrice(selectedTicket.price_cents)}
                         </span>
                       </div>
+                      {selectedTicket.service_fee_cents > 0 && (
+                        <div className="mt-2 flex items-center justify-between text-sm text-muted-foreground">
+                          <span>Service fee per ticket</span>
+                          <span>{formatPrice(selectedTicket.service_fee_cents)}</span>
+                        </div>
+                      )}
                       <div className="mt-4 flex items-center justify-between border-t pt-4">
                         <span className="font-medium">Total</span>
                         <span className="font-bold">
@@ -398,18 +610,67 @@ const handleShare = () => {
                     </div>
                   )}
 
+                  {!isLoggedIn && selectedTicket && !needsAccount && (
+                    <div className="space-y-2">
+                      <p className="text-sm text-muted-foreground">No account? Check out as a guest and we'll email your tickets.</p>
+                      <Input type="email" placeholder="Email" value={guest.email}
+                        onChange={(e) => setGuest({ ...guest, email: e.target.value })} />
+                      <Input placeholder="Full name" value={guest.name}
+                        onChange={(e) => setGuest({ ...guest, name: e.target.value })} />
+                    </div>
+                  )}
+
+                  {selectedTicket && totalPrice > 0 && (
+                    <div className="space-y-2">
+                      <label className="flex items-center gap-2 text-sm">
+                        <input type="checkbox" checked={wantsInvoice} onChange={(e) => setWantsInvoice(e.target.checked)} />
+                        I need a company invoice
+                      </label>
+                      {wantsInvoice && (
+                        <>
+                          <Input placeholder="Company name" value={invoiceBuyer.company_name}
+                            onChange={(e) => setInvoiceBuyer({ ...invoiceBuyer, company_name: e.target.value })} />
+                          <Input placeholder="NIP" value={invoiceBuyer.nip}
+                            onChange={(e) => setInvoiceBuyer({ ...invoiceBuyer, nip: e.target.value })} />
+                          <Input placeholder="Company address" value={invoiceBuyer.address}
+                            onChange={(e) => setInvoiceBuyer({ ...invoiceBuyer, address: e.target.value })} />
+                        </>
+                      )}
+                    </div>
+                  )}
+
                   <Button
                     onClick={handleCheckout}
-                    disabled={!selectedTicketId || Number.parseInt(quantity) === 0 || checkingOut || !isLoggedIn || (selectedTicket?.available_quantity === 0)}
+                    disabled={!selectedTicketId || Number.parseInt(quantity) === 0 || checkingOut || (!isLoggedIn && (needsAccount || !guestReady)) || (selectedTicket?.sales_status !== "on_sale")}
                     className="w-full"
                     size="lg"
                   >
                     {checkingOut && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
                     {!isLoggedIn && <Lock className="mr-2 h-4 w-4" />}
 
-                    {checkingOut ? "Processing..." : isLoggedIn ? "Proceed to Checkout" : "Log in to Checkout"}
+                    {checkingOut ? "Processing..." : isLoggedIn ? "Proceed to Checkout" : isFreeTicket ? "Log in to Register" : limitedPerCustomer ? "Log in to Buy" : "Check out as Guest"}
                     {isLoggedIn && !checkingOut && <Ticket className="ml-2 h-5 w-5" />}
                   </Button>
+
+                  {selectedTicket && !selectedTicket.seated && !isFreeTicket && selectedTicket.sales_status === "on_sale" && (
+                    <Button onClick={handleAddToCart} disabled={Number.parseInt(quantity) === 0} variant="outline" className="w-full">
+                      Add to cart
+                    </Button>
+                  )}
+
+                  {isLoggedIn && selectedTicket?.sales_status === "sold_out" && !selectedTicket.seated && (
+                    <Button onClick={handleJoinWaitlist} variant="outline" className="w-full">
+                      Join the waitlist
+                    </Button>
+                  )}
+
+                  {selectedTicket?.resale && (
+                    <Button onClick={handleBuyResale} disabled={!isLoggedIn || checkingOut} variant="outline" className="w-full">
+                      {isLoggedIn
+                        ? `Buy from a fan from ${formatPrice(selectedTicket.resale.from_cents)} (${selectedTicket.resale.listings} available)`
+                        : "Log in to buy resale tickets"}
+                    </Button>
+                  )}
                 </>
               ) : (
                 <div className="text-center py-8">
@@ -0,0 +1,129 @@
+import { useEffect, useState } from "react"
+import { Link, useParams } from "react-router"
+import { Download, Loader2 } from "lucide-react"
+import { Button } from "../components/ui/button"
+import { Input } from "../components/ui/input"
+import { Card, CardContent, CardHeader, CardTitle } from "../components/ui/card"
+import { toast } from "sonner"
+
+interface GuestOrder {
+  id: string
+  total_amount_cents: number
+  currency: string
+  status: string
+  ticket_quantity: number
+  created_at: string
+  tickets: { id: string; ticket_type_id: number; ticket_code: string }[]
+}
+
+// Landing page of the magic link emailed to guest buyers. An expired or replaced
+// link can be swapped for fresh ones sent to the same address.
+export default function GuestOrderPage() {
+  const { token } = useParams<{ token: string }>()
+  const [order, setOrder] = useState<GuestOrder | null>(null)
+  const [loading, setLoading] = useState(true)
+  const [email, setEmail] = useState("")
+  const [sending, setSending] = useState(false)
+
+  useEffect(() => {
+    fetch(`http://localhost:8080/api/guest/orders/${token}`)
+      .then((res) => (res.ok ? res.json() : null))
+      .then(setOrder)
+      .catch(() => setOrder(null))
+      .finally(() => setLoading(false))
+  }, [token])
+
+  const handleResend = async () => {
+    setSending(true)
+    try {
+      const res = await fetch("http://localhost:8080/api/guest/orders/links", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ email }),
+      })
+      const data = await res.json()
+      if (!res.ok) throw new Error(data.error)
+      toast.success(data.message)
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Could not send new links.")
+    } finally {
+      setSending(false)
+    }
+  }
+
+  if (loading) {
+    return (
+      <div className="flex justify-center py-16">
+        <Loader2 className="h-8 w-8 animate-spin" />
+      </div>
+    )
+  }
+
+  if (!order) {
+    return (
+      <div className="container mx-auto max-w-lg px-4 py-16">
+        <Card>
+          <CardHeader>
+            <CardTitle>This order link no longer works</CardTitle>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            <p className="text-muted-foreground">
+              Enter the email address you checked out with and we'll send you new links to your orders.
+            </p>
+            <Input type="email" placeholder="Email" value={email} onChange={(e) => setEmail(e.target.value)} />
+            <Button onClick={handleResend} disabled={sending || !email} className="w-full">
+              {sending && <Loader2 className="mr-2 h-4 w-4 animate-spin" />}
+              Send new links
+            </Button>
+          </CardContent>
+        </Card>
+      </div>
+    )
+  }
+
+  const { maximumFractionDigits = 2 } = new Intl.NumberFormat("en", { style: "currency", currency: order.currency }).resolvedOptions()
+
+  return (
+    <div className="container mx-auto max-w-2xl px-4 py-16 space-y-6">
+      <Card>
+        <CardHeader>
+          <CardTitle>Your order #{order.id.slice(-8)}</CardTitle>
+        </CardHeader>
+        <CardContent className="space-y-2">
+          <div className="flex justify-between">
+            <span>Tickets</span>
+            <span>{order.ticket_quantity} ticket(s)</span>
+          </div>
+          <div className="flex justify-between font-semibold">
+            <span>Total Paid</span>
+            <span>{(order.total_amount_cents / 10 ** maximumFractionDigits).toFixed(maximumFractionDigits)} {order.currency}</span>
+          </div>
+          {order.total_amount_cents > 0 && (
+            <Button variant="outline" asChild className="w-full">
+              <a href={`http://localhost:8080/api/guest/orders/${token}/invoice`}>
+                <Download className="mr-2 h-4 w-4" />
+                Download Invoice
+              </a>
+            </Button>
+          )}
+        </CardContent>
+      </Card>
+
+      {order.tickets.map((ticket, index) => (
+        <Card key={ticket.id}>
+          <CardContent className="flex items-center justify-between pt-6">
+            <div>
+              <h4 className="font-semibold">Ticket #{index + 1}</h4>
+              <p className="text-sm text-muted-foreground">ID: {ticket.id}</p>
+            </div>
+            <img src={`data:image/png;base64,${ticket.ticket_code}`} alt="QR Code" width={120} height={120} />
+          </CardContent>
+        </Card>
+      ))}
+
+      <p className="text-center text-sm text-muted-foreground">
+        <Link to="/signup" className="underline">Create an account</Link> with the same email address to keep all your tickets in one place.
+      </p>
+    </div>
+  )
+}
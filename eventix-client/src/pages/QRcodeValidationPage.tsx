@@ -5,10 +5,20 @@ import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "../co
 import { Button } from "../components/ui/button"
 import { Badge } from "../components/ui/badge"
 import { Alert, AlertDescription } from "../components/ui/alert"
-import { Loader2, CheckCircle, XCircle, AlertCircle, Scan, Camera, CameraOff, Upload } from "lucide-react"
+import { Loader2, CheckCircle, XCircle, AlertCircle, Scan, Camera, CameraOff, Upload, LogOut } from "lucide-react"
 import { toast } from "sonner"
 import { Input } from "../components/ui/input"
 import { Label } from "../components/ui/label"
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "../components/ui/select"
+import {
+  clearOfflineData,
+  downloadManifest,
+  lookupOffline,
+  pendingScans,
+  recordOfflineScan,
+  storedManifest,
+  syncScans,
+} from "../lib/offlineScanner"
 
 // Define the expected structure of the scan response from your Go backend
 interface ScanResponse {
@@ -16,6 +26,26 @@ interface ScanResponse {
   message: string
   ticketId?: string // Optional, as it might not exist if not found
   isUsed?: boolean // Optional, as it might not exist if not found
+  seat?: string // Seat the holder must take, for seated events
+  usage?: TicketUsage
+  outsideValidity?: boolean // not valid at this time; message says when it is
+}
+
+// How far a ticket is through the entry policy of its type
+interface TicketUsage {
+  entry_policy: string // single, multi, unlimited or in_out
+  entries_used?: number
+  entries_left?: number // absent when entries are not limited
+  inside?: boolean // in/out tickets scanned in and not out since
+}
+
+// An event the logged-in user may scan tickets for; staff only during their window
+interface ScannerEvent {
+  id: string
+  title: string
+  start_time: string
+  starts_at?: string
+  ends_at?: string
 }
 
 const QRCode: React.FC = () => {
@@ -28,12 +58,91 @@ const QRCode: React.FC = () => {
   const [cameraError, setCameraError] = useState<string>("")
   const [isScanning, setIsScanning] = useState<boolean>(false)
   const [manualInput, setManualInput] = useState<string>("")
+  // Entrance this device is at, remembered between sessions for the check-in log
+  const [gate, setGate] = useState<string>(() => localStorage.getItem("scanner-gate") || "")
+  const [events, setEvents] = useState<ScannerEvent[]>([])
+  const [eventId, setEventId] = useState<string>(() => localStorage.getItem("scanner-event") || "")
+  // Offline, tickets are checked against the downloaded list and scans are kept
+  // on the device until they are uploaded
+  const [offline, setOffline] = useState<boolean>(false)
+  const [manifestDate, setManifestDate] = useState<string | null>(null)
+  const [pendingCount, setPendingCount] = useState<number>(0)
+  const [syncing, setSyncing] = useState<boolean>(false)
+  const [deviceId] = useState<string>(() => {
+    const id = localStorage.getItem("scanner-device") || crypto.randomUUID()
+    localStorage.setItem("scanner-device", id)
+    return id
+  })
   
   const videoRef = useRef<HTMLVideoElement>(null)
   const canvasRef = useRef<HTMLCanvasElement>(null)
   const streamRef = useRef<MediaStream | null>(null)
   const scanIntervalRef = useRef<NodeJS.Timeout | null>(null)
 
+  useEffect(() => {
+    fetch("http://localhost:8080/api/scanner/events", { credentials: "include" })
+      .then((res) => (res.ok ? res.json() : []))
+      .then((data: ScannerEvent[]) => {
+        setEvents(data)
+        localStorage.setItem("scanner-events", JSON.stringify(data))
+        if (data.length > 0 && !data.some((e) => e.id === eventId)) {
+          setEventId(data[0].id)
+        }
+      })
+      .catch(() => {
+        // No connection: keep scanning for the events known from last time
+        setEvents(JSON.parse(localStorage.getItem("scanner-events") || "[]"))
+        setOffline(true)
+      })
+  }, [])
+
+  useEffect(() => {
+    if (!eventId) return
+    localStorage.setItem("scanner-event", eventId)
+    setManifestDate(storedManifest(eventId)?.generated_at ?? null)
+    setPendingCount(pendingScans(eventId).length)
+  }, [eventId])
+
+  const handleDownloadManifest = async () => {
+    try {
+      const manifest = await downloadManifest(eventId)
+      setManifestDate(manifest.generated_at)
+      toast.success(`Downloaded ${manifest.tickets.length} tickets for offline scanning`)
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Downloading the ticket list failed.")
+    }
+  }
+
+  const handleClearOfflineData = () => {
+    clearOfflineData(eventId)
+    setManifestDate(null)
+  }
+
+  const handleSync = async () => {
+    setSyncing(true)
+    try {
+      const results = await syncScans(eventId, deviceId)
+      const duplicates = results.filter((r) => r.outcome === "duplicate")
+      // Codes that were never issued, are not genuine or were replaced since the list was downloaded,
+      // and check-outs of tickets that do not allow re-entry
+      const rejected = results.filter((r) =>
+        ["unknown_ticket", "invalid_code", "replaced_code", "check_out_not_allowed"].includes(r.outcome),
+      )
+      setPendingCount(pendingScans(eventId).length)
+      if (rejected.length > 0) {
+        toast.warning(`${rejected.length} of ${results.length} uploaded scans were turned away as invalid`)
+      } else if (duplicates.length > 0) {
+        toast.warning(`${duplicates.length} of ${results.length} uploaded scans were tickets already used elsewhere`)
+      } else {
+        toast.success(`Uploaded ${results.length} scans`)
+      }
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Uploading scans failed.")
+    } finally {
+      setSyncing(false)
+    }
+  }
+
   useEffect(() => {
     checkCameraSupport()
     return () => {
@@ -180,24 +289,70 @@ const QRCode: React.FC = () => {
 
   // Function to send the scanned QR code to the backend for initial check
   const fetchTicketStatus = async (qrCodeValue: string) => {
+    if (!eventId) {
+      toast.error("Choose the event you are scanning for first.")
+      return
+    }
     setLoadingScan(true)
     setValidationMessage("") // Clear previous validation messages
+    if (offline) {
+      const lookup = await lookupOffline(eventId, qrCodeValue)
+      setLoadingScan(false)
+      if (!lookup.found) {
+        setScanResult({ exists: false, message: lookup.message })
+        setValidationMessage(lookup.message)
+        toast.error("Ticket not found")
+        return
+      }
+      const { ticket, usage, outsideValidity } = lookup
+      const usable = ticket.s !== "void" && ticket.s !== "wrong_seat"
+      const exhausted = usage.entries_left === 0
+      setScanResult({
+        exists: usable,
+        message: ticket.s === "void" ? "Ticket has been voided and is not valid for entry."
+          : ticket.s === "wrong_seat" ? "Ticket's seat assignment does not match the seat map. Do not admit."
+          : "Ticket found in the offline list.",
+        ticketId: ticket.t,
+        isUsed: !usable || exhausted,
+        seat: ticket.seat,
+        usage,
+        outsideValidity,
+      })
+      setValidationMessage(
+        !usable ? "Ticket is not valid for entry."
+          : outsideValidity ? "Ticket is not valid at this time. Do not admit."
+          : exhausted ? "Ticket found, but it is already used."
+          : usage.inside ? "Ticket holder is inside. Check the ticket out when they leave."
+          : "Ticket found and is ready for validation (offline).",
+      )
+      return
+    }
     try {
       const res = await fetch("http://localhost:8080/qrCodeScanning", {
         method: "POST",
         headers: { "Content-type": "application/json" },
-        body: JSON.stringify({ img: qrCodeValue }),
+        credentials: "include",
+        body: JSON.stringify({ img: qrCodeValue, eventId }),
       })
 
-      const data: ScanResponse = await res.json()
-      setScanResult(data) // Store the full response
-
+      const data = await res.json()
       if (!res.ok) {
-        setValidationMessage(data.message || "Error during scan.")
-        toast.error(data.message || "Error during scan.")
+        setScanResult(null)
+        setValidationMessage(data.error || data.message || "Error during scan.")
+        toast.error(data.error || data.message || "Error during scan.")
+        return
+      }
+      setScanResult(data as ScanResponse) // Store the full response
+
+      if (data.exists && data.outsideValidity) {
+        setValidationMessage(data.message)
+        toast.warning("Ticket not valid at this time")
       } else if (data.exists && data.isUsed) {
         setValidationMessage("Ticket found, but it is already used.")
         toast.warning("Ticket already used")
+      } else if (data.exists && data.usage?.inside) {
+        setValidationMessage("Ticket holder is inside. Check the ticket out when they leave.")
+        toast.warning("Ticket holder is inside")
       } else if (data.exists && !data.isUsed) {
         setValidationMessage("Ticket found and is ready for validation.")
         toast.success("Valid ticket found")
@@ -215,19 +370,35 @@ const QRCode: React.FC = () => {
     }
   }
 
-  // Function to send a request to the backend to validate (mark as used) the ticket
-  const handleValidateTicket = async () => {
+  // Function to send a request to the backend to admit the ticket, or to check an
+  // in/out ticket out
+  const handleValidateTicket = async (checkOut = false) => {
     if (!scanResult || !scanResult.ticketId) {
       setValidationMessage("No ticket scanned or ID available for validation.")
       toast.error("No ticket available for validation")
       return
     }
-    if (scanResult.isUsed) {
+    if (scanResult.isUsed && !checkOut) {
       setValidationMessage("Ticket is already used.")
       toast.warning("Ticket already used")
       return
     }
 
+    if (offline) {
+      recordOfflineScan(eventId, scannedImageText, scanResult.ticketId, gate, checkOut)
+      setPendingCount(pendingScans(eventId).length)
+      const lookup = await lookupOffline(eventId, scannedImageText)
+      if (lookup.found) {
+        setScanResult((prev) => ({ ...prev!, isUsed: lookup.usage.entries_left === 0, usage: lookup.usage }))
+      }
+      setValidationMessage(
+        checkOut ? "Checked out offline. Upload the scans once the connection is back."
+          : "Admitted offline. Upload the scans once the connection is back.",
+      )
+      toast.success(checkOut ? "Ticket checked out offline" : "Ticket admitted offline")
+      return
+    }
+
     setLoadingValidation(true)
     setValidationMessage("")
 
@@ -235,16 +406,24 @@ const QRCode: React.FC = () => {
       const res = await fetch("http://localhost:8080/validateTicket", {
         method: "POST",
         headers: { "Content-type": "application/json" },
-        body: JSON.stringify({ ticketId: scanResult.ticketId }),
+        credentials: "include",
+        body: JSON.stringify({ code: scannedImageText, eventId, gate, device: deviceId, checkOut }),
       })
 
       const data = await res.json()
 
       if (res.ok) {
         setValidationMessage(data.message || "Ticket validated successfully!")
-        toast.success("Ticket validated successfully!")
+        toast.success(checkOut ? "Ticket checked out" : "Ticket validated successfully!")
         if (scanResult) {
-          setScanResult((prev) => ({ ...prev!, isUsed: true }))
+          // The entries the ticket has left come back with the outcome
+          const usage: TicketUsage = {
+            entry_policy: data.entry_policy,
+            entries_used: data.entries_used,
+            entries_left: data.entries_left,
+            inside: data.inside,
+          }
+          setScanResult((prev) => ({ ...prev!, isUsed: usage.entries_left === 0, usage }))
         }
       } else {
         setValidationMessage(data.error || "Failed to validate ticket.")
@@ -321,6 +500,78 @@ const QRCode: React.FC = () => {
                 </Alert>
               )}
 
+              <div className="space-y-2">
+                <Label>Event</Label>
+                {events.length > 0 ? (
+                  <Select value={eventId} onValueChange={setEventId}>
+                    <SelectTrigger>
+                      <SelectValue placeholder="Choose an event" />
+                    </SelectTrigger>
+                    <SelectContent>
+                      {events.map((e) => (
+                        <SelectItem key={e.id} value={e.id}>
+                          {e.title} · {new Date(e.start_time).toLocaleDateString()}
+                        </SelectItem>
+                      ))}
+                    </SelectContent>
+                  </Select>
+                ) : (
+                  <p className="text-sm text-muted-foreground">
+                    You are not assigned to scan any event. Ask the organizer for an invitation.
+                  </p>
+                )}
+              </div>
+
+              <div className="space-y-2">
+                <Label htmlFor="gate">Gate</Label>
+                <Input
+                  id="gate"
+                  value={gate}
+                  onChange={(e: React.ChangeEvent<HTMLInputElement>) => {
+                    setGate(e.target.value)
+                    localStorage.setItem("scanner-gate", e.target.value)
+                  }}
+                  placeholder="e.g. North entrance"
+                />
+              </div>
+
+              {eventId && (
+                <div className="space-y-2 rounded-lg border p-3">
+                  <div className="flex items-center justify-between">
+                    <Label htmlFor="offline-mode">Offline mode</Label>
+                    <input
+                      id="offline-mode"
+                      type="checkbox"
+                      checked={offline}
+                      onChange={(e) => setOffline(e.target.checked)}
+                      disabled={!manifestDate}
+                    />
+                  </div>
+                  <p className="text-sm text-muted-foreground">
+                    {manifestDate
+                      ? `Ticket list from ${new Date(manifestDate).toLocaleString()}`
+                      : "Download the ticket list to keep scanning without a connection."}
+                    {pendingCount > 0 && ` · ${pendingCount} scans waiting to be uploaded`}
+                  </p>
+                  <div className="flex flex-wrap gap-2">
+                    <Button size="sm" variant="outline" onClick={handleDownloadManifest}>
+                      Download ticket list
+                    </Button>
+                    {pendingCount > 0 && (
+                      <Button size="sm" variant="outline" onClick={handleSync} disabled={syncing}>
+                        {syncing && <Loader2 className="h-4 w-4 mr-2 animate-spin" />}
+                        Upload scans
+                      </Button>
+                    )}
+                    {manifestDate && (
+                      <Button size="sm" variant="ghost" onClick={handleClearOfflineData}>
+                        Clear offline data
+                      </Button>
+                    )}
+                  </div>
+                </div>
+              )}
+
               {/* Camera Section */}
               <div className="space-y-3">
                 <div className="flex gap-2">
@@ -446,12 +697,38 @@ const QRCode: React.FC = () => {
                         <span className="text-sm">{scanResult.isUsed ? "Yes" : "No"}</span>
                       </div>
                     )}
+
+                    {scanResult.usage && scanResult.usage.entry_policy !== "single" && (
+                      <div className="flex items-center justify-between">
+                        <span className="text-sm font-medium">Entries:</span>
+                        <span className="text-sm">
+                          {scanResult.usage.entry_policy === "multi"
+                            ? `${scanResult.usage.entries_left} left`
+                            : scanResult.usage.entry_policy === "in_out"
+                              ? scanResult.usage.inside ? "Inside" : "Outside"
+                              : "Unlimited"}
+                        </span>
+                      </div>
+                    )}
+
+                    {scanResult.seat && (
+                      <div className="flex items-center justify-between">
+                        <span className="text-sm font-medium">Seat:</span>
+                        <span className="text-sm">{scanResult.seat}</span>
+                      </div>
+                    )}
                   </div>
 
                   {/* Validation Button */}
                   <Button
-                    onClick={handleValidateTicket}
-                    disabled={!scanResult?.exists || scanResult?.isUsed || loadingValidation}
+                    onClick={() => handleValidateTicket()}
+                    disabled={
+                      !scanResult?.exists ||
+                      scanResult?.isUsed ||
+                      scanResult?.outsideValidity ||
+                      scanResult?.usage?.inside ||
+                      loadingValidation
+                    }
                     className="w-full"
                     size="lg"
                   >
@@ -467,6 +744,19 @@ const QRCode: React.FC = () => {
                       </>
                     )}
                   </Button>
+
+                  {scanResult.usage?.entry_policy === "in_out" && scanResult.usage.inside && (
+                    <Button
+                      onClick={() => handleValidateTicket(true)}
+                      disabled={loadingValidation}
+                      variant="outline"
+                      className="w-full"
+                      size="lg"
+                    >
+                      <LogOut className="mr-2 h-4 w-4" />
+                      Check Out
+                    </Button>
+                  )}
                 </>
               ) : (
                 <div className="text-center py-8 text-muted-foreground">
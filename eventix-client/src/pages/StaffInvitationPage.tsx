@@ -0,0 +1,87 @@
+import { useEffect, useState } from "react"
+import { useNavigate, useParams } from "react-router"
+import { Loader2, Scan } from "lucide-react"
+import { Button } from "../components/ui/button"
+import { Card, CardContent, CardHeader, CardTitle } from "../components/ui/card"
+import { toast } from "sonner"
+
+interface StaffInvitation {
+  event_title: string
+  email: string
+  starts_at: string
+  ends_at: string
+}
+
+// Landing page of the link emailed to door staff. Accepting gives the logged-in
+// account access to the event's scanner during the invitation's window.
+export default function StaffInvitationPage() {
+  const { token } = useParams<{ token: string }>()
+  const navigate = useNavigate()
+  const [invitation, setInvitation] = useState<StaffInvitation | null>(null)
+  const [loading, setLoading] = useState(true)
+  const [accepting, setAccepting] = useState(false)
+
+  useEffect(() => {
+    fetch(`http://localhost:8080/api/staff-invitations/${token}`)
+      .then((res) => (res.ok ? res.json() : null))
+      .then(setInvitation)
+      .catch(() => setInvitation(null))
+      .finally(() => setLoading(false))
+  }, [token])
+
+  const handleAccept = async () => {
+    setAccepting(true)
+    try {
+      const res = await fetch(`http://localhost:8080/api/staff-invitations/${token}/accept`, {
+        method: "POST",
+        credentials: "include",
+      })
+      const data = await res.json()
+      if (!res.ok) {
+        throw new Error(data.error || `Accepting failed with status: ${res.status}`)
+      }
+      // The login is unchanged; the scanner lists the event through the assignment
+      navigate("/validateCode")
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Could not accept the invitation.")
+      setAccepting(false)
+    }
+  }
+
+  if (loading) {
+    return (
+      <div className="flex justify-center py-16">
+        <Loader2 className="h-8 w-8 animate-spin" />
+      </div>
+    )
+  }
+
+  return (
+    <div className="container mx-auto max-w-lg px-4 py-16">
+      <Card>
+        <CardHeader>
+          <CardTitle>{invitation ? "Door staff invitation" : "This invitation link no longer works"}</CardTitle>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {invitation ? (
+            <>
+              <p className="text-muted-foreground">
+                You're invited to scan tickets at <strong>{invitation.event_title}</strong> from{" "}
+                {new Date(invitation.starts_at).toLocaleString()} to {new Date(invitation.ends_at).toLocaleString()}.
+                Accept it logged in as {invitation.email}.
+              </p>
+              <Button onClick={handleAccept} disabled={accepting} className="w-full" size="lg">
+                {accepting ? <Loader2 className="mr-2 h-4 w-4 animate-spin" /> : <Scan className="mr-2 h-4 w-4" />}
+                {accepting ? "Processing..." : "Accept invitation"}
+              </Button>
+            </>
+          ) : (
+            <p className="text-muted-foreground">
+              It may have been withdrawn by the organizer, or the event is over.
+            </p>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
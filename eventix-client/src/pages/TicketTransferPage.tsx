@@ -0,0 +1,86 @@
+import { useEffect, useState } from "react"
+import { useNavigate, useParams } from "react-router"
+import { Loader2, Ticket } from "lucide-react"
+import { Button } from "../components/ui/button"
+import { Card, CardContent, CardHeader, CardTitle } from "../components/ui/card"
+import { toast } from "sonner"
+
+interface TicketTransfer {
+  event_title: string
+  ticket_type_name: string
+  from_name: string
+  expires_at: string
+}
+
+// Landing page of the link emailed with a ticket transfer. Accepting moves the
+// ticket into the logged-in account with a new QR code.
+export default function TicketTransferPage() {
+  const { token } = useParams<{ token: string }>()
+  const navigate = useNavigate()
+  const [transfer, setTransfer] = useState<TicketTransfer | null>(null)
+  const [loading, setLoading] = useState(true)
+  const [accepting, setAccepting] = useState(false)
+
+  useEffect(() => {
+    fetch(`http://localhost:8080/api/transfers/${token}`)
+      .then((res) => (res.ok ? res.json() : null))
+      .then(setTransfer)
+      .catch(() => setTransfer(null))
+      .finally(() => setLoading(false))
+  }, [token])
+
+  const handleAccept = async () => {
+    setAccepting(true)
+    try {
+      const res = await fetch(`http://localhost:8080/api/transfers/${token}/accept`, {
+        method: "POST",
+        credentials: "include",
+      })
+      const data = await res.json()
+      if (!res.ok) {
+        throw new Error(data.error || `Accepting failed with status: ${res.status}`)
+      }
+      toast.success(data.message)
+      navigate("/profile")
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Could not accept the ticket.")
+      setAccepting(false)
+    }
+  }
+
+  if (loading) {
+    return (
+      <div className="flex justify-center py-16">
+        <Loader2 className="h-8 w-8 animate-spin" />
+      </div>
+    )
+  }
+
+  return (
+    <div className="container mx-auto max-w-lg px-4 py-16">
+      <Card>
+        <CardHeader>
+          <CardTitle>{transfer ? "You've been sent a ticket" : "This transfer link no longer works"}</CardTitle>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {transfer ? (
+            <>
+              <p className="text-muted-foreground">
+                {transfer.from_name} wants to give you a {transfer.ticket_type_name} ticket for{" "}
+                <strong>{transfer.event_title}</strong>. Accept it before {new Date(transfer.expires_at).toLocaleString()}.
+              </p>
+              <Button onClick={handleAccept} disabled={accepting} className="w-full" size="lg">
+                {accepting ? <Loader2 className="mr-2 h-4 w-4 animate-spin" /> : <Ticket className="mr-2 h-4 w-4" />}
+                {accepting ? "Processing..." : "Accept ticket"}
+              </Button>
+            </>
+          ) : (
+            <p className="text-muted-foreground">
+              It may have expired, been cancelled by the sender, or the ticket was already accepted.
+            </p>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
@@ -38,9 +38,16 @@ interface Ticket {
   ticket_code: string
   code: string
   is_used: boolean
+  is_void: boolean
+  refund_percent: number // refunded if cancelled now under the event's policy; 0 when it cannot be
+  transfers_enabled: boolean
+  transfer_to: string | null // recipient of the open transfer, if any
+  resale_max_cents: number // most it may be listed for; 0 when the event does not allow resale
+  listed_price_cents: number | null // price of the open resale listing, if any
   created_at: string
   event_title: string
   ticket_type_name: string
+  seat?: string // assigned seat, for seated events
   event_date?: string
   event_time?: string
   event_slug?: string
@@ -110,9 +117,101 @@ export default function UserProfilePage() {
     fetchTickets()
   }, [])
 
-  const upcomingTickets = tickets.filter((ticket) => !ticket.is_used)
+  const upcomingTickets = tickets.filter((ticket) => !ticket.is_used && !ticket.is_void)
   const pastTickets = tickets.filter((ticket) => ticket.is_used)
 
+  // Offers a ticket to someone else; it moves to their account once they accept the emailed link
+  const handleTransferTicket = async (ticket: Ticket) => {
+    const email = window.prompt("Send this ticket to (email address):")
+    if (!email) return
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/tickets/${ticket.id}/transfer`, {
+        method: "POST",
+        credentials: "include",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ email }),
+      })
+      const data = await res.json()
+      if (!res.ok) throw new Error(data.error || "Could not transfer the ticket")
+      setTickets((prev) => prev.map((t) => (t.id === ticket.id ? { ...t, transfer_to: data.to_email } : t)))
+    } catch (err) {
+      window.alert(err instanceof Error ? err.message : "Could not transfer the ticket")
+    }
+  }
+
+  const handleCancelTransfer = async (ticket: Ticket) => {
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/tickets/${ticket.id}/transfer`, {
+        method: "DELETE",
+        credentials: "include",
+      })
+      const data = await res.json()
+      if (!res.ok) throw new Error(data.error || "Could not cancel the transfer")
+      setTickets((prev) => prev.map((t) => (t.id === ticket.id ? { ...t, transfer_to: null } : t)))
+    } catch (err) {
+      window.alert(err instanceof Error ? err.message : "Could not cancel the transfer")
+    }
+  }
+
+  // Puts a ticket on the resale market at up to its face value plus the event's cap
+  const handleListForResale = async (ticket: Ticket) => {
+    const max = (ticket.resale_max_cents / 100).toFixed(2)
+    const input = window.prompt(`Resale price (at most ${max}):`, max)
+    if (!input) return
+    const priceCents = Math.round(parseFloat(input.replace(",", ".")) * 100)
+    if (!(priceCents > 0)) {
+      window.alert("Enter a valid price")
+      return
+    }
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/tickets/${ticket.id}/resale`, {
+        method: "POST",
+        credentials: "include",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ price_cents: priceCents }),
+      })
+      const data = await res.json()
+      if (!res.ok) throw new Error(data.error || "Could not list the ticket")
+      setTickets((prev) => prev.map((t) => (t.id === ticket.id ? { ...t, listed_price_cents: data.price_cents } : t)))
+    } catch (err) {
+      window.alert(err instanceof Error ? err.message : "Could not list the ticket")
+    }
+  }
+
+  const handleDelistTicket = async (ticket: Ticket) => {
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/tickets/${ticket.id}/resale`, {
+        method: "DELETE",
+        credentials: "include",
+      })
+      const data = await res.json()
+      if (!res.ok) throw new Error(data.error || "Could not take the ticket off resale")
+      setTickets((prev) => prev.map((t) => (t.id === ticket.id ? { ...t, listed_price_cents: null } : t)))
+    } catch (err) {
+      window.alert(err instanceof Error ? err.message : "Could not take the ticket off resale")
+    }
+  }
+
+  // Cancels one ticket of an order; the refund follows the event's refund policy
+  const handleCancelTicket = async (ticket: Ticket) => {
+    if (!window.confirm(`Cancel this ticket? You will get ${ticket.refund_percent}% of its price back; service fees are not refunded.`)) {
+      return
+    }
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/orders/${ticket.order_id}/cancel`, {
+        method: "POST",
+        credentials: "include",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ ticket_ids: [ticket.id] }),
+      })
+      const data = await res.json()
+      if (!res.ok) throw new Error(data.error || "Could not cancel the ticket")
+      setTickets((prev) => prev.map((t) => (t.id === ticket.id ? { ...t, is_void: true, refund_percent: 0 } : t)))
+    } catch (err) {
+      window.alert(err instanceof Error ? err.message : "Could not cancel the ticket")
+    }
+  }
+
   const handlePasswordUpdate = async (e: React.FormEvent) => {
     e.preventDefault()
     setPasswordChangeMessage("")
@@ -312,6 +411,7 @@ export default function UserProfilePage() {
                 <div>
                   <h3 className="text-xl font-bold text-gray-900 dark:text-white mb-1">{ticket.event_title}</h3>
                   <p className="text-sm font-medium text-blue-600 dark:text-blue-400">{ticket.ticket_type_name}</p>
+                  {ticket.seat && <p className="text-sm text-gray-600 dark:text-gray-400">{ticket.seat}</p>}
                 </div>
                 <Badge
                   variant={ticket.is_used ? "secondary" : "default"}
@@ -376,6 +476,31 @@ export default function UserProfilePage() {
                 Download Ticket
               </Button>
             )}
+            {!isPast && ticket.transfers_enabled && !ticket.transfer_to && ticket.listed_price_cents === null && (
+              <Button variant="ghost" size="sm" onClick={() => handleTransferTicket(ticket)} className="w-full mt-2">
+                Transfer to someone
+              </Button>
+            )}
+            {!isPast && ticket.transfer_to && (
+              <Button variant="ghost" size="sm" onClick={() => handleCancelTransfer(ticket)} className="w-full mt-2">
+                Cancel transfer to {ticket.transfer_to}
+              </Button>
+            )}
+            {!isPast && ticket.resale_max_cents > 0 && !ticket.transfer_to && ticket.listed_price_cents === null && (
+              <Button variant="ghost" size="sm" onClick={() => handleListForResale(ticket)} className="w-full mt-2">
+                Sell on resale
+              </Button>
+            )}
+            {!isPast && ticket.listed_price_cents !== null && (
+              <Button variant="ghost" size="sm" onClick={() => handleDelistTicket(ticket)} className="w-full mt-2">
+                Listed at {(ticket.listed_price_cents / 100).toFixed(2)} - take off resale
+              </Button>
+            )}
+            {!isPast && ticket.refund_percent > 0 && ticket.listed_price_cents === null && (
+              <Button variant="ghost" size="sm" onClick={() => handleCancelTicket(ticket)} className="w-full mt-2 text-red-600">
+                Cancel ({ticket.refund_percent}% refund)
+              </Button>
+            )}
           </div>
         </div>
       </CardContent>
@@ -0,0 +1,50 @@
+import { useState } from "react"
+import { useParams } from "react-router"
+import { Loader2, Ticket } from "lucide-react"
+import { Button } from "../components/ui/button"
+import { Card, CardContent, CardHeader, CardTitle } from "../components/ui/card"
+import { toast } from "sonner"
+
+// Landing page of the link emailed with a waitlist offer. The tickets are already
+// held; claiming sends the buyer to payment, or straight to success for free tickets.
+export default function WaitlistOfferPage() {
+  const { token } = useParams<{ token: string }>()
+  const [claiming, setClaiming] = useState(false)
+
+  const handleClaim = async () => {
+    setClaiming(true)
+    try {
+      const res = await fetch(`http://localhost:8080/api/waitlist/offers/${token}/checkout`, {
+        method: "POST",
+        credentials: "include",
+      })
+      const data = await res.json()
+      if (!res.ok) {
+        throw new Error(data.error || `Claim failed with status: ${res.status}`)
+      }
+      window.location.href = data.url ?? `/success?session_id=${data.session_id}`
+    } catch (e) {
+      toast.error(e instanceof Error ? e.message : "Could not claim your tickets.")
+      setClaiming(false)
+    }
+  }
+
+  return (
+    <div className="container mx-auto max-w-lg px-4 py-16">
+      <Card>
+        <CardHeader>
+          <CardTitle>Your waitlist tickets are ready</CardTitle>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          <p className="text-muted-foreground">
+            Tickets are being held for you. Buy them before the offer expires, or they go to the next person on the waitlist.
+          </p>
+          <Button onClick={handleClaim} disabled={claiming} className="w-full" size="lg">
+            {claiming ? <Loader2 className="mr-2 h-4 w-4 animate-spin" /> : <Ticket className="mr-2 h-4 w-4" />}
+            {claiming ? "Processing..." : "Buy my tickets"}
+          </Button>
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
@@ -47,8 +47,44 @@ export type EventDetail = {
     description: string;
     price_cents: number;
     available_quantity: number;
+    min_per_order: number;
+    max_per_order?: number;
+    max_per_customer?: number;
+    regular_price_cents: number;
+    service_fee_cents: number; // charged per ticket on top of price_cents
+    sales_status: "on_sale" | "on_sale_soon" | "sales_ended" | "sold_out";
+    sales_start?: string;
+    sales_end?: string;
+    tier_name?: string;
+    tier_ends_at?: string;
+    tier_remaining?: number;
+    resale?: { listings: number; from_cents: number }; // fan listings, shown once sold out
+    seated?: boolean; // bought by picking seats on the seat map
   }[];
+  seated?: boolean;
   city_id?: number;
+  currency: string; // ISO 4217, prices are in its minor unit
+};
+
+// Seat map of a seated event, as served by /api/events/{slug}/seats
+export type SeatMap = {
+  id: number;
+  name: string;
+  sections: {
+    id: number;
+    name: string;
+    rows: {
+      label: string;
+      seats: {
+        id: number;
+        number: string;
+        accessible: boolean;
+        obstructed: boolean;
+        ticket_type_id?: number;
+        status?: "available" | "held" | "sold" | "unavailable";
+      }[];
+    }[];
+  }[];
 };
 
 export interface EventResponse {
@@ -64,6 +100,7 @@ export interface EventResponse {
   city_name: string
   voivodeship_id: number
   voivodeship_name: string
+  currency: string
   category_ids: number[]
 }
 
@@ -106,6 +143,7 @@ export interface OrderResponse {
   id: string
   user_id: string
   total_amount_cents: number
+  currency: string
   status: string
   event_id: string
   ticket_quantity: number
@@ -218,19 +256,14 @@ export const apiService = {
     return flatCategories
   },
 
-  // Complete payment and create order
-  async completePayment(paymentData: PaymentRecord): Promise<{ status: string }> {
-    const response = await fetch(`${API_BASE_URL}/api/success`, {
-      method: "POST",
-      headers: {
-        "Content-Type": "application/json",
-      },
+  // Poll whether the Stripe webhook has fulfilled the order for a checkout session
+  async getPaymentStatus(sessionId: string): Promise<{ status: string; order_id?: string }> {
+    const response = await fetch(`${API_BASE_URL}/api/success?session_id=${encodeURIComponent(sessionId)}`, {
       credentials: "include",
-      body: JSON.stringify(paymentData),
     })
 
     if (!response.ok) {
-      throw new Error("Failed to complete payment")
+      throw new Error("Failed to fetch payment status")
     }
 
     return response.json()